@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+var (
+	errStandingBy   = errors.New("standing by for another instance")
+	errCycleRunning = errors.New("a cycle is already running")
+)
+
+// serveAdmin runs the admin API on a Unix socket at path, for the ctl
+// command. Connecting to the socket is all the authentication there is, so
+// it is made readable only by the owner.
+func serveAdmin(path string) {
+	ln, listenErr := listenAdmin(path)
+	if listenErr != nil {
+		slog.Error("failed to listen on admin socket", "path", path, "error", listenErr)
+		return
+	}
+
+	slog.Info("serving admin socket", "path", path)
+	srv := &http.Server{Handler: adminHandler(), ReadHeaderTimeout: 10 * time.Second}
+	if err := srv.Serve(ln); err != nil {
+		slog.Error("admin socket stopped", "error", err)
+	}
+}
+
+func listenAdmin(path string) (net.Listener, error) {
+	// A socket left by a process that didn't shut down cleanly would
+	// refuse the listen
+	if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+	ln, listenErr := net.Listen("unix", path)
+	if listenErr != nil {
+		return nil, listenErr
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", handleStatus)
+	mux.HandleFunc("POST /trigger", handleTrigger)
+	mux.HandleFunc("POST /pause", handlePause(true))
+	mux.HandleFunc("POST /resume", handlePause(false))
+	mux.HandleFunc("POST /log-level", handleLogLevel)
+	return mux
+}
+
+// triggerCycle starts a cycle now, even while paused, unless one is
+// already running.
+func triggerCycle() error {
+	if !primary.Load() {
+		return errStandingBy
+	}
+	if halted.Load() {
+		return errHalted
+	}
+	if !scrapeMu.TryLock() {
+		return errCycleRunning
+	}
+	go func() {
+		defer scrapeMu.Unlock()
+		withLive(func(st *settings) { runCycle(st) })
+	}()
+	return nil
+}
+
+func handleTrigger(w http.ResponseWriter, _ *http.Request) {
+	if err := triggerCycle(); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	fmt.Fprintln(w, "cycle started")
+}
+
+// handleLogLevel sets the log level to ?level until the config is next
+// reloaded.
+func handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(r.URL.Query().Get("level"))); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logLevel.Set(level)
+	slog.Info("log level changed", "level", level)
+	fmt.Fprintln(w, "log level", level)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"energy-meter-scraper/config"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminSocket(t *testing.T) {
+	fakeClock(t, time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC))
+	publish(&settings{cfg: &config.Config{}, sinkRefs: &sinkSet{}})
+	prevLevel := logLevel.Level()
+	t.Cleanup(func() {
+		setPaused(false)
+		logLevel.Set(prevLevel)
+	})
+
+	socket := filepath.Join(t.TempDir(), "admin.sock")
+	ln, listenErr := listenAdmin(socket)
+	if listenErr != nil {
+		t.Fatal(listenErr)
+	}
+	srv := &http.Server{Handler: adminHandler()}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("socket mode %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+
+	run := func(args ...string) (string, bool) {
+		t.Helper()
+		method, path, reqErr := ctlRequest(args)
+		if reqErr != nil {
+			t.Fatal(reqErr)
+		}
+		body, ok, ctlErr := ctl(socket, method, path)
+		if ctlErr != nil {
+			t.Fatal(ctlErr)
+		}
+		return string(body), ok
+	}
+	status := func() statusResponse {
+		t.Helper()
+		body, _ := run("status")
+		var resp statusResponse
+		if err := json.Unmarshal([]byte(body), &resp); err != nil {
+			t.Fatalf("status %q: %v", body, err)
+		}
+		return resp
+	}
+
+	if body, ok := run("pause"); !ok || body != "paused\n" {
+		t.Errorf("pause: %q, %v", body, ok)
+	}
+	if body, _ := run("pause"); body != "already paused\n" {
+		t.Errorf("pausing again: %q", body)
+	}
+	if !status().Paused {
+		t.Error("status not paused")
+	}
+	ran := false
+	whenActive(func(*settings) { ran = true })(live())
+	if ran {
+		t.Error("scheduled job ran while paused")
+	}
+	if body, ok := run("resume"); !ok || body != "resumed\n" {
+		t.Errorf("resume: %q, %v", body, ok)
+	}
+
+	if _, ok := run("log-level", "loud"); ok {
+		t.Error("accepted an invalid log level")
+	}
+	if _, ok := run("log-level", "debug"); !ok || logLevel.Level() != slog.LevelDebug {
+		t.Errorf("log level %v, want debug", logLevel.Level())
+	}
+	if got := status().LogLevel; got != "DEBUG" {
+		t.Errorf("status log level %q, want DEBUG", got)
+	}
+
+	// A cycle already running isn't started again
+	scrapeMu.Lock()
+	body, ok := run("trigger")
+	scrapeMu.Unlock()
+	if ok || !strings.Contains(body, errCycleRunning.Error()) {
+		t.Errorf("trigger during a cycle: %q, %v", body, ok)
+	}
+
+	if _, _, err := ctlRequest([]string{"restart"}); err == nil {
+		t.Error("accepted an unknown command")
+	}
+}
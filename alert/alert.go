@@ -0,0 +1,104 @@
+package alert
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+type Kind int
+
+const (
+	// KindAlert is something that needs attention.
+	KindAlert Kind = iota
+	// KindDigest is a routine summary.
+	KindDigest
+)
+
+type Alert struct {
+	Kind Kind
+	// Key identifies what the alert is about, e.g. "crosscheck/gas".
+	Key     string
+	Title   string
+	Message string
+	Time    time.Time
+}
+
+// Notifier delivers alerts somewhere a person will see them.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, a Alert) error
+}
+
+// Factory opens a notifier from config. It returns a nil Notifier if the
+// notifier is not configured.
+type Factory func(cfg *config.Config) (Notifier, error)
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]Factory{}
+	notifiers  []Notifier
+)
+
+// Register makes a notifier available, like sink.Register.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic("notifier registered twice: " + name)
+	}
+	registry[name] = factory
+}
+
+// Setup opens every compiled-in notifier that is configured. Alerts are
+// always logged, whether or not any notifiers are configured.
+func Setup(cfg *config.Config) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var opened []Notifier
+	for _, name := range names {
+		n, err := registry[name](cfg)
+		if err != nil {
+			return fmt.Errorf("open notifier %s: %w", name, err)
+		}
+		if n != nil {
+			opened = append(opened, n)
+		}
+	}
+	notifiers = opened
+	return nil
+}
+
+// Send logs an alert and delivers it to every configured notifier.
+func Send(ctx context.Context, a Alert) {
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+	if a.Kind == KindDigest {
+		slog.Info("digest", "key", a.Key, "title", a.Title, "message", a.Message)
+	} else {
+		slog.Warn("alert", "key", a.Key, "title", a.Title, "message", a.Message)
+	}
+
+	registryMu.Lock()
+	targets := notifiers
+	registryMu.Unlock()
+
+	for _, n := range targets {
+		if err := n.Notify(ctx, a); err != nil {
+			slog.Error("failed to deliver alert", "notifier", n.Name(), "key", a.Key, "error", err)
+		}
+	}
+}
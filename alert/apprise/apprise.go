@@ -0,0 +1,91 @@
+// Package apprise sends alerts through an Apprise API server, which can
+// forward them to any of the services Apprise supports.
+package apprise
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"energy-meter-scraper/alert"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/transport"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func init() {
+	alert.Register("apprise", New)
+}
+
+type Notifier struct {
+	client *http.Client
+	cfg    config.AppriseConfig
+}
+
+func New(cfg *config.Config) (alert.Notifier, error) {
+	appriseCfg := cfg.Notify.Apprise
+	if appriseCfg.URL == "" {
+		return nil, nil
+	}
+
+	httpClient, httpErr := transport.NewClient(appriseCfg.HTTP, cfg.Network)
+	if httpErr != nil {
+		return nil, fmt.Errorf("http config: %w", httpErr)
+	}
+	return &Notifier{client: httpClient, cfg: appriseCfg}, nil
+}
+
+func (n *Notifier) Name() string {
+	return "apprise"
+}
+
+type request struct {
+	// URLs is only sent to the stateless endpoint
+	URLs  string `json:"urls,omitempty"`
+	Tag   string `json:"tag,omitempty"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Type  string `json:"type"`
+}
+
+func (n *Notifier) Notify(ctx context.Context, a alert.Alert) error {
+	msgType := "warning"
+	if a.Kind == alert.KindDigest {
+		msgType = "info"
+	}
+
+	// With a key Apprise looks up the saved configuration; without, the
+	// target services are given in the request
+	endpoint := strings.TrimSuffix(n.cfg.URL, "/") + "/notify/"
+	body := request{Tag: n.cfg.Tag, Title: a.Title, Body: a.Message, Type: msgType}
+	if n.cfg.Key != "" {
+		endpoint += url.PathEscape(n.cfg.Key)
+	} else {
+		body.URLs = strings.Join(n.cfg.URLs, ",")
+	}
+
+	reqBody, marshalErr := json.Marshal(body)
+	if marshalErr != nil {
+		return marshalErr
+	}
+	req, newReqErr := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(reqBody))
+	if newReqErr != nil {
+		return newReqErr
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, postErr := n.client.Do(req)
+	if postErr != nil {
+		return postErr
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("http status code %d: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// Package matrix posts alerts to a Matrix room.
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"energy-meter-scraper/alert"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/transport"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	alert.Register("matrix", New)
+}
+
+type Notifier struct {
+	client     *http.Client
+	homeserver string
+	token      string
+	room       string
+	txn        atomic.Int64
+}
+
+func New(cfg *config.Config) (alert.Notifier, error) {
+	matrixCfg := cfg.Notify.Matrix
+	if matrixCfg.Homeserver == "" {
+		return nil, nil
+	}
+
+	httpClient, httpErr := transport.NewClient(matrixCfg.HTTP, cfg.Network)
+	if httpErr != nil {
+		return nil, fmt.Errorf("http config: %w", httpErr)
+	}
+
+	n := &Notifier{
+		client:     httpClient,
+		homeserver: strings.TrimSuffix(matrixCfg.Homeserver, "/"),
+		token:      matrixCfg.Token,
+		room:       matrixCfg.Room,
+	}
+	// Transaction IDs must be unique per access token, including across
+	// restarts, or the homeserver drops the message as a retry
+	n.txn.Store(time.Now().UnixNano())
+	return n, nil
+}
+
+func (n *Notifier) Name() string {
+	return "matrix"
+}
+
+type message struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format"`
+	FormattedBody string `json:"formatted_body"`
+}
+
+func (n *Notifier) Notify(ctx context.Context, a alert.Alert) error {
+	// Digests are sent as notices, which clients show less prominently and
+	// bots don't respond to
+	msgType := "m.text"
+	if a.Kind == alert.KindDigest {
+		msgType = "m.notice"
+	}
+	body, marshalErr := json.Marshal(message{
+		MsgType:       msgType,
+		Body:          a.Title + "\n" + a.Message,
+		Format:        "org.matrix.custom.html",
+		FormattedBody: "<strong>" + html.EscapeString(a.Title) + "</strong><br>" + strings.ReplaceAll(html.EscapeString(a.Message), "\n", "<br>"),
+	})
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		n.homeserver, url.PathEscape(n.room), strconv.FormatInt(n.txn.Add(1), 10))
+	req, newReqErr := http.NewRequestWithContext(ctx, "PUT", endpoint, bytes.NewReader(body))
+	if newReqErr != nil {
+		return newReqErr
+	}
+	req.Header.Set("Authorization", "Bearer "+n.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, putErr := n.client.Do(req)
+	if putErr != nil {
+		return putErr
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("http status code %d: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
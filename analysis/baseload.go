@@ -0,0 +1,32 @@
+package analysis
+
+import (
+	"math"
+	"slices"
+)
+
+// BaseLoad estimates the always-on consumption per slot from a day of slot
+// values. It uses a low percentile rather than the minimum so that a single
+// anomalous slot (e.g. a missing reading recorded as zero) does not pull it
+// down.
+func BaseLoad(slotValues []float64) float64 {
+	if len(slotValues) == 0 {
+		return 0
+	}
+	return Percentile(slotValues, 0.1)
+}
+
+// Percentile returns the p-th percentile (0 to 1) of values using linear
+// interpolation between closest ranks.
+func Percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	rank := p * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
@@ -0,0 +1,59 @@
+package analysis
+
+import "time"
+
+// Slot is a half hour's usage.
+type Slot struct {
+	Start time.Time
+	KWh   float64
+}
+
+// Session is a run of slots with the heating on, from the start of its
+// first slot to the end of its last.
+type Session struct {
+	Start, End time.Time
+	KWh        float64
+}
+
+// HeatingSessions finds runs of slots, which are in order, using at least
+// minKWh each, and keeps those lasting at least minDuration. Dips below
+// minKWh of up to maxGap are part of the run, as a boiler modulates and
+// cycles, but a missing slot ends it.
+func HeatingSessions(slots []Slot, minKWh float64, maxGap, minDuration time.Duration) []Session {
+	const period = 30 * time.Minute
+
+	var sessions []Session
+	var current *Session
+	var dipKWh float64
+	end := func() {
+		if current != nil && current.End.Sub(current.Start) >= minDuration {
+			sessions = append(sessions, *current)
+		}
+		current, dipKWh = nil, 0
+	}
+
+	var prevEnd time.Time
+	for _, s := range slots {
+		if current != nil && !s.Start.Equal(prevEnd) {
+			end()
+		}
+		prevEnd = s.Start.Add(period)
+
+		switch {
+		case s.KWh >= minKWh && current == nil:
+			current = &Session{Start: s.Start, End: prevEnd, KWh: s.KWh}
+		case s.KWh >= minKWh:
+			current.End = prevEnd
+			current.KWh += dipKWh + s.KWh
+			dipKWh = 0
+		case current != nil:
+			if prevEnd.Sub(current.End) > maxGap {
+				end()
+			} else {
+				dipKWh += s.KWh
+			}
+		}
+	}
+	end()
+	return sessions
+}
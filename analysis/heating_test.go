@@ -0,0 +1,42 @@
+package analysis
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHeatingSessions(t *testing.T) {
+	start := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	slotsOf := func(kwh ...float64) []Slot {
+		var out []Slot
+		for i, k := range kwh {
+			out = append(out, Slot{Start: start.Add(time.Duration(i) * 30 * time.Minute), KWh: k})
+		}
+		return out
+	}
+	at := func(slots int) time.Time { return start.Add(time.Duration(slots) * 30 * time.Minute) }
+
+	// A half hour's dip is bridged, an hour's isn't, and a lone slot is too
+	// short to count
+	slots := slotsOf(0.1, 2, 2, 0.5, 2, 0.1, 0.1, 3, 3, 0.1, 0.1, 0.1, 2)
+	sessions := HeatingSessions(slots, 1, 30*time.Minute, time.Hour)
+	want := []Session{
+		{Start: at(1), End: at(5), KWh: 6.5},
+		{Start: at(7), End: at(9), KWh: 6},
+	}
+	if len(sessions) != len(want) {
+		t.Fatalf("got %+v, want %+v", sessions, want)
+	}
+	for i := range want {
+		if !sessions[i].Start.Equal(want[i].Start) || !sessions[i].End.Equal(want[i].End) || sessions[i].KWh != want[i].KWh {
+			t.Errorf("session %d is %+v, want %+v", i, sessions[i], want[i])
+		}
+	}
+
+	// A missing slot ends a run rather than being bridged
+	gapped := slices.Concat(slots[1:3], slotsOf(0, 0, 0, 0, 2, 2)[4:])
+	if sessions := HeatingSessions(gapped, 1, time.Hour, time.Hour); len(sessions) != 2 {
+		t.Errorf("got %+v, want two sessions either side of the missing slots", sessions)
+	}
+}
@@ -0,0 +1,180 @@
+package analysis
+
+import (
+	"math"
+	"time"
+)
+
+// MinTrendSlots is the fewest half hours of readings a month needs to be
+// compared with others, so that a month the meter was offline for most of
+// doesn't show as a swing in usage.
+const MinTrendSlots = 7 * 48
+
+// Month is a month's usage.
+type Month struct {
+	Start time.Time
+	KWh   float64
+	Pence float64
+	// Slots is how many half hours have readings, fewer than the month has
+	// if some are missing or it isn't over.
+	Slots int
+}
+
+// PerDay is the average usage per day over the slots with readings.
+func (m Month) PerDay() float64 {
+	if m.Slots == 0 {
+		return math.NaN()
+	}
+	return m.KWh / (float64(m.Slots) / 48)
+}
+
+// Trend compares a month with earlier ones. Changes are fractions of the
+// earlier month's usage per day, so that months of different lengths and
+// coverage compare fairly, and are NaN without one to compare with.
+type Trend struct {
+	Month
+	MoM float64
+	YoY float64
+	// Adjusted is usage per day with the calendar month's seasonal factor
+	// divided out, and AdjustedMoM its change from the previous month. Both
+	// are NaN without the factors.
+	Adjusted    float64
+	AdjustedMoM float64
+}
+
+// Summary is the overall picture of a run of months.
+type Summary struct {
+	// Seasonal are the factors by calendar month, 1 being a month of
+	// average usage. It is nil unless every calendar month has readings.
+	Seasonal map[time.Month]float64
+	// TrendPerYear is the fitted change in usage per day over a year, as a
+	// fraction of the average, after seasonal adjustment if there is one.
+	// It is NaN with fewer than two comparable months.
+	TrendPerYear float64
+	// Last12 and Prior12 are the usage per day of the latest 12 months and
+	// the 12 before them, and YoY the change between them. They are NaN
+	// unless the months cover two years.
+	Last12, Prior12, YoY float64
+}
+
+// Trends compares each of months, which are in order and in one location,
+// with the previous month and the same month a year earlier.
+func Trends(months []Month) ([]Trend, Summary) {
+	byStart := map[time.Time]Month{}
+	for _, m := range months {
+		byStart[m.Start] = m
+	}
+	seasonal := seasonalFactors(months)
+	summary := Summary{Seasonal: seasonal, TrendPerYear: math.NaN(), Last12: math.NaN(), Prior12: math.NaN(), YoY: math.NaN()}
+
+	adjusted := func(m Month) float64 {
+		if seasonal == nil || m.Slots < MinTrendSlots || seasonal[m.Start.Month()] == 0 {
+			return math.NaN()
+		}
+		return m.PerDay() / seasonal[m.Start.Month()]
+	}
+	change := func(m Month, earlier time.Time, value func(Month) float64) float64 {
+		prev, ok := byStart[earlier]
+		if !ok || m.Slots < MinTrendSlots || prev.Slots < MinTrendSlots || value(prev) == 0 {
+			return math.NaN()
+		}
+		return value(m)/value(prev) - 1
+	}
+
+	trends := make([]Trend, 0, len(months))
+	var xs, ys []float64
+	for _, m := range months {
+		t := Trend{
+			Month:    m,
+			MoM:      change(m, m.Start.AddDate(0, -1, 0), Month.PerDay),
+			YoY:      change(m, m.Start.AddDate(-1, 0, 0), Month.PerDay),
+			Adjusted: adjusted(m),
+		}
+		if seasonal != nil {
+			t.AdjustedMoM = change(m, m.Start.AddDate(0, -1, 0), adjusted)
+		} else {
+			t.AdjustedMoM = math.NaN()
+		}
+		trends = append(trends, t)
+
+		y := t.Adjusted
+		if seasonal == nil {
+			y = m.PerDay()
+		}
+		if m.Slots >= MinTrendSlots {
+			xs, ys = append(xs, float64(monthsBetween(months[0].Start, m.Start))), append(ys, y)
+		}
+	}
+
+	if len(xs) >= 2 {
+		slope, mean := linearFit(xs, ys)
+		summary.TrendPerYear = slope * 12 / mean
+	}
+	if n := len(months); n > 0 && monthsBetween(months[0].Start, months[n-1].Start) >= 23 {
+		var kwh, slots [2]float64
+		for _, m := range months {
+			if ago := monthsBetween(m.Start, months[n-1].Start); ago < 24 {
+				kwh[ago/12] += m.KWh
+				slots[ago/12] += float64(m.Slots)
+			}
+		}
+		if slots[0] > 0 && slots[1] > 0 {
+			summary.Last12, summary.Prior12 = kwh[0]/(slots[0]/48), kwh[1]/(slots[1]/48)
+			summary.YoY = summary.Last12/summary.Prior12 - 1
+		}
+	}
+	return trends, summary
+}
+
+func monthsBetween(from, to time.Time) int {
+	return (to.Year()-from.Year())*12 + int(to.Month()-from.Month())
+}
+
+// seasonalFactors divides the mean usage per day of each calendar month by
+// the mean over all twelve, or returns nil if any has no comparable month.
+func seasonalFactors(months []Month) map[time.Month]float64 {
+	sums := map[time.Month]float64{}
+	counts := map[time.Month]int{}
+	for _, m := range months {
+		if m.Slots < MinTrendSlots {
+			continue
+		}
+		sums[m.Start.Month()] += m.PerDay()
+		counts[m.Start.Month()]++
+	}
+	if len(counts) < 12 {
+		return nil
+	}
+
+	means := map[time.Month]float64{}
+	var overall float64
+	for month, sum := range sums {
+		means[month] = sum / float64(counts[month])
+		overall += means[month] / 12
+	}
+	if overall == 0 {
+		return nil
+	}
+	for month := range means {
+		means[month] /= overall
+	}
+	return means
+}
+
+// linearFit returns the least squares slope of ys against xs, and the mean
+// of ys.
+func linearFit(xs, ys []float64) (slope, mean float64) {
+	n := float64(len(xs))
+	var sumX, sumY float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+	var cov, varX float64
+	for i := range xs {
+		cov += (xs[i] - meanX) * (ys[i] - meanY)
+		varX += (xs[i] - meanX) * (xs[i] - meanX)
+	}
+	return cov / varX, meanY
+}
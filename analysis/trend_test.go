@@ -0,0 +1,75 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// months returns full months from the start of 2022 using perDay kWh a day.
+func months(n int, perDay func(i int, m time.Month) float64) []Month {
+	var out []Month
+	for i := 0; i < n; i++ {
+		start := time.Date(2022, time.Month(1+i), 1, 0, 0, 0, 0, time.UTC)
+		days := start.AddDate(0, 1, 0).Sub(start).Hours() / 24
+		out = append(out, Month{Start: start, KWh: perDay(i, start.Month()) * days, Slots: int(days) * 48})
+	}
+	return out
+}
+
+func near(got, want float64) bool {
+	return math.Abs(got-want) < 1e-9
+}
+
+func TestTrendsChanges(t *testing.T) {
+	// Usage per day is the same whatever the month's length
+	trends, summary := Trends(months(3, func(int, time.Month) float64 { return 10 }))
+	if !math.IsNaN(trends[0].MoM) || !near(trends[1].MoM, 0) || !near(trends[2].MoM, 0) {
+		t.Errorf("MoM %v, %v, %v, want NaN, 0, 0", trends[0].MoM, trends[1].MoM, trends[2].MoM)
+	}
+	if !math.IsNaN(trends[2].YoY) || summary.Seasonal != nil || !math.IsNaN(trends[2].Adjusted) {
+		t.Errorf("YoY or adjustment without a year: %+v, %v", trends[2], summary.Seasonal)
+	}
+	if !near(summary.TrendPerYear, 0) || !math.IsNaN(summary.YoY) {
+		t.Errorf("summary %+v", summary)
+	}
+
+	// A month with little data isn't compared
+	partial := months(2, func(int, time.Month) float64 { return 10 })
+	partial[1].Slots, partial[1].KWh = 48, 20
+	if trends, _ := Trends(partial); !math.IsNaN(trends[1].MoM) {
+		t.Errorf("compared a day with a month: %v", trends[1].MoM)
+	}
+}
+
+func TestTrendsSeasonal(t *testing.T) {
+	// Winter doubles usage, and the second year uses 10% less throughout
+	winter := func(m time.Month) float64 {
+		if m <= time.March || m >= time.October {
+			return 2
+		}
+		return 1
+	}
+	trends, summary := Trends(months(24, func(i int, m time.Month) float64 {
+		year := 1.0
+		if i >= 12 {
+			year = 0.9
+		}
+		return 10 * winter(m) * year
+	}))
+
+	if summary.Seasonal == nil || !near(summary.Seasonal[time.January]/summary.Seasonal[time.July], 2) {
+		t.Fatalf("seasonal factors %v", summary.Seasonal)
+	}
+	// October's jump is the season, not a change in usage
+	october := trends[9]
+	if !near(october.MoM, 1) || !near(october.AdjustedMoM, 0) {
+		t.Errorf("October MoM %v, adjusted %v, want 1 and 0", october.MoM, october.AdjustedMoM)
+	}
+	if !near(trends[13].YoY, -0.1) {
+		t.Errorf("YoY %v, want -0.1", trends[13].YoY)
+	}
+	if !near(summary.YoY, -0.1) || summary.TrendPerYear >= 0 {
+		t.Errorf("summary %+v", summary)
+	}
+}
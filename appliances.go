@@ -0,0 +1,60 @@
+package main
+
+import (
+	"energy-meter-scraper/plugs"
+	"energy-meter-scraper/schema"
+	"energy-meter-scraper/sink"
+	"maps"
+	"slices"
+	"time"
+)
+
+// appliances follows the smart plugs, if any are configured. Unlike most
+// settings, the plugs only change on restart.
+var appliances *plugs.Tracker
+
+// appliancePoints returns, for each of usage's slots the plugs reported
+// throughout, an appliance_usage point for each plug and an
+// energy_usage_residual point with the usage they don't explain. The
+// residual is negative if the plugs read high.
+func appliancePoints(st *settings, meta resourceMeta, usage []sink.Point) []sink.Point {
+	if appliances == nil || meta.Name != st.cfg.Plugs.Resource {
+		return nil
+	}
+
+	var points []sink.Point
+	for _, p := range usage {
+		kwh, ok := p.Fields["kwh"].(float64)
+		if !ok {
+			continue
+		}
+		shares, covered := appliances.Slot(st.stamps.Start(p.Time, 30*time.Minute))
+		if !covered {
+			continue
+		}
+
+		residual := kwh
+		for _, name := range slices.Sorted(maps.Keys(shares)) {
+			residual -= shares[name]
+			tags := maps.Clone(p.Tags)
+			tags["appliance"] = name
+			points = append(points, schema.Stamp(sink.Point{
+				Measurement: "appliance_usage",
+				Tags:        tags,
+				Fields:      map[string]any{"kwh": shares[name]},
+				Time:        p.Time,
+			}))
+		}
+		fields := map[string]any{"kwh": residual}
+		if pence, ok := p.Fields["pence"].(float64); ok && kwh != 0 {
+			fields["pence"] = pence * residual / kwh
+		}
+		points = append(points, schema.Stamp(sink.Point{
+			Measurement: "energy_usage_residual",
+			Tags:        maps.Clone(p.Tags),
+			Fields:      fields,
+			Time:        p.Time,
+		}))
+	}
+	return points
+}
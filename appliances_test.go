@@ -0,0 +1,46 @@
+package main
+
+import (
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/plugs"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/slot"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAppliancePoints(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	fake := fakeClock(t, start)
+	cfg := &config.Config{Plugs: config.PlugsConfig{Resource: "electricity", Plugs: []config.Plug{{Name: "washer", Format: "tasmota"}}}}
+	st := &settings{cfg: cfg, stamps: slot.Policy{Precision: time.Second, Align: slot.AlignEnd}}
+
+	prev := appliances
+	defer func() { appliances = prev }()
+	appliances = plugs.New(cfg.Plugs, fake)
+	for i := 0; i <= 3; i++ {
+		appliances.Record("washer", 0.1*float64(i), start.Add(time.Duration(i)*10*time.Minute))
+	}
+
+	usage := func(at time.Time) sink.Point {
+		return sink.Point{Measurement: "energy_usage", Tags: map[string]string{"resource": "electricity", "period": "30m"},
+			Fields: map[string]any{"kwh": 0.5, "pence": 10.0}, Time: st.stamps.Stamp(at, 30*time.Minute)}
+	}
+	points := appliancePoints(st, config.Resource{Name: "electricity"}, []sink.Point{usage(start), usage(start.Add(30 * time.Minute))})
+	if len(points) != 2 {
+		t.Fatalf("got %d points, want the covered slot's appliance and residual: %v", len(points), points)
+	}
+	washer, residual := points[0], points[1]
+	if washer.Measurement != "appliance_usage" || washer.Tags["appliance"] != "washer" || math.Abs(washer.Fields["kwh"].(float64)-0.3) > 1e-9 {
+		t.Errorf("appliance point %v", washer)
+	}
+	if residual.Measurement != "energy_usage_residual" || math.Abs(residual.Fields["kwh"].(float64)-0.2) > 1e-9 ||
+		math.Abs(residual.Fields["pence"].(float64)-4) > 1e-9 || !residual.Time.Equal(usage(start).Time) {
+		t.Errorf("residual point %v", residual)
+	}
+
+	if points := appliancePoints(st, config.Resource{Name: "gas"}, []sink.Point{usage(start)}); points != nil {
+		t.Errorf("points for a resource without plugs: %v", points)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/archive"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// archiveMonths writes each resource's settled months missing from the
+// archive, oldest first. Months are read from Glow rather than a sink, so
+// the archive doesn't depend on the sink's retention.
+func archiveMonths(st *settings) {
+	if st.archiveStore == nil {
+		return
+	}
+	cfg := st.cfg.Archive
+	ctx := context.Background()
+
+	// The latest month that ended at least Settle ago
+	latest := startOfMonth(clk.Now().Add(-cfg.Settle), st.location()).AddDate(0, -1, 0)
+	for i := cfg.Months - 1; i >= 0; i-- {
+		month := latest.AddDate(0, -i, 0)
+		for _, meta := range st.resources {
+			if err := archiveMonth(ctx, st, meta, month); err != nil {
+				slog.Error("failed to archive month", "resource", meta.Name, "month", month.Format("2006-01"), "error", err)
+			}
+		}
+	}
+}
+
+// archiveMonth writes meta's slots in the month starting at month, unless
+// they are already archived or there are none.
+func archiveMonth(ctx context.Context, st *settings, meta resourceMeta, month time.Time) error {
+	first, firstErr := resourceFirstTime(meta.KWHResource)
+	if firstErr != nil {
+		return firstErr
+	}
+	monthEnd := month.AddDate(0, 1, 0)
+	if !first.Before(monthEnd) {
+		return nil
+	}
+
+	key := archive.Key(st.cfg.Archive.Key, meta.Name, month)
+	exists, existsErr := st.archiveStore.Exists(ctx, key)
+	if existsErr != nil {
+		return existsErr
+	}
+	if exists {
+		return nil
+	}
+
+	usage, usageErr := readUsage(st, meta, month, monthEnd.Add(-time.Second))
+	if usageErr != nil {
+		return usageErr
+	}
+	rows := archive.Rows(meta.Name, usage, st.stamps)
+	if len(rows) == 0 {
+		return nil
+	}
+	putErr := st.archiveStore.Put(ctx, key, rows)
+	if errors.Is(putErr, archive.ErrExists) {
+		return nil
+	}
+	if putErr != nil {
+		return putErr
+	}
+	slog.Info("archived month", "resource", meta.Name, "month", month.Format("2006-01"), "slots", len(rows), "key", key)
+	return nil
+}
@@ -0,0 +1,91 @@
+// Package archive keeps each resource's slots for a month as one immutable
+// object, a record that outlives any sink's retention.
+package archive
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/slot"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Row is a slot as archived.
+type Row struct {
+	Resource string    `parquet:"resource,dict"`
+	Start    time.Time `parquet:"start,timestamp(millisecond)"`
+	KWh      *float64  `parquet:"kwh,optional"`
+	Pence    *float64  `parquet:"pence,optional"`
+	// Band and TariffPence are from the configured tariff, if there is one.
+	Band        string   `parquet:"band,optional,dict"`
+	TariffPence *float64 `parquet:"tariff_pence,optional"`
+}
+
+// ErrExists is returned by Store.Put when the key has already been written.
+var ErrExists = errors.New("archive object already exists")
+
+// Store is where months are archived.
+type Store interface {
+	// Exists reports whether key has been written.
+	Exists(ctx context.Context, key string) (bool, error)
+	// Put writes rows to key, unless it exists.
+	Put(ctx context.Context, key string, rows []Row) error
+	// Close releases the store's connections.
+	Close() error
+}
+
+var opener func(cfg *config.Config) (Store, error)
+
+func RegisterStore(open func(cfg *config.Config) (Store, error)) {
+	opener = open
+}
+
+// Open returns the configured store, or nil if there is none.
+func Open(cfg *config.Config) (Store, error) {
+	if cfg.Archive.Bucket == "" {
+		return nil, nil
+	}
+	if opener == nil {
+		return nil, fmt.Errorf("archiving is not supported in this build")
+	}
+	return opener(cfg)
+}
+
+// Key is where resource's month is archived, from template.
+func Key(template, resource string, month time.Time) string {
+	return strings.NewReplacer(
+		"{resource}", resource,
+		"{year}", month.Format("2006"),
+		"{month}", month.Format("01"),
+	).Replace(template)
+}
+
+// Rows converts resource's usage points, which are in order, to rows
+// stamped with the start of their slot in UTC. A slot read twice, as where
+// reads of a long range meet, is archived once.
+func Rows(resource string, usage []sink.Point, stamps slot.Policy) []Row {
+	rows := make([]Row, 0, len(usage))
+	for _, p := range usage {
+		row := Row{Resource: resource, Start: stamps.Start(p.Time, 30*time.Minute).UTC()}
+		if n := len(rows); n > 0 && !row.Start.After(rows[n-1].Start) {
+			continue
+		}
+		row.KWh = float(p.Fields["kwh"])
+		row.Pence = float(p.Fields["pence"])
+		row.TariffPence = float(p.Fields["tariffPence"])
+		row.Band, _ = p.Fields["band"].(string)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func float(v any) *float64 {
+	f, ok := v.(float64)
+	if !ok {
+		return nil
+	}
+	return &f
+}
@@ -0,0 +1,100 @@
+// Package s3 archives months as Parquet objects in an S3 compatible bucket.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"energy-meter-scraper/archive"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/transport"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/parquet-go/parquet-go"
+	"net/http"
+)
+
+func init() {
+	archive.RegisterStore(Open)
+}
+
+type Store struct {
+	client *s3.Client
+	http   *http.Client
+	bucket string
+}
+
+func Open(cfg *config.Config) (archive.Store, error) {
+	archiveCfg := cfg.Archive
+	httpClient, httpErr := transport.NewClient(config.HTTPConfig{}, cfg.Network)
+	if httpErr != nil {
+		return nil, fmt.Errorf("http config: %w", httpErr)
+	}
+
+	var opts []func(*awsConfig.LoadOptions) error
+	if archiveCfg.Region != "" {
+		opts = append(opts, awsConfig.WithRegion(archiveCfg.Region))
+	}
+	if archiveCfg.AccessKeyID != "" {
+		opts = append(opts, awsConfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(archiveCfg.AccessKeyID, archiveCfg.SecretAccessKey, "")))
+	}
+	awsCfg, awsErr := awsConfig.LoadDefaultConfig(context.Background(), opts...)
+	if awsErr != nil {
+		return nil, fmt.Errorf("archive: %w", awsErr)
+	}
+
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		o.HTTPClient = httpClient
+		if archiveCfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(archiveCfg.Endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	return &Store{client: client, http: httpClient, bucket: archiveCfg.Bucket}, nil
+}
+
+func (s *Store) Close() error {
+	s.http.CloseIdleConnections()
+	return nil
+}
+
+func (s *Store) Exists(ctx context.Context, key string) (bool, error) {
+	_, headErr := s.client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	var notFound *types.NotFound
+	if errors.As(headErr, &notFound) {
+		return false, nil
+	}
+	if headErr != nil {
+		return false, headErr
+	}
+	return true, nil
+}
+
+// Put writes rows as Parquet, compressed with zstd. The object is only
+// created if it doesn't exist, where the storage supports conditional
+// writes, so that two instances can't both write a month.
+func (s *Store) Put(ctx context.Context, key string, rows []archive.Row) error {
+	var body bytes.Buffer
+	if err := parquet.Write(&body, rows, parquet.Compression(&parquet.Zstd)); err != nil {
+		return fmt.Errorf("parquet: %w", err)
+	}
+
+	_, putErr := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body.Bytes()),
+		ContentType: aws.String("application/vnd.apache.parquet"),
+		IfNoneMatch: aws.String("*"),
+	})
+	var respErr *awshttp.ResponseError
+	if errors.As(putErr, &respErr) && respErr.HTTPStatusCode() == http.StatusPreconditionFailed {
+		return archive.ErrExists
+	}
+	return putErr
+}
@@ -0,0 +1,80 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"energy-meter-scraper/archive"
+	"energy-meter-scraper/config"
+	"errors"
+	"github.com/parquet-go/parquet-go"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPut(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, exists := objects[r.URL.Path]
+		switch r.Method {
+		case "HEAD":
+			if !exists {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case "PUT":
+			if exists && r.Header.Get("If-None-Match") == "*" {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				_, _ = io.WriteString(w, "<Error><Code>PreconditionFailed</Code></Error>")
+				return
+			}
+			objects[r.URL.Path], _ = io.ReadAll(r.Body)
+		default:
+			_, _ = w.Write(body)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{}
+	cfg.Archive = config.ArchiveConfig{Bucket: "energy", Endpoint: server.URL, Region: "us-east-1", AccessKeyID: "key", SecretAccessKey: "secret"}
+	store, openErr := Open(cfg)
+	if openErr != nil {
+		t.Fatal(openErr)
+	}
+	ctx := context.Background()
+	key := "electricity/2024/04.parquet"
+
+	if exists, err := store.Exists(ctx, key); err != nil || exists {
+		t.Fatalf("exists %v before writing: %v", exists, err)
+	}
+	kwh := 0.25
+	rows := []archive.Row{
+		{Resource: "electricity", Start: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), KWh: &kwh, Band: "offpeak"},
+		{Resource: "electricity", Start: time.Date(2024, 4, 1, 0, 30, 0, 0, time.UTC)},
+	}
+	if err := store.Put(ctx, key, rows); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := store.Exists(ctx, key); err != nil || !exists {
+		t.Fatalf("exists %v after writing: %v", exists, err)
+	}
+
+	// Objects are path-style, and are Parquet
+	object := objects["/energy/"+key]
+	read, readErr := parquet.Read[archive.Row](bytes.NewReader(object), int64(len(object)))
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	if len(read) != 2 || *read[0].KWh != 0.25 || read[0].Band != "offpeak" || read[1].KWh != nil || !read[1].Start.Equal(rows[1].Start) {
+		t.Errorf("read back %+v", read)
+	}
+
+	if err := store.Put(ctx, key, rows); !errors.Is(err, archive.ErrExists) {
+		t.Errorf("rewriting got %v, want ErrExists", err)
+	}
+}
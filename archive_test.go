@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/archive"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/glowapi/glowtest"
+	"energy-meter-scraper/slot"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryArchive struct {
+	mu      sync.Mutex
+	objects map[string][]archive.Row
+}
+
+func (a *memoryArchive) Exists(_ context.Context, key string) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.objects[key]
+	return ok, nil
+}
+
+func (a *memoryArchive) Put(_ context.Context, key string, rows []archive.Row) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.objects[key]; ok {
+		return archive.ErrExists
+	}
+	a.objects[key] = rows
+	return nil
+}
+
+func (a *memoryArchive) Close() error { return nil }
+
+func TestArchiveMonths(t *testing.T) {
+	now := time.Date(2024, 6, 5, 12, 0, 0, 0, time.UTC)
+	fakeClock(t, now)
+
+	fakeGlow := glowtest.New(clk, time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC))
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	cfg := &config.Config{Resources: []config.Resource{{Name: "archive-test", KWHResource: "kwh", PenceResource: "pence"}}}
+	cfg.Archive = config.ArchiveConfig{Key: "{resource}/{year}/{month}.parquet", Settle: 7 * 24 * time.Hour, Months: 4}
+	store := &memoryArchive{objects: map[string][]archive.Row{}}
+	st := &settings{
+		cfg:          cfg,
+		resources:    cfg.Resources,
+		stamps:       slot.Policy{Precision: time.Second, Align: slot.AlignEnd},
+		loc:          time.UTC,
+		archiveStore: store,
+	}
+
+	// May is less than a week over, and February has no readings
+	archiveMonths(st)
+	var keys []string
+	for key := range store.objects {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	if want := []string{"archive-test/2024/03.parquet", "archive-test/2024/04.parquet"}; !slices.Equal(keys, want) {
+		t.Fatalf("archived %v, want %v", keys, want)
+	}
+	april := store.objects["archive-test/2024/04.parquet"]
+	if len(april) != 30*48 || !april[0].Start.Equal(time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)) || *april[0].KWh != 0.25 {
+		t.Errorf("April has %d rows, the first %+v", len(april), april[0])
+	}
+
+	// Once archived, months aren't read again
+	requests := fakeGlow.Requests()
+	archiveMonths(st)
+	if fakeGlow.Requests() != requests {
+		t.Errorf("made %d requests for months already archived", fakeGlow.Requests()-requests)
+	}
+}
@@ -0,0 +1,100 @@
+// Package awssecrets resolves settings given as AWS Secrets Manager ARNs or
+// SSM Parameter Store names, using the standard AWS credential chain (so IAM
+// task and instance roles work).
+//
+//	GLOW_PASSWORD=arn:aws:secretsmanager:eu-west-2:123456789012:secret:glow
+//	GLOW_PASSWORD=arn:aws:secretsmanager:eu-west-2:123456789012:secret:glow#password
+//	INFLUX_TOKEN=ssm:/energy-meter-scraper/influx-token
+//
+// A Secrets Manager reference may end in #key to select a key from a JSON
+// secret.
+package awssecrets
+
+import (
+	"context"
+	"encoding/json"
+	"energy-meter-scraper/config"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"strings"
+	"sync"
+)
+
+func init() {
+	config.RegisterSecretResolver("arn:aws:secretsmanager:", resolveSecretsManager)
+	config.RegisterSecretResolver("arn:aws:ssm:", resolveSSM)
+	config.RegisterSecretResolver("ssm:", resolveSSM)
+}
+
+var loadAWS = sync.OnceValues(func() (aws.Config, error) {
+	return awsConfig.LoadDefaultConfig(context.Background())
+})
+
+func resolveSecretsManager(ctx context.Context, ref string) (string, error) {
+	arn, jsonKey, _ := strings.Cut(ref, "#")
+
+	awsCfg, cfgErr := loadAWS()
+	if cfgErr != nil {
+		return "", cfgErr
+	}
+	// The region in the ARN takes precedence over the default region
+	if parts := strings.Split(arn, ":"); len(parts) > 3 && parts[3] != "" {
+		awsCfg.Region = parts[3]
+	}
+
+	out, getErr := secretsmanager.NewFromConfig(awsCfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(arn),
+	})
+	if getErr != nil {
+		return "", getErr
+	}
+	if out.SecretString == nil {
+		return "", fmt.Errorf("secret %s has no string value", arn)
+	}
+
+	if jsonKey == "" {
+		return *out.SecretString, nil
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(*out.SecretString), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object: %w", arn, err)
+	}
+	val, ok := fields[jsonKey]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", arn, jsonKey)
+	}
+	if s, ok := val.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(val), nil
+}
+
+func resolveSSM(ctx context.Context, ref string) (string, error) {
+	name := strings.TrimPrefix(ref, "ssm:")
+
+	awsCfg, cfgErr := loadAWS()
+	if cfgErr != nil {
+		return "", cfgErr
+	}
+	if strings.HasPrefix(ref, "arn:") {
+		if parts := strings.Split(ref, ":"); len(parts) > 3 && parts[3] != "" {
+			awsCfg.Region = parts[3]
+		}
+	}
+
+	out, getErr := ssm.NewFromConfig(awsCfg).GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if getErr != nil {
+		return "", getErr
+	}
+	if out.Parameter == nil || out.Parameter.Value == nil {
+		return "", fmt.Errorf("parameter %s has no value", name)
+	}
+	return *out.Parameter.Value, nil
+}
@@ -0,0 +1,140 @@
+package baseline
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// History returns the stored total for the day starting at day, and false if
+// there is no data for it.
+type History func(day time.Time) (float64, bool, error)
+
+// Baseline is the value a day's total is compared against.
+type Baseline interface {
+	Name() string
+	// Expected returns the expected total for day, or false if there is not
+	// enough history to say.
+	Expected(day time.Time, history History) (float64, bool, error)
+}
+
+// Parse accepts "weekday-median[:weeks]", "seasonal[:years]" or
+// "fixed:<value>".
+func Parse(spec string) (Baseline, error) {
+	kind, arg, hasArg := strings.Cut(spec, ":")
+	switch kind {
+	case "weekday-median":
+		weeks := 8
+		if hasArg {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid number of weeks %q", arg)
+			}
+			weeks = n
+		}
+		return WeekdayMedian{Weeks: weeks}, nil
+	case "seasonal":
+		years := 3
+		if hasArg {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid number of years %q", arg)
+			}
+			years = n
+		}
+		return Seasonal{Years: years, WindowDays: 14}, nil
+	case "fixed":
+		v, err := strconv.ParseFloat(arg, 64)
+		if !hasArg || err != nil {
+			return nil, fmt.Errorf("fixed baseline needs a value, e.g. fixed:10")
+		}
+		return Fixed{Value: v}, nil
+	default:
+		return nil, fmt.Errorf("unknown baseline %q (expected weekday-median, seasonal or fixed)", kind)
+	}
+}
+
+// WeekdayMedian expects the median of the same weekday over previous weeks,
+// which suits homes whose usage follows a weekly routine.
+type WeekdayMedian struct {
+	Weeks int
+}
+
+func (b WeekdayMedian) Name() string {
+	return "weekday-median"
+}
+
+func (b WeekdayMedian) Expected(day time.Time, history History) (float64, bool, error) {
+	var values []float64
+	for i := 1; i <= b.Weeks; i++ {
+		v, ok, err := history(day.AddDate(0, 0, -7*i))
+		if err != nil {
+			return 0, false, err
+		}
+		if ok {
+			values = append(values, v)
+		}
+	}
+	// Fewer than half the weeks is too little to trust
+	if len(values)*2 < b.Weeks {
+		return 0, false, nil
+	}
+	return median(values), true, nil
+}
+
+// Seasonal expects the median of the days around the same date in previous
+// years, which suits heating-dominated homes whose usage follows the weather
+// more than the week.
+type Seasonal struct {
+	Years      int
+	WindowDays int
+}
+
+func (b Seasonal) Name() string {
+	return "seasonal"
+}
+
+func (b Seasonal) Expected(day time.Time, history History) (float64, bool, error) {
+	var values []float64
+	for y := 1; y <= b.Years; y++ {
+		center := day.AddDate(-y, 0, 0)
+		for d := -b.WindowDays / 2; d <= b.WindowDays/2; d++ {
+			v, ok, err := history(center.AddDate(0, 0, d))
+			if err != nil {
+				return 0, false, err
+			}
+			if ok {
+				values = append(values, v)
+			}
+		}
+	}
+	if len(values) < b.WindowDays/2 {
+		return 0, false, nil
+	}
+	return median(values), true, nil
+}
+
+// Fixed expects a constant, for users who would rather set a threshold.
+type Fixed struct {
+	Value float64
+}
+
+func (b Fixed) Name() string {
+	return "fixed"
+}
+
+func (b Fixed) Expected(time.Time, History) (float64, bool, error) {
+	return b.Value, true, nil
+}
+
+func median(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"energy-meter-scraper/sink"
+	"flag"
+	"fmt"
+	"golang.org/x/term"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+var allowBackfill = flag.Bool("allow-backfill", false, "on a cold start, read however much history the first cycle needs without asking")
+
+// bootstrap is what a cold start found and what the first cycle will read.
+type bootstrap struct {
+	// discovered are the account's resources, as "name (classifier) id".
+	discovered []string
+	resources  []bootstrapResource
+	// requestTime is how long Glow took to answer, on average.
+	requestTime time.Duration
+}
+
+type bootstrapResource struct {
+	name        string
+	first, last time.Time
+	// from and to are the range the first cycle will read.
+	from, to time.Time
+}
+
+// requests is how many readings requests reading r's range takes.
+func (r bootstrapResource) requests() int {
+	chunks := int((r.to.Sub(r.from) + maxReadingsSpan - 1) / maxReadingsSpan)
+	return 2 * max(chunks, 1)
+}
+
+// largest is the longest range a resource's first cycle will read.
+func (b *bootstrap) largest() time.Duration {
+	var largest time.Duration
+	for _, r := range b.resources {
+		largest = max(largest, r.to.Sub(r.from))
+	}
+	return largest
+}
+
+// estimate is how long the first cycle's reads should take.
+func (b *bootstrap) estimate() time.Duration {
+	n := 0
+	for _, r := range b.resources {
+		n += r.requests()
+	}
+	return time.Duration(n) * b.requestTime
+}
+
+func (b *bootstrap) write(w io.Writer) {
+	fmt.Fprintln(w, "No usage is stored yet. Resources on the Glow account:")
+	for _, d := range b.discovered {
+		fmt.Fprintf(w, "  %s\n", d)
+	}
+	fmt.Fprintln(w, "Configured resources:")
+	for _, r := range b.resources {
+		fmt.Fprintf(w, "  %s: data from %s to %s, first cycle reads %s (%d requests)\n",
+			r.name, r.first.Format(time.DateTime), r.last.Format(time.DateTime),
+			formatDays(r.to.Sub(r.from)), r.requests())
+	}
+	fmt.Fprintf(w, "Estimated backfill time: %s\n", b.estimate().Round(time.Second))
+}
+
+func formatDays(d time.Duration) string {
+	if d < 48*time.Hour {
+		return d.Round(time.Minute).String()
+	}
+	return fmt.Sprintf("%.0f days", d.Hours()/24)
+}
+
+// checkColdStart reports what the first cycle will read if no sink stores
+// any usage yet, and asks before a backfill longer than BackfillLimit.
+func checkColdStart(st *settings) {
+	if *dryRun || !coldStart(context.Background(), st) {
+		return
+	}
+
+	b, bErr := newBootstrap(st)
+	if bErr != nil {
+		slog.Warn("failed to build the cold start report", "error", bErr)
+		return
+	}
+	b.write(os.Stderr)
+
+	limit := st.cfg.Scrape.BackfillLimit
+	if limit <= 0 || b.largest() <= limit || *allowBackfill {
+		return
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) && confirm(fmt.Sprintf("Backfill %s? [y/N] ", formatDays(b.largest()))) {
+		return
+	}
+	log.Fatalf("the first cycle would backfill %s, more than BACKFILL_LIMIT (%s); rerun with -allow-backfill, lower LOOKBACK, or load the history first with the backfill command",
+		formatDays(b.largest()), formatDays(limit))
+}
+
+func confirm(prompt string) bool {
+	fmt.Fprint(os.Stderr, prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return slices.Contains([]string{"y", "yes"}, strings.ToLower(strings.TrimSpace(answer)))
+}
+
+// coldStart reports whether nothing has been written yet: no checkpoints,
+// and no usage in any sink that can say. It is false if no sink can say.
+func coldStart(ctx context.Context, st *settings) bool {
+	for _, meta := range st.resources {
+		if _, ok := st.checkpoints.Last(meta.Name); ok {
+			return false
+		}
+	}
+
+	checked := false
+	for _, s := range st.sinks {
+		lastTimer, ok := s.(sink.LastTimer)
+		if !ok {
+			continue
+		}
+		for _, meta := range st.resources {
+			_, found, err := lastTimer.LastTime(ctx, "energy_usage",
+				map[string]string{"resource": meta.Name, "period": "30m"}, time.Unix(0, 0), clk.Now().Add(time.Hour))
+			if err != nil || found {
+				return false
+			}
+		}
+		checked = true
+	}
+	return checked
+}
+
+func newBootstrap(st *settings) (*bootstrap, error) {
+	b := &bootstrap{}
+	started := clk.Now()
+	requests := 0
+
+	listed, listErr := glow.ListResources()
+	if listErr != nil {
+		return nil, listErr
+	}
+	requests++
+	for _, r := range listed {
+		b.discovered = append(b.discovered, fmt.Sprintf("%s (%s) %s", r.Name, r.Classifier, r.ResourceId))
+	}
+
+	for _, meta := range st.resources {
+		first, firstErr := glow.GetResourceFirstTime(meta.KWHResource)
+		if firstErr != nil {
+			return nil, fmt.Errorf("%s: %w", meta.Name, firstErr)
+		}
+		from, to, windowErr := scrapeWindow(st, meta)
+		if windowErr != nil {
+			return nil, fmt.Errorf("%s: %w", meta.Name, windowErr)
+		}
+		requests += 3
+		b.resources = append(b.resources, bootstrapResource{name: meta.Name, first: first, last: to, from: from, to: to})
+	}
+
+	b.requestTime = clk.Since(started) / time.Duration(requests)
+	return b, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/glowapi/glowtest"
+	"energy-meter-scraper/sink"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBootstrap(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fakeClock(t, now)
+
+	fakeGlow := glowtest.New(clk, now.AddDate(-1, 0, 0))
+	fakeGlow.Resources = []string{"kwh", "pence"}
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	cfg := &config.Config{Resources: []config.Resource{{Name: "electricity", KWHResource: "kwh", PenceResource: "pence"}}}
+	cfg.Scrape.Lookback = 60 * 24 * time.Hour
+	mem := newMemorySink()
+	st := &settings{cfg: cfg, resources: cfg.Resources, sinks: []sink.Sink{mem}}
+
+	if !coldStart(context.Background(), st) {
+		t.Fatal("empty sink is not a cold start")
+	}
+
+	b, bErr := newBootstrap(st)
+	if bErr != nil {
+		t.Fatal(bErr)
+	}
+	if got := b.largest(); got < 59*24*time.Hour || got > 60*24*time.Hour {
+		t.Errorf("first cycle reads %v, want the 60 day lookback", got)
+	}
+	// 9 weeks of readings, in week-long requests for kwh and pence
+	if n := b.resources[0].requests(); n != 18 {
+		t.Errorf("%d requests, want 18", n)
+	}
+
+	var out bytes.Buffer
+	b.write(&out)
+	for _, want := range []string{"kwh (electricity.consumption) kwh", "electricity: data from 2023-06-01", "60 days"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report lacks %q:\n%s", want, out.String())
+		}
+	}
+
+	if err := mem.Write(context.Background(), []sink.Point{{
+		Measurement: "energy_usage",
+		Tags:        map[string]string{"resource": "electricity", "period": "30m"},
+		Fields:      map[string]any{"kwh": 0.1},
+		Time:        now.Add(-time.Hour),
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if coldStart(context.Background(), st) {
+		t.Error("sink with usage is a cold start")
+	}
+}
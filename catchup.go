@@ -0,0 +1,158 @@
+package main
+
+import (
+	"energy-meter-scraper/metrics"
+	"energy-meter-scraper/schedule"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	catchupsTotal = metrics.NewCounter("scraper_catchups_total",
+		"Cycles in which catchup was requested for a resource.", "resource")
+	catchupFailuresTotal = metrics.NewCounter("scraper_catchup_failures_total",
+		"Cycles in which every catchup request for a resource failed.", "resource")
+	catchupLastSuccess = metrics.NewGauge("scraper_catchup_last_success_timestamp_seconds",
+		"When catchup last succeeded for a resource.", "resource").Persist()
+	readingsWait = metrics.NewGauge("scraper_readings_wait_seconds",
+		"How long the last cycle waited for the half hour just ended to be readable.")
+)
+
+// catchupBackoff is the wait before the first catchup retry, doubling for
+// each one after.
+const catchupBackoff = 10 * time.Second
+
+// readingsPoll is how often a cycle checks whether the half hour just ended
+// has arrived.
+const readingsPoll = 30 * time.Second
+
+// catchups remembers, per resource, whether the latest catchup failed and
+// when one last succeeded.
+var catchups = struct {
+	mu      sync.Mutex
+	failing map[string]bool
+	lastOK  map[string]time.Time
+}{failing: map[string]bool{}, lastOK: map[string]time.Time{}}
+
+// catchupAtBoundary requests catchup for the resources being scraped. It
+// runs on the change of the half hour, as the Glow docs ask, separately from
+// the scrape cycle reading what the DCC has sent.
+func catchupAtBoundary(st *settings) {
+	var resources []resourceMeta
+	for _, meta := range st.resources {
+		if !isDormantResource(meta.Name) {
+			resources = append(resources, meta)
+		}
+	}
+	requestCatchups(st, resources)
+}
+
+// requestCatchups asks Glow to fetch the latest readings from the DCC for
+// each resource, retrying with backoff as the request routinely fails. Each
+// resource waits its own random delay of up to CatchupJitter first, so that
+// clients don't all call at once.
+func requestCatchups(st *settings, resources []resourceMeta) {
+	slog.Info("requesting catchup")
+	var wg sync.WaitGroup
+	for _, meta := range resources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if spread := st.cfg.Scrape.CatchupJitter; spread > 0 {
+				clk.Sleep(rand.N(spread))
+			}
+			catchupResource(st, meta)
+		}()
+	}
+	wg.Wait()
+}
+
+func catchupResource(st *settings, meta resourceMeta) {
+	ok := true
+	for _, resourceID := range []string{meta.KWHResource, meta.PenceResource} {
+		st.catchupDelay.Sleep(clk)
+		if !requestCatchup(st, resourceID) {
+			ok = false
+		}
+	}
+
+	catchups.mu.Lock()
+	catchups.failing[meta.Name] = !ok
+	if ok {
+		catchups.lastOK[meta.Name] = clk.Now()
+	}
+	catchups.mu.Unlock()
+
+	catchupsTotal.Inc(meta.Name)
+	if ok {
+		catchupLastSuccess.Set(float64(clk.Now().Unix()), meta.Name)
+	} else {
+		catchupFailuresTotal.Inc(meta.Name)
+		slog.Warn("catchup failed; reading further back in case DCC data arrives late", "resource", meta.Name)
+	}
+}
+
+func requestCatchup(st *settings, resourceID string) bool {
+	backoff := catchupBackoff
+	for attempt := 0; ; attempt++ {
+		err := glow.RequestResourceCatchup(resourceID)
+		if err == nil {
+			slog.Info("requested resource catchup", "resourceID", resourceID, "attempt", attempt+1)
+			return true
+		}
+		if attempt >= st.cfg.Scrape.CatchupRetries {
+			slog.Info("resource catchup failed", "resourceID", resourceID, "attempts", attempt+1, "error", err)
+			return false
+		}
+		schedule.Jitter{Base: backoff, Fraction: st.cfg.Scrape.Jitter}.Sleep(clk)
+		backoff *= 2
+	}
+}
+
+// awaitReadings waits until Glow has the half hour just ended for every
+// resource, or ReadingsTimeout has passed, whichever is first. The DCC often
+// takes a few minutes, and sometimes much longer.
+func awaitReadings(st *settings, resources []resourceMeta) {
+	if st.cfg.Scrape.ReadingsTimeout <= 0 {
+		return
+	}
+	started := clk.Now()
+	want := started.Truncate(30 * time.Minute).Add(-30 * time.Minute)
+	deadline := started.Add(st.cfg.Scrape.ReadingsTimeout)
+	defer func() { readingsWait.Set(clk.Since(started).Seconds()) }()
+
+	waiting := slices.Clone(resources)
+	for {
+		waiting = slices.DeleteFunc(waiting, func(meta resourceMeta) bool {
+			last, lastErr := glow.GetResourceLastTime(meta.KWHResource)
+			if lastErr != nil {
+				slog.Warn("failed to check for new readings", "resource", meta.Name, "error", lastErr)
+				return false
+			}
+			return !last.Before(want)
+		})
+		if len(waiting) == 0 {
+			return
+		}
+
+		if !clk.Now().Add(readingsPoll).Before(deadline) {
+			for _, meta := range waiting {
+				slog.Warn("half hour not readable yet; reading what there is", "resource", meta.Name, "slot", want,
+					"waited", clk.Since(started).Round(time.Second))
+			}
+			return
+		}
+		clk.Sleep(readingsPoll)
+	}
+}
+
+// catchupFailing reports whether the latest catchup for resource failed,
+// and if so when one last succeeded, zero if never.
+func catchupFailing(resource string) (bool, time.Time) {
+	catchups.mu.Lock()
+	defer catchups.mu.Unlock()
+	return catchups.failing[resource], catchups.lastOK[resource]
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"energy-meter-scraper/checkpoint"
+	"energy-meter-scraper/clock"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/glowapi/glowtest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCatchupRetries(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	prevClk := clk
+	clk = clock.Accelerated(now, 1e6)
+	defer func() { clk = prevClk }()
+
+	fakeGlow := glowtest.New(clk, now.AddDate(0, 0, -30))
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	meta := config.Resource{Name: "catchup-test", KWHResource: "kwh", PenceResource: "pence"}
+	cfg := &config.Config{Resources: []config.Resource{meta}}
+	cfg.Scrape.CatchupRetries = 2
+	cfg.Scrape.Lookback = 8 * 24 * time.Hour
+	checkpoints, checkpointsErr := checkpoint.Open(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if checkpointsErr != nil {
+		t.Fatal(checkpointsErr)
+	}
+	st := &settings{cfg: cfg, resources: cfg.Resources, checkpoints: checkpoints}
+
+	// Failures within the retries are recovered from
+	fakeGlow.CatchupFailures = 2
+	requestCatchups(st, st.resources)
+	if failing, lastOK := catchupFailing(meta.Name); failing || lastOK.IsZero() {
+		t.Fatalf("catchup failing after retries: %v, last succeeded %v", failing, lastOK)
+	}
+
+	// Once they run out, the read reaches back to the last success rather
+	// than starting from the checkpoint
+	_, lastOK := catchupFailing(meta.Name)
+	if err := checkpoints.Set(meta.Name, fakeGlow.Last()); err != nil {
+		t.Fatal(err)
+	}
+	fakeGlow.CatchupFailures = 100
+	failuresBefore := catchupFailuresTotal.Value(meta.Name)
+	requestCatchups(st, st.resources)
+	if failing, _ := catchupFailing(meta.Name); !failing {
+		t.Fatal("catchup not failing after retries ran out")
+	}
+	if n := catchupFailuresTotal.Value(meta.Name) - failuresBefore; n != 1 {
+		t.Errorf("counted %v failures, want 1", n)
+	}
+
+	from, _, windowErr := scrapeWindow(st, meta)
+	if windowErr != nil {
+		t.Fatal(windowErr)
+	}
+	if want := lastOK.Truncate(30 * time.Minute).Add(-30 * time.Minute); !from.Equal(want) {
+		t.Errorf("read from %v, want %v", from, want)
+	}
+}
+
+func TestCatchupAtBoundarySpreadsResources(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fake := fakeClock(t, now)
+
+	fakeGlow := glowtest.New(clk, now.AddDate(0, 0, -30))
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	cfg := &config.Config{Resources: []config.Resource{
+		{Name: "spread-a", KWHResource: "a-kwh", PenceResource: "a-pence"},
+		{Name: "spread-b", KWHResource: "b-kwh", PenceResource: "b-pence"},
+		{Name: "spread-c", KWHResource: "c-kwh", PenceResource: "c-pence"},
+	}}
+	cfg.Scrape.CatchupJitter = 2 * time.Minute
+	st := &settings{cfg: cfg, resources: cfg.Resources}
+
+	// Each resource waits on its own delay rather than one after another
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		catchupAtBoundary(st)
+	}()
+	fake.BlockUntil(len(cfg.Resources))
+	fake.Advance(cfg.Scrape.CatchupJitter)
+	<-done
+
+	for _, meta := range cfg.Resources {
+		failing, lastOK := catchupFailing(meta.Name)
+		if failing || lastOK.Before(now) || lastOK.After(now.Add(cfg.Scrape.CatchupJitter)) {
+			t.Errorf("%s: catchup failing %v, last succeeded %v", meta.Name, failing, lastOK)
+		}
+	}
+}
+
+func TestAwaitReadings(t *testing.T) {
+	now := time.Date(2024, 6, 1, 10, 0, 30, 0, time.UTC)
+	fake := fakeClock(t, now)
+
+	fakeGlow := glowtest.New(clk, now.AddDate(0, 0, -30))
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	cfg := &config.Config{Resources: []config.Resource{{Name: "await", KWHResource: "kwh", PenceResource: "pence"}}}
+	cfg.Scrape.ReadingsTimeout = 10 * time.Minute
+	st := &settings{cfg: cfg, resources: cfg.Resources}
+
+	// await runs awaitReadings, advancing the clock a poll each time it
+	// sleeps, and returns how long it waited. Once done it sleeps once more,
+	// so that there is always a sleeper to wait for.
+	await := func() time.Duration {
+		started := fake.Now()
+		done, exited := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(exited)
+			awaitReadings(st, st.resources)
+			close(done)
+			fake.Sleep(readingsPoll)
+		}()
+		for {
+			fake.BlockUntil(1)
+			select {
+			case <-done:
+				waited := fake.Since(started)
+				fake.Advance(readingsPoll)
+				<-exited
+				return waited
+			default:
+				fake.Advance(readingsPoll)
+			}
+		}
+	}
+
+	// The slot that ended at 10:00 arrives at 10:05, and is read at the
+	// first poll after
+	fakeGlow.Delay = 5 * time.Minute
+	if waited := await(); waited != 4*time.Minute+30*time.Second {
+		t.Errorf("waited %v for a slot arriving after 4m30s", waited)
+	}
+
+	// One that never arrives is given up on at the last poll before the
+	// deadline
+	fakeGlow.Delay = time.Hour
+	if waited := await(); waited != cfg.Scrape.ReadingsTimeout-readingsPoll {
+		t.Errorf("waited %v for a slot that didn't arrive, want %v", waited, cfg.Scrape.ReadingsTimeout-readingsPoll)
+	}
+}
@@ -0,0 +1,180 @@
+// Package changefeed is an append-only local log of what was written to
+// which sink and when, so that whether a slot ever reached a sink can be
+// answered without querying every backend.
+package changefeed
+
+import (
+	"bufio"
+	"encoding/json"
+	"energy-meter-scraper/sink"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Entry is one write of a measurement's points for one resource to a sink.
+type Entry struct {
+	At          time.Time `json:"at"`
+	Sink        string    `json:"sink"`
+	Measurement string    `json:"measurement"`
+	Resource    string    `json:"resource,omitempty"`
+	// Times are the points' timestamps, as Unix seconds.
+	Times []int64 `json:"times"`
+}
+
+// Log is a file of Entries, one JSON object per line. A nil Log records
+// nothing.
+type Log struct {
+	path   string
+	mu     sync.Mutex
+	closed bool
+}
+
+// ErrClosed is returned by Record once the log is closed.
+var ErrClosed = errors.New("changefeed closed")
+
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("changefeed: %w", err)
+	}
+	defer f.Close()
+
+	// A line cut short by a crash is ended, so the next entry isn't lost
+	// with it
+	if info, statErr := f.Stat(); statErr == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			if _, err := f.WriteAt([]byte{'\n'}, info.Size()); err != nil {
+				return nil, fmt.Errorf("changefeed: %w", err)
+			}
+		}
+	}
+	return &Log{path: path}, nil
+}
+
+// Record appends an entry for each measurement and resource in points,
+// written to sinkName at at.
+func (l *Log) Record(at time.Time, sinkName string, points []sink.Point) error {
+	if l == nil || len(points) == 0 {
+		return nil
+	}
+
+	type key struct{ measurement, resource string }
+	var order []key
+	byKey := map[key]*Entry{}
+	for _, p := range points {
+		k := key{p.Measurement, p.Tags["resource"]}
+		e, ok := byKey[k]
+		if !ok {
+			e = &Entry{At: at.UTC(), Sink: sinkName, Measurement: k.measurement, Resource: k.resource}
+			byKey[k] = e
+			order = append(order, k)
+		}
+		e.Times = append(e.Times, p.Time.Unix())
+	}
+
+	var lines []byte
+	for _, k := range order {
+		line, marshalErr := json.Marshal(byKey[k])
+		if marshalErr != nil {
+			return marshalErr
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	f, openErr := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if openErr != nil {
+		return fmt.Errorf("changefeed: %w", openErr)
+	}
+	// One write, so a crash leaves at most a partial last line, which
+	// Query skips and Open ends
+	if _, err := f.Write(lines); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("changefeed: %w", err)
+	}
+	return f.Close()
+}
+
+// Close waits for a Record in progress and stops the log appending, as when
+// a reload moves it to another file. It can still be queried.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	return nil
+}
+
+// Query selects entries. Zero fields match everything.
+type Query struct {
+	Sink        string
+	Measurement string
+	Resource    string
+	// Slot matches entries that include a point at this time.
+	Slot time.Time
+	// Since matches entries written at or after it.
+	Since time.Time
+	// Limit is the most entries returned, the latest. Zero is no limit.
+	Limit int
+}
+
+func (q Query) matches(e Entry) bool {
+	switch {
+	case q.Sink != "" && e.Sink != q.Sink,
+		q.Measurement != "" && e.Measurement != q.Measurement,
+		q.Resource != "" && e.Resource != q.Resource,
+		!q.Since.IsZero() && e.At.Before(q.Since):
+		return false
+	}
+	return q.Slot.IsZero() || slices.Contains(e.Times, q.Slot.Unix())
+}
+
+// Query returns the entries matching q, oldest first.
+func (l *Log) Query(q Query) ([]Entry, error) {
+	if l == nil {
+		return nil, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, openErr := os.Open(l.path)
+	if errors.Is(openErr, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if openErr != nil {
+		return nil, fmt.Errorf("changefeed: %w", openErr)
+	}
+	defer f.Close()
+
+	var matched []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if q.matches(e) {
+			matched = append(matched, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("changefeed: %w", err)
+	}
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[len(matched)-q.Limit:]
+	}
+	return matched, nil
+}
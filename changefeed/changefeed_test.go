@@ -0,0 +1,81 @@
+package changefeed
+
+import (
+	"energy-meter-scraper/sink"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changefeed.ndjson")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slot := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	usage := func(resource string, at time.Time) sink.Point {
+		return sink.Point{Measurement: "energy_usage", Tags: map[string]string{"resource": resource}, Time: at}
+	}
+	first := slot.Add(time.Hour)
+	if err := l.Record(first, "influx", []sink.Point{
+		usage("electricity", slot), usage("electricity", slot.Add(30*time.Minute)), usage("gas", slot),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Record(first.Add(time.Hour), "mqtt", []sink.Point{usage("electricity", slot.Add(30*time.Minute))}); err != nil {
+		t.Fatal(err)
+	}
+
+	all, queryErr := l.Query(Query{})
+	if queryErr != nil {
+		t.Fatal(queryErr)
+	}
+	if len(all) != 3 {
+		t.Fatalf("got %d entries, want one per sink and resource written", len(all))
+	}
+
+	tests := []struct {
+		q    Query
+		want int
+	}{
+		{Query{Sink: "influx", Resource: "electricity", Slot: slot}, 1},
+		{Query{Sink: "mqtt", Resource: "electricity", Slot: slot}, 0},
+		{Query{Resource: "electricity", Slot: slot.Add(30 * time.Minute)}, 2},
+		{Query{Since: first.Add(time.Minute)}, 1},
+		{Query{Limit: 1}, 1},
+	}
+	for _, tt := range tests {
+		got, err := l.Query(tt.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != tt.want {
+			t.Errorf("%+v matched %d entries, want %d", tt.q, len(got), tt.want)
+		}
+	}
+
+	// A line cut short by a crash is skipped
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	_, _ = f.WriteString(`{"at":"2024-`)
+	_ = f.Close()
+	if got, err := l.Query(Query{}); err != nil || len(got) != 3 {
+		t.Errorf("after a partial line got %d entries, %v", len(got), err)
+	}
+	if l, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Record(first, "influx", []sink.Point{usage("gas", slot)}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := l.Query(Query{}); err != nil || len(got) != 4 {
+		t.Errorf("entry after the partial line was lost: got %d entries, %v", len(got), err)
+	}
+
+	var nilLog *Log
+	if err := nilLog.Record(first, "influx", []sink.Point{usage("gas", slot)}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,131 @@
+// Package checkpoint remembers the last reading written for each resource,
+// so that a cycle (or a restart) only fetches what is new.
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Store is a JSON file mapping resource names to the time of the last
+// reading written for them. A nil Store remembers nothing.
+type Store struct {
+	path   string
+	mu     sync.Mutex
+	last   map[string]time.Time
+	closed bool
+}
+
+// ErrClosed is returned by Set once the store is closed.
+var ErrClosed = errors.New("checkpoint store closed")
+
+// Open reads the checkpoints at path. A missing file is an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, last: map[string]time.Time{}}
+
+	contents, readErr := os.ReadFile(path)
+	if errors.Is(readErr, fs.ErrNotExist) {
+		return s, nil
+	}
+	if readErr != nil {
+		return nil, fmt.Errorf("checkpoint: %w", readErr)
+	}
+	if err := json.Unmarshal(contents, &s.last); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Last returns the time of the last reading written for resource.
+func (s *Store) Last(resource string) (time.Time, bool) {
+	if s == nil {
+		return time.Time{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.last[resource]
+	return t, ok
+}
+
+// Set records t as the last reading written for resource and saves the
+// store. Checkpoints only move forward.
+func (s *Store) Set(resource string, t time.Time) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if prev, ok := s.last[resource]; ok && !t.After(prev) {
+		return nil
+	}
+	s.last[resource] = t.UTC()
+	return s.save()
+}
+
+// Reload merges in checkpoints another process has saved to the file, such
+// as the primary a standby follows. Checkpoints only move forward.
+func (s *Store) Reload() error {
+	if s == nil {
+		return nil
+	}
+	saved, openErr := Open(s.path)
+	if openErr != nil {
+		return openErr
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for resource, t := range saved.last {
+		if prev, ok := s.last[resource]; !ok || t.After(prev) {
+			s.last[resource] = t
+		}
+	}
+	return nil
+}
+
+// Close waits for a Set in progress and stops the store saving, as when a
+// reload moves the checkpoints to another file.
+func (s *Store) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+// save replaces the file atomically, so a crash leaves either the old or
+// the new checkpoints.
+func (s *Store) save() error {
+	contents, marshalErr := json.MarshalIndent(s.last, "", "  ")
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	tmp, tmpErr := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if tmpErr != nil {
+		return fmt.Errorf("checkpoint: %w", tmpErr)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(contents); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	return nil
+}
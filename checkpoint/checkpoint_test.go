@@ -0,0 +1,78 @@
+package checkpoint
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+
+	s, openErr := Open(path)
+	if openErr != nil {
+		t.Fatal(openErr)
+	}
+	if _, ok := s.Last("electricity"); ok {
+		t.Fatal("new store has a checkpoint")
+	}
+
+	first := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+	if err := s.Set("electricity", first); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("electricity", first.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, reopenErr := Open(path)
+	if reopenErr != nil {
+		t.Fatal(reopenErr)
+	}
+	got, ok := reopened.Last("electricity")
+	if !ok || !got.Equal(first) {
+		t.Errorf("Last = %v, %v; want %v, true", got, ok, first)
+	}
+
+	// A store replaced on reload stops saving
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("electricity", first.Add(time.Hour)); !errors.Is(err, ErrClosed) {
+		t.Errorf("Set after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestNilStore(t *testing.T) {
+	var s *Store
+	if err := s.Set("gas", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Last("gas"); ok {
+		t.Error("nil store has a checkpoint")
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+	primary, primaryErr := Open(path)
+	if primaryErr != nil {
+		t.Fatal(primaryErr)
+	}
+	standby, standbyErr := Open(path)
+	if standbyErr != nil {
+		t.Fatal(standbyErr)
+	}
+
+	at := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+	if err := primary.Set("electricity", at); err != nil {
+		t.Fatal(err)
+	}
+	if err := standby.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := standby.Last("electricity"); !ok || !got.Equal(at) {
+		t.Errorf("standby has %v %v, want %s", got, ok, at)
+	}
+}
@@ -0,0 +1,92 @@
+// Package clock is the source of time for everything that waits or reads
+// the current time, so that tests can control it and simulations can run
+// faster than real time.
+package clock
+
+import (
+	"github.com/jonboulle/clockwork"
+	"time"
+)
+
+// Clock is satisfied by the clocks in github.com/jonboulle/clockwork,
+// including its fake clock for tests.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+type Timer = clockwork.Timer
+
+// Real is the system clock.
+func Real() Clock {
+	return clockwork.NewRealClock()
+}
+
+// Accelerated returns a clock that starts at start and runs factor times
+// faster than real time.
+func Accelerated(start time.Time, factor float64) Clock {
+	return &accelerated{epoch: start, started: time.Now(), factor: factor}
+}
+
+type accelerated struct {
+	epoch   time.Time
+	started time.Time
+	factor  float64
+}
+
+func (a *accelerated) Now() time.Time {
+	return a.epoch.Add(time.Duration(float64(time.Since(a.started)) * a.factor))
+}
+
+func (a *accelerated) Since(t time.Time) time.Duration {
+	return a.Now().Sub(t)
+}
+
+// real is how long d of this clock's time takes in real time.
+func (a *accelerated) real(d time.Duration) time.Duration {
+	return time.Duration(float64(d) / a.factor)
+}
+
+func (a *accelerated) Sleep(d time.Duration) {
+	time.Sleep(a.real(d))
+}
+
+func (a *accelerated) After(d time.Duration) <-chan time.Time {
+	return a.NewTimer(d).Chan()
+}
+
+func (a *accelerated) NewTimer(d time.Duration) Timer {
+	t := &acceleratedTimer{clock: a, c: make(chan time.Time, 1)}
+	t.timer = time.AfterFunc(a.real(d), t.fire)
+	return t
+}
+
+// acceleratedTimer delivers this clock's time rather than real time, as
+// time.Timer would.
+type acceleratedTimer struct {
+	clock *accelerated
+	timer *time.Timer
+	c     chan time.Time
+}
+
+func (t *acceleratedTimer) fire() {
+	select {
+	case t.c <- t.clock.Now():
+	default:
+	}
+}
+
+func (t *acceleratedTimer) Chan() <-chan time.Time {
+	return t.c
+}
+
+func (t *acceleratedTimer) Reset(d time.Duration) bool {
+	return t.timer.Reset(t.clock.real(d))
+}
+
+func (t *acceleratedTimer) Stop() bool {
+	return t.timer.Stop()
+}
@@ -0,0 +1,36 @@
+package clock
+
+import (
+	"github.com/jonboulle/clockwork"
+	"testing"
+	"time"
+)
+
+var (
+	_ Clock = clockwork.NewRealClock()
+	_ Clock = clockwork.NewFakeClock()
+)
+
+func TestAccelerated(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := Accelerated(start, 36000)
+
+	began := time.Now()
+	fired := <-c.After(time.Hour)
+	if elapsed := time.Since(began); elapsed > 500*time.Millisecond {
+		t.Errorf("an accelerated hour took %v", elapsed)
+	}
+	if fired.Sub(start) < time.Hour {
+		t.Errorf("fired at %v, less than an hour after %v", fired, start)
+	}
+
+	timer := c.NewTimer(time.Hour)
+	if !timer.Stop() {
+		t.Error("Stop reported the timer had already fired")
+	}
+	select {
+	case <-timer.Chan():
+		t.Error("stopped timer fired")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"energy-meter-scraper/analysis"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/slot"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// resourceTrends are one resource's monthly trends.
+type resourceTrends struct {
+	resource string
+	trends   []analysis.Trend
+	summary  analysis.Summary
+}
+
+// runAnalyze prints month-over-month and year-over-year trends in stored
+// usage.
+func runAnalyze(args []string) {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	resource := fs.String("resource", "", "only analyze this resource (default all)")
+	months := fs.Int("months", 24, "how many months to analyze, up to and including this one")
+	format := fs.String("format", "table", "output format: table, json or markdown")
+	_ = fs.Parse(args)
+
+	write, ok := trendFormats[*format]
+	if !ok {
+		log.Fatalf("unknown format %q (expected table, json or markdown)", *format)
+	}
+	if *months < 1 {
+		log.Fatal("-months must be at least 1")
+	}
+
+	cfg, cfgErr := config.Load()
+	if cfgErr != nil {
+		log.Fatal(cfgErr)
+	}
+	loc, locErr := time.LoadLocation(cfg.Timezone)
+	if locErr != nil {
+		log.Fatal("TIMEZONE: ", locErr)
+	}
+	slotAlign, slotAlignErr := slot.ParseAlignment(cfg.Scrape.SlotAlign)
+	if slotAlignErr != nil {
+		log.Fatal("SLOT_ALIGN: ", slotAlignErr)
+	}
+	stamps := slot.Policy{Precision: cfg.Scrape.TimestampPrecision, Align: slotAlign}
+
+	sinks, sinksErr := sink.OpenAll(cfg)
+	if sinksErr != nil {
+		log.Fatal(sinksErr)
+	}
+	defer func() {
+		for _, s := range sinks {
+			_ = s.Close()
+		}
+	}()
+	var reader sink.Reader
+	for _, s := range sinks {
+		if r, ok := s.(sink.Reader); ok {
+			reader = r
+			break
+		}
+	}
+	if reader == nil {
+		log.Fatal("no configured sink can read back stored usage")
+	}
+
+	last := startOfMonth(time.Now(), loc)
+	first := last.AddDate(0, 1-*months, 0)
+	var results []resourceTrends
+	for _, meta := range cfg.Resources {
+		if *resource != "" && meta.Name != *resource {
+			continue
+		}
+		usage, usageErr := monthlyUsage(context.Background(), reader, stamps, meta.Name, first, last)
+		if usageErr != nil {
+			log.Fatalf("%s: %s", meta.Name, usageErr)
+		}
+		trends, summary := analysis.Trends(usage)
+		results = append(results, resourceTrends{resource: meta.Name, trends: trends, summary: summary})
+	}
+	if results == nil {
+		log.Fatalf("no resource named %q", *resource)
+	}
+	if err := write(os.Stdout, results); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// monthlyUsage totals the resource's stored slots for each month from first
+// to last, a month at a time.
+func monthlyUsage(ctx context.Context, reader sink.Reader, stamps slot.Policy, resource string, first, last time.Time) ([]analysis.Month, error) {
+	var months []analysis.Month
+	for start := first; !start.After(last); start = start.AddDate(0, 1, 0) {
+		end := start.AddDate(0, 1, 0)
+		points, readErr := reader.ReadPoints(ctx, "energy_usage", map[string]string{"resource": resource, "period": "30m"},
+			stamps.Stamp(start, 30*time.Minute), stamps.Stamp(end, 30*time.Minute))
+		if readErr != nil {
+			return nil, fmt.Errorf("read %s: %w", start.Format("2006-01"), readErr)
+		}
+
+		m := analysis.Month{Start: start}
+		for _, p := range points {
+			kwh, ok := p.Fields["kwh"].(float64)
+			if !ok {
+				continue
+			}
+			pence, _ := p.Fields["pence"].(float64)
+			m.KWh += kwh
+			m.Pence += pence
+			m.Slots++
+		}
+		if m.Slots > 0 {
+			months = append(months, m)
+		}
+	}
+	return months, nil
+}
+
+var trendFormats = map[string]func(io.Writer, []resourceTrends) error{
+	"table":    writeTrendTable,
+	"json":     writeTrendJSON,
+	"markdown": writeTrendMarkdown,
+}
+
+// trendColumns are the columns of the table and markdown reports.
+var trendColumns = []string{"Month", "Days", "kWh", "kWh/day", "Cost", "MoM", "YoY", "Adjusted kWh/day", "Adjusted MoM"}
+
+func trendRow(t analysis.Trend) []string {
+	return []string{
+		t.Start.Format("2006-01"),
+		fmt.Sprintf("%.1f", float64(t.Slots)/48),
+		fmt.Sprintf("%.1f", t.KWh),
+		fmt.Sprintf("%.2f", t.PerDay()),
+		fmt.Sprintf("£%.2f", t.Pence/100),
+		formatChange(t.MoM),
+		formatChange(t.YoY),
+		formatValue(t.Adjusted),
+		formatChange(t.AdjustedMoM),
+	}
+}
+
+func formatChange(v float64) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "-"
+	}
+	return fmt.Sprintf("%+.1f%%", v*100)
+}
+
+func formatValue(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", v)
+}
+
+// summaryLines describe the overall trend, if there is enough data for one.
+func summaryLines(s analysis.Summary) []string {
+	var lines []string
+	if !math.IsNaN(s.TrendPerYear) {
+		adjusted := "not seasonally adjusted, as there isn't a reading in every calendar month"
+		if s.Seasonal != nil {
+			adjusted = "seasonally adjusted"
+		}
+		lines = append(lines, fmt.Sprintf("Trend: %s a year (%s)", formatChange(s.TrendPerYear), adjusted))
+	}
+	if !math.IsNaN(s.YoY) {
+		lines = append(lines, fmt.Sprintf("Last 12 months: %.2f kWh/day, %s on the 12 before (%.2f kWh/day)", s.Last12, formatChange(s.YoY), s.Prior12))
+	}
+	if lines == nil {
+		lines = append(lines, "Not enough data for a trend")
+	}
+	return lines
+}
+
+func writeTrendTable(w io.Writer, results []resourceTrends) error {
+	for i, r := range results {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, r.resource)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, strings.Join(trendColumns, "\t")+"\t")
+		for _, t := range r.trends {
+			fmt.Fprintln(tw, strings.Join(trendRow(t), "\t")+"\t")
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		for _, line := range summaryLines(r.summary) {
+			fmt.Fprintln(w, line)
+		}
+	}
+	return nil
+}
+
+func writeTrendMarkdown(w io.Writer, results []resourceTrends) error {
+	fmt.Fprintln(w, "# Usage trends")
+	for _, r := range results {
+		fmt.Fprintf(w, "\n## %s\n\n", r.resource)
+		fmt.Fprintf(w, "| %s |\n", strings.Join(trendColumns, " | "))
+		fmt.Fprintf(w, "|%s\n", strings.Repeat(" ---: |", len(trendColumns)))
+		for _, t := range r.trends {
+			fmt.Fprintf(w, "| %s |\n", strings.Join(trendRow(t), " | "))
+		}
+		fmt.Fprintln(w)
+		for _, line := range summaryLines(r.summary) {
+			fmt.Fprintf(w, "- %s\n", line)
+		}
+	}
+	return nil
+}
+
+type trendJSON struct {
+	Resource     string              `json:"resource"`
+	Months       []monthTrendJSON    `json:"months"`
+	Seasonal     map[string]*float64 `json:"seasonal,omitempty"`
+	TrendPerYear *float64            `json:"trendPerYear"`
+	Last12       *float64            `json:"last12KwhPerDay"`
+	Prior12      *float64            `json:"prior12KwhPerDay"`
+	YoY          *float64            `json:"yoy"`
+}
+
+// monthTrendJSON is a month's trend, with changes as fractions and null
+// where there is nothing to compare with.
+type monthTrendJSON struct {
+	Month          string   `json:"month"`
+	Slots          int      `json:"slots"`
+	KWh            float64  `json:"kwh"`
+	Pence          float64  `json:"pence"`
+	KWhPerDay      *float64 `json:"kwhPerDay"`
+	MoM            *float64 `json:"mom"`
+	YoY            *float64 `json:"yoy"`
+	AdjustedPerDay *float64 `json:"adjustedKwhPerDay"`
+	AdjustedMoM    *float64 `json:"adjustedMom"`
+}
+
+// finite is v, or nil if it isn't a number JSON can hold.
+func finite(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+func writeTrendJSON(w io.Writer, results []resourceTrends) error {
+	out := make([]trendJSON, 0, len(results))
+	for _, r := range results {
+		rj := trendJSON{
+			Resource:     r.resource,
+			Months:       []monthTrendJSON{},
+			TrendPerYear: finite(r.summary.TrendPerYear),
+			Last12:       finite(r.summary.Last12),
+			Prior12:      finite(r.summary.Prior12),
+			YoY:          finite(r.summary.YoY),
+		}
+		for month, factor := range r.summary.Seasonal {
+			if rj.Seasonal == nil {
+				rj.Seasonal = map[string]*float64{}
+			}
+			rj.Seasonal[month.String()] = finite(factor)
+		}
+		for _, t := range r.trends {
+			rj.Months = append(rj.Months, monthTrendJSON{
+				Month:          t.Start.Format("2006-01"),
+				Slots:          t.Slots,
+				KWh:            t.KWh,
+				Pence:          t.Pence,
+				KWhPerDay:      finite(t.PerDay()),
+				MoM:            finite(t.MoM),
+				YoY:            finite(t.YoY),
+				AdjustedPerDay: finite(t.Adjusted),
+				AdjustedMoM:    finite(t.AdjustedMoM),
+			})
+		}
+		out = append(out, rj)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"energy-meter-scraper/analysis"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/slot"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonthlyUsage(t *testing.T) {
+	ctx := context.Background()
+	mem := newMemorySink()
+	stamps := slot.Policy{Align: slot.AlignEnd}
+	loc, _ := time.LoadLocation("Europe/London")
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, loc)
+	feb := jan.AddDate(0, 1, 0)
+
+	// A day either side of the end of January, stamped at the end of each
+	// slot, so that January's last slot is stamped at midnight in February
+	var points []sink.Point
+	for start := feb.Add(-24 * time.Hour); start.Before(feb.Add(24 * time.Hour)); start = start.Add(30 * time.Minute) {
+		points = append(points, sink.Point{
+			Measurement: "energy_usage",
+			Tags:        map[string]string{"resource": "electricity", "period": "30m"},
+			Fields:      map[string]any{"kwh": 0.5, "pence": 12.0},
+			Time:        stamps.Stamp(start, 30*time.Minute),
+		})
+	}
+	if err := mem.Write(ctx, points); err != nil {
+		t.Fatal(err)
+	}
+
+	months, usageErr := monthlyUsage(ctx, mem, stamps, "electricity", jan.AddDate(0, -1, 0), feb)
+	if usageErr != nil {
+		t.Fatal(usageErr)
+	}
+	if len(months) != 2 {
+		t.Fatalf("%d months, want January and February only: %+v", len(months), months)
+	}
+	for _, m := range months {
+		if m.Slots != 48 || m.KWh != 24 || m.Pence != 576 {
+			t.Errorf("%s has %d slots, %v kWh, %v pence, want 48, 24 and 576", m.Start.Format("2006-01"), m.Slots, m.KWh, m.Pence)
+		}
+	}
+
+	var out bytes.Buffer
+	results := []resourceTrends{{resource: "electricity"}}
+	results[0].trends, results[0].summary = analysis.Trends(months)
+	for name, write := range trendFormats {
+		out.Reset()
+		if err := write(&out, results); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !strings.Contains(out.String(), "2024-02") {
+			t.Errorf("%s report missing February:\n%s", name, out.String())
+		}
+	}
+	var decoded []trendJSON
+	out.Reset()
+	if err := writeTrendJSON(&out, results); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || decoded[0].Months[0].MoM != nil {
+		t.Errorf("json %s: %v", out.String(), err)
+	}
+}
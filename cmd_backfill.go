@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/checkpoint"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/redact"
+	"energy-meter-scraper/transport"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// runBackfill writes each resource's whole history to the sinks, a week at
+// a time. Progress is saved after every chunk, so an interrupted backfill
+// carries on from where it stopped when run again.
+func runBackfill(args []string) {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	resource := fs.String("resource", "", "only backfill this resource (default all)")
+	sinceFlag := fs.String("since", "", "start at this RFC 3339 time rather than the resource's first reading")
+	progressPath := fs.String("progress", "backfill-progress.json", "file recording how far each resource has got")
+	restart := fs.Bool("restart", false, "ignore saved progress and start from the beginning")
+	_ = fs.Parse(args)
+
+	var since time.Time
+	if *sinceFlag != "" {
+		var parseErr error
+		if since, parseErr = time.Parse(time.RFC3339, *sinceFlag); parseErr != nil {
+			log.Fatal("-since: ", parseErr)
+		}
+	}
+	if *restart {
+		if err := os.Remove(*progressPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Fatal(err)
+		}
+	}
+	progress, progressErr := checkpoint.Open(*progressPath)
+	if progressErr != nil {
+		log.Fatal(progressErr)
+	}
+
+	cfg, cfgErr := config.Load()
+	if cfgErr != nil {
+		log.Fatal(cfgErr)
+	}
+	redact.SetSecrets(cfg.Secrets()...)
+	st, stErr := newSettings(cfg, nil)
+	if stErr != nil {
+		log.Fatal(stErr)
+	}
+	publish(st)
+
+	glowHTTP, glowHTTPErr := transport.NewClient(cfg.Glow.HTTP, cfg.Network)
+	if glowHTTPErr != nil {
+		log.Fatal("glow http config: ", glowHTTPErr)
+	}
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(glowHTTP, cfg.Glow.Username, cfg.Glow.Password); authErr != nil {
+		log.Fatal("failed to authenticate with glow: ", authErr)
+	}
+
+	// Stopping waits for the chunk being written, so progress stays exact
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	found := false
+	for _, meta := range st.resources {
+		if *resource != "" && meta.Name != *resource {
+			continue
+		}
+		found = true
+		if err := backfill(ctx, st, meta, progress, since); err != nil {
+			if errors.Is(err, context.Canceled) {
+				log.Fatalf("%s: backfill interrupted; run it again to resume", meta.Name)
+			}
+			log.Fatalf("%s: %s", meta.Name, err)
+		}
+	}
+	if !found {
+		log.Fatalf("no resource named %q", *resource)
+	}
+}
+
+// backfill writes meta's readings from its first reading, or since if that
+// is later, to its latest, resuming after the last chunk progress records.
+// Once done the resource's checkpoint is moved up so the daemon carries on
+// from the latest reading.
+func backfill(ctx context.Context, st *settings, meta resourceMeta, progress *checkpoint.Store, since time.Time) error {
+	from, firstErr := glow.GetResourceFirstTime(meta.KWHResource)
+	if firstErr != nil {
+		return fmt.Errorf("first reading: %w", firstErr)
+	}
+	to, lastErr := glow.GetResourceLastTime(meta.KWHResource)
+	if lastErr != nil {
+		return fmt.Errorf("last reading: %w", lastErr)
+	}
+	if since.After(from) {
+		from = since
+	}
+	start := from
+	if done, ok := progress.Last(meta.Name); ok && done.After(from) {
+		slog.Info("resuming backfill", "resource", meta.Name, "from", done)
+		from = done
+	}
+
+	started := clk.Now()
+	written := 0
+	for chunkFrom := from; chunkFrom.Before(to); {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		chunkTo := chunkFrom.Add(maxReadingsSpan)
+		if chunkTo.After(to) {
+			chunkTo = to
+		}
+
+		points, readErr := readUsage(st, meta, chunkFrom, chunkTo)
+		if readErr != nil {
+			return fmt.Errorf("read %s to %s: %w", chunkFrom.Format(time.DateOnly), chunkTo.Format(time.DateOnly), readErr)
+		}
+		if err := writePoints(ctx, st, points); err != nil {
+			return err
+		}
+		if err := progress.Set(meta.Name, chunkTo); err != nil {
+			return fmt.Errorf("save progress: %w", err)
+		}
+		written += len(points)
+
+		// The remaining time is estimated from this run alone, as a resumed
+		// run has none of the earlier chunks to go on
+		remaining := time.Duration(0)
+		if covered := chunkTo.Sub(from); covered > 0 {
+			remaining = time.Duration(float64(clk.Since(started)) * float64(to.Sub(chunkTo)) / float64(covered))
+		}
+		slog.Info("backfill progress", "resource", meta.Name, "through", chunkTo,
+			"percent", fmt.Sprintf("%.1f", 100*float64(chunkTo.Sub(start))/float64(to.Sub(start))),
+			"points", written, "remaining", remaining.Round(time.Second))
+
+		chunkFrom = chunkTo
+	}
+
+	if err := st.checkpoints.Set(meta.Name, to); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	slog.Info("backfill complete", "resource", meta.Name, "from", start, "to", to, "points", written)
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/checkpoint"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/glowapi/glowtest"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/slot"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackfillResumes(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fakeClock(t, now)
+
+	fakeGlow := glowtest.New(clk, now.AddDate(0, 0, -20))
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	dir := t.TempDir()
+	progress, progressErr := checkpoint.Open(filepath.Join(dir, "backfill.json"))
+	if progressErr != nil {
+		t.Fatal(progressErr)
+	}
+	checkpoints, checkpointsErr := checkpoint.Open(filepath.Join(dir, "checkpoints.json"))
+	if checkpointsErr != nil {
+		t.Fatal(checkpointsErr)
+	}
+
+	cfg := &config.Config{Resources: []config.Resource{{Name: "electricity", KWHResource: "kwh", PenceResource: "pence"}}}
+	mem := newMemorySink()
+	st := &settings{
+		cfg:         cfg,
+		resources:   cfg.Resources,
+		sinks:       []sink.Sink{mem},
+		stamps:      slot.Policy{Precision: time.Second, Align: slot.AlignStart},
+		checkpoints: checkpoints,
+	}
+	meta := st.resources[0]
+
+	// An earlier run got 10 days in before being stopped
+	resumeAt := fakeGlow.First.AddDate(0, 0, 10)
+	if err := progress.Set(meta.Name, resumeAt); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backfill(context.Background(), st, meta, progress, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	slots := mem.series("energy_usage", map[string]string{"resource": meta.Name, "period": "30m"})
+	if len(slots) == 0 {
+		t.Fatal("nothing was written")
+	}
+	if !slots[0].Equal(resumeAt) {
+		t.Errorf("first slot written is %v, want the saved progress %v", slots[0], resumeAt)
+	}
+	for i := 1; i < len(slots); i++ {
+		if slots[i].Sub(slots[i-1]) != 30*time.Minute {
+			t.Fatalf("slots jump from %v to %v", slots[i-1], slots[i])
+		}
+	}
+	last := fakeGlow.Last()
+	if !slots[len(slots)-1].Equal(last) {
+		t.Errorf("last slot is %v, want %v", slots[len(slots)-1], last)
+	}
+	if done, _ := progress.Last(meta.Name); !done.Equal(last) {
+		t.Errorf("progress is %v, want %v", done, last)
+	}
+	if checkpointed, _ := checkpoints.Last(meta.Name); !checkpointed.Equal(last) {
+		t.Errorf("checkpoint is %v, want %v", checkpointed, last)
+	}
+}
+
+func TestBackfillStopsWhenCancelled(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fakeClock(t, now)
+
+	fakeGlow := glowtest.New(clk, now.AddDate(0, 0, -20))
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	cfg := &config.Config{Resources: []config.Resource{{Name: "electricity", KWHResource: "kwh", PenceResource: "pence"}}}
+	mem := newMemorySink()
+	st := &settings{cfg: cfg, resources: cfg.Resources, sinks: []sink.Sink{mem}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	progress, _ := checkpoint.Open(filepath.Join(t.TempDir(), "backfill.json"))
+	if err := backfill(ctx, st, st.resources[0], progress, time.Time{}); err != context.Canceled {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if _, ok := progress.Last("electricity"); ok {
+		t.Error("progress was recorded for a cancelled backfill")
+	}
+}
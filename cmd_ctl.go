@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"energy-meter-scraper/config"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// runCtl controls the running daemon through its admin socket.
+func runCtl(args []string) {
+	fs := flag.NewFlagSet("ctl", flag.ExitOnError)
+	socket := fs.String("socket", "", "admin socket to connect to (default admin.socket from the config)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: energy-meter-scraper ctl [-socket path] status|trigger|pause|resume|log-level <level>")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	method, path, reqErr := ctlRequest(fs.Args())
+	if reqErr != nil {
+		fs.Usage()
+		log.Fatal(reqErr)
+	}
+	if *socket == "" {
+		cfg, cfgErr := config.LoadPartial()
+		if cfgErr != nil {
+			log.Fatal(cfgErr)
+		}
+		*socket = cfg.Admin.Socket
+	}
+	if *socket == "" {
+		log.Fatal("no admin socket configured; set ADMIN_SOCKET or pass -socket")
+	}
+
+	body, ok, ctlErr := ctl(*socket, method, path)
+	if ctlErr != nil {
+		log.Fatal(ctlErr)
+	}
+	os.Stdout.Write(body)
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// ctlRequest returns the admin API request a ctl command makes.
+func ctlRequest(args []string) (method, path string, err error) {
+	if len(args) == 0 {
+		return "", "", fmt.Errorf("missing command")
+	}
+	switch cmd := args[0]; {
+	case cmd == "status" && len(args) == 1:
+		return http.MethodGet, "/status", nil
+	case (cmd == "trigger" || cmd == "pause" || cmd == "resume") && len(args) == 1:
+		return http.MethodPost, "/" + cmd, nil
+	case cmd == "log-level" && len(args) == 2:
+		return http.MethodPost, "/log-level?level=" + url.QueryEscape(args[1]), nil
+	default:
+		return "", "", fmt.Errorf("unknown command %q", strings.Join(args, " "))
+	}
+}
+
+// ctl makes a request to the admin socket, returning the response body,
+// indented if JSON, and whether it succeeded.
+func ctl(socket, method, path string) ([]byte, bool, error) {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	// The host is ignored, as every request goes to the socket
+	req, reqErr := http.NewRequest(method, "http://admin"+path, nil)
+	if reqErr != nil {
+		return nil, false, reqErr
+	}
+	resp, respErr := client.Do(req)
+	if respErr != nil {
+		return nil, false, fmt.Errorf("connect to the daemon: %w", respErr)
+	}
+	defer resp.Body.Close()
+	body, readErr := io.ReadAll(resp.Body)
+	if readErr != nil {
+		return nil, false, readErr
+	}
+
+	if resp.Header.Get("Content-Type") == "application/json" {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, body, "", "  "); err == nil {
+			body = indented.Bytes()
+		}
+	}
+	return body, resp.StatusCode < 300, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"flag"
+	"fmt"
+	"golang.org/x/term"
+	"log"
+	"os"
+	"slices"
+	"time"
+)
+
+// deletedMeasurements are what a resource's points are written to for each
+// slot, and so what delete removes.
+var deletedMeasurements = []string{"energy_usage", "energy_usage_revision", "energy_usage_provisional", "energy_tariff", "heating_session", "appliance_usage", "energy_usage_residual"}
+
+// runDelete removes a resource's points over a window from every sink that
+// supports it, so that a corrupted window can be backfilled again.
+func runDelete(args []string) {
+	fs := flag.NewFlagSet("delete", flag.ExitOnError)
+	resource := fs.String("resource", "", "resource or group whose points to delete")
+	fromFlag := fs.String("from", "", "delete points at or after this RFC 3339 time")
+	toFlag := fs.String("to", "", "delete points before this RFC 3339 time")
+	dryRun := fs.Bool("dry-run", false, "report how many points would be deleted without deleting them")
+	yes := fs.Bool("yes", false, "delete without asking for confirmation")
+	_ = fs.Parse(args)
+
+	if *resource == "" || *fromFlag == "" || *toFlag == "" {
+		log.Fatal("-resource, -from and -to are required")
+	}
+	from, fromErr := time.Parse(time.RFC3339, *fromFlag)
+	if fromErr != nil {
+		log.Fatal("-from: ", fromErr)
+	}
+	to, toErr := time.Parse(time.RFC3339, *toFlag)
+	if toErr != nil {
+		log.Fatal("-to: ", toErr)
+	}
+	if !from.Before(to) {
+		log.Fatal("-from must be before -to")
+	}
+
+	cfg, cfgErr := config.Load()
+	if cfgErr != nil {
+		log.Fatal(cfgErr)
+	}
+	if !slices.ContainsFunc(cfg.Resources, func(r config.Resource) bool { return r.Name == *resource }) &&
+		!slices.ContainsFunc(cfg.Groups, func(g config.GroupConfig) bool { return g.Name == *resource }) {
+		log.Fatalf("no resource or group named %q", *resource)
+	}
+	sinks, sinksErr := sink.OpenAll(cfg)
+	if sinksErr != nil {
+		log.Fatal(sinksErr)
+	}
+	defer func() {
+		for _, s := range sinks {
+			_ = s.Close()
+		}
+	}()
+
+	ctx := context.Background()
+	n, countErr := deleteWindow(ctx, sinks, *resource, from, to, true)
+	if countErr != nil {
+		log.Fatal(countErr)
+	}
+	if *dryRun {
+		return
+	}
+	if n == 0 {
+		fmt.Println("nothing to delete")
+		return
+	}
+	if !*yes {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			log.Fatal("not deleting without confirmation; pass -yes")
+		}
+		if !confirm(fmt.Sprintf("Delete %d points of %s from %s to %s? [y/N] ", n, *resource,
+			from.Format(time.RFC3339), to.Format(time.RFC3339))) {
+			log.Fatal("not deleting")
+		}
+	}
+
+	if _, err := deleteWindow(ctx, sinks, *resource, from, to, false); err != nil {
+		log.Fatal(err)
+	}
+	// The daemon only rewrites the window if it is after the checkpoint
+	fmt.Printf("to write the window again, run: backfill -resource %s -since %s -restart\n", *resource, from.Format(time.RFC3339))
+}
+
+// deleteWindow deletes, or with dryRun counts, the resource's points in
+// [start, stop) in each sink that supports it, and returns how many there
+// were.
+func deleteWindow(ctx context.Context, sinks []sink.Sink, resource string, start, stop time.Time, dryRun bool) (int, error) {
+	total := 0
+	for _, s := range sinks {
+		deleter, ok := s.(sink.Deleter)
+		if !ok {
+			fmt.Printf("%s: does not support deleting, skipping\n", s.Name())
+			continue
+		}
+		for _, measurement := range deletedMeasurements {
+			n, deleteErr := deleter.DeletePoints(ctx, measurement, map[string]string{"resource": resource}, start, stop, dryRun)
+			if deleteErr != nil {
+				return total, fmt.Errorf("%s: %s: %w", s.Name(), measurement, deleteErr)
+			}
+			if dryRun {
+				fmt.Printf("%s: would delete %d %s points\n", s.Name(), n, measurement)
+			} else {
+				fmt.Printf("%s: deleted %d %s points\n", s.Name(), n, measurement)
+			}
+			total += n
+		}
+	}
+	return total, nil
+}
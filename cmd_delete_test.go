@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/sink"
+	"testing"
+	"time"
+)
+
+func (m *memorySink) DeletePoints(_ context.Context, measurement string, tags map[string]string, start, stop time.Time, dryRun bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for key, p := range m.points {
+		if p.Measurement != measurement || p.Time.Before(start) || !p.Time.Before(stop) {
+			continue
+		}
+		matches := true
+		for k, v := range tags {
+			matches = matches && p.Tags[k] == v
+		}
+		if !matches {
+			continue
+		}
+		n++
+		if !dryRun {
+			delete(m.points, key)
+		}
+	}
+	return n, nil
+}
+
+func TestDeleteWindow(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	mem := newMemorySink()
+	var points []sink.Point
+	for i := range 6 {
+		at := start.Add(time.Duration(i) * 30 * time.Minute)
+		for _, resource := range []string{"elec", "gas"} {
+			points = append(points,
+				sink.Point{Measurement: "energy_usage", Tags: map[string]string{"resource": resource, "period": "30m"}, Time: at},
+				sink.Point{Measurement: "energy_tariff", Tags: map[string]string{"resource": resource}, Time: at})
+		}
+	}
+	if err := mem.Write(context.Background(), points); err != nil {
+		t.Fatal(err)
+	}
+
+	from, to := start.Add(time.Hour), start.Add(2*time.Hour)
+	n, err := deleteWindow(context.Background(), []sink.Sink{mem}, "elec", from, to, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 || len(mem.points) != len(points) {
+		t.Fatalf("dry run counted %d points and left %d of %d, want 4 counted and none deleted", n, len(mem.points), len(points))
+	}
+
+	if n, err = deleteWindow(context.Background(), []sink.Sink{mem}, "elec", from, to, false); err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 || len(mem.points) != len(points)-4 {
+		t.Fatalf("deleted %d points, leaving %d of %d", n, len(mem.points), len(points))
+	}
+	for _, p := range mem.points {
+		if p.Tags["resource"] == "elec" && !p.Time.Before(from) && p.Time.Before(to) {
+			t.Errorf("%s point at %s not deleted", p.Measurement, p.Time)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/ntp"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/transport"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// doctor prints the outcome of each diagnostic check as it runs.
+type doctor struct {
+	failed bool
+}
+
+func (d *doctor) ok(check, format string, args ...any) {
+	fmt.Printf("ok    %s: %s\n", check, fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) warn(check, detail, fix string) {
+	fmt.Printf("warn  %s: %s\n", check, detail)
+	if fix != "" {
+		fmt.Printf("      fix: %s\n", fix)
+	}
+}
+
+func (d *doctor) fail(check string, err error, fix string) {
+	d.failed = true
+	fmt.Printf("FAIL  %s: %s\n", check, err)
+	if fix != "" {
+		fmt.Printf("      fix: %s\n", fix)
+	}
+}
+
+// runDoctor checks the config, Glow and each sink, and suggests fixes for
+// whatever fails. It exits non-zero if any check failed.
+func runDoctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	noWrite := fs.Bool("no-write", false, "don't write a test point to the sinks")
+	_ = fs.Parse(args)
+
+	d := &doctor{}
+	d.run(!*noWrite)
+	if d.failed {
+		os.Exit(1)
+	}
+}
+
+func (d *doctor) run(write bool) {
+	cfg, cfgErr := config.Load()
+	if cfgErr != nil {
+		d.fail("config", cfgErr, "set the missing settings in the environment or CONFIG_FILE (see config.example.yaml)")
+		return
+	}
+	d.ok("config", "loaded %d resources", len(cfg.Resources))
+
+	if cfg.Clock.NTPServer != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		offset, offsetErr := ntp.Offset(ctx, cfg.Clock.NTPServer)
+		cancel()
+		switch {
+		case offsetErr != nil:
+			d.warn("clock", offsetErr.Error(), "check UDP port 123 is allowed out, or set NTP_SERVER=off")
+		case offset.Abs() > cfg.Clock.MaxSkew:
+			d.fail("clock", fmt.Errorf("system clock is %s off", offset), "enable NTP sync on the host")
+		default:
+			d.ok("clock", "within %s of %s", offset.Abs().Round(time.Millisecond), cfg.Clock.NTPServer)
+		}
+	}
+
+	api := d.checkGlow(cfg)
+	if api != nil {
+		d.checkResources(cfg, api)
+	}
+
+	d.checkSinks(cfg, write)
+}
+
+func (d *doctor) checkGlow(cfg *config.Config) *glowapi.API {
+	glowHTTP, glowHTTPErr := transport.NewClient(cfg.Glow.HTTP, cfg.Network)
+	if glowHTTPErr != nil {
+		d.fail("glow http", glowHTTPErr, "check GLOW_PROXY, GLOW_CA_FILE, GLOW_CERT_FILE and GLOW_KEY_FILE")
+		return nil
+	}
+
+	api, authErr := glowapi.Authenticate(glowHTTP, cfg.Glow.Username, cfg.Glow.Password)
+	if authErr != nil {
+		fix := "check GLOW_USERNAME and GLOW_PASSWORD work at https://glowmarkt.com"
+		if strings.Contains(authErr.Error(), "dial") || strings.Contains(authErr.Error(), "lookup") {
+			fix = "check DNS and outbound HTTPS to api.glowmarkt.com, or set GLOW_PROXY"
+		}
+		d.fail("glow auth", authErr, fix)
+		return nil
+	}
+	d.ok("glow auth", "logged in as %s", cfg.Glow.Username)
+	return api
+}
+
+func (d *doctor) checkResources(cfg *config.Config, api *glowapi.API) {
+	available, listErr := api.ListResources()
+	if listErr != nil {
+		d.fail("glow resources", listErr, "")
+		return
+	}
+	byID := map[string]glowapi.Resource{}
+	for _, r := range available {
+		byID[r.ResourceId] = r
+	}
+
+	for _, meta := range cfg.Resources {
+		for _, id := range []string{meta.KWHResource, meta.PenceResource} {
+			check := "resource " + meta.Name
+			r, ok := byID[id]
+			if !ok {
+				d.fail(check, fmt.Errorf("%s is not one of this account's resources", id), suggestResources(available))
+				continue
+			}
+
+			first, firstErr := api.GetResourceFirstTime(id)
+			last, lastErr := api.GetResourceLastTime(id)
+			if firstErr != nil || lastErr != nil {
+				d.fail(check, fmt.Errorf("%s: first/last time: %v %v", r.Classifier, firstErr, lastErr), "")
+				continue
+			}
+			switch {
+			case !first.Before(last):
+				d.fail(check, fmt.Errorf("%s has no readings (first %s, last %s)", r.Classifier, first, last),
+					"check the meter is commissioned with the DCC in the Bright app")
+			case last.After(time.Now().Add(time.Hour)):
+				d.fail(check, fmt.Errorf("%s last reading %s is in the future", r.Classifier, last),
+					"check the system clock and timezone")
+			case time.Since(last) > 48*time.Hour:
+				d.warn(check, fmt.Sprintf("%s last reading is %s old", r.Classifier, time.Since(last).Round(time.Hour)),
+					"the DCC may be behind; if this persists check the meter in the Bright app")
+			default:
+				d.ok(check, "%s readings %s to %s", r.Classifier, first.Format(time.DateOnly), last.Format(time.RFC3339))
+			}
+		}
+	}
+}
+
+// suggestResources lists the account's consumption resources in the form
+// they're configured.
+func suggestResources(available []glowapi.Resource) string {
+	var lines []string
+	for _, r := range available {
+		if strings.HasSuffix(r.Classifier, ".consumption") || strings.HasSuffix(r.Classifier, ".consumption.cost") {
+			lines = append(lines, fmt.Sprintf("%s = %s", r.Classifier, r.ResourceId))
+		}
+	}
+	if len(lines) == 0 {
+		return "this account has no consumption resources"
+	}
+	return "set the resources in CONFIG_FILE from these (kwh is .consumption, pence is .consumption.cost):\n        " +
+		strings.Join(lines, "\n        ")
+}
+
+func (d *doctor) checkSinks(cfg *config.Config, write bool) {
+	sinks, sinksErr := sink.OpenAll(cfg)
+	if sinksErr != nil {
+		d.fail("sinks", sinksErr, "check the sink's settings, such as INFLUX_HOST")
+		return
+	}
+	if len(sinks) == 0 {
+		d.fail("sinks", fmt.Errorf("none configured (available in this build: %v)", sink.Available()), "set INFLUX_HOST")
+		return
+	}
+
+	for _, s := range sinks {
+		check := "sink " + s.Name()
+		if !write {
+			d.ok(check, "opened")
+			_ = s.Close()
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		writeErr := s.Write(ctx, []sink.Point{{
+			Measurement: "scraper_doctor",
+			Tags:        map[string]string{},
+			Fields:      map[string]any{"ok": 1},
+			Time:        time.Now(),
+		}})
+		cancel()
+		if writeErr != nil {
+			fix := "check the sink is reachable and its token can write"
+			if s.Name() == "influx" {
+				fix = "check INFLUX_HOST is reachable and INFLUX_TOKEN can write to INFLUX_BUCKET in INFLUX_ORG"
+			}
+			d.fail(check, writeErr, fix)
+		} else {
+			d.ok(check, "wrote a test point to scraper_doctor")
+		}
+		_ = s.Close()
+	}
+}
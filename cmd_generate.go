@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// billsTasker is implemented by sinks that can total monthly bills
+// themselves on a schedule.
+type billsTasker interface {
+	BillsTask(resources []string, location string) string
+	ApplyBillsTask(ctx context.Context, task string) (bool, error)
+}
+
+// runGenerate writes configuration for other systems, derived from the
+// scraper's own config so it follows the configured schema.
+func runGenerate(args []string) {
+	if len(args) == 0 || args[0] != "tasks" {
+		fmt.Fprintln(os.Stderr, "usage: generate tasks [-apply] [-timezone zone]")
+		os.Exit(2)
+	}
+	runGenerateTasks(args[1:])
+}
+
+// runGenerateTasks prints the task each sink would run to compute monthly
+// bills, or with -apply creates it.
+func runGenerateTasks(args []string) {
+	fs := flag.NewFlagSet("generate tasks", flag.ExitOnError)
+	apply := fs.Bool("apply", false, "create or update the tasks instead of printing them")
+	zone := fs.String("timezone", defaultTaskZone(), "IANA timezone whose calendar months are billed")
+	_ = fs.Parse(args)
+
+	cfg, cfgErr := config.Load()
+	if cfgErr != nil {
+		log.Fatal(cfgErr)
+	}
+	sinks, sinksErr := sink.OpenAll(cfg)
+	if sinksErr != nil {
+		log.Fatal(sinksErr)
+	}
+	defer func() {
+		for _, s := range sinks {
+			_ = s.Close()
+		}
+	}()
+
+	var resources []string
+	for _, r := range cfg.Resources {
+		resources = append(resources, r.Name)
+	}
+
+	generated := 0
+	for _, s := range sinks {
+		tasker, ok := s.(billsTasker)
+		if !ok {
+			continue
+		}
+		generated++
+		task := tasker.BillsTask(resources, *zone)
+
+		if !*apply {
+			fmt.Printf("// %s\n%s", s.Name(), task)
+			continue
+		}
+		created, applyErr := tasker.ApplyBillsTask(context.Background(), task)
+		if applyErr != nil {
+			log.Fatalf("%s: %s", s.Name(), applyErr)
+		}
+		if created {
+			fmt.Printf("%s: created bills task\n", s.Name())
+		} else {
+			fmt.Printf("%s: updated bills task\n", s.Name())
+		}
+	}
+	if generated == 0 {
+		log.Fatal("no configured sink supports tasks")
+	}
+}
+
+func defaultTaskZone() string {
+	if zone := os.Getenv("TZ"); zone != "" {
+		return zone
+	}
+	return "UTC"
+}
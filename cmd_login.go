@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/transport"
+	"flag"
+	"fmt"
+	"golang.org/x/term"
+	"log"
+	"os"
+	"strings"
+)
+
+// runLogin checks a Glow password and saves it in the OS keyring.
+func runLogin(args []string) {
+	cfg, cfgErr := config.LoadPartial()
+	if cfgErr != nil {
+		log.Fatal(cfgErr)
+	}
+
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	username := fs.String("username", cfg.Glow.Username, "glow account username")
+	_ = fs.Parse(args)
+
+	store := config.Passwords()
+	if store == nil {
+		log.Fatal("this build does not include keyring support")
+	}
+
+	fmt.Fprintf(os.Stderr, "Glow password for %s: ", *username)
+	password, readErr := readPassword()
+	fmt.Fprintln(os.Stderr)
+	if readErr != nil {
+		log.Fatal(readErr)
+	}
+
+	glowHTTP, glowHTTPErr := transport.NewClient(cfg.Glow.HTTP, cfg.Network)
+	if glowHTTPErr != nil {
+		log.Fatal("glow http config: ", glowHTTPErr)
+	}
+	if _, authErr := glowapi.Authenticate(glowHTTP, *username, password); authErr != nil {
+		log.Fatal("glow rejected the password: ", authErr)
+	}
+
+	if err := store.Set(*username, password); err != nil {
+		log.Fatal("save to keyring: ", err)
+	}
+	fmt.Println("saved glow password to keyring")
+}
+
+// runLogout removes a saved Glow password from the OS keyring.
+func runLogout(args []string) {
+	fs := flag.NewFlagSet("logout", flag.ExitOnError)
+	username := fs.String("username", defaultGlowUsername(), "glow account username")
+	_ = fs.Parse(args)
+
+	store := config.Passwords()
+	if store == nil {
+		log.Fatal("this build does not include keyring support")
+	}
+	if err := store.Delete(*username); err != nil {
+		log.Fatal("delete from keyring: ", err)
+	}
+	fmt.Println("removed glow password from keyring")
+}
+
+func defaultGlowUsername() string {
+	if username := config.Getenv("GLOW_USERNAME"); username != "" {
+		return username
+	}
+	return config.DefaultGlowUsername
+}
+
+func readPassword() (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		return string(b), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/slot"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+)
+
+// runMigrateSlotAlign moves points already written with one SLOT_ALIGN to
+// where they would have been written with another. Run it after changing
+// SLOT_ALIGN so that old and new points agree.
+func runMigrateSlotAlign(args []string) {
+	fs := flag.NewFlagSet("migrate-slot-align", flag.ExitOnError)
+	fromFlag := fs.String("from", string(slot.AlignStart), "alignment the points were written with")
+	toFlag := fs.String("to", string(slot.AlignEnd), "alignment to move the points to")
+	sinceFlag := fs.String("since", "", "only migrate points at or after this RFC 3339 time (default all)")
+	untilFlag := fs.String("until", "", "only migrate points before this RFC 3339 time (default now)")
+	dryRun := fs.Bool("dry-run", false, "report how many points would move without changing anything")
+	force := fs.Bool("force", false, "migrate even if a previous migration already moved the points to -to")
+	_ = fs.Parse(args)
+
+	from, fromErr := slot.ParseAlignment(*fromFlag)
+	if fromErr != nil {
+		log.Fatal("-from: ", fromErr)
+	}
+	to, toErr := slot.ParseAlignment(*toFlag)
+	if toErr != nil {
+		log.Fatal("-to: ", toErr)
+	}
+
+	start := time.Unix(0, 0)
+	if *sinceFlag != "" {
+		var parseErr error
+		if start, parseErr = time.Parse(time.RFC3339, *sinceFlag); parseErr != nil {
+			log.Fatal("-since: ", parseErr)
+		}
+	}
+	stop := time.Now().Add(time.Hour)
+	if *untilFlag != "" {
+		var parseErr error
+		if stop, parseErr = time.Parse(time.RFC3339, *untilFlag); parseErr != nil {
+			log.Fatal("-until: ", parseErr)
+		}
+	}
+
+	by := slot.Offset(from, to, 30*time.Minute)
+	if by == 0 {
+		fmt.Println("nothing to do: alignments are equivalent")
+		return
+	}
+
+	cfg, cfgErr := config.Load()
+	if cfgErr != nil {
+		log.Fatal(cfgErr)
+	}
+	sinks, sinksErr := sink.OpenAll(cfg)
+	if sinksErr != nil {
+		log.Fatal(sinksErr)
+	}
+
+	for _, s := range sinks {
+		shifter, ok := s.(sink.Shifter)
+		if !ok {
+			fmt.Printf("%s: does not support migration, skipping\n", s.Name())
+			continue
+		}
+
+		ctx := context.Background()
+		if applied, appliedErr := appliedAlignment(ctx, s); appliedErr != nil {
+			log.Fatalf("%s: read previous migrations: %s", s.Name(), appliedErr)
+		} else if applied == to && !*force {
+			log.Fatalf("%s: points were already migrated to %s; pass -force to shift them again", s.Name(), to)
+		}
+
+		// Revisions are stamped like the slot they revise, so move with it
+		for _, measurement := range []string{"energy_usage", "energy_usage_revision"} {
+			n, shiftErr := shifter.ShiftPoints(ctx, measurement,
+				map[string]string{"period": "30m"}, start, stop, by, *dryRun)
+			if shiftErr != nil {
+				log.Fatalf("%s: %s: %s", s.Name(), measurement, shiftErr)
+			}
+			if *dryRun {
+				fmt.Printf("%s: would move %d %s points by %s\n", s.Name(), n, measurement, by)
+			} else {
+				fmt.Printf("%s: moved %d %s points by %s\n", s.Name(), n, measurement, by)
+			}
+		}
+		if !*dryRun {
+			if err := s.Write(ctx, []sink.Point{migrationPoint(from, to, start, stop)}); err != nil {
+				log.Fatalf("%s: record migration: %s", s.Name(), err)
+			}
+		}
+		_ = s.Close()
+	}
+}
+
+// migrationPoint records a migration so that running it twice doesn't shift
+// the points twice.
+func migrationPoint(from, to slot.Alignment, start, stop time.Time) sink.Point {
+	return sink.Point{
+		Measurement: "scraper_migration",
+		Tags:        map[string]string{"measurement": "energy_usage"},
+		Fields: map[string]any{
+			"fromSlotAlign": string(from),
+			"slotAlign":     string(to),
+			"since":         start.Unix(),
+			"until":         stop.Unix(),
+		},
+		Time: time.Now(),
+	}
+}
+
+// appliedAlignment returns the alignment the most recent migration moved the
+// points to, or "" if there has been none or s can't tell.
+func appliedAlignment(ctx context.Context, s sink.Sink) (slot.Alignment, error) {
+	reader, ok := s.(sink.Reader)
+	if !ok {
+		return "", nil
+	}
+	points, err := reader.ReadPoints(ctx, "scraper_migration",
+		map[string]string{"measurement": "energy_usage"}, time.Unix(0, 0), time.Now().Add(time.Hour))
+	if err != nil {
+		return "", err
+	}
+
+	var latest sink.Point
+	for _, p := range points {
+		if p.Time.After(latest.Time) {
+			latest = p
+		}
+	}
+	align, _ := latest.Fields["slotAlign"].(string)
+	return slot.Alignment(align), nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/share"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// runShare prints a read-only link to the dashboard that expires.
+func runShare(args []string) {
+	fs := flag.NewFlagSet("share", flag.ExitOnError)
+	valid := fs.Duration("for", 7*24*time.Hour, "how long the link is valid for")
+	_ = fs.Parse(args)
+
+	cfg, cfgErr := config.Load()
+	if cfgErr != nil {
+		log.Fatal(cfgErr)
+	}
+	if cfg.Server.PublicURL == "" {
+		log.Fatal("SERVER_PUBLIC_URL must be set to make share links")
+	}
+
+	expires := time.Now().Add(*valid)
+	query, signErr := share.Sign(cfg.Server.ShareSecret, expires)
+	if signErr != nil {
+		log.Fatal(signErr)
+	}
+	fmt.Printf("%s/?%s\n", strings.TrimSuffix(cfg.Server.PublicURL, "/"), query.Encode())
+	fmt.Printf("valid until %s\n", expires.Format(time.RFC1123))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/slot"
+	"energy-meter-scraper/split"
+	"energy-meter-scraper/transport"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+)
+
+// runSplitReport prints each party's share of a month's costs.
+func runSplitReport(args []string) {
+	fs := flag.NewFlagSet("split-report", flag.ExitOnError)
+	monthFlag := fs.String("month", "", "month to report on as YYYY-MM (default last month)")
+	_ = fs.Parse(args)
+
+	cfg, cfgErr := config.Load()
+	if cfgErr != nil {
+		log.Fatal(cfgErr)
+	}
+	loc, locErr := time.LoadLocation(cfg.Timezone)
+	if locErr != nil {
+		log.Fatal("TIMEZONE: ", locErr)
+	}
+
+	now := time.Now().In(loc)
+	month := time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, loc)
+	if *monthFlag != "" {
+		var parseErr error
+		if month, parseErr = time.ParseInLocation("2006-01", *monthFlag, loc); parseErr != nil {
+			log.Fatal("-month: ", parseErr)
+		}
+	}
+	// The report only reads Glow, so doesn't need the sinks newSettings
+	// would open
+	plan, planErr := split.New(cfg.Split.Parties)
+	if planErr != nil {
+		log.Fatal("split: ", planErr)
+	}
+	if plan == nil {
+		log.Fatal("no split parties configured")
+	}
+	slotAlign, slotAlignErr := slot.ParseAlignment(cfg.Scrape.SlotAlign)
+	if slotAlignErr != nil {
+		log.Fatal("SLOT_ALIGN: ", slotAlignErr)
+	}
+	st := &settings{
+		cfg:       cfg,
+		resources: cfg.Resources,
+		stamps:    slot.Policy{Precision: cfg.Scrape.TimestampPrecision, Align: slotAlign},
+		split:     plan,
+		loc:       loc,
+	}
+
+	glowHTTP, glowHTTPErr := transport.NewClient(cfg.Glow.HTTP, cfg.Network)
+	if glowHTTPErr != nil {
+		log.Fatal("glow http config: ", glowHTTPErr)
+	}
+	var glowErr error
+	if glow, glowErr = glowapi.Authenticate(glowHTTP, cfg.Glow.Username, cfg.Glow.Password); glowErr != nil {
+		log.Fatal(glowErr)
+	}
+
+	report, reportErr := splitReport(st, month)
+	if reportErr != nil {
+		log.Fatal(reportErr)
+	}
+	fmt.Printf("Energy costs for %s\n%s\n", month.Format("January 2006"), report)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+)
+
+// commands are run as `energy-meter-scraper <command> [flags]`. With no
+// command the scraper runs as a daemon. Optional features add their own from
+// init.
+var commands = map[string]func(args []string){
+	"analyze":            runAnalyze,
+	"backfill":           runBackfill,
+	"ctl":                runCtl,
+	"delete":             runDelete,
+	"doctor":             runDoctor,
+	"generate":           runGenerate,
+	"login":              runLogin,
+	"logout":             runLogout,
+	"migrate-slot-align": runMigrateSlotAlign,
+	"share":              runShare,
+	"split-report":       runSplitReport,
+}
+
+func runCommand(name string, args []string) {
+	cmd, ok := commands[name]
+	if !ok {
+		var names []string
+		for n := range commands {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		fmt.Fprintf(os.Stderr, "unknown command %q, expected one of %v\n", name, names)
+		os.Exit(2)
+	}
+	cmd(args)
+}
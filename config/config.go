@@ -0,0 +1,878 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Config is built from defaults, then the YAML file named by CONFIG_FILE if
+// set, then environment variables, each overriding the last. All variables
+// are read with the EnvPrefix.
+type Config struct {
+	Glow      GlowConfig    `yaml:"glow"`
+	Resources []Resource    `yaml:"resources"`
+	Sinks     SinksConfig   `yaml:"sinks"`
+	Notify    NotifyConfig  `yaml:"notify"`
+	Scrape    ScrapeConfig  `yaml:"scrape"`
+	Network   NetworkConfig `yaml:"network"`
+	Clock     ClockConfig   `yaml:"clock"`
+	// Timezone is the IANA zone where days, months, daily schedules and
+	// tariff bands begin, e.g. "Europe/London", or "Local" for the system's.
+	Timezone string `yaml:"timezone"`
+	// LogLevel is one of debug, info, warn or error.
+	LogLevel string `yaml:"logLevel"`
+
+	CrossCheck CrossCheckConfig `yaml:"crossCheck"`
+	Recheck    RecheckConfig    `yaml:"recheck"`
+	Alerts     AlertsConfig     `yaml:"alerts"`
+	Digest     DigestConfig     `yaml:"digest"`
+	Occupancy  OccupancyConfig  `yaml:"occupancy"`
+	Heating    HeatingConfig    `yaml:"heating"`
+	Plugs      PlugsConfig      `yaml:"plugs"`
+	Split      SplitConfig      `yaml:"split"`
+	Archive    ArchiveConfig    `yaml:"archive"`
+	// Tariffs are time-of-use tariffs by resource name, used to record the
+	// band and configured cost of each slot alongside Glow's.
+	Tariffs map[string]TariffConfig `yaml:"tariffs"`
+	// Groups are combined series summing several resources, such as the
+	// meters of one site.
+	Groups []GroupConfig `yaml:"groups"`
+	// IDs are what each integration calls a resource, by resource name and
+	// then integration, for the integrations whose name for it differs.
+	IDs    map[string]map[string]string `yaml:"ids"`
+	Server ServerConfig                 `yaml:"server"`
+	SLO    SLOConfig                    `yaml:"slo"`
+	// Standby lets instances share a checkpoint file, one scraping while
+	// the others stand by to take over.
+	Standby StandbyConfig `yaml:"standby"`
+	Admin   AdminConfig   `yaml:"admin"`
+	Health  HealthConfig  `yaml:"health"`
+}
+
+// Secrets are the credentials in c, which must never be logged.
+func (c *Config) Secrets() []string {
+	secrets := []string{
+		c.Glow.Password,
+		c.Sinks.Influx.Token,
+		c.Sinks.Influx3.Token,
+		c.Sinks.MQTT.Password,
+		c.Sinks.NATS.Password,
+		c.Sinks.NATS.Token,
+		c.Notify.Matrix.Token,
+		c.Notify.Apprise.Key,
+		c.Occupancy.Token,
+		c.Plugs.Password,
+		c.Archive.SecretAccessKey,
+		c.Server.Token,
+		c.Server.ShareSecret,
+	}
+	// Headers are how collectors are authenticated
+	for _, v := range c.Sinks.OTLP.Headers {
+		secrets = append(secrets, v)
+	}
+	// Apprise service URLs embed the tokens of the services they notify
+	return append(secrets, c.Notify.Apprise.URLs...)
+}
+
+// ServerConfig is the dashboard and API, which is enabled by setting Listen.
+type ServerConfig struct {
+	Listen string `yaml:"listen"`
+	// Token grants full access as a bearer token. It is required unless
+	// Listen is a loopback address, in which case the server is open to
+	// local users.
+	Token string `yaml:"token"`
+	// ShareSecret signs read-only share links, and requires Token. Changing
+	// it revokes them all.
+	ShareSecret string `yaml:"shareSecret"`
+	// PublicURL is the address share links point at.
+	PublicURL string `yaml:"publicURL"`
+}
+
+type SplitConfig struct {
+	// Parties are who costs are split between. Whatever isn't attributed to a
+	// party is the household's.
+	Parties []SplitParty `yaml:"parties"`
+	// Schedule is when the previous month's report is sent. Empty disables.
+	Schedule string `yaml:"schedule"`
+}
+
+// SplitParty is charged Share of all costs, or all usage in Window (a daily
+// "HH:MM-HH:MM" range) on Resources, or all resources if empty.
+type SplitParty struct {
+	Name      string   `yaml:"name"`
+	Share     float64  `yaml:"share"`
+	Window    string   `yaml:"window"`
+	Resources []string `yaml:"resources"`
+}
+
+// GroupConfig is a virtual resource named Name whose usage and cost are the
+// sum of its Members', which are resources of the same fuel. The members'
+// own series are still written.
+type GroupConfig struct {
+	Name    string   `yaml:"name"`
+	Members []string `yaml:"members"`
+}
+
+// TariffConfig is a time-of-use tariff. Each day follows the first season
+// whose dates include it, and every day must be in one.
+type TariffConfig struct {
+	Seasons []TariffSeason `yaml:"seasons"`
+	// CapacityRate is a demand charge in pence per kW of each month's peak
+	// half hour, for tariffs billed on capacity as well as usage.
+	CapacityRate float64 `yaml:"capacityRate"`
+	// StandingCharge is the contracted standing charge in pence per day,
+	// checked against Glow's if set.
+	StandingCharge float64 `yaml:"standingCharge"`
+}
+
+// TariffSeason is the bands in force from From to To inclusive, as "MM-DD".
+// A season may span the new year, e.g. 10-01 to 03-31. Without dates it
+// applies all year.
+type TariffSeason struct {
+	Name  string       `yaml:"name"`
+	From  string       `yaml:"from"`
+	To    string       `yaml:"to"`
+	Bands []TariffBand `yaml:"bands"`
+}
+
+// TariffBand charges Rate pence per kWh in Window, a daily "HH:MM-HH:MM"
+// range that may span midnight. The one band without a Window covers the
+// rest of the day.
+type TariffBand struct {
+	Name   string  `yaml:"name"`
+	Window string  `yaml:"window"`
+	Rate   float64 `yaml:"rate"`
+}
+
+// OccupancyConfig is where the home/away state is read from: a file whose
+// contents are the state, or a URL returning it.
+type OccupancyConfig struct {
+	File  string `yaml:"file"`
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+	// AwayValues are the states meaning nobody is home.
+	AwayValues []string `yaml:"awayValues"`
+}
+
+// HeatingConfig infers when gas heating ran from half-hourly usage, writing
+// each run as a heating_session point. It is enabled by Enabled.
+type HeatingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MinKWh is the gas used in a half hour that means the heating is on,
+	// above what cooking and hot water use.
+	MinKWh float64 `yaml:"minKWh"`
+	// MinDuration is the shortest run counted, so that refilling a hot water
+	// cylinder isn't taken for heating.
+	MinDuration time.Duration `yaml:"minDuration"`
+	// MaxGap is the longest dip below MinKWh within a run, as the boiler
+	// modulates or the thermostat cycles.
+	MaxGap time.Duration `yaml:"maxGap"`
+}
+
+// ArchiveConfig is a Parquet file of each resource's slots for every month
+// in an S3 compatible bucket, which is enabled by setting Bucket. Months are
+// archived from Glow once settled and never rewritten, so the archive
+// outlives any sink's retention.
+type ArchiveConfig struct {
+	Bucket string `yaml:"bucket"`
+	// Endpoint is the S3 API of storage other than AWS, e.g.
+	// "http://minio:9000", which is addressed path-style.
+	Endpoint string `yaml:"endpoint"`
+	Region   string `yaml:"region"`
+	// AccessKeyID and SecretAccessKey default to the AWS credential chain.
+	AccessKeyID     string `yaml:"accessKeyID"`
+	SecretAccessKey string `yaml:"secretAccessKey"`
+	// Key is the object written for each resource and month, with
+	// {resource}, {year} and {month} replaced, so that query engines can
+	// prune by the partition directories it names.
+	Key string `yaml:"key"`
+	// Schedule is when settled months missing from the bucket are written.
+	// "off" disables.
+	Schedule string `yaml:"schedule"`
+	// Settle is how long after a month ends it is archived, so that readings
+	// the DCC delivers late are in it.
+	Settle time.Duration `yaml:"settle"`
+	// Months is how far back missing months are written, such as when the
+	// archive is first enabled.
+	Months int `yaml:"months"`
+}
+
+// PlugsConfig is smart plugs reporting their energy over MQTT, which are
+// followed by setting Broker. Each slot of Resource is written with the
+// plugs' share taken away, leaving the usage they don't explain.
+type PlugsConfig struct {
+	Broker   string `yaml:"broker"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	ClientID string `yaml:"clientID"`
+	// Resource is the electricity resource the plugs are supplied by.
+	Resource string `yaml:"resource"`
+	Plugs    []Plug `yaml:"plugs"`
+}
+
+// Plug is a smart plug reporting its energy counter to Topic, e.g.
+// tele/washer/SENSOR for Tasmota, or shellies/dryer/relay/0/energy or
+// dryer/status/switch:0 for Shelly.
+type Plug struct {
+	Name  string `yaml:"name"`
+	Topic string `yaml:"topic"`
+	// Format is tasmota or shelly.
+	Format string `yaml:"format"`
+}
+
+type DigestConfig struct {
+	// Schedule is when a summary of the previous day is sent. Empty disables.
+	Schedule string `yaml:"schedule"`
+}
+
+// Resource is a pair of Glow resources measuring the same supply in kWh and
+// in pence.
+type Resource struct {
+	Name          string `yaml:"name"`
+	KWHResource   string `yaml:"kwh"`
+	PenceResource string `yaml:"pence"`
+	// Fuel is electricity or gas. If empty it is guessed from Name.
+	Fuel string `yaml:"fuel"`
+}
+
+func (r Resource) IsElectricity() bool {
+	if r.Fuel != "" {
+		return r.Fuel == "electricity"
+	}
+	return strings.Contains(strings.ToLower(r.Name), "electric")
+}
+
+type CrossCheckConfig struct {
+	// Schedule is when the previous day is cross-checked. Empty disables.
+	Schedule string `yaml:"schedule"`
+	// Tolerance is the fraction by which the stored total may differ from
+	// Glow's daily value.
+	Tolerance float64 `yaml:"tolerance"`
+	// Repair rewrites the day when it fails the check.
+	Repair bool `yaml:"repair"`
+}
+
+// RecheckConfig is the healing pass, which re-reads a longer window than
+// each cycle's Lookback, less often, for DCC data that arrives days late or
+// is revised.
+type RecheckConfig struct {
+	// Schedule is when the trailing window is re-read. Empty disables.
+	Schedule string `yaml:"schedule"`
+	// Window is how far back each recheck reads.
+	Window time.Duration `yaml:"window"`
+	// Overwrite rewrites every slot in the window rather than only those
+	// that differ from what is stored, including to sinks that can't be
+	// read back.
+	Overwrite bool `yaml:"overwrite"`
+}
+
+// SLOConfig is the objective slots are written against: Target of them
+// within Deadline of the slot ending, measured over Window.
+type SLOConfig struct {
+	Target   float64       `yaml:"target"`
+	Deadline time.Duration `yaml:"deadline"`
+	Window   time.Duration `yaml:"window"`
+}
+
+type AlertsConfig struct {
+	// Schedule is when the previous day is checked against its baselines.
+	// Empty disables.
+	Schedule string `yaml:"schedule"`
+	// Anomaly alerts when a day's kWh is unusually high or low.
+	Anomaly UsageAlertConfig `yaml:"anomaly"`
+	// Budget alerts when a day's cost is over its baseline.
+	Budget UsageAlertConfig `yaml:"budget"`
+	// TariffChange is the fraction by which Glow's unit rate or standing
+	// charge may change between cycles before alerting. Zero disables.
+	TariffChange float64 `yaml:"tariffChange"`
+	// TariffMismatch is the fraction by which Glow's unit rate or standing
+	// charge may differ from a configured tariff's before alerting, as
+	// Glow's is often stale after switching supplier. Zero disables.
+	TariffMismatch float64 `yaml:"tariffMismatch"`
+}
+
+type UsageAlertConfig struct {
+	// Baselines maps resource names to a baseline spec, as parsed by
+	// baseline.Parse. The "*" entry applies to unlisted resources.
+	Baselines map[string]string `yaml:"baselines" env:"perResource"`
+	// Threshold is the fraction by which a day may differ from its baseline
+	// before alerting.
+	Threshold float64 `yaml:"threshold"`
+}
+
+type ClockConfig struct {
+	// NTPServer is the reference the system clock is checked against before
+	// each write, e.g. pool.ntp.org. Empty (or "off") disables the check,
+	// which is the default since it needs outbound UDP port 123.
+	NTPServer string `yaml:"ntpServer"`
+	// MaxSkew is how far the system clock may drift before warning.
+	MaxSkew time.Duration `yaml:"maxSkew"`
+	// RefuseWrites skips writing points while the clock is skewed.
+	RefuseWrites bool `yaml:"refuseWrites"`
+}
+
+type NetworkConfig struct {
+	// Resolvers are DNS servers (host:port) to use instead of the system
+	// resolver. Retries rotate through them in order.
+	Resolvers []string `yaml:"resolvers"`
+	// DNSRetries is how many times a failed lookup is retried before the
+	// connection attempt fails.
+	DNSRetries int `yaml:"dnsRetries"`
+	// FallbackDelay is how long to wait for IPv6 before racing IPv4 (RFC 6555).
+	// Zero means Go's default of 300ms, and a negative value disables the
+	// race so that addresses are tried one at a time.
+	FallbackDelay time.Duration `yaml:"fallbackDelay"`
+}
+
+type ScrapeConfig struct {
+	// TimestampPrecision is what written timestamps are truncated to.
+	TimestampPrecision time.Duration `yaml:"timestampPrecision"`
+	// SlotAlign is whether readings are stamped as reported by Glow or at
+	// the start or end of their period. See slot.Alignment.
+	SlotAlign string `yaml:"slotAlign"`
+	// StartupDelay is how long to wait before the first cycle.
+	StartupDelay time.Duration `yaml:"startupDelay"`
+	// CatchupDelay is how long to wait before each catchup request.
+	CatchupDelay time.Duration `yaml:"catchupDelay"`
+	// ReadingsTimeout is the longest a cycle waits for the half hour just
+	// ended to be readable before reading what there is. Zero doesn't wait.
+	ReadingsTimeout time.Duration `yaml:"readingsTimeout"`
+	// CatchupJitter is the most random delay before requesting a resource's
+	// catchup at the half hour. Glow asks for up to 2 minutes.
+	CatchupJitter time.Duration `yaml:"catchupJitter"`
+	// CatchupRetries is how many times a failed catchup request is retried,
+	// with backoff, before the cycle carries on without it.
+	CatchupRetries int `yaml:"catchupRetries"`
+	// Concurrency is how many resources are scraped at once.
+	Concurrency int `yaml:"concurrency"`
+	// Jitter is the fraction by which delays are randomly lengthened or
+	// shortened.
+	Jitter float64 `yaml:"jitter"`
+	// Schedule is when cycles run, as parsed by schedule.Parse.
+	Schedule string `yaml:"schedule"`
+	// Lookback is how far before the latest reading each cycle re-reads, so
+	// that late-arriving DCC data is picked up.
+	Lookback time.Duration `yaml:"lookback"`
+	// CheckpointFile, if set, records the last reading written for each
+	// resource so that cycles and restarts read on from there rather than
+	// re-reading the whole Lookback. Corrections to earlier slots are then
+	// left to the recheck job.
+	CheckpointFile string `yaml:"checkpointFile"`
+	// MetricsFile, if set, keeps the counters and last success times across
+	// restarts, saved after every cycle. Unlike the checkpoints it isn't
+	// shared with a standby.
+	MetricsFile string `yaml:"metricsFile"`
+	// ChangefeedFile, if set, logs every write: which points went to which
+	// sink when, for /api/changefeed.
+	ChangefeedFile string `yaml:"changefeedFile"`
+	// DormantAfter is how long a resource can go without new readings before
+	// it is no longer scraped, e.g. after a supplier switch. It is checked
+	// again daily. Zero never gives up on a resource.
+	DormantAfter time.Duration `yaml:"dormantAfter"`
+	// GapRefetch is how long slots missing from Glow's readings, e.g. over a
+	// DCC outage, are re-fetched each cycle in case they are filled in.
+	// Zero disables.
+	GapRefetch time.Duration `yaml:"gapRefetch"`
+	// ProvisionalFor is how long after the latest reading slots are written
+	// to energy_usage_provisional, and only then to energy_usage, for
+	// consumers that can't tolerate points being rewritten. Zero writes
+	// every slot to energy_usage straight away.
+	ProvisionalFor time.Duration `yaml:"provisionalFor"`
+	// BackfillLimit is the most history a cold start reads without being
+	// confirmed, either at a prompt or with -allow-backfill. Zero allows any.
+	BackfillLimit time.Duration `yaml:"backfillLimit"`
+	// SkipStored drops points at or before the newest one each sink already
+	// stores for the resource, for sinks that can tell, rather than
+	// comparing the whole lookback. Revisions to those slots are then left
+	// to the recheck job.
+	SkipStored bool `yaml:"skipStored"`
+	// HouseholdTotals writes an energy_household point for each day,
+	// totalling every fuel's kWh and cost including standing charges.
+	HouseholdTotals bool `yaml:"householdTotals"`
+	// HealthPoints writes scraper_health points about each cycle.
+	HealthPoints bool `yaml:"healthPoints"`
+	// SinkTimeout bounds how long a cycle spends on each sink, which are
+	// written at once, so that one hanging doesn't hold up the cycle. Zero
+	// doesn't time out.
+	SinkTimeout time.Duration `yaml:"sinkTimeout"`
+	// SinkBuffer is the most points held in memory for each sink that fails
+	// to write, retried before its next write, so that a sink being down
+	// doesn't keep points from the others. Zero disables buffering. Until
+	// they are written, or saved by SinkBufferDir, the resource's checkpoint
+	// is held back, as a restart would lose them.
+	SinkBuffer int `yaml:"sinkBuffer"`
+	// SinkBufferDir keeps the buffered points on disk too, a file for each
+	// sink, so that they survive a restart and don't hold back checkpoints.
+	// It is read on start, so changing it takes a restart.
+	SinkBufferDir string `yaml:"sinkBufferDir"`
+}
+
+type GlowConfig struct {
+	Username string     `yaml:"username"`
+	Password string     `yaml:"password"`
+	HTTP     HTTPConfig `yaml:"http"`
+}
+
+type SinksConfig struct {
+	Influx     InfluxConfig     `yaml:"influx"`
+	Influx3    Influx3Config    `yaml:"influx3"`
+	MQTT       MQTTConfig       `yaml:"mqtt"`
+	Prometheus PrometheusConfig `yaml:"prometheus"`
+	SQLite     SQLiteConfig     `yaml:"sqlite"`
+	NDJSON     NDJSONConfig     `yaml:"ndjson"`
+	NATS       NATSConfig       `yaml:"nats"`
+	Graphite   GraphiteConfig   `yaml:"graphite"`
+	StatsD     StatsDConfig     `yaml:"statsd"`
+	OTLP       OTLPConfig       `yaml:"otlp"`
+	Sheets     SheetsConfig     `yaml:"sheets"`
+	Timestream TimestreamConfig `yaml:"timestream"`
+	BigQuery   BigQueryConfig   `yaml:"bigquery"`
+}
+
+// InfluxConfig is the influx sink, which is enabled by setting Host.
+type InfluxConfig struct {
+	Host   string `yaml:"host"`
+	Token  string `yaml:"token"`
+	Org    string `yaml:"org"`
+	Bucket string `yaml:"bucket"`
+	// Routes sends the named resources' points to another org or bucket,
+	// e.g. to keep properties apart. The token must be able to write to
+	// each.
+	Routes map[string]InfluxRoute `yaml:"routes"`
+	HTTP   HTTPConfig             `yaml:"http"`
+}
+
+// InfluxRoute is where a resource is written. Either may be empty for the
+// sink's Org or Bucket.
+type InfluxRoute struct {
+	Org    string `yaml:"org"`
+	Bucket string `yaml:"bucket"`
+}
+
+// Influx3Config is the InfluxDB 3 sink, which is enabled by setting Host.
+// Tags and fields are written as snake case columns, so that they can be
+// queried with SQL without quoting.
+type Influx3Config struct {
+	Host string `yaml:"host"`
+	// Token is a database token with write permission.
+	Token    string     `yaml:"token"`
+	Database string     `yaml:"database"`
+	HTTP     HTTPConfig `yaml:"http"`
+}
+
+// MQTTConfig is the MQTT sink, which is enabled by setting Broker. Each slot
+// is published, retained, to topics following Glow's classifiers, e.g.
+// energy/electricity/consumption/30m for kWh and
+// energy/electricity/consumption/cost/30m for pence.
+type MQTTConfig struct {
+	// Broker is the broker URL, e.g. "tcp://mosquitto:1883" or
+	// "ssl://broker.example.com:8883".
+	Broker   string `yaml:"broker"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// ClientID identifies the connection to the broker.
+	ClientID string `yaml:"clientID"`
+	// TopicPrefix is the root of the topics published to.
+	TopicPrefix string `yaml:"topicPrefix"`
+	// ReadingTopic, if set, is where each new slot is also published as a
+	// JSON object, with {resource} replaced by the resource's ID, e.g.
+	// "energy/{resource}/reading".
+	ReadingTopic string `yaml:"readingTopic"`
+	// TariffTopic, if set, is where each resource's tariff is published as a
+	// JSON object when it changes, with {resource} replaced as for
+	// ReadingTopic.
+	TariffTopic string `yaml:"tariffTopic"`
+	// QoS is the MQTT quality of service messages are published with: 0, 1
+	// or 2.
+	QoS int `yaml:"qos"`
+	// Retain publishes messages retained, so that clients connecting later
+	// get the latest.
+	Retain bool `yaml:"retain"`
+	// Discovery publishes Home Assistant discovery config for each
+	// resource's consumption, cost and tariff sensors, under
+	// DiscoveryPrefix. The sensors read the JSON topics, which default to
+	// under TopicPrefix if not set.
+	Discovery       bool   `yaml:"discovery"`
+	DiscoveryPrefix string `yaml:"discoveryPrefix"`
+}
+
+// PrometheusConfig is the Prometheus exporter, which is enabled by setting
+// Listen. It serves the latest slot and tariff of each resource as gauges at
+// /metrics, for Prometheus to scrape.
+type PrometheusConfig struct {
+	// Listen is the address to serve on, e.g. ":9469".
+	Listen string `yaml:"listen"`
+}
+
+// SQLiteConfig is the SQLite sink, which is enabled by setting Path. Points
+// are kept in one table, with a usage view of the half hour slots, so the
+// scraper is useful without a separate database server.
+type SQLiteConfig struct {
+	// Path is the database file, created if it doesn't exist.
+	Path string `yaml:"path"`
+}
+
+// NDJSONConfig is the NDJSON sink, which writes each point as a line of
+// JSON to stdout when Stdout is set.
+type NDJSONConfig struct {
+	Stdout bool `yaml:"stdout"`
+}
+
+// NATSConfig is the NATS JetStream sink, which is enabled by setting URL.
+// Each point is published as JSON to Subject.<measurement>.<resource>,
+// which a stream must capture, with a Nats-Msg-Id of its series and time so
+// that the stream drops a point published twice.
+type NATSConfig struct {
+	// URL is the server, e.g. "nats://nats:4222".
+	URL string `yaml:"url"`
+	// Subject is the prefix of the subjects published to.
+	Subject  string `yaml:"subject"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Token    string `yaml:"token"`
+	// CredentialsFile is a .creds file holding a user JWT and NKey seed.
+	CredentialsFile string `yaml:"credentialsFile"`
+}
+
+// GraphiteConfig is the Graphite sink, which is enabled by setting Address.
+// Each numeric field is sent in the plaintext protocol, e.g.
+// energy.energy_usage.electricity.30m.kwh.
+type GraphiteConfig struct {
+	// Address is the carbon receiver, e.g. "graphite:2003".
+	Address string `yaml:"address"`
+	// Protocol is tcp or udp.
+	Protocol string `yaml:"protocol"`
+	// Prefix is the first element of every metric's path.
+	Prefix string `yaml:"prefix"`
+}
+
+// StatsDConfig is the StatsD sink, which is enabled by setting Address.
+// Usage is counted as each new slot arrives, and the tariff is gauged.
+type StatsDConfig struct {
+	// Address is the StatsD or DogStatsD agent's UDP address, e.g.
+	// "localhost:8125".
+	Address string `yaml:"address"`
+	// Prefix is the first element of every metric's name.
+	Prefix string `yaml:"prefix"`
+	// Format is dogstatsd, which sends tags such as resource:electricity, or
+	// statsd, which puts their values in the name as Graphite does.
+	Format string `yaml:"format"`
+}
+
+// OTLPConfig is the OpenTelemetry sink, which is enabled by setting
+// Endpoint. Each numeric field is exported as a gauge, e.g.
+// energy_usage.kwh, stamped with its slot.
+type OTLPConfig struct {
+	// Endpoint is the collector's OTLP/HTTP base URL, e.g.
+	// "http://otel-collector:4318", to which /v1/metrics is added.
+	Endpoint string `yaml:"endpoint"`
+	// Headers are sent with every export, e.g. an API key.
+	Headers map[string]string `yaml:"headers" env:"headers"`
+	HTTP    HTTPConfig        `yaml:"http"`
+}
+
+// SheetsConfig is the Google Sheets sink, which is enabled by setting
+// SpreadsheetID. A row of each resource's kWh, cost and standing charge is
+// appended to Sheet for every complete day, for following spend in a
+// spreadsheet.
+type SheetsConfig struct {
+	// SpreadsheetID is the ID in the spreadsheet's URL, which must be shared
+	// with the service account as an editor.
+	SpreadsheetID string `yaml:"spreadsheetID"`
+	// Sheet is the name of the tab rows are appended to.
+	Sheet string `yaml:"sheet"`
+	// CredentialsFile is the service account's JSON key.
+	CredentialsFile string     `yaml:"credentialsFile"`
+	HTTP            HTTPConfig `yaml:"http"`
+}
+
+// TimestreamConfig is the Amazon Timestream sink, which is enabled by
+// setting Database. Each point is a multi-measure record named after its
+// measurement, with its tags as dimensions, and the table is created or
+// updated with the retention below. Credentials come from the AWS
+// credential chain.
+type TimestreamConfig struct {
+	// Database must already exist.
+	Database string `yaml:"database"`
+	Table    string `yaml:"table"`
+	Region   string `yaml:"region"`
+	// Endpoint is the ingest endpoint to use rather than discovering one,
+	// e.g. a VPC endpoint.
+	Endpoint string `yaml:"endpoint"`
+	// MemoryRetention is how long records are kept in the memory store, in
+	// whole hours, and MagneticRetention how long in the magnetic store
+	// after that, in whole days. Magnetic store writes are enabled, as the
+	// lookback rewrites slots older than the memory store keeps.
+	MemoryRetention   time.Duration `yaml:"memoryRetention"`
+	MagneticRetention time.Duration `yaml:"magneticRetention"`
+}
+
+// BigQueryConfig is the BigQuery sink, which is enabled by setting Dataset.
+// Points are streamed into Table, which is created partitioned by day, with
+// a column for each tag and field added as they appear. As the lookback
+// rewrites slots, Table holds every version of a corrected slot, and the
+// Table_latest view only the last.
+type BigQueryConfig struct {
+	// Project defaults to the service account's.
+	Project string `yaml:"project"`
+	// Dataset must already exist.
+	Dataset string `yaml:"dataset"`
+	Table   string `yaml:"table"`
+	// CredentialsFile is the JSON key of a service account with the BigQuery
+	// Data Editor role on the dataset.
+	CredentialsFile string     `yaml:"credentialsFile"`
+	HTTP            HTTPConfig `yaml:"http"`
+}
+
+// StandbyConfig is warm standby, which is enabled by setting LeaseFile. The
+// instance holding the lease scrapes and runs the scheduled jobs; the rest
+// follow its checkpoints and take over once the lease expires.
+type StandbyConfig struct {
+	// LeaseFile is where the lease is kept, on storage every instance
+	// shares along with the checkpoint file.
+	LeaseFile string `yaml:"leaseFile"`
+	// LeaseTTL is how long the lease lasts without being renewed, and so
+	// how soon a standby takes over from a primary that has stopped. It is
+	// renewed every third of that.
+	LeaseTTL time.Duration `yaml:"leaseTTL"`
+}
+
+// AdminConfig is the admin socket `energy-meter-scraper ctl` talks to.
+type AdminConfig struct {
+	// Socket is the Unix socket's path. Anyone who can connect to it has
+	// full control, so it is created readable only by the owner. Empty
+	// disables it.
+	Socket string `yaml:"socket"`
+}
+
+// HealthConfig is the liveness and readiness endpoints for orchestrators,
+// served without authentication on a listener of their own.
+type HealthConfig struct {
+	// Listen is the address /healthz and /readyz are served on. Empty
+	// disables them.
+	Listen string `yaml:"listen"`
+	// MaxAge is how recently a cycle must have succeeded for /readyz to
+	// report ready.
+	MaxAge time.Duration `yaml:"maxAge"`
+}
+
+// NotifyConfig is where alerts and digests are delivered, in addition to the
+// log.
+type NotifyConfig struct {
+	Matrix  MatrixConfig  `yaml:"matrix"`
+	Apprise AppriseConfig `yaml:"apprise"`
+}
+
+// AppriseConfig is the apprise notifier, which is enabled by setting URL.
+type AppriseConfig struct {
+	// URL is the Apprise API server, e.g. "http://apprise:8000".
+	URL string `yaml:"url"`
+	// Key names a configuration saved on the server. Without one, URLs are
+	// the Apprise service URLs to notify, e.g. "ntfy://energy".
+	Key  string   `yaml:"key"`
+	URLs []string `yaml:"urls"`
+	// Tag limits a saved configuration to the services with this tag.
+	Tag  string     `yaml:"tag"`
+	HTTP HTTPConfig `yaml:"http"`
+}
+
+// MatrixConfig is the matrix notifier, which is enabled by setting
+// Homeserver.
+type MatrixConfig struct {
+	Homeserver string `yaml:"homeserver"`
+	// Token is the access token of the account alerts are sent from.
+	Token string `yaml:"token"`
+	// Room is the room ID (not alias) to post in, e.g. "!abc123:matrix.org".
+	Room string     `yaml:"room"`
+	HTTP HTTPConfig `yaml:"http"`
+}
+
+// HTTPConfig controls how outbound connections are made.
+type HTTPConfig struct {
+	// Proxy is the URL of the proxy to use. If empty HTTPS_PROXY, HTTP_PROXY
+	// and NO_PROXY are respected.
+	Proxy string `yaml:"proxy"`
+	// CAFile is a PEM bundle of additional certificate authorities to trust.
+	CAFile string `yaml:"caFile"`
+	// CertFile and KeyFile are a PEM client certificate and key.
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// Timeout bounds each request, including reading the response. Zero is
+	// transport.DefaultTimeout.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+const DefaultGlowUsername = "daniel@danielzfranklin.org"
+
+func defaults() *Config {
+	return &Config{
+		Glow: GlowConfig{
+			Username: DefaultGlowUsername,
+		},
+		Resources: []Resource{
+			{
+				Name:          "electricity",
+				KWHResource:   "24e7909c-c997-4506-9201-a57bd213148d",
+				PenceResource: "cc4dbeca-e207-4618-95d2-bbddd120aa0b",
+			},
+			{
+				Name:          "gas",
+				KWHResource:   "5d594c77-f08a-4f6a-aac1-e086a5234b70",
+				PenceResource: "0cb3f9b9-749b-4e7f-a1e0-c1d437b2e057",
+			},
+		},
+		Scrape: ScrapeConfig{
+			StartupDelay:       15 * time.Second,
+			CatchupRetries:     3,
+			CatchupJitter:      2 * time.Minute,
+			ReadingsTimeout:    10 * time.Minute,
+			BackfillLimit:      31 * 24 * time.Hour,
+			DormantAfter:       60 * 24 * time.Hour,
+			GapRefetch:         7 * 24 * time.Hour,
+			HouseholdTotals:    true,
+			Concurrency:        4,
+			Jitter:             0.3,
+			Schedule:           "*/30 * * * *",
+			Lookback:           8 * 24 * time.Hour,
+			TimestampPrecision: time.Second,
+			SlotAlign:          "start",
+			SinkTimeout:        2 * time.Minute,
+			SinkBuffer:         100000,
+		},
+		Sinks: SinksConfig{
+			NATS: NATSConfig{
+				Subject: "energy",
+			},
+			Graphite: GraphiteConfig{
+				Protocol: "tcp",
+				Prefix:   "energy",
+			},
+			StatsD: StatsDConfig{
+				Prefix: "energy",
+				Format: "dogstatsd",
+			},
+			Sheets: SheetsConfig{
+				Sheet: "Daily",
+			},
+			Timestream: TimestreamConfig{
+				Table:             "energy",
+				MemoryRetention:   24 * time.Hour,
+				MagneticRetention: 10 * 365 * 24 * time.Hour,
+			},
+			BigQuery: BigQueryConfig{
+				Table: "energy",
+			},
+			MQTT: MQTTConfig{
+				ClientID:        "energy-meter-scraper",
+				TopicPrefix:     "energy",
+				QoS:             1,
+				Retain:          true,
+				DiscoveryPrefix: "homeassistant",
+			},
+		},
+		Network: NetworkConfig{
+			DNSRetries:    3,
+			FallbackDelay: 300 * time.Millisecond,
+		},
+		Clock: ClockConfig{
+			MaxSkew: time.Minute,
+		},
+		Timezone: "Europe/London",
+		LogLevel: "info",
+		CrossCheck: CrossCheckConfig{
+			Schedule:  "0 4 * * *",
+			Tolerance: 0.01,
+			Repair:    true,
+		},
+		Plugs: PlugsConfig{
+			ClientID: "energy-meter-scraper-plugs",
+		},
+		Heating: HeatingConfig{
+			MinKWh:      1,
+			MinDuration: time.Hour,
+			MaxGap:      30 * time.Minute,
+		},
+		Standby: StandbyConfig{
+			LeaseTTL: 2 * time.Minute,
+		},
+		Health: HealthConfig{
+			MaxAge: 90 * time.Minute,
+		},
+		SLO: SLOConfig{
+			Target:   0.99,
+			Deadline: 2 * time.Hour,
+			Window:   7 * 24 * time.Hour,
+		},
+		Recheck: RecheckConfig{
+			Schedule: "30 3 * * *",
+			Window:   14 * 24 * time.Hour,
+		},
+		Digest: DigestConfig{
+			Schedule: "0 7 * * *",
+		},
+		Split: SplitConfig{
+			Schedule: "0 8 1 * *",
+		},
+		Archive: ArchiveConfig{
+			Key:      "energy/resource={resource}/year={year}/month={month}/usage.parquet",
+			Schedule: "0 5 * * *",
+			Settle:   7 * 24 * time.Hour,
+			Months:   12,
+		},
+		Occupancy: OccupancyConfig{
+			AwayValues: []string{"away", "not_home", "holiday"},
+		},
+		Alerts: AlertsConfig{
+			Schedule:       "0 5 * * *",
+			TariffChange:   0.05,
+			TariffMismatch: 0.01,
+			Anomaly: UsageAlertConfig{
+				Baselines: map[string]string{"*": "weekday-median"},
+				Threshold: 0.5,
+			},
+			Budget: UsageAlertConfig{
+				Baselines: map[string]string{},
+			},
+		},
+	}
+}
+
+func Load() (*Config, error) {
+	return load(true)
+}
+
+// LoadPartial is Load without requiring settings, for commands such as
+// login that run before the config is complete.
+func LoadPartial() (*Config, error) {
+	return load(false)
+}
+
+func load(complete bool) (*Config, error) {
+	if err := loadDotEnv(); err != nil {
+		return nil, err
+	}
+
+	cfg := defaults()
+	if path := Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	l := &loader{prefix: EnvPrefix()}
+	l.applyPaths(cfg)
+	l.apply(cfg)
+	if complete {
+		l.validate(cfg)
+	}
+
+	if len(l.missing) > 0 {
+		return nil, fmt.Errorf("missing required settings: %s", strings.Join(l.missing, ", "))
+	}
+	if len(l.errs) > 0 {
+		return nil, errors.Join(l.errs...)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadDotEnv sets variables from the file named by ENV_FILE, or from .env in
+// the working directory if it exists. Variables already in the environment
+// take precedence. ENV_FILE is read before any file is loaded, so it and the
+// ENV_PREFIX applied to it have to come from the real environment; an
+// ENV_PREFIX set in the file applies to every other variable.
+func loadDotEnv() error {
+	path := Getenv("ENV_FILE")
+	required := path != ""
+	if !required {
+		path = ".env"
+	}
+
+	f, openErr := os.Open(path)
+	if openErr != nil {
+		if !required && errors.Is(openErr, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("env file: %w", openErr)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNo)
+		}
+		key = strings.TrimSpace(key)
+		val = strings.TrimSpace(val)
+
+		switch {
+		case strings.HasPrefix(val, `"`):
+			unquoted, unquoteErr := strconv.Unquote(val)
+			if unquoteErr != nil {
+				return fmt.Errorf("%s:%d: invalid quoted value", path, lineNo)
+			}
+			val = unquoted
+		case strings.HasPrefix(val, "'"):
+			if len(val) < 2 || !strings.HasSuffix(val, "'") {
+				return fmt.Errorf("%s:%d: invalid quoted value", path, lineNo)
+			}
+			val = val[1 : len(val)-1]
+		default:
+			if comment := strings.Index(val, " #"); comment >= 0 {
+				val = strings.TrimSpace(val[:comment])
+			}
+		}
+
+		if _, exists := os.LookupEnv(key); exists {
+			continue
+		}
+		if err := os.Setenv(key, val); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
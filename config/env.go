@@ -0,0 +1,733 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type loader struct {
+	// prefix is the EnvPrefix, applied to every key read.
+	prefix  string
+	missing []string
+	errs    []error
+	// read are the values getenv has returned, by key, so that a variable
+	// read by both applyPaths and apply has its secret resolved once.
+	read map[string]string
+}
+
+// apply overrides cfg with any settings present in the environment.
+func (l *loader) apply(cfg *Config) {
+	cfg.Glow.Username = l.optional("GLOW_USERNAME", cfg.Glow.Username)
+	cfg.Glow.Password = l.glowPassword(cfg.Glow.Username, cfg.Glow.Password)
+	cfg.Glow.HTTP = l.http("GLOW", cfg.Glow.HTTP)
+
+	influx := &cfg.Sinks.Influx
+	influx.Host = l.optional("INFLUX_HOST", influx.Host)
+	influx.Token = l.secret("INFLUX_TOKEN", influx.Token)
+	influx.Org = l.optional("INFLUX_ORG", influx.Org)
+	influx.Bucket = l.optional("INFLUX_BUCKET", influx.Bucket)
+	influx.Routes = l.influxRoutes(influx.Routes)
+	influx.HTTP = l.http("INFLUX", influx.HTTP)
+
+	influx3 := &cfg.Sinks.Influx3
+	influx3.Host = l.optional("INFLUX3_HOST", influx3.Host)
+	influx3.Token = l.secret("INFLUX3_TOKEN", influx3.Token)
+	influx3.Database = l.optional("INFLUX3_DATABASE", influx3.Database)
+	influx3.HTTP = l.http("INFLUX3", influx3.HTTP)
+
+	mqtt := &cfg.Sinks.MQTT
+	mqtt.Broker = l.optional("MQTT_BROKER", mqtt.Broker)
+	mqtt.Username = l.optional("MQTT_USERNAME", mqtt.Username)
+	mqtt.Password = l.secret("MQTT_PASSWORD", mqtt.Password)
+	mqtt.ClientID = l.optional("MQTT_CLIENT_ID", mqtt.ClientID)
+	mqtt.TopicPrefix = l.optional("MQTT_TOPIC_PREFIX", mqtt.TopicPrefix)
+	mqtt.ReadingTopic = l.optional("MQTT_READING_TOPIC", mqtt.ReadingTopic)
+	mqtt.TariffTopic = l.optional("MQTT_TARIFF_TOPIC", mqtt.TariffTopic)
+	mqtt.QoS = l.int("MQTT_QOS", mqtt.QoS)
+	mqtt.Retain = l.bool("MQTT_RETAIN", mqtt.Retain)
+	mqtt.Discovery = l.bool("MQTT_DISCOVERY", mqtt.Discovery)
+	mqtt.DiscoveryPrefix = l.optional("MQTT_DISCOVERY_PREFIX", mqtt.DiscoveryPrefix)
+
+	cfg.Sinks.Prometheus.Listen = l.optional("PROMETHEUS_LISTEN", cfg.Sinks.Prometheus.Listen)
+	cfg.Sinks.SQLite.Path = l.optional("SQLITE_PATH", cfg.Sinks.SQLite.Path)
+	cfg.Sinks.NDJSON.Stdout = l.bool("NDJSON_STDOUT", cfg.Sinks.NDJSON.Stdout)
+
+	natsCfg := &cfg.Sinks.NATS
+	natsCfg.URL = l.optional("NATS_URL", natsCfg.URL)
+	natsCfg.Subject = l.optional("NATS_SUBJECT", natsCfg.Subject)
+	natsCfg.Username = l.optional("NATS_USERNAME", natsCfg.Username)
+	natsCfg.Password = l.secret("NATS_PASSWORD", natsCfg.Password)
+	natsCfg.Token = l.secret("NATS_TOKEN", natsCfg.Token)
+	natsCfg.CredentialsFile = l.optional("NATS_CREDENTIALS_FILE", natsCfg.CredentialsFile)
+
+	graphite := &cfg.Sinks.Graphite
+	graphite.Address = l.optional("GRAPHITE_ADDRESS", graphite.Address)
+	graphite.Protocol = l.optional("GRAPHITE_PROTOCOL", graphite.Protocol)
+	graphite.Prefix = l.optional("GRAPHITE_PREFIX", graphite.Prefix)
+	statsd := &cfg.Sinks.StatsD
+	statsd.Address = l.optional("STATSD_ADDRESS", statsd.Address)
+	statsd.Prefix = l.optional("STATSD_PREFIX", statsd.Prefix)
+	statsd.Format = l.optional("STATSD_FORMAT", statsd.Format)
+	otlp := &cfg.Sinks.OTLP
+	otlp.Endpoint = l.optional("OTLP_ENDPOINT", otlp.Endpoint)
+	otlp.Headers = l.headers("OTLP_HEADERS", otlp.Headers)
+	otlp.HTTP = l.http("OTLP", otlp.HTTP)
+	sheets := &cfg.Sinks.Sheets
+	sheets.SpreadsheetID = l.optional("SHEETS_SPREADSHEET_ID", sheets.SpreadsheetID)
+	sheets.Sheet = l.optional("SHEETS_SHEET", sheets.Sheet)
+	sheets.CredentialsFile = l.optional("SHEETS_CREDENTIALS_FILE", sheets.CredentialsFile)
+	sheets.HTTP = l.http("SHEETS", sheets.HTTP)
+	timestream := &cfg.Sinks.Timestream
+	timestream.Database = l.optional("TIMESTREAM_DATABASE", timestream.Database)
+	timestream.Table = l.optional("TIMESTREAM_TABLE", timestream.Table)
+	timestream.Region = l.optional("TIMESTREAM_REGION", timestream.Region)
+	timestream.Endpoint = l.optional("TIMESTREAM_ENDPOINT", timestream.Endpoint)
+	timestream.MemoryRetention = l.duration("TIMESTREAM_MEMORY_RETENTION", timestream.MemoryRetention)
+	timestream.MagneticRetention = l.duration("TIMESTREAM_MAGNETIC_RETENTION", timestream.MagneticRetention)
+	bigquery := &cfg.Sinks.BigQuery
+	bigquery.Project = l.optional("BIGQUERY_PROJECT", bigquery.Project)
+	bigquery.Dataset = l.optional("BIGQUERY_DATASET", bigquery.Dataset)
+	bigquery.Table = l.optional("BIGQUERY_TABLE", bigquery.Table)
+	bigquery.CredentialsFile = l.optional("BIGQUERY_CREDENTIALS_FILE", bigquery.CredentialsFile)
+	bigquery.HTTP = l.http("BIGQUERY", bigquery.HTTP)
+
+	matrix := &cfg.Notify.Matrix
+	matrix.Homeserver = l.optional("MATRIX_HOMESERVER", matrix.Homeserver)
+	matrix.Token = l.secret("MATRIX_TOKEN", matrix.Token)
+	matrix.Room = l.optional("MATRIX_ROOM", matrix.Room)
+	matrix.HTTP = l.http("MATRIX", matrix.HTTP)
+
+	apprise := &cfg.Notify.Apprise
+	apprise.URL = l.optional("APPRISE_URL", apprise.URL)
+	apprise.Key = l.optional("APPRISE_KEY", apprise.Key)
+	apprise.URLs = l.list("APPRISE_URLS", apprise.URLs)
+	apprise.Tag = l.optional("APPRISE_TAG", apprise.Tag)
+	apprise.HTTP = l.http("APPRISE", apprise.HTTP)
+
+	scrape := &cfg.Scrape
+	scrape.StartupDelay = l.duration("STARTUP_DELAY", scrape.StartupDelay)
+	scrape.CatchupDelay = l.duration("CATCHUP_DELAY", scrape.CatchupDelay)
+	scrape.CatchupRetries = l.int("CATCHUP_RETRIES", scrape.CatchupRetries)
+	scrape.CatchupJitter = l.duration("CATCHUP_JITTER", scrape.CatchupJitter)
+	scrape.ReadingsTimeout = l.duration("READINGS_TIMEOUT", scrape.ReadingsTimeout)
+	scrape.Concurrency = l.int("CONCURRENCY", scrape.Concurrency)
+	scrape.Jitter = l.fraction("JITTER", scrape.Jitter)
+	scrape.Schedule = l.optional("SCHEDULE", scrape.Schedule)
+	scrape.Lookback = l.duration("LOOKBACK", scrape.Lookback)
+	scrape.CheckpointFile = l.optional("CHECKPOINT_FILE", scrape.CheckpointFile)
+	scrape.MetricsFile = l.optional("METRICS_FILE", scrape.MetricsFile)
+	scrape.ChangefeedFile = l.optional("CHANGEFEED_FILE", scrape.ChangefeedFile)
+	scrape.TimestampPrecision = l.duration("TIMESTAMP_PRECISION", scrape.TimestampPrecision)
+	scrape.HealthPoints = l.bool("HEALTH_POINTS", scrape.HealthPoints)
+	scrape.SkipStored = l.bool("SKIP_STORED", scrape.SkipStored)
+	scrape.BackfillLimit = l.duration("BACKFILL_LIMIT", scrape.BackfillLimit)
+	scrape.DormantAfter = l.duration("DORMANT_AFTER", scrape.DormantAfter)
+	scrape.GapRefetch = l.duration("GAP_REFETCH", scrape.GapRefetch)
+	scrape.ProvisionalFor = l.duration("PROVISIONAL_FOR", scrape.ProvisionalFor)
+	scrape.HouseholdTotals = l.bool("HOUSEHOLD_TOTALS", scrape.HouseholdTotals)
+	scrape.SinkTimeout = l.duration("SINK_TIMEOUT", scrape.SinkTimeout)
+	scrape.SinkBuffer = l.int("SINK_BUFFER", scrape.SinkBuffer)
+	scrape.SinkBufferDir = l.optional("SINK_BUFFER_DIR", scrape.SinkBufferDir)
+	scrape.SlotAlign = l.oneOf("SLOT_ALIGN", scrape.SlotAlign, "reported", "start", "end")
+
+	network := &cfg.Network
+	network.Resolvers = l.list("DNS_RESOLVERS", network.Resolvers)
+	network.DNSRetries = l.int("DNS_RETRIES", network.DNSRetries)
+	network.FallbackDelay = l.signedDuration("HAPPY_EYEBALLS_DELAY", network.FallbackDelay)
+
+	clock := &cfg.Clock
+	clock.NTPServer = l.optionalOff("NTP_SERVER", clock.NTPServer)
+	clock.MaxSkew = l.duration("NTP_MAX_SKEW", clock.MaxSkew)
+	clock.RefuseWrites = l.bool("NTP_REFUSE_WRITES", clock.RefuseWrites)
+
+	cfg.Timezone = l.optional("TIMEZONE", cfg.Timezone)
+	cfg.LogLevel = l.oneOf("LOG_LEVEL", cfg.LogLevel, "debug", "info", "warn", "error")
+
+	crossCheck := &cfg.CrossCheck
+	crossCheck.Schedule = l.optionalOff("CROSSCHECK_SCHEDULE", crossCheck.Schedule)
+	crossCheck.Tolerance = l.fraction("CROSSCHECK_TOLERANCE", crossCheck.Tolerance)
+	crossCheck.Repair = l.bool("CROSSCHECK_REPAIR", crossCheck.Repair)
+
+	recheck := &cfg.Recheck
+	recheck.Schedule = l.optionalOff("RECHECK_SCHEDULE", recheck.Schedule)
+	recheck.Window = l.duration("RECHECK_WINDOW", recheck.Window)
+	recheck.Overwrite = l.bool("RECHECK_OVERWRITE", recheck.Overwrite)
+
+	slo := &cfg.SLO
+	slo.Target = l.fraction("SLO_TARGET", slo.Target)
+	slo.Deadline = l.duration("SLO_DEADLINE", slo.Deadline)
+	slo.Window = l.duration("SLO_WINDOW", slo.Window)
+
+	standby := &cfg.Standby
+	standby.LeaseFile = l.optional("STANDBY_LEASE_FILE", standby.LeaseFile)
+	standby.LeaseTTL = l.duration("STANDBY_LEASE_TTL", standby.LeaseTTL)
+
+	cfg.Admin.Socket = l.optional("ADMIN_SOCKET", cfg.Admin.Socket)
+
+	cfg.Health.Listen = l.optional("HEALTH_LISTEN", cfg.Health.Listen)
+	cfg.Health.MaxAge = l.duration("HEALTH_MAX_AGE", cfg.Health.MaxAge)
+
+	alerts := &cfg.Alerts
+	alerts.Schedule = l.optionalOff("ALERTS_SCHEDULE", alerts.Schedule)
+	alerts.Anomaly.Baselines = l.perResource("ANOMALY_BASELINE", alerts.Anomaly.Baselines)
+	alerts.Anomaly.Threshold = l.float("ANOMALY_THRESHOLD", alerts.Anomaly.Threshold)
+	alerts.Budget.Baselines = l.perResource("BUDGET_BASELINE", alerts.Budget.Baselines)
+	alerts.Budget.Threshold = l.float("BUDGET_THRESHOLD", alerts.Budget.Threshold)
+	alerts.TariffChange = l.float("TARIFF_CHANGE_THRESHOLD", alerts.TariffChange)
+	alerts.TariffMismatch = l.float("TARIFF_MISMATCH_THRESHOLD", alerts.TariffMismatch)
+
+	cfg.Digest.Schedule = l.optionalOff("DIGEST_SCHEDULE", cfg.Digest.Schedule)
+
+	cfg.Split.Schedule = l.optionalOff("SPLIT_SCHEDULE", cfg.Split.Schedule)
+
+	server := &cfg.Server
+	server.Listen = l.optional("SERVER_LISTEN", server.Listen)
+	server.Token = l.secret("SERVER_TOKEN", server.Token)
+	server.ShareSecret = l.secret("SERVER_SHARE_SECRET", server.ShareSecret)
+	server.PublicURL = l.optional("SERVER_PUBLIC_URL", server.PublicURL)
+
+	heating := &cfg.Heating
+	heating.Enabled = l.bool("HEATING_INFERENCE", heating.Enabled)
+	heating.MinKWh = l.float("HEATING_MIN_KWH", heating.MinKWh)
+	heating.MinDuration = l.duration("HEATING_MIN_DURATION", heating.MinDuration)
+	heating.MaxGap = l.duration("HEATING_MAX_GAP", heating.MaxGap)
+
+	plugs := &cfg.Plugs
+	plugs.Broker = l.optional("PLUGS_BROKER", plugs.Broker)
+	plugs.Username = l.optional("PLUGS_USERNAME", plugs.Username)
+	plugs.Password = l.secret("PLUGS_PASSWORD", plugs.Password)
+	plugs.ClientID = l.optional("PLUGS_CLIENT_ID", plugs.ClientID)
+	plugs.Resource = l.optional("PLUGS_RESOURCE", plugs.Resource)
+
+	archive := &cfg.Archive
+	archive.Bucket = l.optional("ARCHIVE_BUCKET", archive.Bucket)
+	archive.Endpoint = l.optional("ARCHIVE_ENDPOINT", archive.Endpoint)
+	archive.Region = l.optional("ARCHIVE_REGION", archive.Region)
+	archive.AccessKeyID = l.optional("ARCHIVE_ACCESS_KEY_ID", archive.AccessKeyID)
+	archive.SecretAccessKey = l.secret("ARCHIVE_SECRET_ACCESS_KEY", archive.SecretAccessKey)
+	archive.Key = l.optional("ARCHIVE_KEY", archive.Key)
+	archive.Schedule = l.optionalOff("ARCHIVE_SCHEDULE", archive.Schedule)
+	archive.Settle = l.duration("ARCHIVE_SETTLE", archive.Settle)
+	archive.Months = l.int("ARCHIVE_MONTHS", archive.Months)
+
+	occupancy := &cfg.Occupancy
+	occupancy.File = l.optional("OCCUPANCY_FILE", occupancy.File)
+	occupancy.URL = l.optional("OCCUPANCY_URL", occupancy.URL)
+	occupancy.Token = l.secret("OCCUPANCY_TOKEN", occupancy.Token)
+	occupancy.AwayValues = l.list("OCCUPANCY_AWAY_VALUES", occupancy.AwayValues)
+}
+
+// validate checks settings that may have come from either the file or the
+// environment.
+func (l *loader) validate(cfg *Config) {
+	if cfg.Glow.Password == "" {
+		l.missing = append(l.missing, "GLOW_PASSWORD")
+	}
+
+	if influx := cfg.Sinks.Influx; influx.Host != "" {
+		for key, val := range map[string]string{"INFLUX_TOKEN": influx.Token, "INFLUX_ORG": influx.Org, "INFLUX_BUCKET": influx.Bucket} {
+			if val == "" {
+				l.missing = append(l.missing, key)
+			}
+		}
+		slices.Sort(l.missing)
+	}
+
+	if influx3 := cfg.Sinks.Influx3; influx3.Host != "" {
+		for key, val := range map[string]string{"INFLUX3_TOKEN": influx3.Token, "INFLUX3_DATABASE": influx3.Database} {
+			if val == "" {
+				l.missing = append(l.missing, key)
+			}
+		}
+		slices.Sort(l.missing)
+	}
+
+	if _, err := time.LoadLocation(cfg.Timezone); err != nil || cfg.Timezone == "" {
+		l.errs = append(l.errs, fmt.Errorf("TIMEZONE: unknown zone %q", cfg.Timezone))
+	}
+
+	if apprise := cfg.Notify.Apprise; apprise.URL != "" && apprise.Key == "" && len(apprise.URLs) == 0 {
+		l.errs = append(l.errs, fmt.Errorf("APPRISE_URL needs APPRISE_KEY or APPRISE_URLS"))
+	}
+
+	if matrix := cfg.Notify.Matrix; matrix.Homeserver != "" {
+		for key, val := range map[string]string{"MATRIX_TOKEN": matrix.Token, "MATRIX_ROOM": matrix.Room} {
+			if val == "" {
+				l.missing = append(l.missing, key)
+			}
+		}
+		slices.Sort(l.missing)
+	}
+
+	for name, httpCfg := range map[string]HTTPConfig{"GLOW": cfg.Glow.HTTP, "INFLUX": cfg.Sinks.Influx.HTTP, "INFLUX3": cfg.Sinks.Influx3.HTTP, "OTLP": cfg.Sinks.OTLP.HTTP, "SHEETS": cfg.Sinks.Sheets.HTTP, "BIGQUERY": cfg.Sinks.BigQuery.HTTP, "MATRIX": cfg.Notify.Matrix.HTTP, "APPRISE": cfg.Notify.Apprise.HTTP} {
+		if (httpCfg.CertFile == "") != (httpCfg.KeyFile == "") {
+			l.errs = append(l.errs, fmt.Errorf("%s_CERT_FILE and %s_KEY_FILE must be set together", name, name))
+		}
+	}
+
+	if server := cfg.Server; server.Listen != "" && server.Token == "" {
+		if server.ShareSecret != "" {
+			l.errs = append(l.errs, fmt.Errorf("SERVER_TOKEN must be set to use SERVER_SHARE_SECRET"))
+		} else if !IsLoopback(server.Listen) {
+			l.errs = append(l.errs, fmt.Errorf("SERVER_TOKEN must be set unless SERVER_LISTEN is a loopback address"))
+		}
+	}
+
+	if health := cfg.Health; health.Listen != "" && health.MaxAge <= 0 {
+		l.errs = append(l.errs, fmt.Errorf("HEALTH_MAX_AGE must be positive"))
+	}
+	if health := cfg.Health; health.Listen != "" && health.Listen == cfg.Server.Listen {
+		l.errs = append(l.errs, fmt.Errorf("HEALTH_LISTEN and SERVER_LISTEN must be different addresses"))
+	}
+
+	if natsCfg := cfg.Sinks.NATS; natsCfg.URL != "" && (natsCfg.Subject == "" || strings.ContainsAny(natsCfg.Subject, "*> ")) {
+		l.errs = append(l.errs, fmt.Errorf("NATS_SUBJECT must be a subject without wildcards"))
+	}
+
+	if graphite := cfg.Sinks.Graphite; graphite.Address != "" && graphite.Protocol != "tcp" && graphite.Protocol != "udp" {
+		l.errs = append(l.errs, fmt.Errorf("GRAPHITE_PROTOCOL must be tcp or udp"))
+	}
+	if statsd := cfg.Sinks.StatsD; statsd.Address != "" && statsd.Format != "dogstatsd" && statsd.Format != "statsd" {
+		l.errs = append(l.errs, fmt.Errorf("STATSD_FORMAT must be dogstatsd or statsd"))
+	}
+
+	if sheets := cfg.Sinks.Sheets; sheets.SpreadsheetID != "" {
+		if sheets.CredentialsFile == "" {
+			l.missing = append(l.missing, "SHEETS_CREDENTIALS_FILE")
+		}
+		if sheets.Sheet == "" || strings.ContainsAny(sheets.Sheet, "'!") {
+			l.errs = append(l.errs, fmt.Errorf("SHEETS_SHEET must be a sheet name without quotes or exclamation marks"))
+		}
+	}
+
+	// Timestream's limits are 1 hour to 1 year in memory and 1 day to 200
+	// years on magnetic storage
+	if timestream := cfg.Sinks.Timestream; timestream.Database != "" {
+		if memory := timestream.MemoryRetention; memory < time.Hour || memory > 8766*time.Hour || memory%time.Hour != 0 {
+			l.errs = append(l.errs, fmt.Errorf("TIMESTREAM_MEMORY_RETENTION must be whole hours from 1h to 8766h"))
+		}
+		if magnetic := timestream.MagneticRetention; magnetic < 24*time.Hour || magnetic > 73000*24*time.Hour || magnetic%(24*time.Hour) != 0 {
+			l.errs = append(l.errs, fmt.Errorf("TIMESTREAM_MAGNETIC_RETENTION must be whole days from 24h to 73000 days"))
+		}
+		if timestream.Table == "" {
+			l.missing = append(l.missing, "TIMESTREAM_TABLE")
+		}
+	}
+
+	if bigquery := cfg.Sinks.BigQuery; bigquery.Dataset != "" {
+		if bigquery.CredentialsFile == "" {
+			l.missing = append(l.missing, "BIGQUERY_CREDENTIALS_FILE")
+		}
+		if !isBigQueryName(bigquery.Dataset) || !isBigQueryName(bigquery.Table) {
+			l.errs = append(l.errs, fmt.Errorf("BIGQUERY_DATASET and BIGQUERY_TABLE must be letters, digits and underscores"))
+		}
+	}
+
+	if qos := cfg.Sinks.MQTT.QoS; qos < 0 || qos > 2 {
+		l.errs = append(l.errs, fmt.Errorf("MQTT_QOS must be 0, 1 or 2"))
+	}
+
+	if cfg.Scrape.Concurrency < 1 {
+		l.errs = append(l.errs, fmt.Errorf("CONCURRENCY must be at least 1"))
+	}
+	if heating := cfg.Heating; heating.Enabled {
+		if heating.MinKWh <= 0 {
+			l.errs = append(l.errs, fmt.Errorf("HEATING_MIN_KWH must be positive"))
+		}
+		if heating.MinDuration < 0 || heating.MaxGap < 0 {
+			l.errs = append(l.errs, fmt.Errorf("HEATING_MIN_DURATION and HEATING_MAX_GAP must not be negative"))
+		}
+	}
+	if standby := cfg.Standby; standby.LeaseFile != "" {
+		if cfg.Scrape.CheckpointFile == "" {
+			l.errs = append(l.errs, fmt.Errorf("CHECKPOINT_FILE must be set to use STANDBY_LEASE_FILE"))
+		}
+		if standby.LeaseTTL <= 0 {
+			l.errs = append(l.errs, fmt.Errorf("STANDBY_LEASE_TTL must be positive"))
+		}
+	}
+	if archive := cfg.Archive; archive.Bucket != "" {
+		for _, placeholder := range []string{"{resource}", "{year}", "{month}"} {
+			if !strings.Contains(archive.Key, placeholder) {
+				l.errs = append(l.errs, fmt.Errorf("ARCHIVE_KEY must contain %s, so that every month is its own object", placeholder))
+			}
+		}
+		if archive.Months < 1 || archive.Settle < 0 {
+			l.errs = append(l.errs, fmt.Errorf("ARCHIVE_MONTHS must be positive and ARCHIVE_SETTLE must not be negative"))
+		}
+		if (archive.AccessKeyID == "") != (archive.SecretAccessKey == "") {
+			l.errs = append(l.errs, fmt.Errorf("ARCHIVE_ACCESS_KEY_ID and ARCHIVE_SECRET_ACCESS_KEY must be set together"))
+		}
+	}
+	if cfg.Alerts.TariffChange < 0 || cfg.Alerts.TariffMismatch < 0 {
+		l.errs = append(l.errs, fmt.Errorf("TARIFF_CHANGE_THRESHOLD and TARIFF_MISMATCH_THRESHOLD must not be negative"))
+	}
+	if cfg.Scrape.MetricsFile != "" && cfg.Scrape.MetricsFile == cfg.Scrape.CheckpointFile {
+		l.errs = append(l.errs, fmt.Errorf("METRICS_FILE and CHECKPOINT_FILE must be different files"))
+	}
+	if cfg.Scrape.SinkTimeout < 0 || cfg.Scrape.SinkBuffer < 0 {
+		l.errs = append(l.errs, fmt.Errorf("SINK_TIMEOUT and SINK_BUFFER must not be negative"))
+	}
+	if cfg.Scrape.ProvisionalFor < 0 {
+		l.errs = append(l.errs, fmt.Errorf("PROVISIONAL_FOR must not be negative"))
+	}
+
+	if len(cfg.Resources) == 0 {
+		l.errs = append(l.errs, fmt.Errorf("no resources configured"))
+	}
+	seen := map[string]bool{}
+	for _, r := range cfg.Resources {
+		if r.Name == "" || r.KWHResource == "" || r.PenceResource == "" {
+			l.errs = append(l.errs, fmt.Errorf("resource %q: name, kwh and pence are required", r.Name))
+		}
+		if r.Fuel != "" && r.Fuel != "electricity" && r.Fuel != "gas" {
+			l.errs = append(l.errs, fmt.Errorf("resource %q: fuel must be electricity or gas", r.Name))
+		}
+		if seen[r.Name] {
+			l.errs = append(l.errs, fmt.Errorf("resource %q is configured twice", r.Name))
+		}
+		seen[r.Name] = true
+	}
+
+	for _, resource := range slices.Sorted(maps.Keys(cfg.Sinks.Influx.Routes)) {
+		if !seen[resource] {
+			l.errs = append(l.errs, fmt.Errorf("influx routes: no resource named %q", resource))
+		}
+	}
+
+	if plugs := cfg.Plugs; plugs.Broker != "" {
+		if !slices.ContainsFunc(cfg.Resources, func(r Resource) bool { return r.Name == plugs.Resource && r.IsElectricity() }) {
+			l.errs = append(l.errs, fmt.Errorf("PLUGS_RESOURCE: no electricity resource named %q", plugs.Resource))
+		}
+		if len(plugs.Plugs) == 0 {
+			l.errs = append(l.errs, fmt.Errorf("plugs: no plugs configured"))
+		}
+		names := map[string]bool{}
+		for _, p := range plugs.Plugs {
+			if p.Name == "" || p.Topic == "" {
+				l.errs = append(l.errs, fmt.Errorf("plug %q: name and topic are required", p.Name))
+			}
+			if p.Format != "tasmota" && p.Format != "shelly" {
+				l.errs = append(l.errs, fmt.Errorf("plug %q: format must be tasmota or shelly", p.Name))
+			}
+			if names[p.Name] {
+				l.errs = append(l.errs, fmt.Errorf("plug %q is configured twice", p.Name))
+			}
+			names[p.Name] = true
+		}
+	}
+
+	// Two resources an integration can't tell apart would share a series
+	integrations := map[string]bool{}
+	for resource, ids := range cfg.IDs {
+		if !seen[resource] {
+			l.errs = append(l.errs, fmt.Errorf("ids: no resource named %q", resource))
+		}
+		for integration, id := range ids {
+			integrations[integration] = true
+			if id == "" {
+				l.errs = append(l.errs, fmt.Errorf("ids: %s: empty %s id", resource, integration))
+			}
+		}
+	}
+	for _, integration := range slices.Sorted(maps.Keys(integrations)) {
+		named := map[string]string{}
+		for _, r := range cfg.Resources {
+			id := r.Name
+			if mapped, ok := cfg.IDs[r.Name][integration]; ok {
+				id = mapped
+			}
+			if other, clash := named[id]; clash {
+				l.errs = append(l.errs, fmt.Errorf("ids: %s and %s are both %q in %s", other, r.Name, id, integration))
+			}
+			named[id] = r.Name
+		}
+	}
+
+	// "off" clears the optional schedules whether it came from the file or
+	// the environment
+	for _, s := range []*string{&cfg.Clock.NTPServer, &cfg.CrossCheck.Schedule, &cfg.Recheck.Schedule, &cfg.Alerts.Schedule, &cfg.Digest.Schedule, &cfg.Split.Schedule, &cfg.Archive.Schedule} {
+		if *s == "off" {
+			*s = ""
+		}
+	}
+}
+
+// IsLoopback reports whether addr, a host:port, only listens locally.
+func IsLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isBigQueryName is whether name can be a dataset or table without quoting.
+func isBigQueryName(name string) bool {
+	return name != "" && strings.Trim(name, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_") == ""
+}
+
+// getenv reads key from the environment, or if unset from the file named by
+// key_FILE, as is conventional for Docker and Kubernetes secrets. Values that
+// are secret references are resolved (see RegisterSecretResolver).
+func (l *loader) getenv(key string) string {
+	key = l.prefix + key
+	if val, ok := l.read[key]; ok {
+		return val
+	}
+	val := l.readEnv(key)
+	if l.read == nil {
+		l.read = map[string]string{}
+	}
+	l.read[key] = val
+	return val
+}
+
+func (l *loader) readEnv(key string) string {
+	val := os.Getenv(key)
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return l.resolveSecret(key, val)
+	}
+	if val != "" {
+		l.errs = append(l.errs, fmt.Errorf("%s and %s_FILE are both set", key, key))
+		return val
+	}
+
+	contents, readErr := os.ReadFile(path)
+	if readErr != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s_FILE: %w", key, readErr))
+		return ""
+	}
+	return l.resolveSecret(key, strings.TrimRight(string(contents), "\r\n"))
+}
+
+func (l *loader) optional(key string, fallback string) string {
+	val := l.getenv(key)
+	if val == "" {
+		return fallback
+	}
+	return val
+}
+
+// secret is optional, but also resolves a secret reference in the fallback
+// (which came from the config file).
+func (l *loader) secret(key string, fallback string) string {
+	if val := l.getenv(key); val != "" {
+		return val
+	}
+	return l.resolveSecret(key, fallback)
+}
+
+// optionalOff is optional but lets the value "off" clear the default.
+func (l *loader) optionalOff(key string, fallback string) string {
+	val := l.optional(key, fallback)
+	if val == "off" {
+		return ""
+	}
+	return val
+}
+
+func (l *loader) oneOf(key string, fallback string, options ...string) string {
+	val := l.optional(key, fallback)
+	if !slices.Contains(options, val) {
+		l.errs = append(l.errs, fmt.Errorf("%s: must be one of %s", key, strings.Join(options, ", ")))
+		return fallback
+	}
+	return val
+}
+
+// perResource reads either a single value applying to every resource, or a
+// list of resource=value pairs such as "electricity=fixed:8,gas=seasonal".
+func (l *loader) perResource(key string, fallback map[string]string) map[string]string {
+	val := l.getenv(key)
+	if val == "" {
+		return fallback
+	}
+
+	out := map[string]string{}
+	if !strings.Contains(val, "=") {
+		out["*"] = val
+		return out
+	}
+	for _, part := range l.list(key, nil) {
+		resource, v, ok := strings.Cut(part, "=")
+		if !ok {
+			l.errs = append(l.errs, fmt.Errorf("%s: expected resource=value, got %q", key, part))
+			continue
+		}
+		out[strings.TrimSpace(resource)] = strings.TrimSpace(v)
+	}
+	return out
+}
+
+// influxRoutes reads INFLUX_BUCKETS and INFLUX_ORGS, each resource=value
+// pairs, into where each resource they name is written.
+func (l *loader) influxRoutes(fallback map[string]InfluxRoute) map[string]InfluxRoute {
+	buckets := l.perResource("INFLUX_BUCKETS", nil)
+	orgs := l.perResource("INFLUX_ORGS", nil)
+	if buckets == nil && orgs == nil {
+		return fallback
+	}
+	routes := map[string]InfluxRoute{}
+	for resource, bucket := range buckets {
+		route := routes[resource]
+		route.Bucket = bucket
+		routes[resource] = route
+	}
+	for resource, org := range orgs {
+		route := routes[resource]
+		route.Org = org
+		routes[resource] = route
+	}
+	return routes
+}
+
+// headers reads name=value pairs separated by commas, as
+// OTEL_EXPORTER_OTLP_HEADERS does. Values are as secret as tokens.
+func (l *loader) headers(key string, fallback map[string]string) map[string]string {
+	pairs := l.list(key, nil)
+	if pairs == nil {
+		return fallback
+	}
+	out := map[string]string{}
+	for _, pair := range pairs {
+		name, v, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			l.errs = append(l.errs, fmt.Errorf("%s: expected name=value, got a header without a name", key))
+			continue
+		}
+		out[strings.TrimSpace(name)] = strings.TrimSpace(v)
+	}
+	return out
+}
+
+func (l *loader) list(key string, fallback []string) []string {
+	val := l.getenv(key)
+	if val == "" {
+		return fallback
+	}
+	var out []string
+	for _, part := range strings.Split(val, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func (l *loader) int(key string, fallback int) int {
+	val := l.getenv(key)
+	if val == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", key, err))
+		return fallback
+	}
+	if n < 0 {
+		l.errs = append(l.errs, fmt.Errorf("%s: must not be negative", key))
+		return fallback
+	}
+	return n
+}
+
+func (l *loader) float(key string, fallback float64) float64 {
+	val := l.getenv(key)
+	if val == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", key, err))
+		return fallback
+	}
+	if f < 0 {
+		l.errs = append(l.errs, fmt.Errorf("%s: must not be negative", key))
+		return fallback
+	}
+	return f
+}
+
+func (l *loader) bool(key string, fallback bool) bool {
+	val := l.getenv(key)
+	if val == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", key, err))
+		return fallback
+	}
+	return b
+}
+
+func (l *loader) fraction(key string, fallback float64) float64 {
+	val := l.getenv(key)
+	if val == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", key, err))
+		return fallback
+	}
+	if f < 0 || f > 1 {
+		l.errs = append(l.errs, fmt.Errorf("%s: must be between 0 and 1", key))
+		return fallback
+	}
+	return f
+}
+
+func (l *loader) duration(key string, fallback time.Duration) time.Duration {
+	val := l.getenv(key)
+	if val == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", key, err))
+		return fallback
+	}
+	if d < 0 {
+		l.errs = append(l.errs, fmt.Errorf("%s: must not be negative", key))
+		return fallback
+	}
+	return d
+}
+
+// signedDuration is duration for settings where negative values mean
+// something.
+func (l *loader) signedDuration(key string, fallback time.Duration) time.Duration {
+	val := l.getenv(key)
+	if val == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", key, err))
+		return fallback
+	}
+	return d
+}
+
+func (l *loader) http(prefix string, fallback HTTPConfig) HTTPConfig {
+	return HTTPConfig{
+		Proxy:    l.optional(prefix+"_PROXY", fallback.Proxy),
+		CAFile:   l.optional(prefix+"_CA_FILE", fallback.CAFile),
+		CertFile: l.optional(prefix+"_CERT_FILE", fallback.CertFile),
+		KeyFile:  l.optional(prefix+"_KEY_FILE", fallback.KeyFile),
+		Timeout:  l.duration(prefix+"_TIMEOUT", fallback.Timeout),
+	}
+}
@@ -0,0 +1,19 @@
+package config
+
+import "testing"
+
+func TestArchiveScheduleOff(t *testing.T) {
+	cfg := defaults()
+	if cfg.Archive.Schedule == "" {
+		t.Fatal("archive schedule has no default")
+	}
+	t.Setenv("ARCHIVE_SCHEDULE", "off")
+	l := &loader{}
+	l.apply(cfg)
+	if len(l.errs) > 0 {
+		t.Fatal(l.errs)
+	}
+	if cfg.Archive.Schedule != "" {
+		t.Errorf("schedule = %q, want it cleared", cfg.Archive.Schedule)
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// EnvPrefix is prepended to the name of every environment variable read, so
+// that several instances can be configured on one host. It is itself read
+// from ENV_PREFIX, for example "EMS_". Set in .env it applies to everything
+// but ENV_FILE, which is read first.
+func EnvPrefix() string {
+	return os.Getenv("ENV_PREFIX")
+}
+
+// Getenv reads key with the EnvPrefix applied.
+func Getenv(key string) string {
+	return os.Getenv(EnvPrefix() + key)
+}
+
+// applyPaths overrides cfg with variables named after the path to each
+// setting in the config file, such as EMS_SINKS_INFLUX_BUCKET for
+// sinks.influx.bucket. This only happens when an EnvPrefix is set, since
+// unprefixed names like SCRAPE_SCHEDULE could collide with unrelated
+// variables. The shorter names read by apply take precedence. Maps are only
+// read if their env tag says how: "perResource" for resource=value pairs,
+// or "headers" for name=value pairs.
+func (l *loader) applyPaths(cfg *Config) {
+	if l.prefix == "" {
+		return
+	}
+	l.applyStruct(reflect.ValueOf(cfg).Elem(), "")
+}
+
+func (l *loader) applyStruct(v reflect.Value, path string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		key := envName(tag)
+		if path != "" {
+			key = path + "_" + key
+		}
+
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.Struct:
+			l.applyStruct(field, key)
+		case reflect.Map:
+			if field.Type() != reflect.TypeFor[map[string]string]() {
+				continue
+			}
+			var fallback map[string]string
+			if !field.IsNil() {
+				fallback = field.Interface().(map[string]string)
+			}
+			switch t.Field(i).Tag.Get("env") {
+			case "perResource":
+				field.Set(reflect.ValueOf(l.perResource(key, fallback)))
+			case "headers":
+				field.Set(reflect.ValueOf(l.headers(key, fallback)))
+			}
+		case reflect.Slice:
+			if field.Type().Elem().Kind() != reflect.String {
+				// slices of structs, like resources, only come from the file
+				continue
+			}
+			if val := l.list(key, nil); val != nil {
+				field.Set(reflect.ValueOf(val))
+			}
+		default:
+			l.decodeScalar(key, field)
+		}
+	}
+}
+
+// decodeScalar sets field from key as the YAML decoder would, so values are
+// spelt the same in the environment as in the file.
+func (l *loader) decodeScalar(key string, field reflect.Value) {
+	val := l.getenv(key)
+	if val == "" {
+		return
+	}
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: val}
+	if field.Kind() == reflect.String {
+		node.Tag = "!!str"
+	}
+	if err := node.Decode(field.Addr().Interface()); err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", l.prefix+key, err))
+	}
+}
+
+// envName converts a camelCase YAML key to UPPER_SNAKE_CASE, keeping runs
+// of capitals together so that publicURL is PUBLIC_URL.
+func envName(tag string) string {
+	runes := []rune(tag)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if !unicode.IsUpper(prev) || nextLower {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
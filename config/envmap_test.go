@@ -0,0 +1,102 @@
+package config
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"bucket":             "BUCKET",
+		"timestampPrecision": "TIMESTAMP_PRECISION",
+		"publicURL":          "PUBLIC_URL",
+		"caFile":             "CA_FILE",
+		"ntpServer":          "NTP_SERVER",
+		"URLPath":            "URL_PATH",
+		"kwh":                "KWH",
+	}
+	for in, want := range tests {
+		if got := envName(in); got != want {
+			t.Errorf("envName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestApplyPaths(t *testing.T) {
+	t.Setenv("EMS_SINKS_INFLUX_BUCKET", "energy")
+	t.Setenv("EMS_SERVER_PUBLIC_URL", "https://energy.example.com")
+	t.Setenv("EMS_SCRAPE_LOOKBACK", "2h")
+	t.Setenv("EMS_SCRAPE_SCHEDULE", "*/5 * * * *")
+	t.Setenv("EMS_ALERTS_BUDGET_BASELINES", "gas=fixed:300")
+
+	cfg := defaults()
+	l := &loader{prefix: "EMS_"}
+	l.applyPaths(cfg)
+	if len(l.errs) > 0 {
+		t.Fatal(l.errs)
+	}
+
+	if cfg.Sinks.Influx.Bucket != "energy" {
+		t.Errorf("bucket = %q", cfg.Sinks.Influx.Bucket)
+	}
+	if cfg.Server.PublicURL != "https://energy.example.com" {
+		t.Errorf("public url = %q", cfg.Server.PublicURL)
+	}
+	if cfg.Scrape.Lookback.String() != "2h0m0s" {
+		t.Errorf("lookback = %s", cfg.Scrape.Lookback)
+	}
+	if cfg.Scrape.Schedule != "*/5 * * * *" {
+		t.Errorf("schedule = %q", cfg.Scrape.Schedule)
+	}
+	if cfg.Alerts.Budget.Baselines["gas"] != "fixed:300" {
+		t.Errorf("budget baselines = %v", cfg.Alerts.Budget.Baselines)
+	}
+}
+
+func TestApplyPathsHeaders(t *testing.T) {
+	t.Setenv("EMS_SINKS_OTLP_HEADERS", "authorization=Bearer abc, x-team=energy")
+
+	cfg := defaults()
+	l := &loader{prefix: "EMS_"}
+	l.applyPaths(cfg)
+	if len(l.errs) > 0 {
+		t.Fatal(l.errs)
+	}
+	if got := cfg.Sinks.OTLP.Headers; len(got) != 2 || got["authorization"] != "Bearer abc" || got["x-team"] != "energy" {
+		t.Errorf("headers = %v", got)
+	}
+
+	// A header without a name is an error, not one for every resource
+	t.Setenv("EMS_SINKS_OTLP_HEADERS", "abc")
+	cfg = defaults()
+	l = &loader{prefix: "EMS_"}
+	l.applyPaths(cfg)
+	if len(l.errs) == 0 {
+		t.Errorf("no error for a header without a name, got %v", cfg.Sinks.OTLP.Headers)
+	}
+}
+
+func TestSecretResolvedOnce(t *testing.T) {
+	var calls atomic.Int32
+	RegisterSecretResolver("test-secret:", func(_ context.Context, ref string) (string, error) {
+		calls.Add(1)
+		return "Europe/London", nil
+	})
+	t.Setenv("EMS_TIMEZONE", "test-secret:timezone")
+
+	// TIMEZONE is both the path of timezone and the name apply reads
+	cfg := defaults()
+	l := &loader{prefix: "EMS_"}
+	l.applyPaths(cfg)
+	l.apply(cfg)
+	if len(l.errs) > 0 {
+		t.Fatal(l.errs)
+	}
+	if cfg.Timezone != "Europe/London" {
+		t.Errorf("timezone = %q", cfg.Timezone)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("resolved the secret %d times, want 1", n)
+	}
+}
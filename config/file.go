@@ -0,0 +1,26 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+)
+
+// loadFile overlays the YAML file at path onto cfg. Keys missing from the
+// file keep their current values.
+func loadFile(path string, cfg *Config) error {
+	contents, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return fmt.Errorf("config file: %w", readErr)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(contents))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
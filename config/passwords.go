@@ -0,0 +1,44 @@
+package config
+
+import "fmt"
+
+// PasswordStore keeps the Glow password somewhere other than the
+// environment, such as the OS keyring.
+type PasswordStore interface {
+	// Get returns the stored password, or "" if none is stored.
+	Get(username string) (string, error)
+	Set(username, password string) error
+	Delete(username string) error
+}
+
+var passwordStore PasswordStore
+
+func RegisterPasswordStore(s PasswordStore) {
+	passwordStore = s
+}
+
+// Passwords returns the compiled-in password store, or nil.
+func Passwords() PasswordStore {
+	return passwordStore
+}
+
+// glowPassword reads GLOW_PASSWORD, falling back to the config file and then
+// the password store.
+func (l *loader) glowPassword(username string, fromFile string) string {
+	if password := l.secret("GLOW_PASSWORD", fromFile); password != "" {
+		return password
+	}
+
+	if passwordStore != nil {
+		password, err := passwordStore.Get(username)
+		if err != nil {
+			l.errs = append(l.errs, fmt.Errorf("read glow password from keyring: %w", err))
+			return ""
+		}
+		if password != "" {
+			return password
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretResolver fetches the secret a reference such as an ARN points to.
+type SecretResolver func(ctx context.Context, ref string) (string, error)
+
+var (
+	secretResolversMu sync.Mutex
+	secretResolvers   = map[string]SecretResolver{}
+)
+
+// secretPrefixes are the references recognised even when no resolver for them
+// is compiled in, so that they fail loudly instead of being used verbatim.
+var secretPrefixes = []string{"arn:aws:secretsmanager:", "arn:aws:ssm:", "ssm:"}
+
+// RegisterSecretResolver lets any setting be given as a reference starting
+// with prefix, which is resolved when the config is loaded.
+func RegisterSecretResolver(prefix string, r SecretResolver) {
+	secretResolversMu.Lock()
+	defer secretResolversMu.Unlock()
+	secretResolvers[prefix] = r
+}
+
+func (l *loader) resolveSecret(key, val string) string {
+	secretResolversMu.Lock()
+	var resolver SecretResolver
+	for prefix, r := range secretResolvers {
+		if strings.HasPrefix(val, prefix) {
+			resolver = r
+			break
+		}
+	}
+	secretResolversMu.Unlock()
+
+	if resolver == nil {
+		for _, prefix := range secretPrefixes {
+			if strings.HasPrefix(val, prefix) {
+				l.errs = append(l.errs, fmt.Errorf("%s: secret references are not supported by this build", key))
+				return ""
+			}
+		}
+		return val
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	resolved, err := resolver(ctx, val)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: resolve secret: %w", key, err))
+		return ""
+	}
+	return resolved
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/alert"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/sink"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// crossCheckYesterday compares the previous day's stored 30 minute points
+// with Glow's P1D value for the same day. A mismatch means slots were missed
+// or duplicated.
+func crossCheckYesterday(st *settings) {
+	dayStart := startOfDay(clk.Now(), st.location()).AddDate(0, 0, -1)
+	for _, meta := range st.resources {
+		if isDormantResource(meta.Name) {
+			continue
+		}
+		crossCheck(context.Background(), st, meta, dayStart)
+	}
+}
+
+func crossCheck(ctx context.Context, st *settings, meta resourceMeta, dayStart time.Time) {
+	dayEnd := dayStart.AddDate(0, 0, 1)
+
+	want, wantErr := glowDayTotal(meta, dayStart, dayEnd)
+	if wantErr != nil {
+		slog.Error("crosscheck: failed to read daily value", "resource", meta.Name, "error", wantErr)
+		return
+	}
+
+	for _, s := range st.sinks {
+		summer, ok := s.(sink.Summer)
+		if !ok {
+			continue
+		}
+
+		got, n, sumErr := summer.SumField(ctx, usageMeasurement(meta), "kwh",
+			map[string]string{"resource": meta.Name, "period": "30m"},
+			st.stamps.Stamp(dayStart, 30*time.Minute), st.stamps.Stamp(dayEnd, 30*time.Minute))
+		if sumErr != nil {
+			slog.Error("crosscheck: failed to sum stored points", "resource", meta.Name, "sink", s.Name(), "error", sumErr)
+			continue
+		}
+
+		slots := int(dayEnd.Sub(dayStart) / (30 * time.Minute))
+		if math.Abs(got-want) <= math.Max(want*st.cfg.CrossCheck.Tolerance, 0.001) && n == slots {
+			slog.Info("crosscheck passed", "resource", meta.Name, "sink", s.Name(), "day", dayStart.Format(time.DateOnly), "kwh", got)
+			continue
+		}
+
+		alert.Send(ctx, alert.Alert{
+			Key:   "crosscheck/" + meta.Name,
+			Title: fmt.Sprintf("%s usage for %s does not match Glow", meta.Name, dayStart.Format(time.DateOnly)),
+			Message: fmt.Sprintf("%s stores %.3f kWh in %d slots, Glow reports %.3f kWh in %d slots",
+				s.Name(), got, n, want, slots),
+		})
+
+		if st.cfg.CrossCheck.Repair {
+			repairDay(ctx, st, meta, dayStart, dayEnd)
+		}
+		return
+	}
+}
+
+// glowDayTotal returns Glow's kWh total for the day [dayStart, dayEnd).
+func glowDayTotal(meta resourceMeta, dayStart, dayEnd time.Time) (float64, error) {
+	// Glow buckets days in UTC unless told the offset, which during BST
+	// would compare a different 24 hours with the stored local day. A day
+	// the clocks change on has two offsets, so is totalled from its slots.
+	query := glowapi.ResourceReadingsQuery{
+		ID:       meta.KWHResource,
+		Period:   "P1D",
+		Function: "sum",
+		From:     dayStart,
+		To:       dayEnd.Add(-time.Second),
+	}
+	_, startOffset := dayStart.Zone()
+	_, endOffset := dayEnd.Zone()
+	if startOffset == endOffset {
+		query.Offset = -startOffset / 60
+	} else {
+		query.Period = "PT30M"
+	}
+
+	readings, readingsErr := readReadings(query)
+	if readingsErr != nil {
+		return 0, readingsErr
+	}
+	var total float64
+	for _, reading := range readings.Data {
+		total += reading[1]
+	}
+	return total, nil
+}
+
+// repairDay rewrites every slot of the day from Glow.
+func repairDay(ctx context.Context, st *settings, meta resourceMeta, dayStart, dayEnd time.Time) {
+	kwhReadings, kwhErr := readResourceRange(meta.KWHResource, "PT30M", dayStart, dayEnd.Add(-time.Second))
+	penceReadings, penceErr := readResourceRange(meta.PenceResource, "PT30M", dayStart, dayEnd.Add(-time.Second))
+	if kwhErr != nil || penceErr != nil {
+		slog.Error("crosscheck: failed to read day for repair", "resource", meta.Name, "kwhError", kwhErr, "penceError", penceErr)
+		return
+	}
+
+	points := usagePoints(st, meta, kwhReadings, penceReadings)
+	if err := writePoints(ctx, st, points); err != nil {
+		slog.Error("crosscheck: failed to write repaired day", "resource", meta.Name, "error", err)
+		return
+	}
+	slog.Info("crosscheck: rewrote day", "resource", meta.Name, "day", dayStart.Format(time.DateOnly), "points", len(points))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/glowapi/glowtest"
+	"testing"
+	"time"
+)
+
+func TestGlowDayTotalAcrossClockChanges(t *testing.T) {
+	london, locErr := time.LoadLocation("Europe/London")
+	if locErr != nil {
+		t.Fatal(locErr)
+	}
+	fakeClock(t, time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC))
+
+	fakeGlow := glowtest.New(clk, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+	meta := config.Resource{Name: "dst", KWHResource: "kwh"}
+
+	// Every slot is 0.25 kWh, so a day's total counts its slots
+	for _, tt := range []struct {
+		day   time.Time
+		slots int
+	}{
+		{time.Date(2024, 1, 15, 0, 0, 0, 0, london), 48},
+		{time.Date(2024, 3, 31, 0, 0, 0, 0, london), 46},
+		{time.Date(2024, 7, 15, 0, 0, 0, 0, london), 48},
+		{time.Date(2024, 10, 27, 0, 0, 0, 0, london), 50},
+	} {
+		total, err := glowDayTotal(meta, tt.day, tt.day.AddDate(0, 0, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := float64(tt.slots) * 0.25; total != want {
+			t.Errorf("%s totals %v kWh, want %v", tt.day.Format(time.DateOnly), total, want)
+		}
+	}
+}
+
+func TestStartOfDay(t *testing.T) {
+	london, locErr := time.LoadLocation("Europe/London")
+	if locErr != nil {
+		t.Fatal(locErr)
+	}
+
+	// 23:30 UTC on the 30th is already the 31st in BST
+	got := startOfDay(time.Date(2024, 7, 30, 23, 30, 0, 0, time.UTC), london)
+	if want := time.Date(2024, 7, 30, 23, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("day starts %v, want %v", got, want)
+	}
+	if day := startOfDay(time.Date(2024, 3, 31, 12, 0, 0, 0, london), london); day.AddDate(0, 0, 1).Sub(day) != 23*time.Hour {
+		t.Errorf("spring forward day is %v long", day.AddDate(0, 0, 1).Sub(day))
+	}
+}
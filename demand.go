@@ -0,0 +1,107 @@
+package main
+
+import (
+	"energy-meter-scraper/schema"
+	"energy-meter-scraper/sink"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// monthPeak is the half hour of highest demand in a month so far.
+type monthPeak struct {
+	kw float64
+	at time.Time
+}
+
+var (
+	peaksMu sync.Mutex
+	// peaks are by resource, then by the Unix time the month starts.
+	peaks = map[string]map[int64]monthPeak{}
+)
+
+// demandPoints returns an energy_demand point for each month usage falls
+// in, recording the month's peak demand and its capacity charge, if the
+// resource's tariff has one. The first time a month is seen its earlier
+// slots are read from Glow, so that the peak covers the whole month rather
+// than only since the scraper started. Failing to read them is logged and
+// the month left until the next cycle.
+func demandPoints(st *settings, meta resourceMeta, usage []sink.Point) []sink.Point {
+	t := st.tariffs[meta.Name]
+	if t == nil || !t.HasCapacityCharge() || len(usage) == 0 {
+		return nil
+	}
+	loc := st.location()
+
+	byMonth := map[int64][]sink.Point{}
+	for _, p := range usage {
+		start := startOfMonth(st.stamps.Start(p.Time, 30*time.Minute), loc)
+		byMonth[start.Unix()] = append(byMonth[start.Unix()], p)
+	}
+	months := slices.Sorted(maps.Keys(byMonth))
+
+	peaksMu.Lock()
+	defer peaksMu.Unlock()
+	if peaks[meta.Name] == nil {
+		peaks[meta.Name] = map[int64]monthPeak{}
+	}
+
+	var points []sink.Point
+	for _, m := range months {
+		monthStart := time.Unix(m, 0).In(loc)
+		slots := byMonth[m]
+
+		peak, seen := peaks[meta.Name][m]
+		if !seen {
+			earlier, readErr := monthSoFar(st, meta, monthStart, slots)
+			if readErr != nil {
+				slog.Warn("failed to read the month's usage for peak demand", "resource", meta.Name,
+					"month", monthStart.Format("2006-01"), "error", readErr)
+				continue
+			}
+			slots = append(earlier, slots...)
+		}
+		for _, p := range slots {
+			kwh, ok := p.Fields["kwh"].(float64)
+			start := st.stamps.Start(p.Time, 30*time.Minute)
+			if !ok || !startOfMonth(start, loc).Equal(monthStart) {
+				continue
+			}
+			// Demand is the average power over the half hour
+			if kw := kwh * 2; kw > peak.kw {
+				peak = monthPeak{kw: kw, at: start}
+			}
+		}
+		peaks[meta.Name][m] = peak
+
+		points = append(points, schema.Stamp(sink.Point{
+			Measurement: "energy_demand",
+			Tags:        map[string]string{"resource": meta.Name},
+			Fields: map[string]any{
+				"peakKw":        peak.kw,
+				"peakAt":        peak.at.Unix(),
+				"capacityPence": t.CapacityCharge(peak.kw),
+			},
+			Time: monthStart,
+		}))
+	}
+	return points
+}
+
+// monthSoFar reads the month's usage from its start up to the earliest of
+// slots.
+func monthSoFar(st *settings, meta resourceMeta, monthStart time.Time, slots []sink.Point) ([]sink.Point, error) {
+	first, _ := pointsSpan(slots)
+	first = st.stamps.Start(first, 30*time.Minute)
+	if !first.After(monthStart) {
+		return nil, nil
+	}
+	return readUsage(st, meta, monthStart, first)
+}
+
+func startOfMonth(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+}
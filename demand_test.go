@@ -0,0 +1,96 @@
+package main
+
+import (
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/glowapi/glowtest"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/slot"
+	"energy-meter-scraper/tariff"
+	"testing"
+	"time"
+)
+
+func TestDemandPoints(t *testing.T) {
+	now := time.Date(2024, 6, 20, 12, 0, 0, 0, time.UTC)
+	fakeClock(t, now)
+	t.Cleanup(func() { peaks = map[string]map[int64]monthPeak{} })
+
+	spike := time.Date(2024, 6, 5, 18, 0, 0, 0, time.UTC)
+	fakeGlow := glowtest.New(clk, time.Date(2024, 5, 25, 0, 0, 0, 0, time.UTC))
+	fakeGlow.Usage = func(resource string, at time.Time) float64 {
+		if at.Equal(spike) {
+			return 3
+		}
+		return 0.25
+	}
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	tariffCfg := config.TariffConfig{
+		Seasons:      []config.TariffSeason{{Bands: []config.TariffBand{{Name: "flat", Rate: 25}}}},
+		CapacityRate: 100,
+	}
+	tr, tariffErr := tariff.New(tariffCfg)
+	if tariffErr != nil {
+		t.Fatal(tariffErr)
+	}
+	cfg := &config.Config{Resources: []config.Resource{{Name: "electricity", KWHResource: "kwh", PenceResource: "pence"}}}
+	st := &settings{
+		cfg:       cfg,
+		resources: cfg.Resources,
+		stamps:    slot.Policy{Precision: time.Second, Align: slot.AlignEnd},
+		tariffs:   map[string]*tariff.Tariff{"electricity": tr},
+		loc:       time.UTC,
+	}
+	meta := st.resources[0]
+
+	// The spike was before the scraper started, so is only found by reading
+	// the rest of the month
+	usage, usageErr := readUsage(st, meta, now.Add(-24*time.Hour), now.Add(-time.Hour))
+	if usageErr != nil {
+		t.Fatal(usageErr)
+	}
+	points := demandPoints(st, meta, usage)
+	if len(points) != 1 {
+		t.Fatalf("got %d points, want 1", len(points))
+	}
+	june := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	checkDemand(t, points[0], june, 6, spike, 600)
+
+	// Later cycles carry on from the peak so far without reading the month again
+	requests := fakeGlow.Requests()
+	stamp := func(start time.Time, kwh float64) sink.Point {
+		return sink.Point{Measurement: "energy_usage", Fields: map[string]any{"kwh": kwh},
+			Time: st.stamps.Stamp(start, 30*time.Minute)}
+	}
+	higher := time.Date(2024, 6, 20, 11, 0, 0, 0, time.UTC)
+	points = demandPoints(st, meta, []sink.Point{stamp(higher, 4), stamp(now, 0.5)})
+	if len(points) != 1 {
+		t.Fatalf("got %d points, want 1", len(points))
+	}
+	checkDemand(t, points[0], june, 8, higher, 800)
+	if fakeGlow.Requests() != requests {
+		t.Error("read the month again for a month already seen")
+	}
+
+	st.tariffs = map[string]*tariff.Tariff{}
+	if points := demandPoints(st, meta, usage); points != nil {
+		t.Errorf("points for a tariff without a capacity charge: %v", points)
+	}
+}
+
+func checkDemand(t *testing.T, p sink.Point, month time.Time, kw float64, at time.Time, pence float64) {
+	t.Helper()
+	if p.Measurement != "energy_demand" || !p.Time.Equal(month) {
+		t.Errorf("got %s at %v, want energy_demand at %v", p.Measurement, p.Time, month)
+	}
+	if p.Fields["peakKw"] != kw || p.Fields["peakAt"] != at.Unix() || p.Fields["capacityPence"] != pence {
+		t.Errorf("got %v, want a %v kW peak at %v costing %v", p.Fields, kw, at, pence)
+	}
+}
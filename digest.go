@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/alert"
+	"energy-meter-scraper/analysis"
+	"energy-meter-scraper/sink"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// sendDailyDigest summarises the previous day's usage and cost, including
+// what the always-on base load cost, and records the base load as an
+// energy_baseload point.
+func sendDailyDigest(st *settings) {
+	ctx := context.Background()
+	dayStart := startOfDay(clk.Now(), st.location()).AddDate(0, 0, -1)
+	dayEnd := dayStart.AddDate(0, 0, 1)
+
+	var lines []string
+	var points []sink.Point
+	for _, meta := range st.resources {
+		usage, usageErr := readUsage(st, meta, dayStart, dayEnd.Add(-time.Second))
+		if usageErr != nil {
+			slog.Error("digest: failed to read usage", "resource", meta.Name, "error", usageErr)
+			lines = append(lines, fmt.Sprintf("%s: no data", meta.Name))
+			continue
+		}
+		if len(usage) == 0 {
+			lines = append(lines, fmt.Sprintf("%s: no data", meta.Name))
+			continue
+		}
+
+		var kwh, pence float64
+		var slotKWh, slotPence []float64
+		for _, p := range usage {
+			k, _ := p.Fields["kwh"].(float64)
+			c, _ := p.Fields["pence"].(float64)
+			kwh += k
+			pence += c
+			slotKWh = append(slotKWh, k)
+			slotPence = append(slotPence, c)
+		}
+		line := fmt.Sprintf("%s: %.2f kWh, £%.2f", meta.Name, kwh, pence/100)
+
+		// Base load is costed at each slot's own rate, so that time-of-use
+		// tariffs are accounted for, falling back to the day's average rate
+		// for slots with no usage
+		baseSlotKWh := analysis.BaseLoad(slotKWh)
+		alwaysOnKWh := baseSlotKWh * float64(len(slotKWh))
+		var alwaysOnPence float64
+		for i, k := range slotKWh {
+			switch {
+			case k > 0:
+				alwaysOnPence += baseSlotKWh * slotPence[i] / k
+			case kwh > 0:
+				alwaysOnPence += baseSlotKWh * pence / kwh
+			}
+		}
+
+		fields := map[string]any{
+			"kwh":   alwaysOnKWh,
+			"pence": alwaysOnPence,
+		}
+		if meta.IsElectricity() {
+			baseWatts := baseSlotKWh * 2 * 1000
+			fields["watts"] = baseWatts
+			line += fmt.Sprintf(". Your always-on devices (%.0f W) cost £%.2f/day", baseWatts, alwaysOnPence/100)
+		} else {
+			line += fmt.Sprintf(". Base load of %.2f kWh/day cost £%.2f", alwaysOnKWh, alwaysOnPence/100)
+		}
+		points = append(points, sink.Point{
+			Measurement: "energy_baseload",
+			Tags:        map[string]string{"resource": meta.Name, "period": "1d"},
+			Fields:      fields,
+			Time:        st.stamps.Truncate(dayStart),
+		})
+		lines = append(lines, line)
+	}
+
+	if len(points) > 0 {
+		if err := writePoints(ctx, st, points); err != nil {
+			slog.Error("digest: failed to write base load", "error", err)
+		}
+	}
+
+	alert.Send(ctx, alert.Alert{
+		Kind:    alert.KindDigest,
+		Key:     "digest/daily",
+		Title:   "Energy for " + dayStart.Format("Monday 2 January"),
+		Message: strings.Join(lines, "\n"),
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"energy-meter-scraper/metrics"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var resourceDormant = metrics.NewGauge("scraper_resource_dormant",
+	"Whether a resource has stopped producing readings and is no longer scraped.", "resource")
+
+// errDormant is returned for a resource whose latest reading is older than
+// DormantAfter, e.g. after a supplier switch.
+var errDormant = errors.New("resource is dormant")
+
+// dormantRecheck is how often a dormant resource is checked for new
+// readings.
+const dormantRecheck = 24 * time.Hour
+
+// dormancy is the dormant resources, with when each was last read and last
+// checked.
+var dormancy = struct {
+	mu        sync.Mutex
+	resources map[string]dormantResource
+}{resources: map[string]dormantResource{}}
+
+type dormantResource struct {
+	last    time.Time
+	checked time.Time
+}
+
+// isDormant reports whether a resource whose latest reading was at last has
+// stopped producing data.
+func isDormant(st *settings, last time.Time) bool {
+	after := st.cfg.Scrape.DormantAfter
+	return after > 0 && clk.Since(last) > after
+}
+
+func markDormant(name string, last time.Time) {
+	dormancy.mu.Lock()
+	defer dormancy.mu.Unlock()
+	if _, ok := dormancy.resources[name]; !ok {
+		slog.Warn("resource has stopped producing readings; no longer scraping it", "resource", name, "lastReading", last)
+	}
+	dormancy.resources[name] = dormantResource{last: last, checked: clk.Now()}
+	resourceDormant.Set(1, name)
+}
+
+func revive(name string) {
+	dormancy.mu.Lock()
+	defer dormancy.mu.Unlock()
+	if _, ok := dormancy.resources[name]; ok {
+		slog.Info("dormant resource has new readings; scraping it again", "resource", name)
+	}
+	delete(dormancy.resources, name)
+	resourceDormant.Set(0, name)
+}
+
+// dormantResources returns when each dormant resource was last read.
+func dormantResources() map[string]time.Time {
+	dormancy.mu.Lock()
+	defer dormancy.mu.Unlock()
+	out := map[string]time.Time{}
+	for name, d := range dormancy.resources {
+		out[name] = d.last
+	}
+	return out
+}
+
+// isDormantResource reports whether a resource is no longer being scraped.
+func isDormantResource(name string) bool {
+	dormancy.mu.Lock()
+	defer dormancy.mu.Unlock()
+	_, ok := dormancy.resources[name]
+	return ok
+}
+
+// activeResources returns the resources to scrape. Dormant ones are left
+// out, except once a day when they are checked for new readings.
+func activeResources(st *settings) []resourceMeta {
+	var active []resourceMeta
+	for _, meta := range st.resources {
+		dormancy.mu.Lock()
+		d, ok := dormancy.resources[meta.Name]
+		dormancy.mu.Unlock()
+
+		if !ok {
+			active = append(active, meta)
+			continue
+		}
+		if clk.Since(d.checked) < dormantRecheck {
+			continue
+		}
+
+		last, lastErr := glow.GetResourceLastTime(meta.KWHResource)
+		if lastErr != nil {
+			slog.Warn("failed to check dormant resource", "resource", meta.Name, "error", lastErr)
+			markDormant(meta.Name, d.last)
+			continue
+		}
+		if isDormant(st, last) {
+			markDormant(meta.Name, last)
+			continue
+		}
+		revive(meta.Name)
+		active = append(active, meta)
+	}
+	return active
+}
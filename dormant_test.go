@@ -0,0 +1,57 @@
+package main
+
+import (
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/glowapi/glowtest"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDormantResources(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fake := fakeClock(t, now)
+
+	fakeGlow := glowtest.New(clk, now.AddDate(-1, 0, 0))
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	meta := config.Resource{Name: "dormant-test", KWHResource: "kwh", PenceResource: "pence"}
+	cfg := &config.Config{Resources: []config.Resource{meta}}
+	cfg.Scrape.Lookback = 8 * 24 * time.Hour
+	cfg.Scrape.DormantAfter = 60 * 24 * time.Hour
+	st := &settings{cfg: cfg, resources: cfg.Resources}
+	defer revive(meta.Name)
+
+	// The meter stopped reporting three months ago
+	fakeGlow.Delay = 90 * 24 * time.Hour
+	if _, err := scrapeResource(st, meta); !errors.Is(err, errDormant) {
+		t.Fatalf("scraped a quiet resource: %v", err)
+	}
+	if active := activeResources(st); len(active) != 0 {
+		t.Fatalf("dormant resource still active: %v", active)
+	}
+	if last, ok := dormantResources()[meta.Name]; !ok || !last.Equal(fakeGlow.Last()) {
+		t.Errorf("dormant since %v, want %v", last, fakeGlow.Last())
+	}
+
+	// It is only checked again a day later, when it has readings again
+	fakeGlow.Delay = 0
+	fake.Advance(time.Hour)
+	if active := activeResources(st); len(active) != 0 {
+		t.Fatal("dormant resource rechecked within a day")
+	}
+	fake.Advance(dormantRecheck)
+	if active := activeResources(st); len(active) != 1 {
+		t.Fatal("resource with new readings still dormant")
+	}
+	if isDormantResource(meta.Name) {
+		t.Error("revived resource still counted as dormant")
+	}
+}
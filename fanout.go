@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/gob"
+	"energy-meter-scraper/metrics"
+	"energy-meter-scraper/sink"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// errBuffered is returned when a sink failed to write points that are saved
+// to retry, which doesn't hold back the resource's checkpoint.
+var errBuffered = errors.New("buffered to retry")
+
+// errHeld is returned when a sink failed to write points that are held in
+// memory only to retry. A restart would lose them, so the resource's
+// checkpoint is held back until they are written.
+var errHeld = errors.New("held in memory to retry")
+
+var sinkBufferedPoints = metrics.NewGauge("scraper_sink_buffered_points",
+	"Points held for a sink that failed to write them.", "sink")
+
+// sinkBuffers hold the batches each sink failed to write, by sink name, so
+// that they outlive a reload that reopens the sink. Unless SinkBufferDir is
+// set they are in memory only, so a restart loses them, and the lookback or
+// recheck job has to fill the gap.
+var sinkBuffers = struct {
+	mu     sync.Mutex
+	byName map[string]*sinkBuffer
+}{byName: map[string]*sinkBuffer{}}
+
+type sinkBuffer struct {
+	mu      sync.Mutex
+	batches [][]sink.Point
+	points  int
+	// path is where the batches are saved, or empty to keep them in memory.
+	path string
+}
+
+// bufferOf returns the buffer for s, loading the batches saved for it in
+// SinkBufferDir the first time. The buffer stays where it was first opened,
+// so changing SinkBufferDir takes a restart.
+func bufferOf(st *settings, s sink.Sink) *sinkBuffer {
+	sinkBuffers.mu.Lock()
+	defer sinkBuffers.mu.Unlock()
+	b, ok := sinkBuffers.byName[s.Name()]
+	if ok {
+		return b
+	}
+	b = &sinkBuffer{}
+	sinkBuffers.byName[s.Name()] = b
+	if dir := st.cfg.Scrape.SinkBufferDir; dir != "" {
+		b.path = filepath.Join(dir, s.Name()+".gob")
+		if err := b.load(); err != nil {
+			slog.Error("failed to load buffered points; they will be re-read from glow", "sink", s.Name(), "error", err)
+		} else if b.points > 0 {
+			slog.Info("loaded buffered points", "sink", s.Name(), "count", b.points)
+		}
+		sinkBufferedPoints.Set(float64(b.points), s.Name())
+	}
+	return b
+}
+
+func (b *sinkBuffer) load() error {
+	f, openErr := os.Open(b.path)
+	if errors.Is(openErr, fs.ErrNotExist) {
+		return nil
+	} else if openErr != nil {
+		return openErr
+	}
+	defer f.Close()
+	var batches [][]sink.Point
+	if err := gob.NewDecoder(f).Decode(&batches); err != nil {
+		return fmt.Errorf("%s: %w", b.path, err)
+	}
+	b.batches = batches
+	for _, batch := range batches {
+		b.points += len(batch)
+	}
+	return nil
+}
+
+// save replaces the saved batches with those held, if they are kept on
+// disk. gob keeps the type of each field, which JSON would lose.
+func (b *sinkBuffer) save() error {
+	if b.path == "" {
+		return nil
+	}
+	if err := b.write(); err != nil {
+		slog.Error("failed to save buffered points; a restart will lose them", "path", b.path, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (b *sinkBuffer) write() error {
+	if len(b.batches) == 0 {
+		if err := os.Remove(b.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(b.path), 0o700); err != nil {
+		return err
+	}
+	tmp, tmpErr := os.CreateTemp(filepath.Dir(b.path), filepath.Base(b.path)+".*")
+	if tmpErr != nil {
+		return tmpErr
+	}
+	defer os.Remove(tmp.Name())
+	if err := gob.NewEncoder(tmp).Encode(b.batches); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), b.path)
+}
+
+// writeBuffered writes points to s once the batches already buffered for it
+// are written. If s fails, points are buffered too, and the error wraps
+// errBuffered, or errHeld if they couldn't be saved to disk, unless the
+// buffer is full or disabled.
+func writeBuffered(ctx context.Context, st *settings, s sink.Sink, points []sink.Point) error {
+	b := bufferOf(st, s)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	writeErr := b.flush(ctx, st, s)
+	if writeErr == nil {
+		if writeErr = writeSink(ctx, st, s, points); writeErr == nil {
+			return nil
+		}
+	}
+	if limit := st.cfg.Scrape.SinkBuffer; limit == 0 {
+		return writeErr
+	} else if b.points+len(points) > limit {
+		return fmt.Errorf("%w (buffer full with %d of %d points)", writeErr, b.points, limit)
+	}
+	b.batches = append(b.batches, points)
+	b.points += len(points)
+	sinkBufferedPoints.Set(float64(b.points), s.Name())
+	if b.path == "" || b.save() != nil {
+		return fmt.Errorf("%w: %w", errHeld, writeErr)
+	}
+	return fmt.Errorf("%w: %w", errBuffered, writeErr)
+}
+
+// flush writes the buffered batches, oldest first, until one fails.
+func (b *sinkBuffer) flush(ctx context.Context, st *settings, s sink.Sink) error {
+	if len(b.batches) == 0 {
+		return nil
+	}
+	written := 0
+	for len(b.batches) > 0 {
+		if err := writeSink(ctx, st, s, b.batches[0]); err != nil {
+			sinkBufferedPoints.Set(float64(b.points), s.Name())
+			if written > 0 {
+				_ = b.save()
+			}
+			return err
+		}
+		written += len(b.batches[0])
+		b.points -= len(b.batches[0])
+		b.batches = b.batches[1:]
+	}
+	b.batches = nil
+	sinkBufferedPoints.Set(0, s.Name())
+	_ = b.save()
+	slog.Info("wrote buffered points", "sink", s.Name(), "count", written)
+	return nil
+}
+
+// sinkContext bounds the time spent writing to one sink.
+func sinkContext(ctx context.Context, st *settings) (context.Context, context.CancelFunc) {
+	if st.cfg.Scrape.SinkTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, st.cfg.Scrape.SinkTimeout)
+}
+
+// eachSink runs fn for every sink at once, each with its own deadline, and
+// waits for them all. It returns whether fn panicked for any of them.
+func eachSink(ctx context.Context, st *settings, fn func(ctx context.Context, s sink.Sink)) bool {
+	var wg sync.WaitGroup
+	var panicked atomic.Bool
+	for _, s := range st.sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// recoverCycle can't catch a panic on another goroutine
+			defer func() {
+				if r := recover(); r != nil {
+					slog.Error("writing to sink panicked", "sink", s.Name(), "panic", r, "stack", string(debug.Stack()))
+					cyclePanicsTotal.Inc()
+					panicked.Store(true)
+				}
+			}()
+			ctx, cancel := sinkContext(ctx, st)
+			defer cancel()
+			fn(ctx, s)
+		}()
+	}
+	wg.Wait()
+	return panicked.Load()
+}
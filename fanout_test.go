@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakySink fails or hangs until told otherwise, recording what it writes
+// while it works.
+type flakySink struct {
+	name string
+	mu   sync.Mutex
+	fail bool
+	hang bool
+	got  []time.Time
+}
+
+func (f *flakySink) Name() string { return f.name }
+
+func (f *flakySink) Write(ctx context.Context, points []sink.Point) error {
+	f.mu.Lock()
+	fail, hang := f.fail, f.hang
+	f.mu.Unlock()
+	if hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if fail {
+		return errors.New("unavailable")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range points {
+		f.got = append(f.got, p.Time)
+	}
+	return nil
+}
+
+func (f *flakySink) Close() error { return nil }
+
+func (f *flakySink) set(fail, hang bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail, f.hang = fail, hang
+}
+
+func TestWriteCycleIsolatesSinks(t *testing.T) {
+	broken := &flakySink{name: "broken", fail: true}
+	mem := newMemorySink()
+	t.Cleanup(func() {
+		sinkBuffers.mu.Lock()
+		defer sinkBuffers.mu.Unlock()
+		delete(sinkBuffers.byName, broken.name)
+	})
+
+	cfg := &config.Config{Resources: []config.Resource{{Name: "gas"}}}
+	cfg.Scrape.SinkTimeout = 100 * time.Millisecond
+	cfg.Scrape.SinkBuffer = 10
+	st := &settings{cfg: cfg, resources: cfg.Resources, sinks: []sink.Sink{broken, mem}}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cycle := func(i int) (failed, held map[string]bool) {
+		var usage []sink.Point
+		for j := range 4 {
+			usage = append(usage, sink.Point{Measurement: "energy_usage", Tags: map[string]string{"resource": "gas", "period": "30m"},
+				Fields: map[string]any{"kwh": 0.5}, Time: start.Add(time.Duration(4*i+j) * 30 * time.Minute)})
+		}
+		return writeCycle(context.Background(), st, nil, map[string]resourcePoints{"gas": {usage: usage}})
+	}
+
+	// The broken sink's batches are buffered while there is room, without
+	// failing the resource or keeping the other sink's points from it, and
+	// one that hangs is abandoned at the timeout. Held in memory only, they
+	// hold back the checkpoint.
+	if failed, held := cycle(0); failed["gas"] {
+		t.Fatal("cycle failed with room in the buffer")
+	} else if !held["gas"] {
+		t.Error("points held in memory didn't hold back the checkpoint")
+	}
+	broken.set(false, true)
+	began := time.Now()
+	if failed, _ := cycle(1); failed["gas"] {
+		t.Fatal("cycle failed with room in the buffer")
+	}
+	if elapsed := time.Since(began); elapsed > time.Second {
+		t.Errorf("cycle took %v with a hanging sink", elapsed)
+	}
+	if got := len(mem.series("energy_usage", map[string]string{"resource": "gas", "period": "30m"})); got != 8 {
+		t.Errorf("memory sink has %d points, want 8", got)
+	}
+	if got := sinkBufferedPoints.Value("broken"); got != 8 {
+		t.Errorf("buffered %v points, want 8", got)
+	}
+	broken.set(true, false)
+	if failed, _ := cycle(2); !failed["gas"] {
+		t.Error("cycle with the buffer full didn't fail")
+	}
+
+	// Once back, the sink gets its buffered batches in order before new ones
+	broken.set(false, false)
+	if failed, held := cycle(3); failed["gas"] || held["gas"] {
+		t.Error("cycle failed after the sink recovered")
+	}
+	var want []time.Time
+	for _, i := range []int{0, 1, 3} {
+		for j := range 4 {
+			want = append(want, start.Add(time.Duration(4*i+j)*30*time.Minute))
+		}
+	}
+	if len(broken.got) != len(want) {
+		t.Fatalf("broken sink got %v, want %v", broken.got, want)
+	}
+	for i := range want {
+		if !broken.got[i].Equal(want[i]) {
+			t.Fatalf("broken sink got %v, want %v", broken.got, want)
+		}
+	}
+	if got := sinkBufferedPoints.Value("broken"); got != 0 {
+		t.Errorf("%v points still buffered", got)
+	}
+}
+
+func TestSinkBufferDir(t *testing.T) {
+	broken := &flakySink{name: "restarted", fail: true}
+	forget := func() {
+		sinkBuffers.mu.Lock()
+		defer sinkBuffers.mu.Unlock()
+		delete(sinkBuffers.byName, broken.name)
+	}
+	t.Cleanup(forget)
+
+	cfg := &config.Config{}
+	cfg.Scrape.SinkBuffer = 10
+	cfg.Scrape.SinkBufferDir = t.TempDir()
+	st := &settings{cfg: cfg, sinks: []sink.Sink{broken}}
+
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	points := []sink.Point{{Measurement: "energy_usage", Tags: map[string]string{"resource": "gas"},
+		Fields: map[string]any{"kwh": 0.5, "revision": int64(2)}, Time: at}}
+	if err := writeBuffered(context.Background(), st, broken, points); !errors.Is(err, errBuffered) {
+		t.Fatalf("write err %v, want errBuffered", err)
+	}
+
+	// After a restart the batch is loaded, with its field types, and
+	// written before the next
+	forget()
+	if loaded := bufferOf(st, broken); loaded.points != 1 {
+		t.Fatalf("loaded %d points, want 1", loaded.points)
+	} else if _, ok := loaded.batches[0][0].Fields["revision"].(int64); !ok {
+		t.Errorf("revision loaded as %T, want int64", loaded.batches[0][0].Fields["revision"])
+	}
+	broken.set(false, false)
+	next := []sink.Point{{Measurement: "energy_usage", Fields: map[string]any{"kwh": 1.0}, Time: at.Add(30 * time.Minute)}}
+	if err := writeBuffered(context.Background(), st, broken, next); err != nil {
+		t.Fatal(err)
+	}
+	if len(broken.got) != 2 || !broken.got[0].Equal(at) {
+		t.Fatalf("sink got %v, want the buffered point first", broken.got)
+	}
+	if got := bufferOf(st, broken); got.points != 0 {
+		t.Errorf("%d points still buffered", got.points)
+	}
+	if entries, _ := os.ReadDir(cfg.Scrape.SinkBufferDir); len(entries) != 0 {
+		t.Errorf("buffer files left: %v", entries)
+	}
+}
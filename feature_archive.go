@@ -0,0 +1,5 @@
+//go:build !minimal && !no_archive
+
+package main
+
+import _ "energy-meter-scraper/archive/s3"
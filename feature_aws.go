@@ -0,0 +1,5 @@
+//go:build !minimal && !no_aws
+
+package main
+
+import _ "energy-meter-scraper/awssecrets"
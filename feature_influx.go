@@ -0,0 +1,5 @@
+//go:build !no_influx
+
+package main
+
+import _ "energy-meter-scraper/sink/influx"
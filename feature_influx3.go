@@ -0,0 +1,5 @@
+//go:build !minimal && !no_influx3
+
+package main
+
+import _ "energy-meter-scraper/sink/influx3"
@@ -0,0 +1,5 @@
+//go:build !minimal && !no_keyring
+
+package main
+
+import _ "energy-meter-scraper/keyring"
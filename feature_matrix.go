@@ -0,0 +1,5 @@
+//go:build !minimal && !no_matrix
+
+package main
+
+import _ "energy-meter-scraper/alert/matrix"
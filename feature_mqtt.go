@@ -0,0 +1,5 @@
+//go:build !minimal && !no_mqtt
+
+package main
+
+import _ "energy-meter-scraper/sink/mqtt"
@@ -0,0 +1,5 @@
+//go:build !minimal && !no_ndjson
+
+package main
+
+import _ "energy-meter-scraper/sink/ndjson"
@@ -0,0 +1,5 @@
+//go:build !minimal && !no_otlp
+
+package main
+
+import _ "energy-meter-scraper/sink/otlp"
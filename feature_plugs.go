@@ -0,0 +1,5 @@
+//go:build !minimal && !no_plugs
+
+package main
+
+import _ "energy-meter-scraper/plugs/mqtt"
@@ -0,0 +1,5 @@
+//go:build !minimal && !no_statsd
+
+package main
+
+import _ "energy-meter-scraper/sink/statsd"
@@ -0,0 +1,7 @@
+//go:build !minimal && !no_tzdata
+
+package main
+
+// The timezone database is embedded so that TIMEZONE works in images
+// without /usr/share/zoneinfo; minimal builds rely on the system's.
+import _ "time/tzdata"
@@ -0,0 +1,19 @@
+package main
+
+// Optional subsystems register themselves from the feature_*.go files in this
+// package. Each is compiled in unless excluded by a build tag: -tags minimal
+// leaves out everything that is not needed to scrape Glow into InfluxDB, and
+// -tags no_<feature> leaves out a single feature. For a small static binary
+// suitable for a router:
+//
+//	CGO_ENABLED=0 go build -tags minimal -trimpath -ldflags="-s -w"
+//
+// The dashboard and API, with the openapi command, are left out by
+// -tags no_server.
+//
+// Programs embedding Glow scraping rather than running the daemon import the
+// scraper package instead, which with glowapi and sink/ndjson builds none of
+// these and no server.
+
+// serveWeb runs the dashboard and API, or is nil if they aren't built in.
+var serveWeb func(addr string)
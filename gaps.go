@@ -0,0 +1,143 @@
+package main
+
+import (
+	"energy-meter-scraper/metrics"
+	"energy-meter-scraper/sink"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	gapSlots = metrics.NewGauge("scraper_gap_slots",
+		"Half-hour slots missing from Glow's readings that are being re-fetched.", "resource")
+	gapSlotsFilledTotal = metrics.NewCounter("scraper_gap_slots_filled_total",
+		"Missing half-hour slots since filled in by a re-fetch.", "resource")
+)
+
+// maxGapRefetches is the most missing windows of a resource re-fetched in
+// one cycle, oldest first, so a patchy history doesn't stall the cycle.
+const maxGapRefetches = 8
+
+// gaps are the slots each resource's readings have skipped, by the Unix time
+// the slot starts, with when each was found missing. They are kept in memory,
+// so after a restart only the lookback and recheck job cover earlier holes.
+var gaps = struct {
+	mu      sync.Mutex
+	missing map[string]map[int64]time.Time
+}{missing: map[string]map[int64]time.Time{}}
+
+// recordGaps notes the slots starting from from to to that the usage just
+// written lacks, and forgets any missing slots it has.
+func recordGaps(st *settings, name string, from, to time.Time, usage []sink.Point) {
+	if st.cfg.Scrape.GapRefetch <= 0 {
+		return
+	}
+	have := map[int64]bool{}
+	for _, p := range usage {
+		have[st.stamps.Start(p.Time, 30*time.Minute).Unix()] = true
+	}
+
+	gaps.mu.Lock()
+	defer gaps.mu.Unlock()
+	missing := gaps.missing[name]
+	if missing == nil {
+		missing = map[int64]time.Time{}
+		gaps.missing[name] = missing
+	}
+
+	found := 0
+	for slot := range missing {
+		if have[slot] {
+			delete(missing, slot)
+			found++
+		}
+	}
+	if found > 0 {
+		gapSlotsFilledTotal.Add(float64(found), name)
+		slog.Info("filled in missing slots", "resource", name, "slots", found)
+	}
+
+	now := clk.Now()
+	added := 0
+	for t := ceilSlot(from); !t.After(to); t = t.Add(30 * time.Minute) {
+		if _, known := missing[t.Unix()]; !have[t.Unix()] && !known {
+			missing[t.Unix()] = now
+			added++
+		}
+	}
+	if added > 0 {
+		slog.Warn("readings skip slots; re-fetching them on later cycles", "resource", name, "slots", added)
+	}
+	gapSlots.Set(float64(len(missing)), name)
+}
+
+// gapWindow is a run of consecutive missing slots, by the start of the
+// first and last.
+type gapWindow struct {
+	from, to time.Time
+}
+
+// gapWindows returns the resource's missing slots as runs, oldest first,
+// having given up on slots missing for longer than GapRefetch.
+func gapWindows(st *settings, name string) []gapWindow {
+	gaps.mu.Lock()
+	defer gaps.mu.Unlock()
+	missing := gaps.missing[name]
+
+	expired := 0
+	for slot, since := range missing {
+		if clk.Since(since) > st.cfg.Scrape.GapRefetch {
+			delete(missing, slot)
+			expired++
+		}
+	}
+	if expired > 0 {
+		slog.Warn("giving up on slots Glow never filled in", "resource", name, "slots", expired)
+		gapSlots.Set(float64(len(missing)), name)
+	}
+
+	var windows []gapWindow
+	for _, slot := range slices.Sorted(maps.Keys(missing)) {
+		t := time.Unix(slot, 0)
+		if n := len(windows); n > 0 && windows[n-1].to.Add(30*time.Minute).Equal(t) {
+			windows[n-1].to = t
+			continue
+		}
+		windows = append(windows, gapWindow{from: t, to: t})
+	}
+	return windows
+}
+
+// refetchGaps reads the resource's missing slots again, returning whatever
+// Glow now has. Those it still lacks stay missing until recordGaps next sees
+// them.
+func refetchGaps(st *settings, meta resourceMeta) []sink.Point {
+	if st.cfg.Scrape.GapRefetch <= 0 {
+		return nil
+	}
+	var points []sink.Point
+	for i, w := range gapWindows(st, meta.Name) {
+		if i == maxGapRefetches {
+			break
+		}
+		// Glow's range is inclusive, but a range of one slot must not be empty
+		refetched, readErr := readUsage(st, meta, w.from, w.to.Add(time.Second))
+		if readErr != nil {
+			slog.Warn("failed to re-fetch missing slots", "resource", meta.Name, "from", w.from, "to", w.to, "error", readErr)
+			break
+		}
+		points = append(points, refetched...)
+	}
+	return points
+}
+
+// ceilSlot returns the start of the first slot at or after t.
+func ceilSlot(t time.Time) time.Time {
+	if floor := t.Truncate(30 * time.Minute); floor.Before(t) {
+		return floor.Add(30 * time.Minute)
+	}
+	return t
+}
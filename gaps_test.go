@@ -0,0 +1,75 @@
+package main
+
+import (
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/glowapi/glowtest"
+	"energy-meter-scraper/slot"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGapsAreRefetched(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	fake := fakeClock(t, now)
+
+	outageFrom := time.Date(2024, 6, 8, 0, 0, 0, 0, time.UTC)
+	outageTo := outageFrom.Add(24 * time.Hour)
+	lone := time.Date(2024, 6, 9, 6, 0, 0, 0, time.UTC)
+	fakeGlow := glowtest.New(clk, now.AddDate(0, 0, -30))
+	fakeGlow.Missing = func(_ string, at time.Time) bool {
+		return !at.Before(outageFrom) && at.Before(outageTo) || at.Equal(lone)
+	}
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	meta := config.Resource{Name: "gaps-test", KWHResource: "kwh", PenceResource: "pence"}
+	cfg := &config.Config{Resources: []config.Resource{meta}}
+	cfg.Scrape.Lookback = 3 * 24 * time.Hour
+	cfg.Scrape.GapRefetch = 7 * 24 * time.Hour
+	st := &settings{cfg: cfg, resources: cfg.Resources, stamps: slot.Policy{Precision: time.Second, Align: slot.AlignEnd}}
+	defer func() { delete(gaps.missing, meta.Name) }()
+
+	rp, err := scrapeResource(st, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordGaps(st, meta.Name, rp.from, rp.through, rp.usage)
+	windows := gapWindows(st, meta.Name)
+	want := []gapWindow{{outageFrom, outageTo.Add(-30 * time.Minute)}, {lone, lone}}
+	if !sameWindows(windows, want) {
+		t.Fatalf("missing %v, want %v", windows, want)
+	}
+	if gapSlots.Value(meta.Name) != 49 {
+		t.Errorf("gauge is %v, want 49", gapSlots.Value(meta.Name))
+	}
+
+	// The DCC delivers the day, but not the lone slot
+	fakeGlow.Missing = func(_ string, at time.Time) bool { return at.Equal(lone) }
+	if rp, err = scrapeResource(st, meta); err != nil {
+		t.Fatal(err)
+	}
+	if len(rp.refetched) != 48 {
+		t.Errorf("refetched %d slots, want the outage's 48", len(rp.refetched))
+	}
+	recordGaps(st, meta.Name, rp.from, rp.through, slices.Concat(rp.refetched, rp.usage))
+	if windows := gapWindows(st, meta.Name); !sameWindows(windows, []gapWindow{{lone, lone}}) {
+		t.Errorf("missing %v after the outage was filled in, want only %v", windows, lone)
+	}
+
+	// Slots never filled in are given up on
+	fake.Advance(8 * 24 * time.Hour)
+	if windows := gapWindows(st, meta.Name); len(windows) != 0 {
+		t.Errorf("still re-fetching %v", windows)
+	}
+}
+
+func sameWindows(a, b []gapWindow) bool {
+	return slices.EqualFunc(a, b, func(x, y gapWindow) bool { return x.from.Equal(y.from) && x.to.Equal(y.to) })
+}
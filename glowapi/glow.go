@@ -3,6 +3,7 @@ package glowapi
 import (
 	"bytes"
 	"encoding/json"
+	"energy-meter-scraper/metrics"
 	"errors"
 	"fmt"
 	"io"
@@ -10,6 +11,9 @@ import (
 	"net/http"
 	"net/url"
 	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -24,20 +28,138 @@ const (
 	applicationID = "b0f1b774-a586-4f72-9edd-27ead8aa7a8d"
 )
 
+var (
+	requestsTotal = metrics.NewCounter("scraper_glow_requests_total",
+		"Requests to the Glow API, by status code, or error if none was received.", "endpoint", "status")
+	requestSecondsTotal = metrics.NewCounter("scraper_glow_request_seconds_total",
+		"Time spent on requests to the Glow API.", "endpoint")
+)
+
 type API struct {
+	client   *http.Client
+	username string
+	password string
+
+	mu    sync.Mutex
 	token string
+	// renewErr is why the session last failed to renew, until it renews.
+	renewErr error
+}
+
+// ErrRejected is returned when Glow refuses the username and password, as
+// opposed to being unreachable.
+var ErrRejected = errors.New("glow rejected the credentials")
+
+// ErrInvalidApplication is returned when Glow refuses the scraper's
+// application ID, which no amount of logging in again will fix.
+var ErrInvalidApplication = errors.New("glow rejected the application ID")
+
+// invalidApplicationMessage is the error Glow refuses a request with once
+// it no longer accepts the application ID.
+const invalidApplicationMessage = "Invalid applicationId"
+
+// invalidApplication reports whether a refusal is Glow's JSON error blaming
+// the application ID, rather than the session, the credentials or a proxy
+// in the way, which are retried as usual.
+func invalidApplication(status int, body []byte) bool {
+	if status != http.StatusUnauthorized && status != http.StatusForbidden {
+		return false
+	}
+	var refusal struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &refusal); err != nil {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(refusal.Error), invalidApplicationMessage)
 }
 
-func Authenticate(username string, password string) (*API, error) {
-	token, authErr := doAuth(username, password)
+// Authenticate logs in to Glow. If client is nil http.DefaultClient is used.
+// The session is renewed automatically when it expires.
+func Authenticate(client *http.Client, username string, password string) (*API, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	token, authErr := doAuth(client, username, password)
 	if authErr != nil {
 		return nil, authErr
 	}
 
-	return &API{token: token}, nil
+	return &API{client: client, username: username, password: password, token: token}, nil
+}
+
+// do sends an authenticated request, logging in again and retrying once if
+// the session has expired. Requests must not have a body.
+func (a *API) do(req *http.Request) (*http.Response, error) {
+	a.mu.Lock()
+	token := a.token
+	a.mu.Unlock()
+
+	req.Header.Set("token", token)
+	resp, err := send(a.client, req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	resp.Body.Close()
+	if invalidApplication(resp.StatusCode, body) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidApplication, bytes.TrimSpace(body))
+	}
+
+	a.mu.Lock()
+	if a.token == token {
+		slog.Info("glow session expired, logging in again")
+		newToken, authErr := doAuth(a.client, a.username, a.password)
+		if authErr != nil {
+			a.renewErr = authErr
+			a.mu.Unlock()
+			return nil, fmt.Errorf("renew session: %w", authErr)
+		}
+		a.token, a.renewErr = newToken, nil
+	}
+	token = a.token
+	a.mu.Unlock()
+
+	retry := req.Clone(req.Context())
+	retry.Header.Set("token", token)
+	return send(a.client, retry)
 }
 
-func doAuth(username, password string) (string, error) {
+// send sends req with client, counting it by endpoint: the path with
+// resource and virtual entity IDs replaced by {id}.
+func send(client *http.Client, req *http.Request) (*http.Response, error) {
+	name := endpointName(req.URL.Path)
+	started := time.Now()
+	resp, err := client.Do(req)
+	requestSecondsTotal.Add(time.Since(started).Seconds(), name)
+	if err != nil {
+		requestsTotal.Inc(name, "error")
+	} else {
+		requestsTotal.Inc(name, strconv.Itoa(resp.StatusCode))
+	}
+	return resp, err
+}
+
+func endpointName(path string) string {
+	parts := strings.Split(strings.TrimPrefix(path, "/api/v0-1/"), "/")
+	for i := 1; i < len(parts); i++ {
+		if parts[i-1] == "resource" || parts[i-1] == "virtualentity" {
+			parts[i] = "{id}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// Authenticated reports whether the session is current, which it isn't once
+// it has expired and failed to renew until a later renewal succeeds.
+func (a *API) Authenticated() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.renewErr == nil
+}
+
+func doAuth(client *http.Client, username, password string) (string, error) {
 	type request struct {
 		Username      string `json:"username"`
 		Password      string `json:"password"`
@@ -60,7 +182,12 @@ func doAuth(username, password string) (string, error) {
 		return "", serErr
 	}
 
-	resp, postErr := http.Post(endpoint+"/auth", "application/json", bytes.NewBuffer(reqBody))
+	req, newReqErr := http.NewRequest("POST", endpoint+"/auth", bytes.NewBuffer(reqBody))
+	if newReqErr != nil {
+		return "", newReqErr
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, postErr := send(client, req)
 	if postErr != nil {
 		return "", postErr
 	}
@@ -70,6 +197,12 @@ func doAuth(username, password string) (string, error) {
 		body, _ := io.ReadAll(resp.Body)
 		slog.Info("auth rejected", "httpStatus", resp.StatusCode, "body", string(body))
 
+		if invalidApplication(resp.StatusCode, body) {
+			return "", fmt.Errorf("%w: %s", ErrInvalidApplication, bytes.TrimSpace(body))
+		}
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return "", fmt.Errorf("%w: http status code %d", ErrRejected, resp.StatusCode)
+		}
 		return "", fmt.Errorf("http status code %d", resp.StatusCode)
 	}
 
@@ -84,7 +217,7 @@ func doAuth(username, password string) (string, error) {
 	}
 
 	if !authResp.Valid {
-		return "", errors.New("auth response without valid=True")
+		return "", fmt.Errorf("%w: auth response without valid=True", ErrRejected)
 	}
 
 	return authResp.Token, nil
@@ -134,6 +267,44 @@ type Resource struct {
 	OwnerId string `json:"ownerId"`
 }
 
+// KWhScale is what the resource's readings are multiplied by to be in kWh,
+// from the unit its storage records. Some meters report in Wh. Readings in
+// other units, such as pence, are left as they are.
+func (r *Resource) KWhScale() (scale float64, unit string) {
+	for _, storage := range r.Storage {
+		for _, field := range storage.Fields {
+			if field.Unit == "" {
+				continue
+			}
+			switch strings.ToLower(field.Unit) {
+			case "wh":
+				return 0.001, field.Unit
+			case "mwh":
+				return 1000, field.Unit
+			default:
+				return 1, field.Unit
+			}
+		}
+	}
+	return 1, ""
+}
+
+// Exports reports whether the resource measures energy sent to the grid: an
+// export meter, or a net meter whose readings go negative when exporting.
+func (r *Resource) Exports() bool {
+	if strings.Contains(r.Classifier, "export") {
+		return true
+	}
+	for _, storage := range r.Storage {
+		for _, field := range storage.Fields {
+			if field.Negative {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 type ResourceReadingsQuery struct {
 	ID string `json:"id"`
 	// the aggregation period of the readings, example, P1D for daily aggregation or PT30M for every 30 minutes
@@ -142,6 +313,10 @@ type ResourceReadingsQuery struct {
 	Function string    `json:"function"`
 	From     time.Time `json:"from"`
 	To       time.Time `json:"to"`
+	// Offset is the timezone P1D and longer periods are bucketed in, as
+	// minutes to subtract from local time to get UTC, e.g. -60 for BST.
+	// Zero buckets in UTC.
+	Offset int `json:"offset"`
 }
 
 type ResourceReadings struct {
@@ -168,10 +343,9 @@ func (a *API) GetVirtualEntity(id string) (*VirtualEntity, error) {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("token", a.token)
 	req.Header.Set("applicationId", applicationID)
 
-	resp, getErr := http.DefaultClient.Do(req)
+	resp, getErr := a.do(req)
 	if getErr != nil {
 		return nil, getErr
 	}
@@ -204,10 +378,9 @@ func (a *API) GetResource(id string) (*Resource, error) {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("token", a.token)
 	req.Header.Set("applicationId", applicationID)
 
-	resp, getErr := http.DefaultClient.Do(req)
+	resp, getErr := a.do(req)
 	if getErr != nil {
 		return nil, getErr
 	}
@@ -233,6 +406,42 @@ func (a *API) GetResource(id string) (*Resource, error) {
 	return &out, nil
 }
 
+// ListResources returns every resource the account can read.
+func (a *API) ListResources() ([]Resource, error) {
+	req, newReqErr := http.NewRequest("GET", endpoint+"/resource", nil)
+	if newReqErr != nil {
+		return nil, newReqErr
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("applicationId", applicationID)
+
+	resp, getErr := a.do(req)
+	if getErr != nil {
+		return nil, getErr
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		slog.Info("ListResources rejected", "httpStatus", resp.StatusCode, "body", string(body))
+
+		return nil, fmt.Errorf("http status code %d", resp.StatusCode)
+	}
+
+	respBody, readErr := io.ReadAll(resp.Body)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	var out []Resource
+	if deserErr := json.Unmarshal(respBody, &out); deserErr != nil {
+		return nil, deserErr
+	}
+
+	return out, nil
+}
+
 /*
 	RequestResourceCatchup triggers an async request to DCC
 
@@ -256,10 +465,9 @@ func (a *API) RequestResourceCatchup(id string) error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("token", a.token)
 	req.Header.Set("applicationId", applicationID)
 
-	resp, getErr := http.DefaultClient.Do(req)
+	resp, getErr := a.do(req)
 	if getErr != nil {
 		return getErr
 	}
@@ -302,10 +510,9 @@ func (a *API) GetResourceFirstTime(id string) (time.Time, error) {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("token", a.token)
 	req.Header.Set("applicationId", applicationID)
 
-	resp, getErr := http.DefaultClient.Do(req)
+	resp, getErr := a.do(req)
 	if getErr != nil {
 		return time.Time{}, getErr
 	}
@@ -344,10 +551,9 @@ func (a *API) GetResourceLastTime(id string) (time.Time, error) {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("token", a.token)
 	req.Header.Set("applicationId", applicationID)
 
-	resp, getErr := http.DefaultClient.Do(req)
+	resp, getErr := a.do(req)
 	if getErr != nil {
 		return time.Time{}, getErr
 	}
@@ -379,6 +585,9 @@ func (a *API) GetResourceReadings(query ResourceReadingsQuery) (*ResourceReading
 	params.Set("function", query.Function)
 	params.Set("from", (&Time{query.From}).String())
 	params.Set("to", (&Time{query.To}).String())
+	if query.Offset != 0 {
+		params.Set("offset", strconv.Itoa(query.Offset))
+	}
 
 	req, newReqErr := http.NewRequest("GET", endpoint+"/resource/"+query.ID+"/readings?"+params.Encode(), nil)
 	if newReqErr != nil {
@@ -386,10 +595,9 @@ func (a *API) GetResourceReadings(query ResourceReadingsQuery) (*ResourceReading
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("token", a.token)
 	req.Header.Set("applicationId", applicationID)
 
-	resp, getErr := http.DefaultClient.Do(req)
+	resp, getErr := a.do(req)
 	if getErr != nil {
 		return nil, getErr
 	}
@@ -422,10 +630,9 @@ func (a *API) Tariff(resourceID string) (*Tariff, error) {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("token", a.token)
 	req.Header.Set("applicationId", applicationID)
 
-	resp, getErr := http.DefaultClient.Do(req)
+	resp, getErr := a.do(req)
 	if getErr != nil {
 		return nil, getErr
 	}
@@ -0,0 +1,230 @@
+package glowapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/goleak"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// fakeGlow issues a new token on each login and accepts only the latest.
+type fakeGlow struct {
+	logins atomic.Int32
+	reject bool
+	// revoked refuses the application ID on every request.
+	revoked atomic.Bool
+}
+
+func (f *fakeGlow) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.revoked.Load() {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": "Invalid applicationId"})
+		return
+	}
+	if r.URL.Path == "/api/v0-1/auth" {
+		if f.reject {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := f.logins.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{"valid": true, "token": fmt.Sprint("token-", n)})
+		return
+	}
+
+	if r.Header.Get("token") != fmt.Sprint("token-", f.logins.Load()) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"firstTs": 1700000000}})
+}
+
+// redirect sends every request to the test server in place of Glow.
+type redirect struct {
+	to   *url.URL
+	base http.RoundTripper
+}
+
+func (rt redirect) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme = rt.to.Scheme
+	r.URL.Host = rt.to.Host
+	return rt.base.RoundTrip(r)
+}
+
+func testClient(t *testing.T, handler http.Handler) *http.Client {
+	server := httptest.NewServer(handler)
+	to, _ := url.Parse(server.URL)
+	transport := &http.Transport{}
+	t.Cleanup(func() {
+		transport.CloseIdleConnections()
+		server.Close()
+	})
+	return &http.Client{Transport: redirect{to: to, base: transport}}
+}
+
+func TestSessionRenewal(t *testing.T) {
+	glow := &fakeGlow{}
+	api, authErr := Authenticate(testClient(t, glow), "user", "pass")
+	if authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	// Expire the session by logging in elsewhere
+	glow.logins.Add(1)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := api.GetResourceFirstTime("resource")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The requests that all saw the expired token share one renewal
+	if logins := glow.logins.Load(); logins != 3 {
+		t.Errorf("logged in %d times, want 3", logins)
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	endpoint := "resource/{id}/first-time"
+	ok, expired := requestsTotal.Value(endpoint, "200"), requestsTotal.Value(endpoint, "401")
+	glow := &fakeGlow{}
+	api, authErr := Authenticate(testClient(t, glow), "user", "pass")
+	if authErr != nil {
+		t.Fatal(authErr)
+	}
+	glow.logins.Add(1)
+	if _, err := api.GetResourceFirstTime("abc123"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The request refused with the expired session and its retry are both
+	// counted, under the endpoint rather than the resource
+	if got := requestsTotal.Value(endpoint, "200") - ok; got != 1 {
+		t.Errorf("counted %v successful requests, want 1", got)
+	}
+	if got := requestsTotal.Value(endpoint, "401") - expired; got != 1 {
+		t.Errorf("counted %v refused requests, want 1", got)
+	}
+	if requestSecondsTotal.Value(endpoint) <= 0 {
+		t.Error("no time counted")
+	}
+}
+
+func TestAuthenticateRejected(t *testing.T) {
+	_, err := Authenticate(testClient(t, &fakeGlow{reject: true}), "user", "wrong")
+	if !errors.Is(err, ErrRejected) {
+		t.Errorf("got %v, want ErrRejected", err)
+	}
+}
+
+func TestInvalidApplication(t *testing.T) {
+	glow := &fakeGlow{}
+	api, authErr := Authenticate(testClient(t, glow), "user", "pass")
+	if authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	// Logging in again can't help, so isn't tried
+	glow.revoked.Store(true)
+	if _, err := api.GetResourceFirstTime("resource"); !errors.Is(err, ErrInvalidApplication) {
+		t.Errorf("got %v, want ErrInvalidApplication", err)
+	}
+	if logins := glow.logins.Load(); logins != 1 {
+		t.Errorf("logged in %d times, want 1", logins)
+	}
+	if _, err := Authenticate(testClient(t, glow), "user", "pass"); !errors.Is(err, ErrInvalidApplication) || errors.Is(err, ErrRejected) {
+		t.Errorf("got %v, want ErrInvalidApplication rather than ErrRejected", err)
+	}
+}
+
+func TestInvalidApplicationBody(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   bool
+	}{
+		{http.StatusUnauthorized, `{"valid":false,"error":"Invalid applicationId"}`, true},
+		{http.StatusForbidden, `{"error":"invalid applicationid"}`, true},
+		{http.StatusBadRequest, `{"error":"Invalid applicationId"}`, false},
+		{http.StatusUnauthorized, `{"error":"Invalid token"}`, false},
+		{http.StatusUnauthorized, `{"message":"expected Content-Type application/json"}`, false},
+		{http.StatusForbidden, `<html><body>Proxy denied: application blocked</body></html>`, false},
+	}
+	for _, tt := range tests {
+		if got := invalidApplication(tt.status, []byte(tt.body)); got != tt.want {
+			t.Errorf("invalidApplication(%d, %s) = %v, want %v", tt.status, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestKWhScale(t *testing.T) {
+	tests := []struct {
+		name      string
+		resource  string
+		wantScale float64
+		wantUnit  string
+	}{
+		{"kWh meter", `{"storage": [{"type": "onchange", "sampling": "PT30M", "fields": [{"fieldName": "value", "unit": "kWh", "datatype": "float"}]}]}`, 1, "kWh"},
+		{"Wh meter", `{"storage": [{"type": "onchange", "sampling": "PT30M", "fields": [{"fieldName": "value", "unit": "Wh", "datatype": "float"}]}]}`, 0.001, "Wh"},
+		{"MWh meter", `{"storage": [{"type": "onchange", "sampling": "PT30M", "fields": [{"fieldName": "value", "unit": "MWh", "datatype": "float"}]}]}`, 1000, "MWh"},
+		{"cost", `{"storage": [{"type": "onchange", "sampling": "PT30M", "fields": [{"fieldName": "value", "unit": "pence", "datatype": "float"}]}]}`, 1, "pence"},
+		{"unit on a later field", `{"storage": [{"fields": [{"fieldName": "ts"}]}, {"fields": [{"fieldName": "value", "unit": "Wh"}]}]}`, 0.001, "Wh"},
+		{"no unit", `{"storage": []}`, 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r Resource
+			if err := json.Unmarshal([]byte(tt.resource), &r); err != nil {
+				t.Fatal(err)
+			}
+			if scale, unit := r.KWhScale(); scale != tt.wantScale || unit != tt.wantUnit {
+				t.Errorf("got %v %q, want %v %q", scale, unit, tt.wantScale, tt.wantUnit)
+			}
+		})
+	}
+}
+
+func TestExports(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource string
+		want     bool
+	}{
+		{"consumption", `{"classifier": "electricity.consumption", "storage": [{"fields": [{"fieldName": "value", "unit": "kWh", "negative": false}]}]}`, false},
+		{"export meter", `{"classifier": "electricity.export", "storage": [{"fields": [{"fieldName": "value", "unit": "kWh"}]}]}`, true},
+		{"net meter", `{"classifier": "electricity.consumption", "storage": [{"fields": [{"fieldName": "value", "unit": "kWh", "negative": true}]}]}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r Resource
+			if err := json.Unmarshal([]byte(tt.resource), &r); err != nil {
+				t.Fatal(err)
+			}
+			if got := r.Exports(); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
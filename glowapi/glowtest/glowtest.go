@@ -0,0 +1,265 @@
+// Package glowtest is a fake Glow API for tests. It serves half-hourly
+// readings up to the time on a clock, so that long-running behaviour can be
+// simulated with a fake or accelerated clock.
+package glowtest
+
+import (
+	"encoding/json"
+	"energy-meter-scraper/clock"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const glowTimeLayout = "2006-01-02T15:04:05"
+
+type Server struct {
+	// First is when the meter's readings begin.
+	First time.Time
+	// Delay is how far the latest reading lags behind the clock, as DCC
+	// data does.
+	Delay time.Duration
+	// SessionLength is how long a token is accepted. Zero never expires.
+	SessionLength time.Duration
+	// Resources are the IDs listed as the account's resources.
+	Resources []string
+	// CatchupFailures is how many of the next catchup requests fail, as
+	// they routinely do.
+	CatchupFailures int
+	// Usage is the value of a resource's reading for the slot starting at
+	// t. If nil every reading is 0.25.
+	Usage func(resource string, t time.Time) float64
+	// Missing reports whether the slot starting at t has no reading, as
+	// during a DCC outage. If nil every slot has one.
+	Missing func(resource string, t time.Time) bool
+	// Units are the units resources' metadata gives their readings in. A
+	// resource not listed is in kWh.
+	Units map[string]string
+	// Negative are the resources whose metadata allows negative readings,
+	// as a net meter's does.
+	Negative map[string]bool
+
+	clock     clock.Clock
+	server    *httptest.Server
+	transport *http.Transport
+
+	mu       sync.Mutex
+	tokens   map[string]time.Time
+	logins   int
+	requests int
+	revoked  bool
+}
+
+// New starts a fake Glow API whose readings begin at first.
+func New(c clock.Clock, first time.Time) *Server {
+	s := &Server{First: first, clock: c, tokens: map[string]time.Time{}, transport: &http.Transport{}}
+	s.server = httptest.NewServer(s)
+	return s
+}
+
+func (s *Server) Close() {
+	s.transport.CloseIdleConnections()
+	s.server.Close()
+}
+
+// Client returns an HTTP client that sends Glow requests to the fake.
+func (s *Server) Client() *http.Client {
+	to, _ := url.Parse(s.server.URL)
+	return &http.Client{Transport: redirect{to: to, base: s.transport}}
+}
+
+// Logins is how many times a session has been started.
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+// Requests is how many authenticated requests have been served.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// RevokeApplication makes every request fail as Glow does once it no
+// longer accepts the application ID.
+func (s *Server) RevokeApplication() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked = true
+}
+
+// Last is the start of the latest reading available now.
+func (s *Server) Last() time.Time {
+	return s.clock.Now().Add(-s.Delay).Truncate(30 * time.Minute).Add(-30 * time.Minute)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v0-1")
+	s.mu.Lock()
+	revoked := s.revoked
+	s.mu.Unlock()
+	if revoked {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"valid":false,"error":"Invalid applicationId"}`)
+		return
+	}
+	if path == "/auth" {
+		s.login(w)
+		return
+	}
+	if !s.authorized(r.Header.Get("token")) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if path == "/resource" {
+		var listed []any
+		for _, id := range s.Resources {
+			listed = append(listed, map[string]any{"resourceId": id, "name": id, "classifier": "electricity.consumption"})
+		}
+		writeJSON(w, listed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) == 2 && parts[0] == "resource" {
+		unit, ok := s.Units[parts[1]]
+		if !ok {
+			unit = "kWh"
+		}
+		writeJSON(w, map[string]any{"resourceId": parts[1], "storage": []any{map[string]any{
+			"type": "onchange", "sampling": "PT30M",
+			"fields": []any{map[string]any{"fieldName": "value", "unit": unit, "datatype": "float", "negative": s.Negative[parts[1]]}},
+		}}})
+		return
+	}
+	if len(parts) != 3 || parts[0] != "resource" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	id := parts[1]
+
+	switch parts[2] {
+	case "catchup":
+		s.mu.Lock()
+		valid := s.CatchupFailures <= 0
+		s.CatchupFailures--
+		s.mu.Unlock()
+		writeJSON(w, map[string]any{"data": map[string]any{"valid": valid}})
+	case "first-time":
+		writeJSON(w, map[string]any{"data": map[string]any{"firstTs": s.First.Unix()}})
+	case "last-time":
+		writeJSON(w, map[string]any{"data": map[string]any{"lastTs": s.Last().Unix()}})
+	case "tariff":
+		writeJSON(w, map[string]any{"data": []any{map[string]any{
+			"from":         s.First.UTC().Format(glowTimeLayout),
+			"currentRates": map[string]any{"rate": 24.5, "standingCharge": 53.2},
+		}}})
+	case "readings":
+		s.readings(w, r, id)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *Server) login(w http.ResponseWriter) {
+	s.mu.Lock()
+	s.logins++
+	token := fmt.Sprint("token-", s.logins)
+	expires := time.Time{}
+	if s.SessionLength > 0 {
+		expires = s.clock.Now().Add(s.SessionLength)
+	}
+	s.tokens[token] = expires
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]any{"valid": true, "token": token})
+}
+
+func (s *Server) authorized(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.tokens[token]
+	if !ok {
+		return false
+	}
+	if !expires.IsZero() && !s.clock.Now().Before(expires) {
+		delete(s.tokens, token)
+		return false
+	}
+	s.requests++
+	return true
+}
+
+func (s *Server) readings(w http.ResponseWriter, r *http.Request, id string) {
+	from, fromErr := time.Parse(glowTimeLayout, r.URL.Query().Get("from"))
+	to, toErr := time.Parse(glowTimeLayout, r.URL.Query().Get("to"))
+	if fromErr != nil || toErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if first := s.First.Truncate(30 * time.Minute); from.Before(first) {
+		from = first
+	}
+	if last := s.Last(); to.After(last) {
+		to = last
+	}
+
+	data := [][2]float64{}
+	for t := from.Truncate(30 * time.Minute); !t.After(to); t = t.Add(30 * time.Minute) {
+		if t.Before(from) || (s.Missing != nil && s.Missing(id, t)) {
+			continue
+		}
+		value := 0.25
+		if s.Usage != nil {
+			value = s.Usage(id, t)
+		}
+		data = append(data, [2]float64{float64(t.Unix()), value})
+	}
+	if r.URL.Query().Get("period") == "P1D" {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		data = daily(data, time.Duration(offset)*time.Minute)
+	}
+	writeJSON(w, map[string]any{"resourceId": id, "data": data})
+}
+
+// daily sums slots into days, which Glow moves from UTC midnight by offset:
+// an offset of -60 buckets BST days.
+func daily(slots [][2]float64, offset time.Duration) [][2]float64 {
+	var days [][2]float64
+	for _, slot := range slots {
+		t := time.Unix(int64(slot[0]), 0).UTC()
+		day := float64(t.Add(-offset).Truncate(24 * time.Hour).Add(offset).Unix())
+		if len(days) == 0 || days[len(days)-1][0] != day {
+			days = append(days, [2]float64{day, 0})
+		}
+		days[len(days)-1][1] += slot[1]
+	}
+	return days
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// redirect sends every request to the fake in place of Glow.
+type redirect struct {
+	to   *url.URL
+	base http.RoundTripper
+}
+
+func (rt redirect) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme = rt.to.Scheme
+	r.URL.Host = rt.to.Host
+	return rt.base.RoundTrip(r)
+}
@@ -0,0 +1,152 @@
+// Package googleauth authenticates to Google APIs as a service account,
+// from the JSON key downloaded from the Google Cloud console.
+package googleauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServiceAccount fetches access tokens for a service account with the JWT
+// bearer grant, keeping each until shortly before it expires.
+type ServiceAccount struct {
+	client    *http.Client
+	email     string
+	projectID string
+	key       *rsa.PrivateKey
+	tokenURL  string
+	scope     string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// Load reads a service account's JSON key, for tokens granting scopes.
+func Load(client *http.Client, path string, scopes ...string) (*ServiceAccount, error) {
+	b, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return nil, readErr
+	}
+	var file struct {
+		Type        string `json:"type"`
+		ClientEmail string `json:"client_email"`
+		ProjectID   string `json:"project_id"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if file.Type != "service_account" || file.ClientEmail == "" {
+		return nil, fmt.Errorf("%s is not a service account key", path)
+	}
+	if file.TokenURI == "" {
+		file.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	block, _ := pem.Decode([]byte(file.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("%s: private_key is not PEM", path)
+	}
+	parsed, parseErr := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if parseErr != nil {
+		return nil, fmt.Errorf("%s: private_key: %w", path, parseErr)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: private_key is not an RSA key", path)
+	}
+	return &ServiceAccount{
+		client:    client,
+		email:     file.ClientEmail,
+		projectID: file.ProjectID,
+		key:       key,
+		tokenURL:  file.TokenURI,
+		scope:     strings.Join(scopes, " "),
+	}, nil
+}
+
+// ProjectID is the project the service account belongs to.
+func (a *ServiceAccount) ProjectID() string {
+	return a.projectID
+}
+
+// Token returns an access token for the scopes.
+func (a *ServiceAccount) Token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Now().Before(a.expires) {
+		return a.token, nil
+	}
+
+	assertion, signErr := a.assertion(time.Now())
+	if signErr != nil {
+		return "", signErr
+	}
+	form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+	req, newReqErr := http.NewRequestWithContext(ctx, "POST", a.tokenURL, strings.NewReader(form.Encode()))
+	if newReqErr != nil {
+		return "", newReqErr
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, postErr := a.client.Do(req)
+	if postErr != nil {
+		return "", fmt.Errorf("token: %w", postErr)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token: http status code %d: %s", resp.StatusCode, body)
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", fmt.Errorf("token: %w", err)
+	}
+	if out.AccessToken == "" {
+		return "", errors.New("token: no access_token in response")
+	}
+	a.token = out.AccessToken
+	a.expires = time.Now().Add(time.Duration(out.ExpiresIn)*time.Second - time.Minute)
+	return a.token, nil
+}
+
+// assertion is the signed JWT exchanged for an access token.
+func (a *ServiceAccount) assertion(now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   a.email,
+		"scope": a.scope,
+		"aud":   a.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, signErr := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if signErr != nil {
+		return "", signErr
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
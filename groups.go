@@ -0,0 +1,190 @@
+package main
+
+import (
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/schema"
+	"energy-meter-scraper/sink"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+)
+
+// group is a virtual resource whose usage is the sum of its members', such
+// as the several meters of one site. It is written as energy_usage under its
+// own name and has its own checkpoint.
+type group struct {
+	name    string
+	members []string
+}
+
+func parseGroups(resources []resourceMeta, cfgs []config.GroupConfig) ([]group, error) {
+	byName := map[string]resourceMeta{}
+	for _, r := range resources {
+		byName[r.Name] = r
+	}
+
+	var groups []group
+	seen := map[string]bool{}
+	for _, c := range cfgs {
+		switch _, clash := byName[c.Name]; {
+		case c.Name == "":
+			return nil, errors.New("group without a name")
+		case clash || seen[c.Name]:
+			return nil, fmt.Errorf("%s: name is already used", c.Name)
+		case len(c.Members) < 2:
+			return nil, fmt.Errorf("%s: needs at least two members", c.Name)
+		}
+		seen[c.Name] = true
+
+		for _, m := range c.Members {
+			r, ok := byName[m]
+			if !ok {
+				return nil, fmt.Errorf("%s: no resource named %q", c.Name, m)
+			}
+			if r.IsElectricity() != byName[c.Members[0]].IsElectricity() {
+				return nil, fmt.Errorf("%s: members mix electricity and gas", c.Name)
+			}
+		}
+		groups = append(groups, group{name: c.Name, members: slices.Clone(c.Members)})
+	}
+	return groups, nil
+}
+
+func (g group) meta() resourceMeta {
+	return resourceMeta{Name: g.name}
+}
+
+// scrapeGroups adds each group's combined usage to scraped, from its own
+// checkpoint up to the latest slot every member has.
+func scrapeGroups(st *settings, scraped map[string]resourcePoints) {
+	for _, g := range st.groups {
+		rp, err := scrapeGroup(st, g, scraped)
+		if err != nil {
+			slog.Warn("not combining group this cycle", "group", g.name, "error", err)
+			continue
+		}
+		scraped[g.name] = rp
+	}
+}
+
+func scrapeGroup(st *settings, g group, scraped map[string]resourcePoints) (resourcePoints, error) {
+	var to time.Time
+	var members []string
+	for _, m := range g.members {
+		// A dormant meter has stopped contributing, and would otherwise hold
+		// the group back for good
+		if isDormantResource(m) {
+			continue
+		}
+		rp, ok := scraped[m]
+		if !ok {
+			return resourcePoints{}, fmt.Errorf("%s was not scraped", m)
+		}
+		if meta := st.resources[slices.IndexFunc(st.resources, func(r resourceMeta) bool { return r.Name == m })]; resourceExports(meta.KWHResource) {
+			return resourcePoints{}, fmt.Errorf("%s is an export meter, which can't be summed with consumption", m)
+		}
+		if to.IsZero() || rp.through.Before(to) {
+			to = rp.through
+		}
+		members = append(members, m)
+	}
+	if len(members) == 0 {
+		return resourcePoints{}, errors.New("every member is dormant")
+	}
+
+	from := to.Add(-st.cfg.Scrape.Lookback)
+	if last, ok := st.checkpoints.Last(g.name); ok {
+		from = last
+	}
+	from = reachProvisional(st, from, to)
+
+	usage := map[string][]sink.Point{}
+	for _, m := range members {
+		points := scraped[m].usage
+		// A member whose checkpoint is ahead of the group's, e.g. as the
+		// group was added later, is read again for the slots between
+		earliest := scraped[m].through
+		if len(points) > 0 {
+			first, _ := pointsSpan(points)
+			earliest = st.stamps.Start(first, 30*time.Minute)
+		}
+		if from.Before(earliest) {
+			meta := st.resources[slices.IndexFunc(st.resources, func(r resourceMeta) bool { return r.Name == m })]
+			earlier, readErr := readUsage(st, meta, from, earliest)
+			if readErr != nil {
+				return resourcePoints{}, fmt.Errorf("%s: %w", m, readErr)
+			}
+			points = append(earlier, points...)
+		}
+		usage[m] = points
+	}
+
+	return resourcePoints{usage: combineUsage(st, g.name, usage, from, to), through: to}, nil
+}
+
+// combineUsage sums the members' energy_usage points into the group's, for
+// the slots starting from from to to. Slots some member lacks are left out,
+// and kwh or pence is only summed if every member has it.
+func combineUsage(st *settings, name string, members map[string][]sink.Point, from, to time.Time) []sink.Point {
+	type total struct {
+		at      time.Time
+		members int
+		fields  map[string]float64
+		counts  map[string]int
+	}
+	totals := map[int64]*total{}
+	for _, points := range members {
+		// Slots can be read twice where a member's earlier read meets its scrape
+		seen := map[int64]bool{}
+		for _, p := range points {
+			start := st.stamps.Start(p.Time, 30*time.Minute)
+			key := p.Time.UnixNano()
+			if start.Before(from) || start.After(to) || seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			t := totals[key]
+			if t == nil {
+				t = &total{at: p.Time, fields: map[string]float64{}, counts: map[string]int{}}
+				totals[key] = t
+			}
+			t.members++
+			for _, field := range []string{"kwh", "pence"} {
+				if v, ok := p.Fields[field].(float64); ok {
+					t.fields[field] += v
+					t.counts[field]++
+				}
+			}
+		}
+	}
+
+	var points []sink.Point
+	incomplete := 0
+	for _, key := range slices.Sorted(maps.Keys(totals)) {
+		t := totals[key]
+		fields := map[string]any{}
+		for field, v := range t.fields {
+			if t.counts[field] == len(members) {
+				fields[field] = v
+			}
+		}
+		if t.members < len(members) || len(fields) == 0 {
+			incomplete++
+			continue
+		}
+		points = append(points, schema.Stamp(sink.Point{
+			Measurement: "energy_usage",
+			Tags:        map[string]string{"resource": name, "period": "30m"},
+			Fields:      fields,
+			Time:        t.at,
+		}))
+	}
+	if incomplete > 0 {
+		slog.Warn("some members lack slots; leaving them out of the group", "group", name, "slots", incomplete)
+	}
+	return points
+}
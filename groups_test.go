@@ -0,0 +1,143 @@
+package main
+
+import (
+	"energy-meter-scraper/checkpoint"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/glowapi/glowtest"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/slot"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseGroups(t *testing.T) {
+	resources := []resourceMeta{{Name: "main", Fuel: "electricity"}, {Name: "annex", Fuel: "electricity"}, {Name: "gas", Fuel: "gas"}}
+
+	groups, err := parseGroups(resources, []config.GroupConfig{{Name: "site", Members: []string{"main", "annex"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].name != "site" || len(groups[0].members) != 2 {
+		t.Errorf("got %+v", groups)
+	}
+
+	tests := map[string][]config.GroupConfig{
+		"no name":        {{Members: []string{"main", "annex"}}},
+		"resource name":  {{Name: "main", Members: []string{"main", "annex"}}},
+		"duplicate":      {{Name: "site", Members: []string{"main", "annex"}}, {Name: "site", Members: []string{"main", "annex"}}},
+		"one member":     {{Name: "site", Members: []string{"main"}}},
+		"unknown member": {{Name: "site", Members: []string{"main", "shed"}}},
+		"mixed fuels":    {{Name: "site", Members: []string{"main", "gas"}}},
+	}
+	for name, cfgs := range tests {
+		if _, err := parseGroups(resources, cfgs); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestCombineUsage(t *testing.T) {
+	st := &settings{stamps: slot.Policy{Precision: time.Second, Align: slot.AlignStart}}
+	at := func(slot int) time.Time {
+		return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(slot) * 30 * time.Minute)
+	}
+	usage := func(slot int, fields map[string]any) sink.Point {
+		return sink.Point{Measurement: "energy_usage", Fields: fields, Time: at(slot)}
+	}
+
+	members := map[string][]sink.Point{
+		"main": {
+			usage(0, map[string]any{"kwh": 1.0, "pence": 25.0}),
+			usage(1, map[string]any{"kwh": 2.0, "pence": 50.0}),
+			usage(2, map[string]any{"kwh": 3.0, "pence": 75.0}),
+			// Read twice where an earlier read meets the scrape
+			usage(2, map[string]any{"kwh": 3.0, "pence": 75.0}),
+		},
+		"annex": {
+			usage(0, map[string]any{"kwh": 0.5, "pence": 12.5}),
+			usage(1, map[string]any{"kwh": 0.5}),
+		},
+	}
+	points := combineUsage(st, "site", members, at(0), at(2))
+
+	if len(points) != 2 {
+		t.Fatalf("got %d points, want the 2 slots both members have", len(points))
+	}
+	if p := points[0]; p.Tags["resource"] != "site" || p.Fields["kwh"] != 1.5 || p.Fields["pence"] != 37.5 {
+		t.Errorf("first slot is %v %v", p.Tags, p.Fields)
+	}
+	if p := points[1]; p.Fields["kwh"] != 2.5 || p.Fields["pence"] != nil {
+		t.Errorf("second slot is %v, want kwh summed and pence left out as annex lacks it", p.Fields)
+	}
+}
+
+func TestScrapeGroupReadsBehindMembers(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fakeClock(t, now)
+
+	fakeGlow := glowtest.New(clk, now.AddDate(0, 0, -5))
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	checkpoints, checkpointsErr := checkpoint.Open(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if checkpointsErr != nil {
+		t.Fatal(checkpointsErr)
+	}
+	cfg := &config.Config{Resources: []config.Resource{
+		{Name: "main", KWHResource: "main-kwh", PenceResource: "main-pence"},
+		{Name: "annex", KWHResource: "annex-kwh", PenceResource: "annex-pence"},
+	}}
+	st := &settings{
+		cfg:         cfg,
+		resources:   cfg.Resources,
+		stamps:      slot.Policy{Precision: time.Second, Align: slot.AlignStart},
+		groups:      []group{{name: "site", members: []string{"main", "annex"}}},
+		checkpoints: checkpoints,
+	}
+
+	last := fakeGlow.Last()
+	groupFrom := last.Add(-3 * time.Hour)
+	if err := checkpoints.Set("site", groupFrom); err != nil {
+		t.Fatal(err)
+	}
+	scraped := map[string]resourcePoints{}
+	for _, meta := range st.resources {
+		// Both members were scraped from later than the group's checkpoint
+		usage, usageErr := readUsage(st, meta, last.Add(-time.Hour), last)
+		if usageErr != nil {
+			t.Fatal(usageErr)
+		}
+		scraped[meta.Name] = resourcePoints{usage: usage, through: last}
+	}
+
+	scrapeGroups(st, scraped)
+	rp, ok := scraped["site"]
+	if !ok {
+		t.Fatal("group was not combined")
+	}
+	if want := 7; len(rp.usage) != want {
+		t.Errorf("group has %d slots, want %d from its checkpoint to the latest", len(rp.usage), want)
+	}
+	if !rp.through.Equal(last) {
+		t.Errorf("group is through %v, want %v", rp.through, last)
+	}
+	for _, p := range rp.usage {
+		if p.Fields["kwh"] != 0.5 {
+			t.Errorf("slot at %v is %v kWh, want both members' 0.25", p.Time, p.Fields["kwh"])
+		}
+	}
+
+	delete(scraped, "site")
+	delete(scraped, "annex")
+	scrapeGroups(st, scraped)
+	if _, ok := scraped["site"]; ok {
+		t.Error("group was combined without one of its members")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/alert"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/metrics"
+	"energy-meter-scraper/transport"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+)
+
+// invalidApplicationHelp is what to do when Glow refuses the application
+// ID, which is built in rather than the user's.
+const invalidApplicationHelp = "Glow no longer accepts this version's application ID. " +
+	"Upgrade energy-meter-scraper, then restart or reload it."
+
+var (
+	// halted stops the scheduled jobs once Glow refuses the application
+	// ID, as every request would be refused until it changes.
+	halted atomic.Bool
+
+	haltedGauge = metrics.NewGauge("scraper_halted",
+		"1 if scraping has stopped because Glow refused the application ID.")
+
+	errHalted = errors.New("halted as glow refused the application ID")
+)
+
+// halt stops scraping after Glow refuses the application ID, alerting
+// once rather than failing every cycle.
+func halt(err error) {
+	if halted.Swap(true) {
+		return
+	}
+	haltedGauge.Set(1)
+	slog.Error("halting scraping", "error", err, "help", invalidApplicationHelp)
+	alert.Send(context.Background(), alert.Alert{
+		Key:     "glow/application",
+		Title:   "Scraping halted: Glow refused the application ID",
+		Message: invalidApplicationHelp,
+	})
+}
+
+// resumeAfterHalt logs in to Glow again on reload, resuming if it is
+// accepted, so that a fix doesn't need a restart.
+func resumeAfterHalt(cfg *config.Config) {
+	if !halted.Load() {
+		return
+	}
+	glowHTTP, glowHTTPErr := transport.NewClient(cfg.Glow.HTTP, cfg.Network)
+	if glowHTTPErr != nil {
+		slog.Error("glow http config", "error", glowHTTPErr)
+		return
+	}
+	api, authErr := glowapi.Authenticate(glowHTTP, cfg.Glow.Username, cfg.Glow.Password)
+	if authErr != nil {
+		slog.Error("glow still refuses to log in; staying halted", "error", authErr)
+		return
+	}
+
+	scrapeMu.Lock()
+	glow = api
+	scrapeMu.Unlock()
+	glowSession.Store(api)
+	halted.Store(false)
+	haltedGauge.Set(0)
+	slog.Info("logged in to glow again; resuming scraping")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/glowapi/glowtest"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/slot"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHaltOnInvalidApplication(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 5, 0, 0, time.UTC)
+	fakeClock(t, now)
+	alerts := captureAlerts(t)
+	t.Cleanup(func() {
+		halted.Store(false)
+		haltedGauge.Set(0)
+	})
+
+	fakeGlow := glowtest.New(clk, now.AddDate(0, 0, -2))
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	cfg := &config.Config{Resources: []config.Resource{{Name: "halt-test", KWHResource: "kwh", PenceResource: "pence"}}}
+	cfg.Scrape.Lookback = 24 * time.Hour
+	st := &settings{
+		cfg:       cfg,
+		resources: cfg.Resources,
+		sinks:     []sink.Sink{newMemorySink()},
+		stamps:    slot.Policy{Precision: time.Second, Align: slot.AlignStart},
+	}
+
+	// The cycle fails without logging in again, and halts with one alert
+	fakeGlow.RevokeApplication()
+	logins := fakeGlow.Logins()
+	if result := scrapeCycle(st); result != cycleFailed {
+		t.Fatalf("result %v, want cycleFailed", result)
+	}
+	if !halted.Load() || fakeGlow.Logins() != logins {
+		t.Fatalf("halted %v after %d logins, want halted without logging in", halted.Load(), fakeGlow.Logins()-logins)
+	}
+	scrapeCycle(st)
+	if got := alerts(); len(got) != 1 || got[0].Key != "glow/application" {
+		t.Errorf("alerts %+v, want one for the application ID", got)
+	}
+
+	// Nothing else is attempted until it resumes
+	if err := triggerCycle(); !errors.Is(err, errHalted) {
+		t.Errorf("trigger err %v, want errHalted", err)
+	}
+	ran := false
+	whenActive(func(*settings) { ran = true })(st)
+	if ran {
+		t.Error("job ran while halted")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"energy-meter-scraper/glowapi"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// glowSession is the Glow session once logged in, for readiness checks
+// that can't take scrapeMu to read glow.
+var glowSession atomic.Pointer[glowapi.API]
+
+// serveHealth runs /healthz and /readyz for orchestrators. It starts before
+// logging in to Glow, so that a scraper waiting out the startup delay or
+// retrying authentication is alive but not ready. The listen address only
+// takes effect on restart.
+func serveHealth(addr string) {
+	slog.Info("serving health checks", "addr", addr)
+	srv := &http.Server{Addr: addr, Handler: healthHandler(), ReadHeaderTimeout: 10 * time.Second}
+	if err := srv.ListenAndServe(); err != nil {
+		slog.Error("health server stopped", "error", err)
+	}
+}
+
+func healthHandler() http.Handler {
+	mux := http.NewServeMux()
+	// The process answering is all liveness checks
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, _ *http.Request) {
+		state, err := readiness(live())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, state)
+	})
+	return mux
+}
+
+// readiness returns an error unless the scraper is logged in to Glow and a
+// cycle has succeeded within the configured age. A standby or paused
+// instance isn't expected to have, so is ready once logged in.
+func readiness(st *settings) (string, error) {
+	if session := glowSession.Load(); session == nil {
+		return "", errors.New("not authenticated with glow")
+	} else if !session.Authenticated() {
+		return "", errors.New("glow session failed to renew")
+	}
+	if halted.Load() {
+		return "", errHalted
+	}
+	if !primary.Load() {
+		return "standing by", nil
+	}
+	if paused.Load() {
+		return "paused", nil
+	}
+
+	last := lastSuccess.Value()
+	if last == 0 {
+		return "", errors.New("no cycle has succeeded yet")
+	}
+	age := clk.Since(time.Unix(int64(last), 0))
+	if maxAge := st.cfg.Health.MaxAge; age > maxAge {
+		return "", fmt.Errorf("last cycle succeeded %s ago, more than %s", age.Round(time.Second), maxAge)
+	}
+	return "ok", nil
+}
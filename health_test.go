@@ -0,0 +1,72 @@
+package main
+
+import (
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/glowapi/glowtest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadiness(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fake := fakeClock(t, now)
+	cfg := &config.Config{}
+	cfg.Health.MaxAge = 90 * time.Minute
+	publish(&settings{cfg: cfg, sinkRefs: &sinkSet{}})
+	prevSession, prevLast := glowSession.Load(), lastSuccess.Value()
+	t.Cleanup(func() {
+		glowSession.Store(prevSession)
+		lastSuccess.Set(prevLast)
+		setPaused(false)
+	})
+	glowSession.Store(nil)
+	lastSuccess.Set(0)
+
+	srv := httptest.NewServer(healthHandler())
+	defer srv.Close()
+	get := func(path string) int {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Alive but not ready before logging in, or before a cycle succeeds
+	if got := get("/healthz"); got != http.StatusOK {
+		t.Errorf("/healthz %d before logging in, want 200", got)
+	}
+	if got := get("/readyz"); got != http.StatusServiceUnavailable {
+		t.Errorf("/readyz %d before logging in, want 503", got)
+	}
+	fakeGlow := glowtest.New(clk, now.AddDate(0, 0, -1))
+	defer fakeGlow.Close()
+	session, authErr := glowapi.Authenticate(fakeGlow.Client(), "user", "pass")
+	if authErr != nil {
+		t.Fatal(authErr)
+	}
+	glowSession.Store(session)
+	if got := get("/readyz"); got != http.StatusServiceUnavailable {
+		t.Errorf("/readyz %d before a cycle succeeded, want 503", got)
+	}
+
+	lastSuccess.Set(float64(now.Unix()))
+	if got := get("/readyz"); got != http.StatusOK {
+		t.Errorf("/readyz %d after a cycle succeeded, want 200", got)
+	}
+
+	// A stuck scraper stops being ready, unless it was paused
+	fake.Advance(2 * time.Hour)
+	if got := get("/readyz"); got != http.StatusServiceUnavailable {
+		t.Errorf("/readyz %d with the last success 2h ago, want 503", got)
+	}
+	setPaused(true)
+	if got := get("/readyz"); got != http.StatusOK {
+		t.Errorf("/readyz %d while paused, want 200", got)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"energy-meter-scraper/analysis"
+	"energy-meter-scraper/schema"
+	"energy-meter-scraper/sink"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// heatingHistory is how far before a cycle's first slot heating sessions
+// are looked for, so that one running across cycles keeps its start.
+const heatingHistory = 24 * time.Hour
+
+// heating holds each gas resource's recent slots, by the Unix time they
+// start.
+var heating = struct {
+	mu    sync.Mutex
+	slots map[string]map[int64]float64
+}{slots: map[string]map[int64]float64{}}
+
+// heatingPoints returns a heating_session point for each run of heating
+// that usage adds to or ends, inferred from gas use. A session that may
+// still be running is marked ongoing, and rewritten as it grows. The first
+// time a resource is seen its earlier slots are read from Glow, and failing
+// that it is left until the next cycle.
+func heatingPoints(st *settings, meta resourceMeta, usage []sink.Point) []sink.Point {
+	cfg := st.cfg.Heating
+	if !cfg.Enabled || meta.IsElectricity() || len(usage) == 0 {
+		return nil
+	}
+	first, last := pointsSpan(usage)
+	first, last = st.stamps.Start(first, 30*time.Minute), st.stamps.Start(last, 30*time.Minute)
+
+	heating.mu.Lock()
+	defer heating.mu.Unlock()
+
+	slots, seen := heating.slots[meta.Name]
+	if !seen {
+		earlier, readErr := readUsage(st, meta, first.Add(-heatingHistory), first)
+		if readErr != nil {
+			slog.Warn("failed to read earlier usage for heating sessions", "resource", meta.Name, "error", readErr)
+			return nil
+		}
+		slots = map[int64]float64{}
+		heating.slots[meta.Name] = slots
+		usage = slices.Concat(earlier, usage)
+	}
+	for _, p := range usage {
+		if kwh, ok := p.Fields["kwh"].(float64); ok {
+			slots[st.stamps.Start(p.Time, 30*time.Minute).Unix()] = kwh
+		}
+	}
+	cutoff := first.Add(-heatingHistory).Unix()
+	maps.DeleteFunc(slots, func(start int64, _ float64) bool { return start < cutoff })
+
+	var ordered []analysis.Slot
+	for _, start := range slices.Sorted(maps.Keys(slots)) {
+		ordered = append(ordered, analysis.Slot{Start: time.Unix(start, 0), KWh: slots[start]})
+	}
+	if len(ordered) == 0 {
+		return nil
+	}
+
+	var points []sink.Point
+	latestEnd := last.Add(30 * time.Minute)
+	for _, s := range analysis.HeatingSessions(ordered, cfg.MinKWh, cfg.MaxGap, cfg.MinDuration) {
+		// One running since the first slot held may have started earlier,
+		// and was written when it did
+		if s.Start.Equal(ordered[0].Start) || s.End.Before(first) {
+			continue
+		}
+		points = append(points, schema.Stamp(sink.Point{
+			Measurement: "heating_session",
+			Tags:        map[string]string{"resource": meta.Name},
+			Fields: map[string]any{
+				"end":     s.End.Unix(),
+				"minutes": int64(s.End.Sub(s.Start).Minutes()),
+				"kwh":     s.KWh,
+				"ongoing": latestEnd.Sub(s.End) <= cfg.MaxGap,
+			},
+			Time: st.stamps.Truncate(s.Start),
+		}))
+	}
+	return points
+}
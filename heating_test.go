@@ -0,0 +1,83 @@
+package main
+
+import (
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/glowapi/glowtest"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/slot"
+	"testing"
+	"time"
+)
+
+func TestHeatingPoints(t *testing.T) {
+	now := time.Date(2024, 1, 10, 9, 0, 0, 0, time.UTC)
+	fakeClock(t, now)
+	t.Cleanup(func() { heating.slots = map[string]map[int64]float64{} })
+
+	// The heating came on at 6am, before the scraper started
+	on := time.Date(2024, 1, 10, 6, 0, 0, 0, time.UTC)
+	fakeGlow := glowtest.New(clk, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	fakeGlow.Usage = func(resource string, at time.Time) float64 {
+		if !at.Before(on) {
+			return 2
+		}
+		return 0.1
+	}
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	cfg := &config.Config{Resources: []config.Resource{{Name: "gas", KWHResource: "kwh", PenceResource: "pence", Fuel: "gas"}}}
+	cfg.Heating = config.HeatingConfig{Enabled: true, MinKWh: 1, MinDuration: time.Hour, MaxGap: 30 * time.Minute}
+	st := &settings{
+		cfg:       cfg,
+		resources: cfg.Resources,
+		stamps:    slot.Policy{Precision: time.Second, Align: slot.AlignEnd},
+		loc:       time.UTC,
+	}
+	meta := st.resources[0]
+	stamp := func(start time.Time, kwh float64) sink.Point {
+		return sink.Point{Measurement: "energy_usage", Fields: map[string]any{"kwh": kwh},
+			Time: st.stamps.Stamp(start, 30*time.Minute)}
+	}
+
+	points := heatingPoints(st, meta, []sink.Point{stamp(now.Add(-time.Hour), 2), stamp(now.Add(-30*time.Minute), 2)})
+	if len(points) != 1 {
+		t.Fatalf("got %d points, want 1", len(points))
+	}
+	checkHeating(t, points[0], on, 180, true)
+
+	// Once it goes off the session is finished, without reading Glow again
+	requests := fakeGlow.Requests()
+	points = heatingPoints(st, meta, []sink.Point{stamp(now, 0.1), stamp(now.Add(30*time.Minute), 0.1)})
+	if len(points) != 1 {
+		t.Fatalf("got %d points, want 1", len(points))
+	}
+	checkHeating(t, points[0], on, 180, false)
+	if fakeGlow.Requests() != requests {
+		t.Error("read earlier usage again for a resource already seen")
+	}
+
+	// Nothing more comes of it once it is over
+	if points := heatingPoints(st, meta, []sink.Point{stamp(now.Add(2*time.Hour), 0.1)}); points != nil {
+		t.Errorf("points after the session ended: %v", points)
+	}
+	if points := heatingPoints(st, config.Resource{Name: "electricity"}, []sink.Point{stamp(now, 2)}); points != nil {
+		t.Errorf("points for electricity: %v", points)
+	}
+}
+
+func checkHeating(t *testing.T, p sink.Point, start time.Time, minutes int64, ongoing bool) {
+	t.Helper()
+	if p.Measurement != "heating_session" || !p.Time.Equal(start) {
+		t.Errorf("got %s at %v, want heating_session at %v", p.Measurement, p.Time, start)
+	}
+	if p.Fields["minutes"] != minutes || p.Fields["ongoing"] != ongoing {
+		t.Errorf("got %v, want %v minutes, ongoing %v", p.Fields, minutes, ongoing)
+	}
+}
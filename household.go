@@ -0,0 +1,142 @@
+package main
+
+import (
+	"energy-meter-scraper/schema"
+	"energy-meter-scraper/sink"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// household holds each resource's slots for recent days, so that the daily
+// total across fuels can be kept up to date as slots arrive.
+var household = struct {
+	mu sync.Mutex
+	// slots are by resource, then the Unix time the day starts, then the
+	// slot's Unix nanoseconds.
+	slots map[string]map[int64]map[int64]sink.Point
+	// standing is each resource's latest standing charge, in pence per day.
+	standing map[string]float64
+	// written is the last total written for each day.
+	written map[int64]map[string]any
+}{
+	slots:    map[string]map[int64]map[int64]sink.Point{},
+	standing: map[string]float64{},
+	written:  map[int64]map[string]any{},
+}
+
+// householdPoints returns an energy_household point for each day the
+// cycle's usage falls in whose total has changed, summing every fuel's kWh
+// and cost, including standing charges. Export meters and groups are left
+// out, as they would be counted twice. The first time a resource's day is
+// seen its earlier slots are read from Glow, and failing that the day is
+// left until the next cycle.
+func householdPoints(st *settings, scraped map[string]resourcePoints) []sink.Point {
+	if !st.cfg.Scrape.HouseholdTotals {
+		return nil
+	}
+	loc := st.location()
+
+	household.mu.Lock()
+	defer household.mu.Unlock()
+
+	touched := map[int64]bool{}
+	var newest int64
+	for _, meta := range st.resources {
+		rp, ok := scraped[meta.Name]
+		if !ok || resourceExports(meta.KWHResource) {
+			continue
+		}
+		if standing, ok := rp.tariff.Fields["standingCharge"].(float64); ok {
+			household.standing[meta.Name] = standing
+		}
+		if household.slots[meta.Name] == nil {
+			household.slots[meta.Name] = map[int64]map[int64]sink.Point{}
+		}
+		days := household.slots[meta.Name]
+
+		byDay := map[int64][]sink.Point{}
+		for _, p := range slices.Concat(rp.refetched, rp.usage) {
+			day := startOfDay(st.stamps.Start(p.Time, 30*time.Minute), loc).Unix()
+			byDay[day] = append(byDay[day], p)
+		}
+		for day, points := range byDay {
+			if days[day] == nil {
+				earlier, readErr := daySoFar(st, meta, time.Unix(day, 0).In(loc), points)
+				if readErr != nil {
+					slog.Warn("failed to read the day's usage for the household total", "resource", meta.Name,
+						"day", time.Unix(day, 0).In(loc).Format(time.DateOnly), "error", readErr)
+					continue
+				}
+				days[day] = map[int64]sink.Point{}
+				points = append(earlier, points...)
+			}
+			for _, p := range points {
+				days[day][p.Time.UnixNano()] = p
+			}
+			touched[day] = true
+			newest = max(newest, day)
+		}
+	}
+
+	var out []sink.Point
+	for _, day := range slices.Sorted(maps.Keys(touched)) {
+		fields := householdTotal(st, day)
+		if maps.Equal(fields, household.written[day]) {
+			continue
+		}
+		household.written[day] = fields
+		out = append(out, schema.Stamp(sink.Point{
+			Measurement: "energy_household",
+			Tags:        map[string]string{"period": "1d"},
+			Fields:      maps.Clone(fields),
+			Time:        st.stamps.Truncate(time.Unix(day, 0)),
+		}))
+	}
+
+	// Days older than the lookback are no longer scraped
+	cutoff := time.Unix(newest, 0).Add(-st.cfg.Scrape.Lookback - 24*time.Hour).Unix()
+	for _, days := range household.slots {
+		maps.DeleteFunc(days, func(day int64, _ map[int64]sink.Point) bool { return day < cutoff })
+	}
+	maps.DeleteFunc(household.written, func(day int64, _ map[string]any) bool { return day < cutoff })
+	return out
+}
+
+// householdTotal sums the day's slots and standing charges across
+// resources.
+func householdTotal(st *settings, day int64) map[string]any {
+	var kwh, pence, standing float64
+	for _, meta := range st.resources {
+		slots, ok := household.slots[meta.Name][day]
+		if !ok {
+			continue
+		}
+		for _, p := range slots {
+			k, _ := p.Fields["kwh"].(float64)
+			c, _ := p.Fields["pence"].(float64)
+			kwh += k
+			pence += c
+		}
+		standing += household.standing[meta.Name]
+	}
+	return map[string]any{
+		"kwh":           kwh,
+		"pence":         pence,
+		"standingPence": standing,
+		"totalPence":    pence + standing,
+	}
+}
+
+// daySoFar reads the day's usage from its start up to the earliest of
+// slots.
+func daySoFar(st *settings, meta resourceMeta, dayStart time.Time, slots []sink.Point) ([]sink.Point, error) {
+	first, _ := pointsSpan(slots)
+	first = st.stamps.Start(first, 30*time.Minute)
+	if !first.After(dayStart) {
+		return nil, nil
+	}
+	return readUsage(st, meta, dayStart, first)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/glowapi/glowtest"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/slot"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScrapeCycleWritesHouseholdTotal(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 5, 0, 0, time.UTC)
+	fake := fakeClock(t, now)
+	t.Cleanup(func() {
+		household.slots = map[string]map[int64]map[int64]sink.Point{}
+		household.standing = map[string]float64{}
+		household.written = map[int64]map[string]any{}
+	})
+
+	fakeGlow := glowtest.New(clk, now.AddDate(0, 0, -2))
+	defer fakeGlow.Close()
+	fakeGlow.Usage = func(resource string, _ time.Time) float64 {
+		if strings.HasSuffix(resource, "pence") {
+			return 7.5
+		}
+		return 0.25
+	}
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	cfg := &config.Config{Resources: []config.Resource{
+		{Name: "electricity", KWHResource: "e-kwh", PenceResource: "e-pence"},
+		{Name: "gas", KWHResource: "g-kwh", PenceResource: "g-pence"},
+	}}
+	cfg.Scrape.Lookback = time.Hour
+	cfg.Scrape.HouseholdTotals = true
+	mem := newMemorySink()
+	st := &settings{
+		cfg:       cfg,
+		resources: cfg.Resources,
+		sinks:     []sink.Sink{mem},
+		stamps:    slot.Policy{Precision: time.Second, Align: slot.AlignStart},
+		loc:       time.UTC,
+	}
+
+	check := func(slots int) {
+		t.Helper()
+		day := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+		points, _ := mem.ReadPoints(context.Background(), "energy_household", map[string]string{"period": "1d"}, day, day.Add(time.Second))
+		if len(points) != 1 {
+			t.Fatalf("wrote %d household points for the day, want 1", len(points))
+		}
+		want := map[string]float64{
+			"kwh":           float64(2*slots) * 0.25,
+			"pence":         float64(2*slots) * 7.5,
+			"standingPence": 2 * 53.2,
+			"totalPence":    float64(2*slots)*7.5 + 2*53.2,
+		}
+		for field, v := range want {
+			if got, _ := points[0].Fields[field].(float64); math.Abs(got-v) > 1e-9 {
+				t.Errorf("%s is %v, want %v", field, got, v)
+			}
+		}
+	}
+
+	// The day's slots before the lookback are read to start the total
+	if result := scrapeCycle(st); result != cycleOK {
+		t.Fatalf("result %v, want cycleOK", result)
+	}
+	check(24)
+
+	fake.Advance(30 * time.Minute)
+	if result := scrapeCycle(st); result != cycleOK {
+		t.Fatalf("result %v, want cycleOK", result)
+	}
+	check(25)
+}
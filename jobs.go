@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/clock"
+	"energy-meter-scraper/schedule"
+	"log/slog"
+	"time"
+)
+
+// clk is what the daemon reads the time from and waits on, replaced by a
+// fake clock in tests.
+var clk = clock.Real()
+
+// runScheduled calls fn at each activation of the schedule pick selects from
+// the live settings, re-evaluating the schedule whenever the config is
+// reloaded, until ctx is done. A nil schedule idles the job until a reload
+// enables it.
+func runScheduled(ctx context.Context, pick func(st *settings) schedule.Schedule, fn func(st *settings)) {
+	runScheduledFrom(ctx, clk.Now(), pick, fn)
+}
+
+// runScheduledFrom is runScheduled counting activations from last, so that
+// one passed while the caller was busy still runs.
+func runScheduledFrom(ctx context.Context, last time.Time, pick func(st *settings) schedule.Schedule, fn func(st *settings)) {
+	for {
+		changed := reloaded()
+
+		var timer clock.Timer
+		var fire <-chan time.Time
+		var next time.Time
+		st := live()
+		if sched := pick(st); sched != nil {
+			// Cron fields are matched in the configured zone, so that a
+			// daily job keeps its local time across the clocks changing
+			loc := st.location()
+			if next = nextActivation(sched, last.In(loc), clk.Now().In(loc)); !next.IsZero() {
+				timer = clk.NewTimer(max(next.Sub(clk.Now()), 0))
+				fire = timer.Chan()
+			}
+		}
+
+		select {
+		case <-fire:
+			// Timers run on the monotonic clock, so if the wall clock was
+			// stepped back while waiting the boundary is still ahead
+			if clk.Now().Before(next) {
+				continue
+			}
+			last = next
+			withLive(fn)
+		case <-changed:
+			if timer != nil {
+				timer.Stop()
+			}
+			last = clk.Now()
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+	}
+}
+
+// nextActivation returns the first activation after last. If fn overran
+// later ones, e.g. a cycle longer than the interval or the host sleeping, it
+// returns the latest of those, which is already due, rather than skipping
+// ahead to the next one still to come or running every one missed.
+func nextActivation(sched schedule.Schedule, last, now time.Time) time.Time {
+	next := sched.Next(last)
+	skipped := 0
+	for !next.IsZero() && !next.After(now) {
+		after := sched.Next(next)
+		if after.IsZero() || after.After(now) {
+			break
+		}
+		next = after
+		skipped++
+	}
+	if skipped > 0 {
+		slog.Warn("missed scheduled activations while busy", "skipped", skipped, "running", next)
+	}
+	return next
+}
+
+// retryBackoff calls fn until it succeeds, waiting a minute after the first
+// failure and doubling up to max. It gives up when fn's error is fatal or
+// ctx is done, returning the last error. what names fn in the log.
+func retryBackoff(ctx context.Context, what string, max time.Duration, fatal func(err error) bool, fn func() error) error {
+	for delay := time.Minute; ; delay = min(delay*2, max) {
+		err := fn()
+		if err == nil || fatal(err) {
+			return err
+		}
+		slog.Error(what+" failed, retrying", "error", err, "retryIn", delay)
+
+		select {
+		case <-clk.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
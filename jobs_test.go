@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/schedule"
+	"errors"
+	"github.com/jonboulle/clockwork"
+	"go.uber.org/goleak"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func fakeClock(t *testing.T, now time.Time) clockwork.FakeClock {
+	fake := clockwork.NewFakeClockAt(now)
+	prev := clk
+	clk = fake
+	t.Cleanup(func() { clk = prev })
+	return fake
+}
+
+func mustParse(t *testing.T, spec string) schedule.Schedule {
+	sched, err := schedule.Parse(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sched
+}
+
+// startScheduled runs the scrape job until the test ends, sending the time
+// of each activation.
+func startScheduled(t *testing.T) <-chan time.Time {
+	ctx, cancel := context.WithCancel(context.Background())
+	fired := make(chan time.Time)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runScheduled(ctx, func(st *settings) schedule.Schedule { return st.scrape }, func(*settings) {
+			fired <- clk.Now()
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return fired
+}
+
+func TestRunScheduledFiresOnEachActivation(t *testing.T) {
+	fake := fakeClock(t, time.Date(2024, 1, 1, 10, 5, 0, 0, time.UTC))
+	publish(&settings{sinkRefs: &sinkSet{}, scrape: mustParse(t, "*/30 * * * *")})
+	fired := startScheduled(t)
+
+	for _, want := range []time.Time{
+		time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC),
+		time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC),
+	} {
+		fake.BlockUntil(1)
+		fake.Advance(want.Sub(fake.Now()))
+		if got := <-fired; !got.Equal(want) {
+			t.Errorf("fired at %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRunScheduledFollowsReloads(t *testing.T) {
+	fake := fakeClock(t, time.Date(2024, 1, 1, 10, 5, 0, 0, time.UTC))
+	publish(&settings{sinkRefs: &sinkSet{}})
+	fired := startScheduled(t)
+
+	publish(&settings{sinkRefs: &sinkSet{}, scrape: mustParse(t, "0 * * * *")})
+	fake.BlockUntil(1)
+	fake.Advance(55 * time.Minute)
+
+	want := time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)
+	if got := <-fired; !got.Equal(want) {
+		t.Errorf("fired at %v, want %v", got, want)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	fake := fakeClock(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	start := fake.Now()
+
+	var attempts []time.Duration
+	done := make(chan error)
+	go func() {
+		done <- retryBackoff(context.Background(), "test", 4*time.Minute, func(error) bool { return false }, func() error {
+			attempts = append(attempts, fake.Since(start))
+			if len(attempts) < 5 {
+				return errors.New("unavailable")
+			}
+			return nil
+		})
+	}()
+
+	for _, delay := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute} {
+		fake.BlockUntil(1)
+		fake.Advance(delay)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	want := []time.Duration{0, time.Minute, 3 * time.Minute, 7 * time.Minute, 11 * time.Minute}
+	if len(attempts) != len(want) {
+		t.Fatalf("attempts at %v, want %v", attempts, want)
+	}
+	for i := range want {
+		if attempts[i] != want[i] {
+			t.Errorf("attempts at %v, want %v", attempts, want)
+			break
+		}
+	}
+}
+
+func TestRetryBackoffStops(t *testing.T) {
+	fakeClock(t, time.Now())
+	fatalErr := errors.New("rejected")
+
+	calls := 0
+	err := retryBackoff(context.Background(), "test", time.Hour, func(err error) bool { return err == fatalErr }, func() error {
+		calls++
+		return fatalErr
+	})
+	if err != fatalErr || calls != 1 {
+		t.Errorf("got %v after %d calls, want %v after 1", err, calls, fatalErr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = retryBackoff(ctx, "test", time.Hour, func(error) bool { return false }, func() error {
+		return errors.New("unavailable")
+	})
+	if err == nil {
+		t.Error("retried after ctx was done")
+	}
+}
+
+func TestRunScheduledRunsSlotOverrun(t *testing.T) {
+	fake := fakeClock(t, time.Date(2024, 1, 1, 10, 5, 0, 0, time.UTC))
+	publish(&settings{sinkRefs: &sinkSet{}, scrape: mustParse(t, "*/30 * * * *")})
+
+	// The first cycle runs past two boundaries, the later of which still
+	// gets its cycle as soon as the first one finishes
+	fired := make(chan time.Time)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	cycles := 0
+	go func() {
+		defer close(done)
+		runScheduled(ctx, func(st *settings) schedule.Schedule { return st.scrape }, func(*settings) {
+			if cycles++; cycles == 1 {
+				fake.Advance(100 * time.Minute)
+			}
+			fired <- clk.Now()
+		})
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	fake.BlockUntil(1)
+	fake.Advance(25 * time.Minute)
+	<-fired
+	if got, want := <-fired, time.Date(2024, 1, 1, 12, 10, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("overrun slot ran at %v, want %v", got, want)
+	}
+
+	fake.BlockUntil(1)
+	fake.Advance(20 * time.Minute)
+	if got, want := <-fired, time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("fired at %v, want %v", got, want)
+	}
+}
+
+func TestNextActivation(t *testing.T) {
+	sched := mustParse(t, "*/30 * * * *")
+	at := func(h, m, s int) time.Time { return time.Date(2024, 1, 1, h, m, s, 0, time.UTC) }
+	tests := []struct {
+		last, now, want time.Time
+	}{
+		{at(10, 0, 0), at(10, 0, 59), at(10, 30, 0)},
+		{at(10, 29, 59), at(10, 29, 59), at(10, 30, 0)},
+		{at(10, 0, 0), at(10, 31, 0), at(10, 30, 0)},
+		{at(10, 0, 0), at(12, 10, 0), at(12, 0, 0)},
+	}
+	for _, tt := range tests {
+		if got := nextActivation(sched, tt.last, tt.now); !got.Equal(tt.want) {
+			t.Errorf("nextActivation(%v, %v) = %v, want %v", tt.last, tt.now, got, tt.want)
+		}
+	}
+}
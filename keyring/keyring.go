@@ -0,0 +1,38 @@
+// Package keyring stores the Glow password in the OS keyring (macOS
+// Keychain, Secret Service on Linux, Windows Credential Manager) so that
+// interactive runs don't need GLOW_PASSWORD set.
+package keyring
+
+import (
+	"energy-meter-scraper/config"
+	"errors"
+	goKeyring "github.com/zalando/go-keyring"
+)
+
+const service = "energy-meter-scraper"
+
+func init() {
+	config.RegisterPasswordStore(store{})
+}
+
+type store struct{}
+
+func (store) Get(username string) (string, error) {
+	password, err := goKeyring.Get(service, username)
+	if errors.Is(err, goKeyring.ErrNotFound) {
+		return "", nil
+	}
+	return password, err
+}
+
+func (store) Set(username, password string) error {
+	return goKeyring.Set(service, username, password)
+}
+
+func (store) Delete(username string) error {
+	err := goKeyring.Delete(service, username)
+	if errors.Is(err, goKeyring.ErrNotFound) {
+		return nil
+	}
+	return err
+}
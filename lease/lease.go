@@ -0,0 +1,111 @@
+// Package lease elects which of several scraper instances sharing storage
+// is the primary, with a file recording who holds the lease and until when.
+package lease
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File is a lease kept in a JSON file. Renaming over the file is atomic, so
+// instances taking an expired lease at once each see whose write landed
+// last.
+type File struct {
+	path   string
+	holder string
+}
+
+type record struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// New returns the lease at path, taken as holder.
+func New(path, holder string) *File {
+	return &File{path: path, holder: holder}
+}
+
+// Acquire takes or renews the lease until now+ttl, and reports whether it is
+// held. Another holder's unexpired lease is left alone.
+func (f *File) Acquire(now time.Time, ttl time.Duration) (bool, error) {
+	current, readErr := f.read()
+	if readErr != nil {
+		return false, readErr
+	}
+	if current.Holder != f.holder && now.Before(current.Expires) {
+		return false, nil
+	}
+	if err := f.write(record{Holder: f.holder, Expires: now.Add(ttl).UTC()}); err != nil {
+		return false, err
+	}
+
+	written, readErr := f.read()
+	if readErr != nil {
+		return false, readErr
+	}
+	return written.Holder == f.holder, nil
+}
+
+// Release gives up the lease, if held, so that a standby can take over
+// without waiting for it to expire.
+func (f *File) Release() error {
+	current, readErr := f.read()
+	if readErr != nil || current.Holder != f.holder {
+		return readErr
+	}
+	return f.write(record{})
+}
+
+// Holder returns who holds the lease at now, if anyone.
+func (f *File) Holder(now time.Time) (string, bool, error) {
+	current, err := f.read()
+	if err != nil || current.Holder == "" || !now.Before(current.Expires) {
+		return "", false, err
+	}
+	return current.Holder, true, nil
+}
+
+func (f *File) read() (record, error) {
+	var r record
+	contents, readErr := os.ReadFile(f.path)
+	if errors.Is(readErr, fs.ErrNotExist) {
+		return r, nil
+	}
+	if readErr != nil {
+		return r, fmt.Errorf("lease: %w", readErr)
+	}
+	if err := json.Unmarshal(contents, &r); err != nil {
+		return r, fmt.Errorf("lease %s: %w", f.path, err)
+	}
+	return r, nil
+}
+
+func (f *File) write(r record) error {
+	contents, marshalErr := json.Marshal(r)
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	tmp, tmpErr := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if tmpErr != nil {
+		return fmt.Errorf("lease: %w", tmpErr)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(contents); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("lease: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("lease: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("lease: %w", err)
+	}
+	return nil
+}
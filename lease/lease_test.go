@@ -0,0 +1,61 @@
+package lease
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lease.json")
+	primary, standby := New(path, "primary"), New(path, "standby")
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	ttl := 2 * time.Minute
+
+	if held, err := primary.Acquire(now, ttl); err != nil || !held {
+		t.Fatalf("primary didn't take the free lease: %v %v", held, err)
+	}
+	if held, err := standby.Acquire(now.Add(time.Minute), ttl); err != nil || held {
+		t.Fatalf("standby took a held lease: %v %v", held, err)
+	}
+	// Renewing moves the expiry on
+	if held, err := primary.Acquire(now.Add(time.Minute), ttl); err != nil || !held {
+		t.Fatalf("primary couldn't renew: %v %v", held, err)
+	}
+	if held, _ := standby.Acquire(now.Add(2*time.Minute+30*time.Second), ttl); held {
+		t.Fatal("standby took a renewed lease")
+	}
+
+	if holder, ok, _ := primary.Holder(now.Add(2 * time.Minute)); !ok || holder != "primary" {
+		t.Errorf("holder %q %v, want primary", holder, ok)
+	}
+	if held, err := standby.Acquire(now.Add(3*time.Minute), ttl); err != nil || !held {
+		t.Fatalf("standby didn't take the expired lease: %v %v", held, err)
+	}
+	if held, _ := primary.Acquire(now.Add(3*time.Minute), ttl); held {
+		t.Fatal("old primary took the lease back")
+	}
+}
+
+func TestRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lease.json")
+	primary, standby := New(path, "primary"), New(path, "standby")
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	if _, err := primary.Acquire(now, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// Releasing a lease held by someone else leaves it
+	if err := standby.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := standby.Holder(now); !ok {
+		t.Fatal("standby released the primary's lease")
+	}
+	if err := primary.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if held, _ := standby.Acquire(now, time.Hour); !held {
+		t.Error("standby couldn't take a released lease")
+	}
+}
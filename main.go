@@ -2,176 +2,807 @@ package main
 
 import (
 	"context"
+	"energy-meter-scraper/alert"
+	"energy-meter-scraper/config"
 	"energy-meter-scraper/glowapi"
-	"github.com/influxdata/influxdb-client-go/v2"
-	influxApi "github.com/influxdata/influxdb-client-go/v2/api"
-	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"energy-meter-scraper/lease"
+	"energy-meter-scraper/metrics"
+	"energy-meter-scraper/ntp"
+	"energy-meter-scraper/plugs"
+	"energy-meter-scraper/redact"
+	"energy-meter-scraper/schedule"
+	"energy-meter-scraper/schema"
+	"energy-meter-scraper/scraper"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/transport"
+	"errors"
+	"flag"
+	"fmt"
+	"golang.org/x/sync/errgroup"
 	"log"
 	"log/slog"
-	"math/rand/v2"
+	"maps"
 	"os"
+	"os/signal"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
-type resourceMeta struct {
-	Name          string
-	KWHResource   string
-	PenceResource string
-}
-
-var resourcesOfInterest = []resourceMeta{
-	{
-		Name:          "electricity",
-		KWHResource:   "24e7909c-c997-4506-9201-a57bd213148d",
-		PenceResource: "cc4dbeca-e207-4618-95d2-bbddd120aa0b",
-	},
-	{
-		Name:          "gas",
-		KWHResource:   "5d594c77-f08a-4f6a-aac1-e086a5234b70",
-		PenceResource: "0cb3f9b9-749b-4e7f-a1e0-c1d437b2e057",
-	},
-}
+type resourceMeta = config.Resource
 
 var glow *glowapi.API
-var influxClient influxdb2.Client
-var influxWrite influxApi.WriteAPIBlocking
+
+var dryRun = flag.Bool("dry-run", false, "print points as line protocol instead of writing them to the sinks")
+
+var once = flag.Bool("once", false, "run a single cycle and exit: 0 if it succeeded, 1 if some resources failed, 2 if nothing was written")
 
 func main() {
-	glowUsername := "daniel@danielzfranklin.org"
-	glowPassword := mustGetEnv("GLOW_PASSWORD")
+	setupLogging()
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+	flag.Parse()
 
-	influxHost := mustGetEnv("INFLUX_HOST")
-	influxToken := mustGetEnv("INFLUX_TOKEN")
-	influxOrg := mustGetEnv("INFLUX_ORG")
-	influxBucket := mustGetEnv("INFLUX_BUCKET")
+	cfg, cfgErr := config.Load()
+	if cfgErr != nil {
+		log.Fatal(cfgErr)
+	}
+	redact.SetSecrets(cfg.Secrets()...)
+	applyLogLevel(cfg.LogLevel)
+	if *pprofAddr != "" {
+		go servePprof(*pprofAddr)
+	}
 
-	slog.Info("delaying start")
-	sleepJitter(15 * time.Second)
+	st, stErr := newSettings(cfg, nil)
+	if stErr != nil {
+		log.Fatal(stErr)
+	}
+	publish(st)
+	if cfg.Scrape.MetricsFile != "" {
+		if err := metrics.Load(cfg.Scrape.MetricsFile); err != nil {
+			slog.Error("failed to restore metrics; counting from zero", "error", err)
+		}
+	}
 
-	influxClient = influxdb2.NewClient(influxHost, influxToken)
-	influxWrite = influxClient.WriteAPIBlocking(influxOrg, influxBucket)
+	if err := alert.Setup(cfg); err != nil {
+		log.Fatal(err)
+	}
 
-	var glowErr error
-	glow, glowErr = glowapi.Authenticate(glowUsername, glowPassword)
-	if glowErr != nil {
-		log.Fatal(glowErr)
+	glowHTTP, glowHTTPErr := transport.NewClient(cfg.Glow.HTTP, cfg.Network)
+	if glowHTTPErr != nil {
+		log.Fatal("glow http config: ", glowHTTPErr)
 	}
+
+	if cfg.Health.Listen != "" && !*once {
+		go serveHealth(cfg.Health.Listen)
+	}
+
+	if !*once {
+		slog.Info("delaying start")
+		st.startupDelay.Sleep(clk)
+	}
+
+	// Only rejected credentials are fatal; Glow being unreachable at boot is
+	// retried like any other failure
+	authErr := retryBackoff(context.Background(), "glow authentication", 30*time.Minute, func(err error) bool {
+		return *once || errors.Is(err, glowapi.ErrRejected) || errors.Is(err, glowapi.ErrInvalidApplication)
+	}, func() error {
+		var glowErr error
+		glow, glowErr = glowapi.Authenticate(glowHTTP, cfg.Glow.Username, cfg.Glow.Password)
+		return glowErr
+	})
+	if authErr != nil {
+		if *once {
+			slog.Error("failed to authenticate with glow", "error", authErr)
+			os.Exit(int(cycleFailed))
+		}
+		if errors.Is(authErr, glowapi.ErrInvalidApplication) {
+			log.Fatal(authErr, ". ", invalidApplicationHelp)
+		}
+		log.Fatal(authErr)
+	}
+	glowSession.Store(glow)
 	slog.Info("authenticated with glow")
+	checkColdStart(st)
 
-	for {
-		slog.Info("requesting catchup")
-		for _, meta := range resourcesOfInterest {
-			for _, resourceID := range []string{meta.KWHResource, meta.PenceResource} {
-				// This routinely fails
-				catchupErr := glow.RequestResourceCatchup(resourceID)
-				slog.Info("requested resource catchup", "resourceID", resourceID, "error", catchupErr)
-			}
+	if *once {
+		var result cycleResult
+		withLive(func(st *settings) { result = runCycle(st) })
+		os.Exit(int(result))
+	}
+
+	// The schedules stop on SIGINT or SIGTERM, once any cycle in progress
+	// has finished
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var standbyLease *lease.File
+	if cfg.Standby.LeaseFile != "" {
+		standbyLease = lease.New(cfg.Standby.LeaseFile, leaseHolder())
+		checkLease(standbyLease, cfg.Standby.LeaseTTL, func() {})
+		go followLease(ctx, standbyLease, func() { withLive(scheduledScrape) })
+	}
+
+	if cfg.Plugs.Broker != "" {
+		tracker, stopPlugs, plugsErr := plugs.Follow(cfg.Plugs, clk)
+		if plugsErr != nil {
+			log.Fatal("plugs: ", plugsErr)
 		}
+		defer stopPlugs()
+		appliances = tracker
+	}
 
-		time.Sleep(5 * time.Minute)
+	go watchReloads()
+	go watchPauses()
+	if cfg.Server.Listen != "" {
+		if serveWeb == nil {
+			log.Fatal("server.listen is set but the dashboard isn't in this build (no_server)")
+		}
+		go serveWeb(cfg.Server.Listen)
+	}
+	if cfg.Admin.Socket != "" {
+		go serveAdmin(cfg.Admin.Socket)
+	}
+	go runScheduled(ctx, func(*settings) schedule.Schedule { return schedule.Interval(30 * time.Minute) }, whenActive(catchupAtBoundary))
+	go runScheduled(ctx, func(st *settings) schedule.Schedule { return st.crossCheck }, whenActive(crossCheckYesterday))
+	go runScheduled(ctx, func(st *settings) schedule.Schedule { return st.recheck }, whenActive(recheckWindow))
+	go runScheduled(ctx, func(st *settings) schedule.Schedule { return st.alerts }, whenActive(checkUsageAlerts))
+	go runScheduled(ctx, func(st *settings) schedule.Schedule { return st.digest }, whenActive(sendDailyDigest))
+	go runScheduled(ctx, func(st *settings) schedule.Schedule { return st.splitReport }, whenActive(sendSplitReport))
+	go runScheduled(ctx, func(st *settings) schedule.Schedule { return st.archive }, whenActive(archiveMonths))
 
-		var points []*write.Point
+	started := clk.Now()
+	withLive(scheduledScrape)
+	runScheduledFrom(ctx, started, func(st *settings) schedule.Schedule { return st.scrape }, scheduledScrape)
+	withLive(saveMetrics)
+	releaseLease(standbyLease)
+	slog.Info("shutting down")
+}
 
-		for _, meta := range resourcesOfInterest {
-			tariffTime := time.Now()
-			tariff, tariffErr := glow.Tariff(meta.KWHResource)
-			if tariffErr != nil {
-				log.Fatal(tariffErr)
-			}
-			points = append(points, write.NewPoint(
-				"energy_tariff",
-				map[string]string{"resource": meta.Name},
-				map[string]any{
-					"rate":           tariff.CurrentRates.Rate,
-					"standingCharge": tariff.CurrentRates.StandingCharge,
-				},
-				tariffTime))
-
-			kwhReadings, kwhReadingsErr := readResource(meta.KWHResource)
-			penceReadings, penceReadingsErr := readResource(meta.PenceResource)
-			if kwhReadingsErr != nil || penceReadingsErr != nil {
-				log.Fatal(kwhReadingsErr, penceReadingsErr)
-			}
+var (
+	cyclesTotal = metrics.NewCounter("scraper_cycles_total",
+		"Scrape cycles run.")
+	cycleFailuresTotal = metrics.NewCounter("scraper_cycle_failures_total",
+		"Scrape cycles that wrote nothing.")
+	cyclePanicsTotal = metrics.NewCounter("scraper_cycle_panics_total",
+		"Scrape cycles that panicked.")
+	resourceErrorsTotal = metrics.NewCounter("scraper_resource_errors_total",
+		"Resources that failed to scrape.", "resource")
+	consecutiveFailures = metrics.NewGauge("scraper_consecutive_cycle_failures",
+		"Scrape cycles in a row that wrote nothing.")
+	cycleDuration = metrics.NewGauge("scraper_cycle_duration_seconds",
+		"How long the last scrape cycle took.")
+	usageMismatchesTotal = metrics.NewCounter("scraper_usage_mismatches_total",
+		"Slots read with only one of kwh and pence.", "resource")
+	dataLatency = metrics.NewGauge("scraper_data_latency_seconds",
+		"How far the latest reading scraped lags behind the time it was scraped.", "resource")
+	noNewDataTotal = metrics.NewCounter("scraper_no_new_data_total",
+		"Cycles in which a resource had nothing new or revised to write to a sink.", "resource", "sink")
+	pointsWrittenTotal = metrics.NewCounter("scraper_points_written_total",
+		"Points written to a sink.", "sink")
+	lastSuccess = metrics.NewGauge("scraper_last_success_timestamp_seconds",
+		"When a scrape cycle last wrote readings.").Persist()
+)
 
-			if len(kwhReadings.Data) != len(penceReadings.Data) {
-				log.Fatal("expected same number of kwh and pence readings")
-			}
+// scrapeMu keeps a triggered cycle from overlapping a scheduled one.
+var scrapeMu sync.Mutex
+
+// scheduledScrape runs a cycle unless paused. Failed cycles are logged by
+// runCycle and retried at the next activation; only --once turns the
+// outcome into an exit code. A standby follows the primary's checkpoints
+// instead, and a takeover waits for a triggered cycle already running.
+func scheduledScrape(st *settings) {
+	if !primary.Load() {
+		if err := st.checkpoints.Reload(); err != nil {
+			slog.Error("failed to reload checkpoints", "error", err)
+		}
+		return
+	}
+	if paused.Load() || halted.Load() {
+		return
+	}
+	scrapeMu.Lock()
+	defer scrapeMu.Unlock()
+	runCycle(st)
+}
+
+// cycleResult is the outcome of a cycle, used as the exit code with --once.
+type cycleResult int
+
+const (
+	cycleOK cycleResult = iota
+	// cyclePartial means some resources failed but the rest were written.
+	cyclePartial
+	// cycleFailed means nothing was written.
+	cycleFailed
+)
+
+// runCycle scrapes and writes once. Failures are logged and counted, and
+// the next cycle starts afresh.
+func runCycle(st *settings) cycleResult {
+	started := clk.Now()
+	result := recoverCycle(st)
+	cycleDuration.Set(clk.Since(started).Seconds())
 
-			for i := 0; i < len(kwhReadings.Data); i++ {
-				if kwhReadings.Data[i][0] != penceReadings.Data[i][0] {
-					log.Fatal("expected corresponding readings to have same timestamp")
+	cyclesTotal.Inc()
+	if result == cycleFailed {
+		cycleFailuresTotal.Inc()
+		consecutiveFailures.Add(1)
+		slog.Error("cycle failed; retrying at the next scheduled cycle", "consecutiveFailures", consecutiveFailures.Value())
+	} else {
+		consecutiveFailures.Set(0)
+		lastSuccess.Set(float64(clk.Now().Unix()))
+	}
+
+	if st.cfg.Scrape.HealthPoints {
+		if err := writePoints(context.Background(), st, healthPoints(st, result, clk.Now())); err != nil {
+			slog.Error("failed to write health points", "error", err)
+		}
+	}
+	saveMetrics(st)
+	return result
+}
+
+// saveMetrics snapshots the counters to the metrics file, if there is one,
+// so that a restart carries on from them.
+func saveMetrics(st *settings) {
+	// Dry runs write nowhere, so leave the snapshot as the last real run
+	if st.cfg.Scrape.MetricsFile == "" || *dryRun {
+		return
+	}
+	if err := metrics.Save(st.cfg.Scrape.MetricsFile); err != nil {
+		slog.Error("failed to save metrics", "error", err)
+	}
+}
+
+// recoverCycle runs scrapeCycle, turning a panic into a failed cycle so that
+// one bad response doesn't stop the daemon.
+func recoverCycle(st *settings) (result cycleResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("cycle panicked", "panic", r, "stack", string(debug.Stack()))
+			cyclePanicsTotal.Inc()
+			result = cycleFailed
+		}
+	}()
+	return scrapeCycle(st)
+}
+
+// healthPoints reports on the scraper itself as scraper_health points, for
+// alerting from the sink without a metrics exporter.
+func healthPoints(st *settings, result cycleResult, now time.Time) []sink.Point {
+	points := []sink.Point{{
+		Measurement: "scraper_health",
+		Tags:        map[string]string{},
+		Fields: map[string]any{
+			"result":              int(result),
+			"durationSeconds":     cycleDuration.Value(),
+			"consecutiveFailures": int(consecutiveFailures.Value()),
+			"cycleFailures":       int(cycleFailuresTotal.Value()),
+		},
+		Time: st.stamps.Truncate(now),
+	}}
+	for _, meta := range st.resources {
+		fields := map[string]any{"errors": int(resourceErrorsTotal.Value(meta.Name))}
+		if latency := dataLatency.Value(meta.Name); latency > 0 {
+			fields["latencySeconds"] = latency
+		}
+		points = append(points, sink.Point{
+			Measurement: "scraper_health",
+			Tags:        map[string]string{"resource": meta.Name},
+			Fields:      fields,
+			Time:        st.stamps.Truncate(now),
+		})
+	}
+	return points
+}
+
+func scrapeCycle(st *settings) cycleResult {
+	active := activeResources(st)
+	if len(active) == 0 {
+		slog.Warn("every resource is dormant; nothing to scrape")
+		return cycleOK
+	}
+	// The daemon requests catchup at each half hour on its own, but a single
+	// cycle has nothing else to do it
+	if *once {
+		requestCatchups(st, active)
+	}
+	awaitReadings(st, active)
+
+	// Each resource is scraped and written on its own, so that one failing
+	// doesn't stop the others being recorded
+	scraped := map[string]resourcePoints{}
+	failed, dormant := 0, 0
+
+	// Errors are counted rather than returned, so one resource failing
+	// doesn't cancel the others
+	var g errgroup.Group
+	g.SetLimit(max(st.cfg.Scrape.Concurrency, 1))
+	results := make([]resourcePoints, len(active))
+	errs := make([]error, len(active))
+	for i, meta := range active {
+		g.Go(func() error {
+			// recoverCycle can't catch a panic on another goroutine
+			defer func() {
+				if r := recover(); r != nil {
+					slog.Error("scraping resource panicked", "resource", meta.Name, "panic", r, "stack", string(debug.Stack()))
+					cyclePanicsTotal.Inc()
+					errs[i] = fmt.Errorf("panic: %v", r)
 				}
-				ts := kwhReadings.Data[i][0]
-
-				kwhVal := kwhReadings.Data[i][1]
-				penceVal := penceReadings.Data[i][1]
-
-				points = append(points, write.NewPoint(
-					"energy_usage",
-					map[string]string{"resource": meta.Name, "period": "30m"},
-					map[string]any{
-						"kwh":   kwhVal,
-						"pence": penceVal,
-					},
-					time.Unix(int64(ts), 0),
-				))
+			}()
+			results[i], errs[i] = scrapeResource(st, meta)
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	for i, meta := range active {
+		if errors.Is(errs[i], errDormant) {
+			dormant++
+			continue
+		}
+		if errors.Is(errs[i], glowapi.ErrInvalidApplication) {
+			halt(errs[i])
+		}
+		if errs[i] != nil {
+			slog.Error("failed to scrape resource", "resource", meta.Name, "error", errs[i])
+			resourceErrorsTotal.Inc(meta.Name)
+			forgetMeta(meta)
+			failed++
+			continue
+		}
+		scraped[meta.Name] = results[i]
+	}
+	if dormant == len(active) {
+		return cycleOK
+	}
+	if failed == len(active)-dormant {
+		return cycleFailed
+	}
+
+	scrapeGroups(st, scraped)
+
+	var common []sink.Point
+	if point, ok := occupancyPoint(st); ok {
+		common = append(common, point)
+	}
+	common = append(common, householdPoints(st, scraped)...)
+
+	if !checkClock(st) {
+		slog.Error("not writing points because the system clock is skewed")
+		return cycleFailed
+	}
+
+	writeFailed, held := writeCycle(context.Background(), st, common, scraped)
+	for name := range writeFailed {
+		resourceErrorsTotal.Inc(name)
+	}
+	for name, rp := range scraped {
+		if writeFailed[name] {
+			continue
+		}
+		written := slices.Concat(rp.refetched, rp.usage)
+		recordWritten(st, name, written)
+		if !rp.from.IsZero() {
+			recordGaps(st, name, rp.from, rp.through, written)
+		}
+		// Points held in memory for a sink are re-read after a restart
+		if held[name] {
+			continue
+		}
+		if err := st.checkpoints.Set(name, rp.through); err != nil {
+			slog.Error("failed to save checkpoint", "resource", name, "error", err)
+		}
+	}
+	// A group failing to write doesn't fail the cycle, as its members were
+	// recorded and it catches up from its checkpoint
+	for name := range writeFailed {
+		if !slices.ContainsFunc(st.groups, func(g group) bool { return g.name == name }) {
+			failed++
+		}
+	}
+	sloReport(st)
+
+	switch {
+	case failed == len(active)-dormant:
+		return cycleFailed
+	case failed > 0:
+		return cyclePartial
+	default:
+		return cycleOK
+	}
+}
+
+// resourcePoints is what a cycle scraped for one resource, or combined for
+// one group.
+type resourcePoints struct {
+	// tariff is unset for groups, which have no tariff of their own.
+	tariff sink.Point
+	usage  []sink.Point
+	// refetched is usage re-read for slots earlier cycles found missing.
+	refetched []sink.Point
+	// demand is the peak demand of the months usage falls in, if the
+	// resource has a capacity charge.
+	demand []sink.Point
+	// heating are the gas heating sessions usage adds to, if inferred.
+	heating []sink.Point
+	// appliances are the smart plugs' shares of the slots, and what is
+	// left, if plugs are followed.
+	appliances []sink.Point
+	// from and through are the window of readings scraped, from its first
+	// slot to the latest reading, which the resource's checkpoint moves to
+	// once every sink has written it. from is unset for groups, which
+	// aren't checked for gaps.
+	from, through time.Time
+}
+
+// scrapeResource reads a resource's current tariff and recent usage, along
+// with any slots missing from earlier cycles. It returns errDormant, having
+// marked the resource dormant, if the latest reading is older than
+// DormantAfter.
+func scrapeResource(st *settings, meta resourceMeta) (resourcePoints, error) {
+	from, to, windowErr := scrapeWindow(st, meta)
+	if windowErr != nil {
+		return resourcePoints{}, fmt.Errorf("readings: %w", windowErr)
+	}
+	if isDormant(st, to) {
+		markDormant(meta.Name, to)
+		return resourcePoints{}, errDormant
+	}
+	// Windows and the tariff point go by Glow's latest reading rather than
+	// the host clock, which may be skewed or in the wrong zone
+	if now := clk.Now(); to.After(now) {
+		slog.Warn("latest reading is after the system clock", "resource", meta.Name, "reading", to, "clock", now)
+	}
+
+	tariff, tariffErr := resourceTariff(meta.KWHResource)
+	if tariffErr != nil {
+		return resourcePoints{}, fmt.Errorf("tariff: %w", tariffErr)
+	}
+	tariffPoint := schema.Stamp(sink.Point{
+		Measurement: "energy_tariff",
+		Tags:        map[string]string{"resource": meta.Name},
+		Fields: map[string]any{
+			"rate":           tariff.CurrentRates.Rate,
+			"standingCharge": tariff.CurrentRates.StandingCharge,
+		},
+		Time: st.stamps.Stamp(to, 30*time.Minute),
+	})
+	checkTariffChange(st, meta, tariffPoint)
+	checkTariffMismatch(st, meta, tariffPoint, to)
+
+	usage, usageErr := readUsage(st, meta, from, to)
+	if usageErr != nil {
+		return resourcePoints{}, fmt.Errorf("readings: %w", usageErr)
+	}
+	refetched := refetchGaps(st, meta)
+	dataLatency.Set(clk.Since(to.Add(30*time.Minute)).Seconds(), meta.Name)
+	return resourcePoints{
+		tariff:     tariffPoint,
+		usage:      usage,
+		refetched:  refetched,
+		demand:     demandPoints(st, meta, slices.Concat(refetched, usage)),
+		heating:    heatingPoints(st, meta, slices.Concat(refetched, usage)),
+		appliances: appliancePoints(st, meta, slices.Concat(refetched, usage)),
+		from:       from,
+		through:    to,
+	}, nil
+}
+
+// scrapeWindow is the range of readings a cycle fetches: from the
+// resource's checkpoint, or failing that the start of the lookback, up to
+// its latest reading. While catchup is failing it reaches back to the last
+// successful catchup, as slots since may be filled in late, and it always
+// reaches back over slots that are still provisional.
+func scrapeWindow(st *settings, meta resourceMeta) (time.Time, time.Time, error) {
+	from, firstErr := resourceFirstTime(meta.KWHResource)
+	if firstErr != nil {
+		return time.Time{}, time.Time{}, firstErr
+	}
+
+	to, lastErr := glow.GetResourceLastTime(meta.KWHResource)
+	if lastErr != nil {
+		return time.Time{}, time.Time{}, lastErr
+	}
+
+	// The checkpointed slot is read again as Glow may have completed it since
+	since := to.Add(-st.cfg.Scrape.Lookback)
+	if last, ok := st.checkpoints.Last(meta.Name); ok {
+		since = last
+	}
+	since = reachProvisional(st, since, to)
+	if failing, lastOK := catchupFailing(meta.Name); failing {
+		reach := to.Add(-st.cfg.Scrape.Lookback)
+		if !lastOK.IsZero() {
+			reach = lastOK.Truncate(30 * time.Minute).Add(-30 * time.Minute)
+		}
+		if reach.Before(since) {
+			since = reach
+		}
+	}
+
+	if from.Before(since) {
+		from = since
+	}
+	return from, to, nil
+}
+
+// checkClock warns if the system clock has drifted from NTP, and reports
+// whether it is safe to write points.
+func checkClock(st *settings) bool {
+	clock := st.cfg.Clock
+	if clock.NTPServer == "" {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	offset, offsetErr := ntp.Offset(ctx, clock.NTPServer)
+	if offsetErr != nil {
+		slog.Warn("failed to check clock against ntp", "server", clock.NTPServer, "error", offsetErr)
+		return true
+	}
+
+	if offset.Abs() > clock.MaxSkew {
+		slog.Warn("system clock is skewed", "offset", offset, "maxSkew", clock.MaxSkew)
+		return !clock.RefuseWrites
+	}
+	return true
+}
+
+// usagePoints joins kwh and pence readings by timestamp, counting slots
+// with only one of them in scraper_usage_mismatches_total.
+func usagePoints(st *settings, meta resourceMeta, kwhReadings, penceReadings *glowapi.ResourceReadings) []sink.Point {
+	points, mismatched := scraper.Join(meta, kwhReadings, penceReadings, usageOptions(st, meta))
+	countMismatches(meta, mismatched)
+	return points
+}
+
+func usageOptions(st *settings, meta resourceMeta) scraper.Options {
+	return scraper.Options{
+		Measurement: usageMeasurement(meta),
+		Stamps:      st.stamps,
+		Tariff:      st.tariffs[meta.Name],
+		Location:    st.location(),
+	}
+}
+
+func countMismatches(meta resourceMeta, mismatched []time.Time) {
+	if len(mismatched) == 0 {
+		return
+	}
+	usageMismatchesTotal.Add(float64(len(mismatched)), meta.Name)
+	slog.Warn("kwh and pence readings differ; writing the fields present", "resource", meta.Name,
+		"slots", len(mismatched), "first", mismatched[0].Format(time.DateTime), "last", mismatched[len(mismatched)-1].Format(time.DateTime))
+}
+
+// usageMeasurement is where meta's slots are written: energy_usage, or
+// energy_export for export and net meters, so that energy sent to the grid
+// isn't counted as consumption. Readings keep their sign.
+func usageMeasurement(meta resourceMeta) string {
+	if resourceExports(meta.KWHResource) {
+		return "energy_export"
+	}
+	return "energy_usage"
+}
+
+// maxReadingsSpan is the longest range fetched in one readings request.
+const maxReadingsSpan = scraper.MaxSpan
+
+// readUsage fetches energy_usage points for [from, to], splitting the range
+// into requests Glow will accept.
+func readUsage(st *settings, meta resourceMeta, from, to time.Time) ([]sink.Point, error) {
+	// The resource's metadata says whether its slots are export
+	if _, unitsErr := resourceUnitsOf(meta.KWHResource); unitsErr != nil {
+		return nil, fmt.Errorf("resource metadata: %w", unitsErr)
+	}
+	points, mismatched, readErr := scraper.Read(glowSource{}, meta, from, to, usageOptions(st, meta))
+	if readErr != nil {
+		return nil, readErr
+	}
+	countMismatches(meta, mismatched)
+	return points, nil
+}
+
+// glowSource reads from the current Glow session, in kWh.
+type glowSource struct{}
+
+func (glowSource) GetResourceReadings(query glowapi.ResourceReadingsQuery) (*glowapi.ResourceReadings, error) {
+	return readReadings(query)
+}
+
+// writeCycle writes a cycle's points to every sink at once, each resource in
+// its own batch, and returns the resources that failed to write to some
+// sink. Usage is compared with what each sink already stores, so slots Glow
+// has revised within the lookback are recorded as revisions rather than
+// silently overwritten. A batch a sink fails to write is buffered for it if
+// there is room, and doesn't count as failed, though it is returned as held
+// if only in memory.
+func writeCycle(ctx context.Context, st *settings, common []sink.Point, scraped map[string]resourcePoints) (failed, held map[string]bool) {
+	var mu sync.Mutex
+	failed, held = map[string]bool{}, map[string]bool{}
+	panicked := eachSink(ctx, st, func(ctx context.Context, s sink.Sink) {
+		sinkFailed, sinkHeld := writeSinkCycle(ctx, st, s, common, scraped)
+		mu.Lock()
+		defer mu.Unlock()
+		maps.Copy(failed, sinkFailed)
+		maps.Copy(held, sinkHeld)
+	})
+	if panicked {
+		for name := range scraped {
+			failed[name] = true
+		}
+	}
+	return failed, held
+}
+
+// writeSinkCycle writes a cycle's points to s, and returns the resources
+// that failed, and those held in memory for it.
+func writeSinkCycle(ctx context.Context, st *settings, s sink.Sink, common []sink.Point, scraped map[string]resourcePoints) (failed, held map[string]bool) {
+	failed, held = map[string]bool{}, map[string]bool{}
+	if len(common) > 0 {
+		if err := writeBuffered(ctx, st, s, common); err != nil {
+			slog.Error("failed to write points", "sink", s.Name(), "error", err)
+		}
+	}
+
+	for _, meta := range writeOrder(st) {
+		rp, ok := scraped[meta.Name]
+		if !ok {
+			continue
+		}
+
+		usage := rp.usage
+		if st.cfg.Scrape.SkipStored {
+			unstored, skipErr := skipStored(ctx, s, meta, usage)
+			if skipErr != nil {
+				slog.Warn("failed to find newest stored point", "resource", meta.Name, "sink", s.Name(), "error", skipErr)
+			} else {
+				usage = unstored
 			}
 		}
+		// Refetched slots are older than what is stored, so are never skipped
+		usage = slices.Concat(rp.refetched, usage)
+		usage, provisional := splitProvisional(st, rp.through, usage)
 
-		if err := influxWrite.WritePoint(context.Background(), points...); err != nil {
-			log.Fatal(err)
+		revised, revisions, reviseErr := revise(ctx, s, meta, usage)
+		if reviseErr != nil {
+			slog.Warn("failed to read stored points, rewriting all", "resource", meta.Name, "sink", s.Name(), "error", reviseErr)
+			revised, revisions = usage, 0
 		}
-		slog.Info("wrote points to influx")
+		// The tariff, demand, heating and provisional slots are written with new
+		// readings, so that a cycle with none writes nothing
+		if reviseErr == nil && len(revised) == 0 {
+			slog.Debug("no new readings; skipping write", "resource", meta.Name, "sink", s.Name())
+			noNewDataTotal.Inc(meta.Name, s.Name())
+			continue
+		}
+		var out []sink.Point
+		if rp.tariff.Measurement != "" {
+			out = append(out, rp.tariff)
+		}
+		out = append(out, revised...)
+		out = append(out, provisional...)
+		out = append(out, rp.demand...)
+		out = append(out, rp.heating...)
+		out = append(out, rp.appliances...)
 
-		now := time.Now()
-		nowMinute := now.Minute()
-		var waitMinutes int
-		if nowMinute < 30 {
-			waitMinutes = 30 - nowMinute
-		} else {
-			waitMinutes = 60 - nowMinute
+		if err := writeBuffered(ctx, st, s, out); errors.Is(err, errBuffered) {
+			slog.Warn("failed to write points", "resource", meta.Name, "sink", s.Name(), "error", err)
+			continue
+		} else if errors.Is(err, errHeld) {
+			slog.Warn("failed to write points", "resource", meta.Name, "sink", s.Name(), "error", err)
+			held[meta.Name] = true
+			continue
+		} else if err != nil {
+			slog.Error("failed to write points", "resource", meta.Name, "sink", s.Name(), "error", err)
+			failed[meta.Name] = true
+			continue
 		}
-		waitDur := time.Duration(waitMinutes) * time.Minute
-		waitUntil := now.Add(waitDur)
-		slog.Info("Waiting", "duration", waitDur, "until", waitUntil)
-		time.Sleep(waitDur)
+		slog.Info("wrote points", "resource", meta.Name, "sink", s.Name(), "count", len(out), "revisions", revisions)
 	}
+	return failed, held
 }
 
-func readResource(id string) (*glowapi.ResourceReadings, error) {
-	from, firstErr := glow.GetResourceFirstTime(id)
-	if firstErr != nil {
-		return nil, firstErr
+// writeOrder is the resources then the groups, which are written like
+// resources once their members have been.
+func writeOrder(st *settings) []resourceMeta {
+	order := slices.Clone(st.resources)
+	for _, g := range st.groups {
+		order = append(order, g.meta())
+	}
+	return order
+}
+
+// skipStored drops the usage points at or before the newest one s stores
+// for the resource. Sinks that can't tell get every point.
+func skipStored(ctx context.Context, s sink.Sink, meta resourceMeta, usage []sink.Point) ([]sink.Point, error) {
+	lastTimer, ok := s.(sink.LastTimer)
+	if !ok || len(usage) == 0 {
+		return usage, nil
 	}
 
-	to, lastErr := glow.GetResourceLastTime(id)
+	start, stop := pointsSpan(usage)
+	last, found, lastErr := lastTimer.LastTime(ctx, usageMeasurement(meta),
+		map[string]string{"resource": meta.Name, "period": "30m"}, start, stop.Add(time.Nanosecond))
 	if lastErr != nil {
 		return nil, lastErr
 	}
+	if !found {
+		return usage, nil
+	}
+
+	var unstored []sink.Point
+	for _, p := range usage {
+		if p.Time.After(last) {
+			unstored = append(unstored, p)
+		}
+	}
+	return unstored, nil
+}
+
+// writePoints writes points to every sink at once, returning the errors of
+// those that failed. Nothing is buffered, for callers that report failure.
+func writePoints(ctx context.Context, st *settings, points []sink.Point) error {
+	var mu sync.Mutex
+	var errs []error
+	panicked := eachSink(ctx, st, func(ctx context.Context, s sink.Sink) {
+		if err := writeSink(ctx, st, s, points); err != nil {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, fmt.Errorf("write to %s: %w", s.Name(), err))
+			return
+		}
+		slog.Info("wrote points", "sink", s.Name(), "count", len(points))
+	})
+	if panicked {
+		errs = append(errs, errors.New("writing to a sink panicked"))
+	}
+	return errors.Join(errs...)
+}
 
-	cutoff := to.AddDate(0, 0, -8)
-	if from.Before(cutoff) {
-		from = cutoff
+// writeSink writes points to s and records them in the changefeed.
+func writeSink(ctx context.Context, st *settings, s sink.Sink, points []sink.Point) error {
+	if err := s.Write(ctx, points); err != nil {
+		return err
+	}
+	pointsWrittenTotal.Add(float64(len(points)), s.Name())
+	if err := st.changefeed.Record(clk.Now(), s.Name(), points); err != nil {
+		slog.Warn("failed to record write in the changefeed", "sink", s.Name(), "error", err)
 	}
+	return nil
+}
 
-	return glow.GetResourceReadings(glowapi.ResourceReadingsQuery{
+func readResourceRange(id string, period string, from, to time.Time) (*glowapi.ResourceReadings, error) {
+	return readReadings(glowapi.ResourceReadingsQuery{
 		ID:       id,
-		Period:   "PT30M",
+		Period:   period,
 		Function: "sum",
 		From:     from,
 		To:       to,
 	})
 }
 
-func mustGetEnv(key string) string {
-	val := os.Getenv(key)
-	if val == "" {
-		log.Fatalf("Missing required environment variable: %s", key)
+// readReadings is glow.GetResourceReadings with energy converted to kWh, for
+// meters that report in another unit.
+func readReadings(query glowapi.ResourceReadingsQuery) (*glowapi.ResourceReadings, error) {
+	units, unitsErr := resourceUnitsOf(query.ID)
+	if unitsErr != nil {
+		return nil, fmt.Errorf("resource metadata: %w", unitsErr)
 	}
-	return val
-}
-
-func sleepJitter(d time.Duration) {
-	factor := rand.Float64()*(1.3-0.7) + 0.7
-	time.Sleep(time.Duration(float64(d) * factor))
+	readings, readingsErr := glow.GetResourceReadings(query)
+	if readingsErr != nil || units.scale == 1 {
+		return readings, readingsErr
+	}
+	for i := range readings.Data {
+		readings.Data[i][1] *= units.scale
+	}
+	return readings, nil
 }
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/glowapi/glowtest"
+	"energy-meter-scraper/schema"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/slot"
+	"github.com/jonboulle/clockwork"
+	"maps"
+	"testing"
+	"time"
+)
+
+func TestRunCycleRecoversPanic(t *testing.T) {
+	fakeClock(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	prevGlow := glow
+	glow = nil
+	defer func() { glow = prevGlow }()
+
+	// With no Glow session the first request dereferences nil
+	cfg := &config.Config{Resources: []config.Resource{{Name: "panic-test", KWHResource: "kwh", PenceResource: "pence"}}}
+	st := &settings{cfg: cfg, resources: cfg.Resources}
+
+	panicsBefore, failuresBefore := cyclePanicsTotal.Value(), cycleFailuresTotal.Value()
+	if result := runCycle(st); result != cycleFailed {
+		t.Errorf("result %v, want cycleFailed", result)
+	}
+	if cyclePanicsTotal.Value() != panicsBefore+1 || cycleFailuresTotal.Value() != failuresBefore+1 {
+		t.Error("panic not counted as a failed cycle")
+	}
+}
+
+func TestSkipStored(t *testing.T) {
+	meta := config.Resource{Name: "gas"}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var usage []sink.Point
+	for i := range 4 {
+		usage = append(usage, sink.Point{
+			Measurement: "energy_usage",
+			Tags:        map[string]string{"resource": "gas", "period": "30m"},
+			Fields:      map[string]any{"kwh": 0.5},
+			Time:        start.Add(time.Duration(i) * 30 * time.Minute),
+		})
+	}
+
+	mem := newMemorySink()
+	if err := mem.Write(context.Background(), usage[:2]); err != nil {
+		t.Fatal(err)
+	}
+
+	unstored, err := skipStored(context.Background(), mem, meta, usage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unstored) != 2 || !unstored[0].Time.Equal(usage[2].Time) {
+		t.Errorf("kept %v, want the last two points", unstored)
+	}
+}
+
+func TestUsagePointsJoinsByTimestamp(t *testing.T) {
+	st := &settings{stamps: slot.Policy{Precision: time.Second, Align: slot.AlignStart}}
+	meta := config.Resource{Name: "join-test"}
+	kwh := &glowapi.ResourceReadings{Data: [][2]float64{{1800, 0.1}, {3600, 0.2}, {5400, 0.3}}}
+	pence := &glowapi.ResourceReadings{Data: [][2]float64{{5400, 9}, {1800, 3}, {7200, 12}}}
+
+	mismatchesBefore := usageMismatchesTotal.Value("join-test")
+	points := usagePoints(st, meta, kwh, pence)
+	want := []map[string]any{
+		{"kwh": 0.1, "pence": 3.0, schema.Field: int64(schema.Unversioned)},
+		{"kwh": 0.2, schema.Field: int64(schema.Unversioned)},
+		{"kwh": 0.3, "pence": 9.0, schema.Field: int64(schema.Unversioned)},
+		{"pence": 12.0, schema.Field: int64(schema.Unversioned)},
+	}
+	if len(points) != len(want) {
+		t.Fatalf("got %d points, want %d", len(points), len(want))
+	}
+	for i, p := range points {
+		if !maps.Equal(p.Fields, want[i]) {
+			t.Errorf("point %d at %v has %v, want %v", i, p.Time, p.Fields, want[i])
+		}
+	}
+	if n := usageMismatchesTotal.Value("join-test") - mismatchesBefore; n != 2 {
+		t.Errorf("counted %v mismatches, want 2", n)
+	}
+}
+
+func TestReadUsageConvertsWhToKWh(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 5, 0, 0, time.UTC)
+	fakeClock(t, now)
+
+	fakeGlow := glowtest.New(clk, now.AddDate(0, 0, -1))
+	defer fakeGlow.Close()
+	fakeGlow.Units = map[string]string{"kwh": "Wh", "pence": "pence"}
+	fakeGlow.Usage = func(resource string, _ time.Time) float64 {
+		if resource == "kwh" {
+			return 250
+		}
+		return 7.5
+	}
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	st := &settings{cfg: &config.Config{}, stamps: slot.Policy{Precision: time.Second, Align: slot.AlignStart}}
+	meta := config.Resource{Name: "wh-test", KWHResource: "kwh", PenceResource: "pence"}
+	points, err := readUsage(st, meta, now.Add(-2*time.Hour), fakeGlow.Last())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) == 0 {
+		t.Fatal("read no points")
+	}
+	for _, p := range points {
+		if p.Fields["kwh"] != 0.25 || p.Fields["pence"] != 7.5 {
+			t.Errorf("point at %s has %v, want 0.25 kWh and 7.5 pence", p.Time, p.Fields)
+		}
+	}
+}
+
+func TestRevisedPointsFillsMissingFields(t *testing.T) {
+	at := time.Unix(1800, 0)
+	stored := []sink.Point{{Time: at, Fields: map[string]any{"kwh": 0.2}}}
+
+	// Filling in pence rewrites the slot without counting a revision
+	changed, history := revisedPoints([]sink.Point{{Time: at, Fields: map[string]any{"kwh": 0.2, "pence": 6.0}}}, stored, at)
+	if len(changed) != 1 || len(history) != 0 {
+		t.Errorf("changed %v history %v, want one rewrite and no revision", changed, history)
+	}
+
+	// A reading missing a field it had before is not a revision either
+	stored = []sink.Point{{Time: at, Fields: map[string]any{"kwh": 0.2, "pence": 6.0}}}
+	changed, history = revisedPoints([]sink.Point{{Time: at, Fields: map[string]any{"kwh": 0.2}}}, stored, at)
+	if len(changed) != 0 || len(history) != 0 {
+		t.Errorf("changed %v history %v, want nothing", changed, history)
+	}
+
+	changed, history = revisedPoints([]sink.Point{{Time: at, Fields: map[string]any{"kwh": 0.3}}}, stored, at)
+	if len(changed) != 1 || len(history) != 1 {
+		t.Fatalf("changed %v history %v, want one revision", changed, history)
+	}
+	if _, ok := history[0].Fields["prevPence"]; ok {
+		t.Errorf("revision records pence, which didn't change: %v", history[0].Fields)
+	}
+}
+
+func TestRevisedPointsRewritesOlderSchema(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	stored := []sink.Point{{Time: at, Fields: map[string]any{"kwh": 0.2, schema.Field: int64(0)}}}
+	fresh := []sink.Point{{Time: at, Fields: map[string]any{"kwh": 0.2, schema.Field: int64(schema.Unversioned)}}}
+
+	changed, history := revisedPoints(fresh, stored, at)
+	if len(changed) != 1 || len(history) != 0 {
+		t.Errorf("got %d changed and %d revisions, want the slot rewritten without a revision", len(changed), len(history))
+	}
+
+	stored[0].Fields[schema.Field] = int64(schema.Unversioned)
+	if changed, _ := revisedPoints(fresh, stored, at); len(changed) != 0 {
+		t.Errorf("rewrote %d slots already in the current schema", len(changed))
+	}
+}
+
+func TestOverwrittenKeepsRevisions(t *testing.T) {
+	at := func(slot int) time.Time { return time.Unix(int64(slot)*1800, 0) }
+	usage := func(slot int, kwh float64) sink.Point {
+		return sink.Point{Measurement: "energy_usage", Time: at(slot), Fields: map[string]any{"kwh": kwh}}
+	}
+	fresh := []sink.Point{usage(1, 0.1), usage(2, 0.3), usage(3, 0.4)}
+	stored := []sink.Point{usage(1, 0.1), usage(2, 0.2), usage(3, 0.4)}
+
+	changed, history := revisedPoints(fresh, stored, at(4))
+	points := overwritten(fresh, append(changed, history...))
+	if len(points) != 4 {
+		t.Fatalf("got %d points, want every slot and one revision", len(points))
+	}
+	if points[1].Fields["revision"] != int64(1) {
+		t.Errorf("revised slot is %v, want it to count the revision", points[1].Fields)
+	}
+	if _, ok := points[0].Fields["revision"]; ok {
+		t.Errorf("unchanged slot is %v, want it rewritten as read", points[0].Fields)
+	}
+	if points[3].Measurement != "energy_usage_revision" {
+		t.Errorf("last point is %s, want the revision", points[3].Measurement)
+	}
+}
+
+func TestScrapeCycleScrapesResourcesConcurrently(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 5, 0, 0, time.UTC)
+	fakeClock(t, now)
+
+	fakeGlow := glowtest.New(clk, now.AddDate(0, 0, -2))
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	cfg := &config.Config{}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		cfg.Resources = append(cfg.Resources, config.Resource{Name: name, KWHResource: name + "-kwh", PenceResource: name + "-pence"})
+	}
+	cfg.Scrape.Lookback = 24 * time.Hour
+	cfg.Scrape.Concurrency = 2
+	mem := newMemorySink()
+	st := &settings{
+		cfg:       cfg,
+		resources: cfg.Resources,
+		sinks:     []sink.Sink{mem},
+		stamps:    slot.Policy{Precision: time.Second, Align: slot.AlignStart},
+	}
+
+	if result := scrapeCycle(st); result != cycleOK {
+		t.Fatalf("result %v, want cycleOK", result)
+	}
+	for _, meta := range st.resources {
+		if n := len(mem.series("energy_usage", map[string]string{"resource": meta.Name, "period": "30m"})); n != 49 {
+			t.Errorf("%s: %d slots written, want 49", meta.Name, n)
+		}
+	}
+}
+
+func TestScrapeCycleSkipsWriteWithNothingNew(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 5, 0, 0, time.UTC)
+	fake := fakeClock(t, now)
+
+	fakeGlow := glowtest.New(clk, now.AddDate(0, 0, -2))
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	cfg := &config.Config{Resources: []config.Resource{{Name: "skip-test", KWHResource: "kwh", PenceResource: "pence"}}}
+	cfg.Scrape.Lookback = 24 * time.Hour
+	mem := newMemorySink()
+	st := &settings{
+		cfg:       cfg,
+		resources: cfg.Resources,
+		sinks:     []sink.Sink{mem},
+		stamps:    slot.Policy{Precision: time.Second, Align: slot.AlignStart},
+	}
+	skippedBefore := noNewDataTotal.Value("skip-test", "memory")
+	if result := scrapeCycle(st); result != cycleOK {
+		t.Fatalf("result %v, want cycleOK", result)
+	}
+	writes := mem.writes
+
+	// Ten minutes on, Glow has no new slot
+	fake.Advance(10 * time.Minute)
+	if result := scrapeCycle(st); result != cycleOK {
+		t.Fatalf("result %v, want cycleOK", result)
+	}
+	if n := noNewDataTotal.Value("skip-test", "memory") - skippedBefore; n != 1 {
+		t.Errorf("counted %v cycles with nothing new, want 1", n)
+	}
+	if mem.writes != writes {
+		t.Errorf("wrote %d times with no new readings", mem.writes-writes)
+	}
+}
+
+func TestScrapeCycleStampsTariffWithLatestReading(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 5, 0, 0, time.UTC)
+	// The host clock is three hours fast
+	fakeClock(t, now.Add(3*time.Hour))
+
+	fakeGlow := glowtest.New(clockwork.NewFakeClockAt(now), now.AddDate(0, 0, -2))
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	cfg := &config.Config{Resources: []config.Resource{{Name: "elec", KWHResource: "kwh", PenceResource: "pence"}}}
+	cfg.Scrape.Lookback = 24 * time.Hour
+	mem := newMemorySink()
+	st := &settings{
+		cfg:       cfg,
+		resources: cfg.Resources,
+		sinks:     []sink.Sink{mem},
+		stamps:    slot.Policy{Precision: time.Second, Align: slot.AlignStart},
+	}
+
+	if result := scrapeCycle(st); result != cycleOK {
+		t.Fatalf("result %v, want cycleOK", result)
+	}
+	tariffs := mem.series("energy_tariff", map[string]string{"resource": "elec"})
+	if len(tariffs) != 1 || !tariffs[0].Equal(fakeGlow.Last()) {
+		t.Errorf("tariff points at %v, want one at the latest reading %s", tariffs, fakeGlow.Last())
+	}
+	usage := mem.series("energy_usage", map[string]string{"resource": "elec", "period": "30m"})
+	if len(usage) == 0 || !usage[len(usage)-1].Equal(fakeGlow.Last()) {
+		t.Errorf("latest usage slot is not Glow's latest reading %s", fakeGlow.Last())
+	}
+}
+
+func TestScrapeCycleWritesNetMeterToExport(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 5, 0, 0, time.UTC)
+	fake := fakeClock(t, now)
+
+	fakeGlow := glowtest.New(clk, now.AddDate(0, 0, -1))
+	defer fakeGlow.Close()
+	fakeGlow.Negative = map[string]bool{"net-kwh": true}
+	fakeGlow.Usage = func(string, time.Time) float64 { return -0.4 }
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	cfg := &config.Config{Resources: []config.Resource{{Name: "solar", KWHResource: "net-kwh", PenceResource: "net-pence"}}}
+	cfg.Scrape.Lookback = 6 * time.Hour
+	mem := newMemorySink()
+	st := &settings{
+		cfg:       cfg,
+		resources: cfg.Resources,
+		sinks:     []sink.Sink{mem},
+		stamps:    slot.Policy{Precision: time.Second, Align: slot.AlignStart},
+	}
+	tags := map[string]string{"resource": "solar", "period": "30m"}
+
+	if result := scrapeCycle(st); result != cycleOK {
+		t.Fatalf("result %v, want cycleOK", result)
+	}
+	if n := len(mem.series("energy_usage", tags)); n != 0 {
+		t.Errorf("wrote %d export slots as consumption", n)
+	}
+	exported, _ := mem.ReadPoints(context.Background(), "energy_export", tags, now.AddDate(0, 0, -1), now)
+	if len(exported) == 0 {
+		t.Fatal("wrote no energy_export points")
+	}
+	for _, p := range exported {
+		if p.Fields["kwh"] != -0.4 {
+			t.Errorf("slot at %s has %v kWh, want -0.4", p.Time, p.Fields["kwh"])
+		}
+	}
+
+	// Export slots are compared with what is stored like consumption is
+	writes := mem.writes
+	fake.Advance(10 * time.Minute)
+	if result := scrapeCycle(st); result != cycleOK {
+		t.Fatalf("result %v, want cycleOK", result)
+	}
+	if mem.writes != writes {
+		t.Errorf("rewrote unchanged export slots")
+	}
+}
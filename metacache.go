@@ -0,0 +1,138 @@
+package main
+
+import (
+	"energy-meter-scraper/glowapi"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// tariffCacheFor is how long a resource's tariff is reused before asking
+// Glow again. Tariffs change rarely, and a change is recorded within this.
+const tariffCacheFor = time.Hour
+
+// metaCache holds what Glow says about a resource that changes rarely or
+// never, so that cycles don't ask again every half hour. It is keyed by Glow
+// resource ID. A resource's entries are dropped when scraping it fails, in
+// case they were the cause, and all of them if the Glow session is replaced.
+var metaCache = struct {
+	mu      sync.Mutex
+	api     *glowapi.API
+	first   map[string]time.Time
+	tariffs map[string]cachedTariff
+	units   map[string]resourceUnits
+}{}
+
+type cachedTariff struct {
+	tariff  *glowapi.Tariff
+	fetched time.Time
+}
+
+// lockMetaCache locks the cache for the current Glow session, emptying it
+// if the session has changed.
+func lockMetaCache() {
+	metaCache.mu.Lock()
+	if metaCache.api != glow {
+		metaCache.api = glow
+		metaCache.first = map[string]time.Time{}
+		metaCache.tariffs = map[string]cachedTariff{}
+		metaCache.units = map[string]resourceUnits{}
+	}
+}
+
+// resourceFirstTime is glow.GetResourceFirstTime, which never changes once
+// known.
+func resourceFirstTime(id string) (time.Time, error) {
+	lockMetaCache()
+	first, ok := metaCache.first[id]
+	metaCache.mu.Unlock()
+	if ok {
+		return first, nil
+	}
+
+	first, err := glow.GetResourceFirstTime(id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	lockMetaCache()
+	metaCache.first[id] = first
+	metaCache.mu.Unlock()
+	return first, nil
+}
+
+// resourceTariff is glow.Tariff, reused for tariffCacheFor.
+func resourceTariff(id string) (*glowapi.Tariff, error) {
+	lockMetaCache()
+	cached, ok := metaCache.tariffs[id]
+	metaCache.mu.Unlock()
+	if ok && clk.Since(cached.fetched) < tariffCacheFor {
+		return cached.tariff, nil
+	}
+
+	tariff, err := glow.Tariff(id)
+	if err != nil {
+		return nil, err
+	}
+	lockMetaCache()
+	metaCache.tariffs[id] = cachedTariff{tariff: tariff, fetched: clk.Now()}
+	metaCache.mu.Unlock()
+	return tariff, nil
+}
+
+// resourceUnits is how a resource's readings are to be read, from its
+// metadata.
+type resourceUnits struct {
+	// scale is what readings are multiplied by to be in kWh.
+	scale float64
+	// exports is set for export and net meters, whose readings are energy
+	// sent to the grid or can go negative.
+	exports bool
+}
+
+// resourceUnitsOf returns how readings of the resource are to be read. Its
+// metadata is only asked for once.
+func resourceUnitsOf(id string) (resourceUnits, error) {
+	lockMetaCache()
+	units, ok := metaCache.units[id]
+	metaCache.mu.Unlock()
+	if ok {
+		return units, nil
+	}
+
+	resource, err := glow.GetResource(id)
+	if err != nil {
+		return resourceUnits{}, err
+	}
+	scale, unit := resource.KWhScale()
+	units = resourceUnits{scale: scale, exports: resource.Exports()}
+	if scale != 1 {
+		slog.Info("converting readings to kWh", "glowResource", id, "unit", unit)
+	}
+	if units.exports {
+		slog.Info("writing readings to energy_export", "glowResource", id, "classifier", resource.Classifier)
+	}
+	lockMetaCache()
+	metaCache.units[id] = units
+	metaCache.mu.Unlock()
+	return units, nil
+}
+
+// resourceExports reports whether the resource is known to be an export or
+// net meter. It doesn't ask Glow, as its readings have been read by the time
+// this matters.
+func resourceExports(id string) bool {
+	lockMetaCache()
+	defer metaCache.mu.Unlock()
+	return metaCache.units[id].exports
+}
+
+// forgetMeta drops what is cached about meta's Glow resources.
+func forgetMeta(meta resourceMeta) {
+	lockMetaCache()
+	defer metaCache.mu.Unlock()
+	for _, id := range []string{meta.KWHResource, meta.PenceResource} {
+		delete(metaCache.first, id)
+		delete(metaCache.tariffs, id)
+		delete(metaCache.units, id)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/glowapi/glowtest"
+	"testing"
+	"time"
+)
+
+func TestMetaCache(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fake := fakeClock(t, now)
+
+	fakeGlow := glowtest.New(clk, now.AddDate(0, 0, -10))
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	lookups := func() {
+		t.Helper()
+		if first, err := resourceFirstTime("kwh"); err != nil || !first.Equal(fakeGlow.First) {
+			t.Fatalf("first time %v, %v", first, err)
+		}
+		if _, err := resourceTariff("kwh"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	requests := func() int { return fakeGlow.Requests() }
+
+	before := requests()
+	lookups()
+	lookups()
+	if n := requests() - before; n != 2 {
+		t.Errorf("%d requests for two rounds of lookups, want 2", n)
+	}
+
+	// The tariff expires, the first time doesn't
+	fake.Advance(tariffCacheFor)
+	before = requests()
+	lookups()
+	if n := requests() - before; n != 1 {
+		t.Errorf("%d requests after the tariff expired, want 1", n)
+	}
+
+	before = requests()
+	forgetMeta(config.Resource{Name: "cache-test", KWHResource: "kwh", PenceResource: "pence"})
+	lookups()
+	if n := requests() - before; n != 2 {
+		t.Errorf("%d requests after forgetting the resource, want 2", n)
+	}
+
+	// A new session starts afresh
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+	before = requests()
+	lookups()
+	if n := requests() - before; n != 2 {
+		t.Errorf("%d requests with a new session, want 2", n)
+	}
+}
@@ -0,0 +1,135 @@
+// Package metrics counts what the scraper does, for the log, health points
+// and exporters to report.
+package metrics
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+type Kind int
+
+const (
+	KindCounter Kind = iota
+	KindGauge
+)
+
+// Metric is a counter or gauge, optionally split by label values.
+type Metric struct {
+	Name   string
+	Help   string
+	Kind   Kind
+	Labels []string
+
+	// persist keeps the values in a snapshot, as it does every counter.
+	persist bool
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []*Metric
+)
+
+func register(m *Metric) *Metric {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, existing := range registry {
+		if existing.Name == m.Name {
+			panic("metric registered twice: " + m.Name)
+		}
+	}
+	m.values = map[string]float64{}
+	registry = append(registry, m)
+	return m
+}
+
+// NewCounter registers a metric that only goes up.
+func NewCounter(name, help string, labels ...string) *Metric {
+	return register(&Metric{Name: name, Help: help, Kind: KindCounter, Labels: labels, persist: true})
+}
+
+// NewGauge registers a metric that is set to its current value.
+func NewGauge(name, help string, labels ...string) *Metric {
+	return register(&Metric{Name: name, Help: help, Kind: KindGauge, Labels: labels})
+}
+
+// Persist keeps a gauge's values across restarts in the snapshot, for one
+// such as a timestamp that is meaningless once reset.
+func (m *Metric) Persist() *Metric {
+	m.persist = true
+	return m
+}
+
+// labelSep can't appear in label values we use (resource names and the like).
+const labelSep = "\x00"
+
+func (m *Metric) key(labelValues []string) string {
+	if len(labelValues) != len(m.Labels) {
+		panic("metric " + m.Name + ": wrong number of label values")
+	}
+	return strings.Join(labelValues, labelSep)
+}
+
+func (m *Metric) Inc(labelValues ...string) {
+	m.Add(1, labelValues...)
+}
+
+func (m *Metric) Add(v float64, labelValues ...string) {
+	k := m.key(labelValues)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[k] += v
+}
+
+func (m *Metric) Set(v float64, labelValues ...string) {
+	k := m.key(labelValues)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[k] = v
+}
+
+func (m *Metric) Value(labelValues ...string) float64 {
+	k := m.key(labelValues)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.values[k]
+}
+
+// Sample is one value of a metric.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// Samples returns every value of m, sorted by label values.
+func (m *Metric) Samples() []Sample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]string, 0, len(m.values))
+	for k := range m.values {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	out := make([]Sample, 0, len(keys))
+	for _, k := range keys {
+		var labelValues []string
+		if len(m.Labels) > 0 {
+			labelValues = strings.Split(k, labelSep)
+		}
+		out = append(out, Sample{LabelValues: labelValues, Value: m.values[k]})
+	}
+	return out
+}
+
+// All returns every registered metric in registration order.
+func All() []*Metric {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return slices.Clone(registry)
+}
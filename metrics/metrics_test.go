@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Metrics can only be registered once, so tests register theirs here and
+// reset them, to run with -count.
+var (
+	testErrors        = NewCounter("test_errors_total", "Errors.", "resource")
+	testLevel         = NewGauge("test_level", "Level.")
+	testSnapshotTotal = NewCounter("test_snapshot_total", "Points.", "sink")
+	testSnapshotTime  = NewGauge("test_snapshot_timestamp", "Last success.").Persist()
+	testSnapshotLevel = NewGauge("test_snapshot_level", "Level.")
+	testTextRequests  = NewCounter("test_text_requests_total", "Requests.", "endpoint", "status")
+	_                 = NewGauge("test_text_unset", "Never set.")
+)
+
+func reset(ms ...*Metric) {
+	for _, m := range ms {
+		m.mu.Lock()
+		m.values = map[string]float64{}
+		m.mu.Unlock()
+	}
+}
+
+func TestMetric(t *testing.T) {
+	c, g := testErrors, testLevel
+	reset(c, g)
+	c.Inc("gas")
+	c.Add(2, "electricity")
+	c.Inc("gas")
+
+	if got := c.Value("gas"); got != 2 {
+		t.Errorf("gas = %v, want 2", got)
+	}
+	samples := c.Samples()
+	if len(samples) != 2 || samples[0].LabelValues[0] != "electricity" || samples[0].Value != 2 {
+		t.Errorf("samples = %+v", samples)
+	}
+
+	g.Set(5)
+	g.Set(3)
+	if got := g.Value(); got != 3 {
+		t.Errorf("gauge = %v, want 3", got)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	c, g, level := testSnapshotTotal, testSnapshotTime, testSnapshotLevel
+	reset(c, g, level)
+	c.Add(3, "influx")
+	g.Set(100)
+	level.Set(7)
+	if err := Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restart starts from zero, and what is counted before loading is
+	// added to what was saved
+	c.Set(1, "influx")
+	level.Set(0)
+	reset(g)
+	if err := Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Value("influx"); got != 4 {
+		t.Errorf("counter = %v, want 4", got)
+	}
+	if got := g.Value(); got != 100 {
+		t.Errorf("persisted gauge = %v, want 100", got)
+	}
+	if got := level.Value(); got != 0 {
+		t.Errorf("gauge = %v, want it left at 0", got)
+	}
+
+	if err := Load(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("missing snapshot: %v", err)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	c := testTextRequests
+	reset(c)
+	c.Inc("resource/{id}/readings", "200")
+	c.Add(2, `say "hi"`, "error")
+
+	var b strings.Builder
+	if err := WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_text_requests_total Requests.
+# TYPE test_text_requests_total counter
+test_text_requests_total{endpoint="resource/{id}/readings",status="200"} 1
+test_text_requests_total{endpoint="say \"hi\"",status="error"} 2
+`
+	if !strings.Contains(b.String(), want) {
+		t.Errorf("missing\n%s\nin\n%s", want, b.String())
+	}
+	if strings.Contains(b.String(), "test_text_unset") {
+		t.Errorf("metric without a value written:\n%s", b.String())
+	}
+}
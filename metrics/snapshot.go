@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// savedSample is a value in a snapshot file.
+type savedSample struct {
+	Labels []string `json:"labels,omitempty"`
+	Value  float64  `json:"value"`
+}
+
+// Save writes the counters and persisted gauges to path, replacing it
+// atomically so that a crash leaves either the old or the new snapshot.
+func Save(path string) error {
+	saved := map[string][]savedSample{}
+	for _, m := range All() {
+		if !m.persist {
+			continue
+		}
+		for _, s := range m.Samples() {
+			saved[m.Name] = append(saved[m.Name], savedSample{Labels: s.LabelValues, Value: s.Value})
+		}
+	}
+	contents, marshalErr := json.MarshalIndent(saved, "", "  ")
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	tmp, tmpErr := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if tmpErr != nil {
+		return fmt.Errorf("metrics snapshot: %w", tmpErr)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(contents); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("metrics snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("metrics snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("metrics snapshot: %w", err)
+	}
+	return nil
+}
+
+// Load restores the snapshot at path, adding saved counts to those made
+// since starting and setting gauges that haven't been. A missing file
+// restores nothing, and values of metrics since removed or relabelled are
+// dropped.
+func Load(path string) error {
+	contents, readErr := os.ReadFile(path)
+	if errors.Is(readErr, fs.ErrNotExist) {
+		return nil
+	}
+	if readErr != nil {
+		return fmt.Errorf("metrics snapshot: %w", readErr)
+	}
+	var saved map[string][]savedSample
+	if err := json.Unmarshal(contents, &saved); err != nil {
+		return fmt.Errorf("metrics snapshot %s: %w", path, err)
+	}
+
+	for _, m := range All() {
+		if !m.persist {
+			continue
+		}
+		for _, s := range saved[m.Name] {
+			if len(s.Labels) != len(m.Labels) {
+				continue
+			}
+			k := m.key(s.Labels)
+			m.mu.Lock()
+			if _, set := m.values[k]; m.Kind == KindCounter || !set {
+				m.values[k] += s.Value
+			}
+			m.mu.Unlock()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteText writes every registered metric with a value in the Prometheus
+// text format.
+func WriteText(w io.Writer) error {
+	for _, m := range All() {
+		samples := m.Samples()
+		if len(samples) == 0 {
+			continue
+		}
+		kind := "gauge"
+		if m.Kind == KindCounter {
+			kind = "counter"
+		}
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.Name, m.Help, m.Name, kind); err != nil {
+			return err
+		}
+		for _, s := range samples {
+			var labels []string
+			for i, name := range m.Labels {
+				labels = append(labels, fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(s.LabelValues[i])))
+			}
+			series := m.Name
+			if len(labels) > 0 {
+				series += "{" + strings.Join(labels, ",") + "}"
+			}
+			if _, err := fmt.Fprintf(w, "%s %s\n", series, strconv.FormatFloat(s.Value, 'f', -1, 64)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
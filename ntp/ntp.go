@@ -0,0 +1,85 @@
+package ntp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+// ntpEpochOffset is the number of seconds between 1900 (the NTP epoch) and 1970.
+const ntpEpochOffset = 2208988800
+
+// Offset queries an SNTP server and returns how far the local clock is behind
+// it. A positive offset means the local clock is slow.
+func Offset(ctx context.Context, server string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+
+	var d net.Dialer
+	conn, dialErr := d.DialContext(ctx, "udp", server)
+	if dialErr != nil {
+		return 0, dialErr
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return 0, err
+	}
+
+	req := make([]byte, 48)
+	// Leap indicator 0, version 4, mode 3 (client)
+	req[0] = 0x23
+	t1 := time.Now()
+	putTimestamp(req[40:], t1)
+
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+
+	resp := make([]byte, 48)
+	n, readErr := conn.Read(resp)
+	if readErr != nil {
+		return 0, readErr
+	}
+	t4 := time.Now()
+	if n < 48 {
+		return 0, errors.New("short ntp response")
+	}
+	if mode := resp[0] & 0x7; mode != 4 {
+		return 0, errors.New("unexpected ntp response mode")
+	}
+	// The server echoes our transmit timestamp as its origin timestamp, which
+	// rules out stale or spoofed replies
+	if !bytes.Equal(resp[24:32], req[40:48]) {
+		return 0, errors.New("ntp response does not match request")
+	}
+	if stratum := resp[1]; stratum == 0 {
+		return 0, errors.New("ntp server sent kiss-of-death")
+	}
+
+	t2 := getTimestamp(resp[32:])
+	t3 := getTimestamp(resp[40:])
+
+	return (t2.Sub(t1) + t3.Sub(t4)) / 2, nil
+}
+
+func putTimestamp(b []byte, t time.Time) {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	binary.BigEndian.PutUint32(b[0:], uint32(secs))
+	binary.BigEndian.PutUint32(b[4:], uint32(frac))
+}
+
+func getTimestamp(b []byte) time.Time {
+	secs := int64(binary.BigEndian.Uint32(b[0:])) - ntpEpochOffset
+	frac := int64(binary.BigEndian.Uint32(b[4:]))
+	return time.Unix(secs, frac*1e9>>32)
+}
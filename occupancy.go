@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/sink"
+	"log/slog"
+	"time"
+)
+
+// occupancyPoint samples the home/away state as an energy_occupancy point,
+// so that later checks can tell which days the household was away.
+func occupancyPoint(st *settings) (sink.Point, bool) {
+	if st.occupancy == nil {
+		return sink.Point{}, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	away, awayErr := st.occupancy.Away(ctx)
+	if awayErr != nil {
+		slog.Warn("failed to read occupancy", "error", awayErr)
+		return sink.Point{}, false
+	}
+
+	awayVal := 0
+	if away {
+		awayVal = 1
+	}
+	return sink.Point{
+		Measurement: "energy_occupancy",
+		Tags:        map[string]string{},
+		Fields:      map[string]any{"away": awayVal},
+		Time:        st.stamps.Truncate(clk.Now()),
+	}, true
+}
+
+// awayOn reports whether the household was away for most of the day, judged
+// from the stored occupancy samples.
+func awayOn(ctx context.Context, st *settings, summer sink.Summer, day time.Time) (bool, error) {
+	if st.occupancy == nil {
+		return false, nil
+	}
+	awaySamples, n, err := summer.SumField(ctx, "energy_occupancy", "away", nil, day, day.AddDate(0, 0, 1))
+	if err != nil || n == 0 {
+		return false, err
+	}
+	return awaySamples*2 > float64(n), nil
+}
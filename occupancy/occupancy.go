@@ -0,0 +1,93 @@
+// Package occupancy reads whether the household is home or away from an
+// external input, such as a file maintained by an automation or a Home
+// Assistant entity.
+package occupancy
+
+import (
+	"context"
+	"encoding/json"
+	"energy-meter-scraper/config"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+type Source struct {
+	cfg    config.OccupancyConfig
+	client *http.Client
+}
+
+// New returns nil if no occupancy input is configured.
+func New(cfg config.OccupancyConfig, client *http.Client) *Source {
+	if cfg.File == "" && cfg.URL == "" {
+		return nil
+	}
+	return &Source{cfg: cfg, client: client}
+}
+
+// Away reports whether the household is currently away. A nil Source is
+// always home.
+func (s *Source) Away(ctx context.Context) (bool, error) {
+	if s == nil {
+		return false, nil
+	}
+
+	var state string
+	var err error
+	if s.cfg.File != "" {
+		state, err = s.readFile()
+	} else {
+		state, err = s.fetch(ctx)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return slices.Contains(s.cfg.AwayValues, strings.ToLower(strings.TrimSpace(state))), nil
+}
+
+func (s *Source) readFile() (string, error) {
+	contents, err := os.ReadFile(s.cfg.File)
+	if err != nil {
+		return "", err
+	}
+	return string(contents), nil
+}
+
+// fetch reads the state from a URL returning either plain text or a JSON
+// object with a state key, as Home Assistant's /api/states/<entity> does.
+func (s *Source) fetch(ctx context.Context) (string, error) {
+	req, newReqErr := http.NewRequestWithContext(ctx, "GET", s.cfg.URL, nil)
+	if newReqErr != nil {
+		return "", newReqErr
+	}
+	if s.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.Token)
+	}
+
+	resp, getErr := s.client.Do(req)
+	if getErr != nil {
+		return "", getErr
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("http status code %d", resp.StatusCode)
+	}
+
+	body, readErr := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if readErr != nil {
+		return "", readErr
+	}
+
+	var entity struct {
+		State string `json:"state"`
+	}
+	if json.Unmarshal(body, &entity) == nil && entity.State != "" {
+		return entity.State, nil
+	}
+	return string(body), nil
+}
@@ -0,0 +1,154 @@
+//go:build !minimal && !no_server
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// openAPIDocument describes routes as an OpenAPI 3.0 document. Response
+// schemas are derived from the types the handlers encode, so they can't
+// drift from what is served.
+func openAPIDocument(routes []apiRoute) map[string]any {
+	paths := map[string]any{}
+	for _, r := range routes {
+		op := map[string]any{
+			"summary":   r.summary,
+			"responses": map[string]any{"200": okResponse(r)},
+		}
+		var params []any
+		for _, p := range r.params {
+			schema := map[string]any{"type": p.kind}
+			if p.kind == "date-time" {
+				schema = map[string]any{"type": "string", "format": "date-time"}
+			}
+			params = append(params, map[string]any{"name": p.name, "in": "query", "description": p.description, "schema": schema})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+
+		switch r.access {
+		case accessNone:
+			op["security"] = []any{}
+		case accessRead:
+			op["security"] = []any{map[string]any{"bearer": []any{}}, map[string]any{"shareLink": []any{}}}
+		}
+		if r.access != accessNone {
+			op["responses"].(map[string]any)["401"] = map[string]any{"description": "Missing or invalid credentials."}
+		}
+
+		if paths[r.path] == nil {
+			paths[r.path] = map[string]any{}
+		}
+		paths[r.path].(map[string]any)[strings.ToLower(r.method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "energy-meter-scraper",
+			"version": "1",
+			"description": "The scraper's dashboard and API. Without server.token, which is only allowed " +
+				"when listening on loopback, every endpoint is open.",
+		},
+		"paths":    paths,
+		"security": []any{map[string]any{"bearer": []any{}}},
+		"components": map[string]any{
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer", "description": "server.token"},
+				"shareLink": map[string]any{"type": "apiKey", "in": "query", "name": "sig",
+					"description": "A signed share link from `energy-meter-scraper share`, with its exp parameter."},
+			},
+		},
+	}
+}
+
+func okResponse(r apiRoute) map[string]any {
+	resp := map[string]any{"description": "OK"}
+	contentType, schema := r.contentType, map[string]any{"type": "string"}
+	if r.response != nil {
+		contentType, schema = "application/json", jsonSchema(reflect.TypeOf(r.response))
+	} else if contentType == "application/json" {
+		schema = map[string]any{"type": "object"}
+	}
+	resp["content"] = map[string]any{contentType: map[string]any{"schema": schema}}
+	return resp
+}
+
+// jsonSchema describes how encoding/json encodes values of t.
+func jsonSchema(t reflect.Type) map[string]any {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := jsonSchema(t.Elem())
+		schema["nullable"] = true
+		return schema
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		props := map[string]any{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = jsonSchema(f.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]any{"type": "object", "properties": props}
+		if required != nil {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return map[string]any{}
+}
+
+func handleOpenAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(openAPIDocument(apiRoutes()))
+}
+
+func init() {
+	commands["openapi"] = runOpenAPI
+}
+
+// runOpenAPI prints the OpenAPI document, for generating clients without a
+// running server.
+func runOpenAPI(args []string) {
+	_ = flag.NewFlagSet("openapi", flag.ExitOnError).Parse(args)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(openAPIDocument(apiRoutes()))
+}
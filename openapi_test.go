@@ -0,0 +1,65 @@
+//go:build !minimal && !no_server
+
+package main
+
+import (
+	"encoding/json"
+	"energy-meter-scraper/config"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.Token = "secret"
+	publish(&settings{cfg: cfg, sinkRefs: &sinkSet{}})
+
+	// The document is served without a token, and encodes as JSON
+	rec := httptest.NewRecorder()
+	requireAccess(accessNone, http.HandlerFunc(handleOpenAPI)).ServeHTTP(rec, httptest.NewRequest("GET", "/api/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Security  []map[string][]string `json:"security"`
+			Responses map[string]struct {
+				Content map[string]struct {
+					Schema schemaObject `json:"schema"`
+				} `json:"content"`
+			} `json:"responses"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range apiRoutes() {
+		if _, ok := doc.Paths[r.path][strings.ToLower(r.method)]; !ok {
+			t.Errorf("%s %s is not documented", r.method, r.path)
+		}
+	}
+	if security := doc.Paths["/api/openapi.json"]["get"].Security; security == nil || len(security) != 0 {
+		t.Errorf("openapi.json security %v, want none", security)
+	}
+
+	status := doc.Paths["/api/status"]["get"].Responses["200"].Content["application/json"].Schema
+	if status.Type != "object" || !slices.Contains(status.Required, "primary") || status.Properties["paused"].Type != "boolean" {
+		t.Errorf("status schema %+v", status)
+	}
+	entry := doc.Paths["/api/changefeed"]["get"].Responses["200"].Content["application/json"].Schema.Items
+	if entry == nil || entry.Properties["at"].Format != "date-time" || slices.Contains(entry.Required, "resource") {
+		t.Errorf("changefeed entry schema %+v", entry)
+	}
+}
+
+type schemaObject struct {
+	Type       string                  `json:"type"`
+	Format     string                  `json:"format"`
+	Properties map[string]schemaObject `json:"properties"`
+	Required   []string                `json:"required"`
+	Items      *schemaObject           `json:"items"`
+}
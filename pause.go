@@ -0,0 +1,64 @@
+package main
+
+import (
+	"energy-meter-scraper/metrics"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+var (
+	// paused stops the scheduled jobs, leaving the process and its servers
+	// running.
+	paused atomic.Bool
+
+	pausedGauge = metrics.NewGauge("scraper_paused",
+		"1 if scheduled scraping is paused.")
+)
+
+// setPaused pauses or resumes the scheduled jobs, reporting whether that
+// changed anything. A cycle already running finishes.
+func setPaused(pause bool) bool {
+	if paused.Swap(pause) == pause {
+		return false
+	}
+	if pause {
+		pausedGauge.Set(1)
+		slog.Info("paused scheduled scraping")
+	} else {
+		pausedGauge.Set(0)
+		slog.Info("resumed scheduled scraping")
+	}
+	return true
+}
+
+// watchPauses pauses scheduled scraping on SIGUSR1 and resumes it on
+// SIGUSR2, for maintenance scripts without access to the API.
+func watchPauses() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	for sig := range signals {
+		setPaused(sig == syscall.SIGUSR1)
+	}
+}
+
+// handlePause pauses or resumes scheduled scraping, for the API and the
+// admin socket.
+func handlePause(pause bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		changed := setPaused(pause)
+		state := "resumed"
+		if pause {
+			state = "paused"
+		}
+		if !changed {
+			state = "already " + state
+		}
+		fmt.Fprintln(w, state)
+	}
+}
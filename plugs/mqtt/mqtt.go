@@ -0,0 +1,42 @@
+// Package mqtt subscribes to smart plugs' topics on an MQTT broker.
+package mqtt
+
+import (
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/plugs"
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+func init() {
+	plugs.RegisterSubscriber(subscribe)
+}
+
+// subscribe connects in the background, like the MQTT sink, and subscribes
+// again on every connection, as the broker may not have kept the session.
+func subscribe(cfg config.PlugsConfig, deliver func(plug string, payload []byte)) (func(), error) {
+	filters := map[string]byte{}
+	byTopic := map[string]string{}
+	for _, p := range cfg.Plugs {
+		filters[p.Topic] = 0
+		byTopic[p.Topic] = p.Name
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(func(c paho.Client) {
+			c.SubscribeMultiple(filters, func(_ paho.Client, m paho.Message) {
+				if name, ok := byTopic[m.Topic()]; ok {
+					deliver(name, m.Payload())
+				}
+			})
+		})
+	client := paho.NewClient(opts)
+	client.Connect()
+
+	return func() { client.Disconnect(250) }, nil
+}
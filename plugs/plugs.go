@@ -0,0 +1,185 @@
+// Package plugs follows the energy counters smart plugs report, so that
+// each appliance's share of a half hour slot is known.
+package plugs
+
+import (
+	"encoding/json"
+	"energy-meter-scraper/clock"
+	"energy-meter-scraper/config"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const slotLength = 30 * time.Minute
+
+// maxInterval is the longest between two readings whose difference is
+// shared over the time between them. Across a longer gap, such as the plug
+// or broker being down, the slots aren't known.
+const maxInterval = 30 * time.Minute
+
+// retain is how long slots are kept for, as Glow's readings often arrive
+// hours, and sometimes days, late.
+const retain = 7 * 24 * time.Hour
+
+// Subscriber delivers each message published to a plug's topic until stop
+// is called.
+type Subscriber func(cfg config.PlugsConfig, deliver func(plug string, payload []byte)) (stop func(), err error)
+
+var subscriber Subscriber
+
+func RegisterSubscriber(s Subscriber) {
+	subscriber = s
+}
+
+// Tracker totals each plug's energy by slot.
+type Tracker struct {
+	clk     clock.Clock
+	formats map[string]string
+
+	mu    sync.Mutex
+	plugs map[string]*plug
+}
+
+type plug struct {
+	seen  bool
+	last  time.Time
+	total float64
+	// kwh and covered are by the Unix time each slot starts, covered being
+	// how much of the slot is between readings.
+	kwh     map[int64]float64
+	covered map[int64]time.Duration
+}
+
+func New(cfg config.PlugsConfig, clk clock.Clock) *Tracker {
+	t := &Tracker{clk: clk, formats: map[string]string{}, plugs: map[string]*plug{}}
+	for _, p := range cfg.Plugs {
+		t.formats[p.Name] = p.Format
+		t.plugs[p.Name] = &plug{kwh: map[int64]float64{}, covered: map[int64]time.Duration{}}
+	}
+	return t
+}
+
+// Follow subscribes to cfg's plugs, or returns an error if this build has
+// no subscriber.
+func Follow(cfg config.PlugsConfig, clk clock.Clock) (*Tracker, func(), error) {
+	if subscriber == nil {
+		return nil, nil, fmt.Errorf("smart plugs are not supported in this build")
+	}
+	t := New(cfg, clk)
+	stop, subscribeErr := subscriber(cfg, t.Deliver)
+	if subscribeErr != nil {
+		return nil, nil, subscribeErr
+	}
+	return t, stop, nil
+}
+
+// Deliver records a message from plug's topic, received now.
+func (t *Tracker) Deliver(name string, payload []byte) {
+	total, ok, parseErr := parse(t.formats[name], payload)
+	if parseErr != nil {
+		slog.Warn("unreadable smart plug reading", "plug", name, "error", parseErr)
+		return
+	}
+	if ok {
+		t.Record(name, total, t.clk.Now())
+	}
+}
+
+// Record notes that plug's counter read total kWh at at, sharing the
+// energy since its previous reading over the slots in between.
+func (t *Tracker) Record(name string, total float64, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.plugs[name]
+	if !ok {
+		return
+	}
+	// A counter going backwards has been reset, so starts afresh
+	if p.seen && at.After(p.last) && at.Sub(p.last) <= maxInterval && total >= p.total {
+		p.spread(p.last, at, total-p.total)
+	}
+	p.seen, p.last, p.total = true, at, total
+
+	cutoff := at.Add(-retain).Unix()
+	maps.DeleteFunc(p.kwh, func(start int64, _ float64) bool { return start < cutoff })
+	maps.DeleteFunc(p.covered, func(start int64, _ time.Duration) bool { return start < cutoff })
+}
+
+func (p *plug) spread(from, to time.Time, kwh float64) {
+	span := to.Sub(from)
+	for start := from.Truncate(slotLength); start.Before(to); start = start.Add(slotLength) {
+		begin, end := start, start.Add(slotLength)
+		if from.After(begin) {
+			begin = from
+		}
+		if to.Before(end) {
+			end = to
+		}
+		overlap := end.Sub(begin)
+		p.kwh[start.Unix()] += kwh * float64(overlap) / float64(span)
+		p.covered[start.Unix()] += overlap
+	}
+}
+
+// Slot returns each plug's kWh in the half hour from start, and false
+// unless every plug reported throughout it.
+func (t *Tracker) Slot(start time.Time) (map[string]float64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	shares := map[string]float64{}
+	for name, p := range t.plugs {
+		if p.covered[start.Unix()] < slotLength {
+			return nil, false
+		}
+		shares[name] = p.kwh[start.Unix()]
+	}
+	return shares, true
+}
+
+// parse reads a plug's energy counter in kWh from a message, returning
+// false for messages without one, such as a Tasmota SENSOR message from a
+// device with no energy monitoring.
+func parse(format string, payload []byte) (float64, bool, error) {
+	switch format {
+	case "tasmota":
+		var msg struct {
+			Energy *struct {
+				Total float64 `json:"Total"`
+			} `json:"ENERGY"`
+		}
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return 0, false, err
+		}
+		if msg.Energy == nil {
+			return 0, false, nil
+		}
+		return msg.Energy.Total, true, nil
+	case "shelly":
+		// Gen 1 devices publish watt-minutes, and later ones a status
+		// object with watt-hours
+		if wattMinutes, err := strconv.ParseFloat(strings.TrimSpace(string(payload)), 64); err == nil {
+			return wattMinutes / 60000, true, nil
+		}
+		var msg struct {
+			AEnergy *struct {
+				Total float64 `json:"total"`
+			} `json:"aenergy"`
+		}
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return 0, false, err
+		}
+		if msg.AEnergy == nil {
+			return 0, false, nil
+		}
+		return msg.AEnergy.Total / 1000, true, nil
+	default:
+		return 0, false, fmt.Errorf("unknown format %q", format)
+	}
+}
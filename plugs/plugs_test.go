@@ -0,0 +1,77 @@
+package plugs
+
+import (
+	"energy-meter-scraper/config"
+	"github.com/jonboulle/clockwork"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clk := clockwork.NewFakeClockAt(start.Add(-5 * time.Minute))
+	tr := New(config.PlugsConfig{Plugs: []config.Plug{
+		{Name: "washer", Format: "tasmota"},
+		{Name: "fridge", Format: "shelly"},
+	}}, clk)
+
+	// Readings every 10 minutes, from 5 minutes before the slot to 5 after
+	for i := 0; i <= 4; i++ {
+		tr.Deliver("washer", []byte(`{"Time":"2024-03-01T12:00:00","ENERGY":{"Total":`+ftoa(10+0.1*float64(i))+`}}`))
+		tr.Deliver("fridge", []byte(ftoa(60000*(1+0.02*float64(i)))))
+		clk.Advance(10 * time.Minute)
+	}
+	shares, ok := tr.Slot(start)
+	if !ok {
+		t.Fatal("slot not covered")
+	}
+	if !near(shares["washer"], 0.3) || !near(shares["fridge"], 0.06) {
+		t.Errorf("shares %v, want 0.3 and 0.06 kWh", shares)
+	}
+	if _, ok := tr.Slot(start.Add(30 * time.Minute)); ok {
+		t.Error("covered a slot the readings stop part way through")
+	}
+
+	// Messages without a counter are ignored, and a reset or a long gap
+	// leaves the time in between unknown
+	tr.Deliver("washer", []byte(`{"Time":"2024-03-01T12:45:00","ANALOG":{"A0":3}}`))
+	tr.Record("washer", 1, start.Add(50*time.Minute))
+	tr.Record("washer", 2, start.Add(2*time.Hour))
+	for _, tm := range []time.Time{start.Add(30 * time.Minute), start.Add(time.Hour)} {
+		if _, ok := tr.Slot(tm); ok {
+			t.Errorf("slot at %v covered across a reset or gap", tm)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		format, payload string
+		kwh             float64
+		ok              bool
+	}{
+		{"tasmota", `{"ENERGY":{"Total":1.5,"Power":40}}`, 1.5, true},
+		{"tasmota", `{"DS18B20":{"Temperature":20}}`, 0, false},
+		{"shelly", "120000", 2, true},
+		{"shelly", `{"id":0,"apower":12,"aenergy":{"total":2500}}`, 2.5, true},
+		{"shelly", `{"id":0,"output":true}`, 0, false},
+	} {
+		kwh, ok, err := parse(tc.format, []byte(tc.payload))
+		if err != nil || ok != tc.ok || !near(kwh, tc.kwh) {
+			t.Errorf("%s %s: got %v, %v, %v, want %v, %v", tc.format, tc.payload, kwh, ok, err, tc.kwh, tc.ok)
+		}
+	}
+	if _, _, err := parse("tasmota", []byte("on")); err == nil {
+		t.Error("no error for an unreadable message")
+	}
+}
+
+func ftoa(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func near(got, want float64) bool {
+	return math.Abs(got-want) < 1e-9
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"energy-meter-scraper/config"
+	"flag"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+var pprofAddr = flag.String("pprof", "", "serve net/http/pprof on this loopback address, e.g. localhost:6060, to profile in place")
+
+// servePprof runs the profiling endpoints under /debug/pprof/. Profiles
+// reveal enough of the process that they are only served locally; reach
+// them remotely through kubectl port-forward or an SSH tunnel.
+func servePprof(addr string) {
+	if !config.IsLoopback(addr) {
+		log.Fatalf("-pprof %s: must be a loopback address, such as localhost:6060", addr)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	slog.Info("serving pprof", "addr", addr)
+	// No write timeout, as CPU profiles and traces stream for as long as
+	// asked
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	if err := srv.ListenAndServe(); err != nil {
+		slog.Error("pprof server stopped", "error", err)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"energy-meter-scraper/sink"
+	"time"
+)
+
+// splitProvisional separates the usage slots starting within ProvisionalFor
+// of through, the resource's latest reading, from those old enough to be
+// final, and moves them to energy_usage_provisional. Without ProvisionalFor
+// every slot is final.
+func splitProvisional(st *settings, through time.Time, usage []sink.Point) (final, provisional []sink.Point) {
+	window := st.cfg.Scrape.ProvisionalFor
+	if window <= 0 {
+		return usage, nil
+	}
+	cutoff := through.Add(-window)
+	for _, p := range usage {
+		if p.Measurement != "energy_usage" || !st.stamps.Start(p.Time, 30*time.Minute).After(cutoff) {
+			final = append(final, p)
+			continue
+		}
+		p.Measurement = "energy_usage_provisional"
+		provisional = append(provisional, p)
+	}
+	return final, provisional
+}
+
+// reachProvisional moves since back to the earliest slot still provisional
+// at to, so that slots are read again until they are written as final.
+func reachProvisional(st *settings, since, to time.Time) time.Time {
+	if reach := to.Add(-st.cfg.Scrape.ProvisionalFor); reach.Before(since) {
+		return reach
+	}
+	return since
+}
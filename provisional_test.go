@@ -0,0 +1,81 @@
+package main
+
+import (
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/glowapi/glowtest"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/slot"
+	"testing"
+	"time"
+)
+
+func TestSplitProvisional(t *testing.T) {
+	through := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	st := &settings{cfg: &config.Config{}, stamps: slot.Policy{Align: slot.AlignEnd}}
+	st.cfg.Scrape.ProvisionalFor = time.Hour
+
+	var usage []sink.Point
+	for i := range 4 {
+		// Stamped at the end of slots starting 10:30 to 12:00
+		usage = append(usage, sink.Point{Measurement: "energy_usage", Time: through.Add(time.Duration(i-2) * 30 * time.Minute)})
+	}
+	final, provisional := splitProvisional(st, through, usage)
+	if len(final) != 2 || len(provisional) != 2 {
+		t.Fatalf("%d final and %d provisional, want 2 of each", len(final), len(provisional))
+	}
+	for _, p := range provisional {
+		if p.Measurement != "energy_usage_provisional" {
+			t.Errorf("provisional point written to %s", p.Measurement)
+		}
+	}
+	if usage[3].Measurement != "energy_usage" {
+		t.Error("splitting changed the usage passed in")
+	}
+
+	st.cfg.Scrape.ProvisionalFor = 0
+	if final, provisional := splitProvisional(st, through, usage); len(final) != 4 || provisional != nil {
+		t.Errorf("with provisional slots off, %d final and %d provisional", len(final), len(provisional))
+	}
+}
+
+func TestScrapeCyclePromotesProvisionalSlots(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 5, 0, 0, time.UTC)
+	fake := fakeClock(t, now)
+
+	fakeGlow := glowtest.New(clk, now.AddDate(0, 0, -2))
+	defer fakeGlow.Close()
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	cfg := &config.Config{Resources: []config.Resource{{Name: "elec", KWHResource: "kwh", PenceResource: "pence"}}}
+	cfg.Scrape.Lookback = 24 * time.Hour
+	cfg.Scrape.ProvisionalFor = time.Hour
+	mem := newMemorySink()
+	st := &settings{
+		cfg:       cfg,
+		resources: cfg.Resources,
+		sinks:     []sink.Sink{mem},
+		stamps:    slot.Policy{Precision: time.Second, Align: slot.AlignStart},
+	}
+	tags := map[string]string{"resource": "elec", "period": "30m"}
+
+	for range 2 {
+		if result := scrapeCycle(st); result != cycleOK {
+			t.Fatalf("result %v, want cycleOK", result)
+		}
+		final := mem.series("energy_usage", tags)
+		if len(final) == 0 || !final[len(final)-1].Equal(fakeGlow.Last().Add(-time.Hour)) {
+			t.Fatalf("latest final slot is not an hour before the latest reading %s", fakeGlow.Last())
+		}
+		provisional := mem.series("energy_usage_provisional", tags)
+		if len(provisional) == 0 || !provisional[len(provisional)-1].Equal(fakeGlow.Last()) {
+			t.Fatalf("latest provisional slot is not the latest reading %s", fakeGlow.Last())
+		}
+		fake.Advance(30 * time.Minute)
+	}
+}
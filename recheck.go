@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/schema"
+	"energy-meter-scraper/sink"
+	"log/slog"
+	"maps"
+	"math"
+	"strconv"
+	"time"
+)
+
+// recheckWindow re-reads the trailing window and rewrites slots whose values
+// Glow has since revised, e.g. after a DCC correction. Groups are combined
+// again from their members' fresh readings. The window ends at each
+// resource's latest reading, so a skewed host clock doesn't move it.
+func recheckWindow(st *settings) {
+	var from, to time.Time
+	fresh := map[string][]sink.Point{}
+	for _, meta := range st.resources {
+		if isDormantResource(meta.Name) {
+			continue
+		}
+		last, lastErr := glow.GetResourceLastTime(meta.KWHResource)
+		if lastErr != nil {
+			slog.Error("recheck: failed to read latest reading time", "resource", meta.Name, "error", lastErr)
+			continue
+		}
+		start := last.Add(-st.cfg.Recheck.Window)
+		if from.IsZero() || start.Before(from) {
+			from = start
+		}
+		if last.After(to) {
+			to = last
+		}
+		points, freshErr := readUsage(st, meta, start, last)
+		if freshErr != nil {
+			slog.Error("recheck: failed to read usage", "resource", meta.Name, "error", freshErr)
+			continue
+		}
+		fresh[meta.Name] = points
+		recheck(context.Background(), st, meta, points)
+	}
+
+	for _, g := range st.groups {
+		members := map[string][]sink.Point{}
+		for _, m := range g.members {
+			if points, ok := fresh[m]; ok {
+				members[m] = points
+			} else if !isDormantResource(m) {
+				members = nil
+				break
+			}
+		}
+		if len(members) == 0 {
+			slog.Warn("recheck: not combining group as a member failed", "group", g.name)
+			continue
+		}
+		recheck(context.Background(), st, g.meta(), combineUsage(st, g.name, members, from, to))
+	}
+}
+
+func recheck(ctx context.Context, st *settings, meta resourceMeta, fresh []sink.Point) {
+	overwrite := st.cfg.Recheck.Overwrite
+	for _, s := range st.sinks {
+		if _, ok := s.(sink.Reader); !ok && !overwrite {
+			continue
+		}
+
+		points, revisions, reviseErr := revise(ctx, s, meta, fresh)
+		if reviseErr != nil {
+			slog.Error("recheck: failed to read stored points", "resource", meta.Name, "sink", s.Name(), "error", reviseErr)
+			continue
+		}
+		if overwrite {
+			points = overwritten(fresh, points)
+		}
+		if len(points) == 0 {
+			slog.Info("recheck: no revisions", "resource", meta.Name, "sink", s.Name())
+			continue
+		}
+
+		if err := writeSink(ctx, st, s, points); err != nil {
+			slog.Error("recheck: failed to write revisions", "resource", meta.Name, "sink", s.Name(), "error", err)
+			continue
+		}
+		slog.Info("recheck: rewrote revised slots", "resource", meta.Name, "sink", s.Name(),
+			"count", len(points)-revisions, "revisions", revisions)
+	}
+}
+
+// revise compares fresh usage or export points for a resource with what s
+// stores, and returns the points to write: the new and revised slots
+// followed by an energy_usage_revision point for each revision, and how
+// many of those there are. Sinks that can't be read get every fresh point.
+func revise(ctx context.Context, s sink.Sink, meta resourceMeta, fresh []sink.Point) ([]sink.Point, int, error) {
+	reader, ok := s.(sink.Reader)
+	if !ok || len(fresh) == 0 {
+		return fresh, 0, nil
+	}
+
+	start, stop := pointsSpan(fresh)
+	stored, storedErr := reader.ReadPoints(ctx, usageMeasurement(meta),
+		map[string]string{"resource": meta.Name, "period": "30m"}, start, stop.Add(time.Nanosecond))
+	if storedErr != nil {
+		return nil, 0, storedErr
+	}
+	for i, p := range stored {
+		var upgradeErr error
+		if stored[i], upgradeErr = schema.Upgrade(p); upgradeErr != nil {
+			return nil, 0, upgradeErr
+		}
+	}
+
+	changed, history := revisedPoints(fresh, stored, clk.Now())
+	return append(changed, history...), len(history), nil
+}
+
+// overwritten returns every fresh point, taking the revised version from
+// revised where there is one, followed by revised's energy_usage_revision
+// points.
+func overwritten(fresh, revised []sink.Point) []sink.Point {
+	byTime := map[int64]sink.Point{}
+	var history []sink.Point
+	for _, p := range revised {
+		if p.Measurement == "energy_usage_revision" {
+			history = append(history, p)
+			continue
+		}
+		byTime[p.Time.UnixNano()] = p
+	}
+
+	points := make([]sink.Point, 0, len(fresh)+len(history))
+	for _, p := range fresh {
+		if r, ok := byTime[p.Time.UnixNano()]; ok {
+			p = r
+		}
+		points = append(points, p)
+	}
+	return append(points, history...)
+}
+
+// pointsSpan returns the earliest and latest times of points, which must not
+// be empty.
+func pointsSpan(points []sink.Point) (time.Time, time.Time) {
+	start, stop := points[0].Time, points[0].Time
+	for _, p := range points {
+		if p.Time.Before(start) {
+			start = p.Time
+		}
+		if p.Time.After(stop) {
+			stop = p.Time
+		}
+	}
+	return start, stop
+}
+
+// revisedPoints returns the fresh points that are missing from stored, that
+// fill in a field stored lacks or were stored in an older schema version, or
+// whose values differ. Revised points carry
+// a revision field counting how many times the slot has changed. It is a
+// field rather than a tag so that the rewrite replaces the slot instead of
+// adding a second series. Fields fresh lacks are left as stored.
+//
+// For every revised slot it also returns an energy_usage_revision point
+// recording the values being replaced, so corrections remain visible.
+func revisedPoints(fresh, stored []sink.Point, now time.Time) ([]sink.Point, []sink.Point) {
+	// Keyed by instant, as time.Time map keys also compare the location and
+	// stored points come back in UTC while fresh ones are Local
+	byTime := map[int64]sink.Point{}
+	for _, p := range stored {
+		byTime[p.Time.UnixNano()] = p
+	}
+
+	var changed, history []sink.Point
+	for _, p := range fresh {
+		prev, ok := byTime[p.Time.UnixNano()]
+		if !ok {
+			changed = append(changed, p)
+			continue
+		}
+		differs, fills := compareUsage(p.Fields, prev.Fields)
+		if !differs {
+			if fills || schema.VersionOf(prev) < schema.VersionOf(p) {
+				changed = append(changed, p)
+			}
+			continue
+		}
+
+		revision, _ := prev.Fields["revision"].(int64)
+		p.Fields = maps.Clone(p.Fields)
+		p.Fields["revision"] = revision + 1
+		changed = append(changed, p)
+		history = append(history, revisionPoint(prev, p, revision+1, now))
+	}
+	return changed, history
+}
+
+func revisionPoint(prev, next sink.Point, revision int64, now time.Time) sink.Point {
+	tags := map[string]string{"revision": strconv.FormatInt(revision, 10)}
+	for k, v := range next.Tags {
+		tags[k] = v
+	}
+
+	fields := map[string]any{"revisedAt": now.Unix()}
+	for k, suffix := range map[string]string{"kwh": "Kwh", "pence": "Pence"} {
+		nextVal, ok := next.Fields[k].(float64)
+		if !ok {
+			continue
+		}
+		prevVal, _ := prev.Fields[k].(float64)
+		fields["prev"+suffix] = prevVal
+		fields[k] = nextVal
+		fields["delta"+suffix] = nextVal - prevVal
+	}
+
+	return schema.Stamp(sink.Point{
+		Measurement: "energy_usage_revision",
+		Tags:        tags,
+		Fields:      fields,
+		Time:        next.Time,
+	})
+}
+
+// compareUsage reports whether any usage field in fresh differs from stored,
+// and whether fresh has any that stored lacks.
+func compareUsage(fresh, stored map[string]any) (differs, fills bool) {
+	for _, k := range []string{"kwh", "pence"} {
+		freshVal, freshOK := fresh[k].(float64)
+		if !freshOK {
+			continue
+		}
+		storedVal, storedOK := stored[k].(float64)
+		switch {
+		case !storedOK:
+			fills = true
+		case math.Abs(freshVal-storedVal) > 1e-9:
+			differs = true
+		}
+	}
+	return differs, fills
+}
@@ -0,0 +1,26 @@
+package schedule
+
+import (
+	"energy-meter-scraper/clock"
+	"math/rand/v2"
+	"time"
+)
+
+// Jitter randomises a delay by up to ±Fraction of Base, so that many
+// instances started together do not hit the API in lockstep.
+type Jitter struct {
+	Base     time.Duration
+	Fraction float64
+}
+
+func (j Jitter) Duration() time.Duration {
+	if j.Base <= 0 {
+		return 0
+	}
+	factor := 1 + (rand.Float64()*2-1)*j.Fraction
+	return time.Duration(float64(j.Base) * factor)
+}
+
+func (j Jitter) Sleep(c clock.Clock) {
+	c.Sleep(j.Duration())
+}
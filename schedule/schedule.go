@@ -0,0 +1,59 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule decides when scrape cycles run.
+type Schedule interface {
+	// Next returns the first activation time strictly after t.
+	Next(t time.Time) time.Time
+}
+
+// Parse accepts a five-field cron expression ("*/30 * * * *"), one of the
+// macros @hourly, @daily, @weekly, @monthly, or an interval as "@every 15m"
+// or just "15m".
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+
+	if every, ok := strings.CutPrefix(spec, "@every "); ok {
+		return parseInterval(every)
+	}
+	if _, err := time.ParseDuration(spec); err == nil {
+		return parseInterval(spec)
+	}
+
+	return parseCron(spec)
+}
+
+// Interval activates on multiples of a fixed duration, so that a 30m interval
+// fires on the hour and half hour rather than relative to process start.
+type Interval time.Duration
+
+func parseInterval(s string) (Schedule, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid interval %q: %w", s, err)
+	}
+	if d < time.Minute {
+		return nil, fmt.Errorf("interval %s is shorter than a minute", d)
+	}
+	return Interval(d), nil
+}
+
+func (i Interval) Next(t time.Time) time.Time {
+	return t.Truncate(time.Duration(i)).Add(time.Duration(i))
+}
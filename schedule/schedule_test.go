@@ -0,0 +1,109 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-2 * * * *",
+		"a * * * *",
+		"@every 30s",
+		"@every soon",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	london := mustLocation(t, "Europe/London")
+	utc := func(y int, m time.Month, d, h, min int) time.Time {
+		return time.Date(y, m, d, h, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"*/30 * * * *", utc(2024, 1, 1, 10, 0), utc(2024, 1, 1, 10, 30)},
+		{"*/30 * * * *", utc(2024, 1, 1, 10, 29), utc(2024, 1, 1, 10, 30)},
+		{"*/30 * * * *", utc(2024, 1, 1, 23, 45), utc(2024, 1, 2, 0, 0)},
+		{"0 4 * * *", utc(2024, 1, 1, 4, 0), utc(2024, 1, 2, 4, 0)},
+		{"15,45 9-10 * * *", utc(2024, 1, 1, 10, 50), utc(2024, 1, 2, 9, 15)},
+		{"0 0 29 2 *", utc(2024, 3, 1, 0, 0), utc(2028, 2, 29, 0, 0)},
+		// Day of month and day of week both restricted match either
+		{"0 0 13 * 5", utc(2024, 1, 1, 0, 0), utc(2024, 1, 5, 0, 0)},
+		// 7 is Sunday, like 0
+		{"0 0 * * 7", utc(2024, 1, 1, 0, 0), utc(2024, 1, 7, 0, 0)},
+		{"@hourly", utc(2024, 1, 1, 10, 5), utc(2024, 1, 1, 11, 0)},
+		{"@monthly", utc(2024, 1, 15, 0, 0), utc(2024, 2, 1, 0, 0)},
+		{"15m", utc(2024, 1, 1, 10, 7), utc(2024, 1, 1, 10, 15)},
+		{"@every 1h", utc(2024, 1, 1, 10, 0), utc(2024, 1, 1, 11, 0)},
+		{"0 0 30 2 *", utc(2024, 1, 1, 0, 0), time.Time{}},
+
+		// Spring forward in London: 01:00 GMT becomes 02:00 BST
+		{"0 3 * * *", time.Date(2024, 3, 31, 0, 0, 0, 0, london), time.Date(2024, 3, 31, 3, 0, 0, 0, london)},
+		{"*/30 * * * *", time.Date(2024, 3, 31, 0, 45, 0, 0, london), time.Date(2024, 3, 31, 2, 0, 0, 0, london)},
+		// Times that don't exist on the day are skipped to the next day
+		{"30 1 * * *", time.Date(2024, 3, 31, 0, 0, 0, 0, london), time.Date(2024, 4, 1, 1, 30, 0, 0, london)},
+		// Fall back: 02:00 BST becomes 01:00 GMT, and the repeated hour
+		// still fires every half hour
+		{"*/30 * * * *", utc(2024, 10, 27, 0, 45).In(london), utc(2024, 10, 27, 1, 0)},
+		{"0 4 * * *", time.Date(2024, 10, 27, 0, 0, 0, 0, london), time.Date(2024, 10, 27, 4, 0, 0, 0, london)},
+	}
+	for _, tt := range tests {
+		sched, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		got := sched.Next(tt.from)
+		if !got.Equal(tt.want) {
+			t.Errorf("%q.Next(%s) = %s, want %s", tt.spec, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestNextHalfHoursAcrossFallBack(t *testing.T) {
+	london := mustLocation(t, "Europe/London")
+	sched, err := Parse("*/30 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fall-back day is 25 hours long, so has 50 half hours
+	from := time.Date(2024, 10, 27, 0, 0, 0, 0, london)
+	end := time.Date(2024, 10, 28, 0, 0, 0, 0, london)
+	n := 0
+	for next := sched.Next(from.Add(-time.Second)); next.Before(end); next = sched.Next(next) {
+		n++
+		if next.Sub(from) != time.Duration(n-1)*30*time.Minute {
+			t.Fatalf("activation %d at %s is not evenly spaced", n, next)
+		}
+	}
+	if n != 50 {
+		t.Errorf("got %d activations, want 50", n)
+	}
+}
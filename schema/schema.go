@@ -0,0 +1,118 @@
+// Package schema versions the shape of each measurement, so that a change
+// such as renaming a field or changing its unit can be rolled out without
+// rewriting history first. Every point is written with the version of its
+// measurement, and points read back are upgraded to the current version
+// before use. Stored points are rewritten in the current shape as the
+// recheck job next touches them.
+package schema
+
+import (
+	"energy-meter-scraper/sink"
+	"fmt"
+	"maps"
+	"sync"
+)
+
+// Field is the field recording which version of its measurement a point
+// follows. It is a field rather than a tag so that a point rewritten in a
+// newer version replaces the old one instead of starting a second series.
+const Field = "schemaVersion"
+
+// Unversioned is the version of points written before versioning.
+const Unversioned = 1
+
+// Migration converts a point from one version of its measurement to the
+// next. It may modify p's fields, which are its own copy.
+type Migration func(p sink.Point) sink.Point
+
+var (
+	mu       sync.Mutex
+	current  = map[string]int{}
+	upgrades = map[string]map[int]Migration{}
+)
+
+func init() {
+	for _, measurement := range []string{"energy_usage", "energy_tariff", "energy_usage_revision", "energy_demand", "energy_usage_provisional", "energy_export", "energy_household", "heating_session", "appliance_usage", "energy_usage_residual"} {
+		current[measurement] = Unversioned
+	}
+}
+
+// Register adds a migration of measurement from version from to from+1, and
+// makes from+1 the version written. Migrations register from init, in order.
+func Register(measurement string, from int, m Migration) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if v := current[measurement]; v != from {
+		panic(fmt.Sprintf("schema: %s migration from version %d registered at version %d", measurement, from, v))
+	}
+	if upgrades[measurement] == nil {
+		upgrades[measurement] = map[int]Migration{}
+	}
+	upgrades[measurement][from] = m
+	current[measurement] = from + 1
+}
+
+// Current returns the version of measurement written now, and false if it
+// isn't versioned.
+func Current(measurement string) (int, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	v, ok := current[measurement]
+	return v, ok
+}
+
+// Stamp records the current version on p, if its measurement is versioned.
+func Stamp(p sink.Point) sink.Point {
+	if v, ok := Current(p.Measurement); ok {
+		p.Fields[Field] = int64(v)
+	}
+	return p
+}
+
+// VersionOf returns the version p was written with.
+func VersionOf(p sink.Point) int {
+	switch v := p.Fields[Field].(type) {
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return Unversioned
+}
+
+// Upgrade returns p in the current shape of its measurement. Its version
+// field is left as stored, so callers can tell the point needs rewriting.
+// Points from a newer version than this build knows are an error, as their
+// fields can't be trusted to mean what this build expects.
+func Upgrade(p sink.Point) (sink.Point, error) {
+	want, ok := Current(p.Measurement)
+	if !ok {
+		return p, nil
+	}
+	v := VersionOf(p)
+	if v > want {
+		return p, fmt.Errorf("%s point at %v has schema version %d, newer than %d", p.Measurement, p.Time, v, want)
+	}
+	if v == want {
+		return p, nil
+	}
+
+	mu.Lock()
+	steps := upgrades[p.Measurement]
+	mu.Unlock()
+
+	stored := p.Fields[Field]
+	p.Fields = maps.Clone(p.Fields)
+	for ; v < want; v++ {
+		p = steps[v](p)
+	}
+	if stored != nil {
+		p.Fields[Field] = stored
+	} else {
+		delete(p.Fields, Field)
+	}
+	return p, nil
+}
@@ -0,0 +1,65 @@
+package schema
+
+import (
+	"energy-meter-scraper/sink"
+	"testing"
+	"time"
+)
+
+// A second version of a private measurement renames wh to kwh. It registers
+// from init like real migrations, which can't register twice under -count.
+func init() {
+	Register("schema_test", 0, func(p sink.Point) sink.Point { return p })
+	Register("schema_test", 1, func(p sink.Point) sink.Point {
+		if wh, ok := p.Fields["wh"].(float64); ok {
+			p.Fields["kwh"] = wh / 1000
+			delete(p.Fields, "wh")
+		}
+		return p
+	})
+}
+
+func TestUpgrade(t *testing.T) {
+	if v, _ := Current("schema_test"); v != 2 {
+		t.Fatalf("current version %d, want 2", v)
+	}
+
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	old := sink.Point{Measurement: "schema_test", Fields: map[string]any{"wh": 250.0}, Time: at}
+	got, err := Upgrade(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Fields["kwh"] != 0.25 || got.Fields["wh"] != nil {
+		t.Errorf("upgraded to %v", got.Fields)
+	}
+	if VersionOf(got) != Unversioned {
+		t.Errorf("upgrade changed the stored version to %d", VersionOf(got))
+	}
+	if old.Fields["wh"] != 250.0 {
+		t.Error("upgrade modified the stored point")
+	}
+
+	current := Stamp(sink.Point{Measurement: "schema_test", Fields: map[string]any{"kwh": 0.25}, Time: at})
+	if VersionOf(current) != 2 {
+		t.Errorf("stamped version %d, want 2", VersionOf(current))
+	}
+	if got, _ := Upgrade(current); got.Fields["kwh"] != 0.25 {
+		t.Errorf("current point changed to %v", got.Fields)
+	}
+
+	newer := sink.Point{Measurement: "schema_test", Fields: map[string]any{Field: int64(3)}, Time: at}
+	if _, err := Upgrade(newer); err == nil {
+		t.Error("upgraded a point from a newer version")
+	}
+}
+
+func TestUnversionedMeasurements(t *testing.T) {
+	p := Stamp(sink.Point{Measurement: "scraper_health", Fields: map[string]any{}})
+	if _, ok := p.Fields[Field]; ok {
+		t.Error("stamped a measurement without a schema")
+	}
+	if p := Stamp(sink.Point{Measurement: "energy_usage", Fields: map[string]any{}}); VersionOf(p) != Unversioned {
+		t.Errorf("energy_usage stamped %d", VersionOf(p))
+	}
+}
@@ -0,0 +1,134 @@
+// Package scraper reads half-hourly usage from Glow as sink points. It is
+// the scraper's core without the daemon's sinks, server or schedules, for
+// embedding Glow scraping in another program; with glowapi and the stdout
+// sink, sink/ndjson, it links nothing else of the daemon:
+//
+//	api, authErr := glowapi.Authenticate(http.DefaultClient, username, password)
+//	...
+//	points, mismatched, readErr := scraper.Read(api, resource, from, to, scraper.Options{})
+package scraper
+
+import (
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/schema"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/slot"
+	"energy-meter-scraper/tariff"
+	"slices"
+	"time"
+)
+
+// MaxSpan is the longest range fetched in one readings request.
+const MaxSpan = 7 * 24 * time.Hour
+
+// Source is where readings come from. *glowapi.API is one; wrap it to
+// convert readings in another unit to kWh.
+type Source interface {
+	GetResourceReadings(query glowapi.ResourceReadingsQuery) (*glowapi.ResourceReadings, error)
+}
+
+// Options are how slots are written.
+type Options struct {
+	// Measurement is energy_usage if empty.
+	Measurement string
+	// Stamps timestamps each slot. The zero policy keeps the time Glow
+	// reports, the slot's start.
+	Stamps slot.Policy
+	// Tariff, if set, adds each slot's band and its kWh priced at the
+	// band's rate as tariffPence, with bands beginning in Location.
+	Tariff   *tariff.Tariff
+	Location *time.Location
+}
+
+// Read fetches the resource's half-hour slots from from to to, splitting the
+// range into requests Glow will accept. As Join, it also returns the starts
+// of slots with only one of kwh and pence.
+func Read(src Source, meta config.Resource, from, to time.Time, opts Options) ([]sink.Point, []time.Time, error) {
+	var points []sink.Point
+	var mismatched []time.Time
+	for chunkFrom := from; chunkFrom.Before(to); {
+		chunkTo := chunkFrom.Add(MaxSpan)
+		if chunkTo.After(to) {
+			chunkTo = to
+		}
+
+		kwhReadings, kwhErr := readRange(src, meta.KWHResource, chunkFrom, chunkTo)
+		if kwhErr != nil {
+			return nil, nil, kwhErr
+		}
+		penceReadings, penceErr := readRange(src, meta.PenceResource, chunkFrom, chunkTo)
+		if penceErr != nil {
+			return nil, nil, penceErr
+		}
+
+		chunk, chunkMismatched := Join(meta, kwhReadings, penceReadings, opts)
+		points = append(points, chunk...)
+		mismatched = append(mismatched, chunkMismatched...)
+
+		chunkFrom = chunkTo
+	}
+	return points, mismatched, nil
+}
+
+func readRange(src Source, id string, from, to time.Time) (*glowapi.ResourceReadings, error) {
+	return src.GetResourceReadings(glowapi.ResourceReadingsQuery{
+		ID:       id,
+		Period:   "PT30M",
+		Function: "sum",
+		From:     from,
+		To:       to,
+	})
+}
+
+// Join joins kwh and pence readings by timestamp. The DCC sometimes
+// delivers one without the other, so a slot missing either has the field it
+// has, and its start is returned in mismatched.
+func Join(meta config.Resource, kwhReadings, penceReadings *glowapi.ResourceReadings, opts Options) (points []sink.Point, mismatched []time.Time) {
+	measurement := opts.Measurement
+	if measurement == "" {
+		measurement = "energy_usage"
+	}
+	loc := opts.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	fields := map[float64]map[string]any{}
+	var order []float64
+	add := func(readings *glowapi.ResourceReadings, field string) {
+		for _, reading := range readings.Data {
+			ts := reading[0]
+			if _, ok := fields[ts]; !ok {
+				fields[ts] = map[string]any{}
+				order = append(order, ts)
+			}
+			fields[ts][field] = reading[1]
+		}
+	}
+	add(kwhReadings, "kwh")
+	add(penceReadings, "pence")
+	slices.Sort(order)
+
+	for _, ts := range order {
+		reported := time.Unix(int64(ts), 0)
+		if len(fields[ts]) < 2 {
+			mismatched = append(mismatched, reported)
+		}
+		if opts.Tariff != nil {
+			// Glow reports the start of the slot
+			band, rate := opts.Tariff.Band(reported.In(loc))
+			fields[ts]["band"] = band
+			if kwh, ok := fields[ts]["kwh"].(float64); ok {
+				fields[ts]["tariffPence"] = kwh * rate
+			}
+		}
+		points = append(points, schema.Stamp(sink.Point{
+			Measurement: measurement,
+			Tags:        map[string]string{"resource": meta.Name, "period": "30m"},
+			Fields:      fields[ts],
+			Time:        opts.Stamps.Stamp(reported, 30*time.Minute),
+		}))
+	}
+	return points, mismatched
+}
@@ -0,0 +1,55 @@
+package scraper
+
+import (
+	"energy-meter-scraper/clock"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/glowapi/glowtest"
+	"energy-meter-scraper/slot"
+	"energy-meter-scraper/tariff"
+	"testing"
+	"time"
+)
+
+func TestRead(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 5, 0, 0, time.UTC)
+	fakeGlow := glowtest.New(clock.Accelerated(now, 1), now.AddDate(0, 0, -10))
+	defer fakeGlow.Close()
+	api, authErr := glowapi.Authenticate(fakeGlow.Client(), "user", "pass")
+	if authErr != nil {
+		t.Fatal(authErr)
+	}
+	offpeak, tariffErr := tariff.New(config.TariffConfig{Seasons: []config.TariffSeason{{Bands: []config.TariffBand{
+		{Name: "offpeak", Window: "00:00-07:00", Rate: 8},
+		{Name: "day", Rate: 24},
+	}}}})
+	if tariffErr != nil {
+		t.Fatal(tariffErr)
+	}
+
+	// Nine days take two requests of each resource
+	meta := config.Resource{Name: "electricity", KWHResource: "kwh", PenceResource: "pence"}
+	from := now.Truncate(24*time.Hour).AddDate(0, 0, -9)
+	points, mismatched, readErr := Read(api, meta, from, fakeGlow.Last(), Options{
+		Stamps:   slot.Policy{Precision: time.Second, Align: slot.AlignEnd},
+		Tariff:   offpeak,
+		Location: time.UTC,
+	})
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	if len(points) < 9*48 || len(mismatched) != 0 {
+		t.Fatalf("read %d slots with %d mismatched, want at least nine days' and none", len(points), len(mismatched))
+	}
+	if fakeGlow.Requests() < 4 {
+		t.Errorf("%d requests, want the range split", fakeGlow.Requests())
+	}
+
+	first := points[0]
+	if first.Measurement != "energy_usage" || first.Tags["resource"] != "electricity" || !first.Time.Equal(from.Add(30*time.Minute)) {
+		t.Errorf("first point %+v", first)
+	}
+	if first.Fields["band"] != "offpeak" || first.Fields["tariffPence"] != 0.25*8 {
+		t.Errorf("first point fields %v, want priced off-peak", first.Fields)
+	}
+}
@@ -0,0 +1,273 @@
+//go:build !minimal && !no_server
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"energy-meter-scraper/changefeed"
+	"energy-meter-scraper/share"
+	"energy-meter-scraper/sink"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+func init() {
+	serveWeb = serve
+}
+
+// access is what a request is allowed to do.
+type access int
+
+const (
+	accessNone access = iota
+	accessRead
+	accessFull
+)
+
+// serve runs the dashboard and API. The listen address only takes effect on
+// restart; everything else is read from the live settings per request.
+func serve(addr string) {
+	mux := http.NewServeMux()
+	for _, route := range apiRoutes() {
+		mux.Handle(route.pattern(), requireAccess(route.access, route.handler))
+	}
+
+	slog.Info("serving dashboard", "addr", addr)
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	if err := srv.ListenAndServe(); err != nil {
+		slog.Error("server stopped", "error", err)
+	}
+}
+
+// apiRoute is an endpoint of the server, described in the OpenAPI document.
+type apiRoute struct {
+	method, path string
+	summary      string
+	access       access
+	handler      http.Handler
+	params       []apiParam
+	// response is a value of the type the handler encodes as JSON, or nil
+	// if it responds with contentType.
+	response    any
+	contentType string
+}
+
+// apiParam is a query parameter. kind is its OpenAPI type, or date-time
+// for an RFC 3339 time.
+type apiParam struct {
+	name, kind, description string
+}
+
+func (r apiRoute) pattern() string {
+	if r.path == "/" {
+		return r.method + " /{$}"
+	}
+	return r.method + " " + r.path
+}
+
+func apiRoutes() []apiRoute {
+	return []apiRoute{
+		{method: "GET", path: "/", summary: "The dashboard.", access: accessRead,
+			handler: http.HandlerFunc(handleDashboard), contentType: "text/html"},
+		{method: "GET", path: "/api/usage", summary: "Half-hourly usage of each resource.", access: accessRead,
+			handler: http.HandlerFunc(handleUsage), response: usageResponse{},
+			params: []apiParam{{"hours", "integer", "How many hours back to return, up to " + strconv.Itoa(maxUsageHours) + ". Default 24."}}},
+		{method: "GET", path: "/api/status", summary: "Whether the pipeline is healthy.", access: accessRead,
+			handler: http.HandlerFunc(handleStatus), response: statusResponse{}},
+		{method: "GET", path: "/api/changefeed", summary: "The latest changefeed entries, recording which points were written to which sink.", access: accessFull,
+			handler: http.HandlerFunc(handleChangefeed), response: []changefeed.Entry{},
+			params: []apiParam{
+				{"sink", "string", "Only entries for this sink."},
+				{"resource", "string", "Only entries for this resource."},
+				{"measurement", "string", "Only entries for this measurement."},
+				{"slot", "date-time", "Only entries including a point at this time."},
+				{"since", "date-time", "Only entries written at or after this time."},
+				{"limit", "integer", "The most entries to return, up to " + strconv.Itoa(maxChangefeedEntries) + ". Default 100."},
+			}},
+		{method: "POST", path: "/api/pause", summary: "Pause scheduled scraping.", access: accessFull,
+			handler: handlePause(true), contentType: "text/plain"},
+		{method: "POST", path: "/api/resume", summary: "Resume scheduled scraping.", access: accessFull,
+			handler: handlePause(false), contentType: "text/plain"},
+		{method: "GET", path: "/api/openapi.json", summary: "This document.", access: accessNone,
+			handler: http.HandlerFunc(handleOpenAPI), contentType: "application/json"},
+	}
+}
+
+// requestAccess grants full access to the configured bearer token, and read
+// access to valid share links. Without a token, which config only allows
+// when listening on loopback, every local caller has full access.
+func requestAccess(st *settings, r *http.Request) (access, error) {
+	cfg := st.cfg.Server
+	if cfg.Token == "" {
+		return accessFull, nil
+	}
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if subtle.ConstantTimeCompare([]byte(bearer), []byte(cfg.Token)) == 1 {
+			return accessFull, nil
+		}
+		return accessNone, errors.New("invalid token")
+	}
+	if r.URL.Query().Has("sig") {
+		if err := share.Verify(cfg.ShareSecret, r.URL.Query(), clk.Now()); err != nil {
+			return accessNone, err
+		}
+		return accessRead, nil
+	}
+	return accessNone, errors.New("missing token")
+}
+
+func requireAccess(need access, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, err := requestAccess(live(), r)
+		if got < need {
+			msg := "forbidden"
+			if err != nil {
+				msg = err.Error()
+			}
+			http.Error(w, msg, http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func handleDashboard(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(dashboardHTML)
+}
+
+type usageResponse struct {
+	Resources []resourceUsage `json:"resources"`
+}
+
+type resourceUsage struct {
+	Name  string      `json:"name"`
+	Slots []usageSlot `json:"slots"`
+}
+
+type usageSlot struct {
+	Time  time.Time `json:"time"`
+	KWh   float64   `json:"kwh"`
+	Pence float64   `json:"pence"`
+}
+
+// maxUsageHours limits how much the usage API returns in one request.
+const maxUsageHours = 31 * 24
+
+// handleUsage returns half-hourly usage for the last ?hours (default 24).
+func handleUsage(w http.ResponseWriter, r *http.Request) {
+	withLive(func(st *settings) { serveUsage(w, r, st) })
+}
+
+func serveUsage(w http.ResponseWriter, r *http.Request, st *settings) {
+	hours := 24
+	if v := r.URL.Query().Get("hours"); v != "" {
+		var parseErr error
+		if hours, parseErr = strconv.Atoi(v); parseErr != nil || hours <= 0 || hours > maxUsageHours {
+			http.Error(w, "hours must be between 1 and "+strconv.Itoa(maxUsageHours), http.StatusBadRequest)
+			return
+		}
+	}
+	to := clk.Now()
+	from := to.Add(-time.Duration(hours) * time.Hour)
+
+	var resp usageResponse
+	for _, meta := range st.resources {
+		points, readErr := storedUsage(r.Context(), st, meta, from, to)
+		if readErr != nil {
+			slog.Error("server: failed to read usage", "resource", meta.Name, "error", readErr)
+			http.Error(w, "failed to read usage", http.StatusBadGateway)
+			return
+		}
+
+		ru := resourceUsage{Name: meta.Name, Slots: []usageSlot{}}
+		for _, p := range points {
+			kwh, _ := p.Fields["kwh"].(float64)
+			pence, _ := p.Fields["pence"].(float64)
+			ru.Slots = append(ru.Slots, usageSlot{Time: p.Time, KWh: kwh, Pence: pence})
+		}
+		resp.Resources = append(resp.Resources, ru)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// maxChangefeedEntries limits how many entries the changefeed API returns.
+const maxChangefeedEntries = 1000
+
+// handleChangefeed returns the latest ?limit (default 100) changefeed
+// entries matching ?sink, ?resource, ?measurement, ?slot and ?since, the
+// last two as RFC 3339 times. For example ?sink=influx&slot=... answers
+// whether that slot was ever written to influx.
+func handleChangefeed(w http.ResponseWriter, r *http.Request) {
+	st := live()
+	if st.changefeed == nil {
+		http.Error(w, "the changefeed is off; set CHANGEFEED_FILE", http.StatusNotFound)
+		return
+	}
+
+	params := r.URL.Query()
+	q := changefeed.Query{
+		Sink:        params.Get("sink"),
+		Resource:    params.Get("resource"),
+		Measurement: params.Get("measurement"),
+		Limit:       100,
+	}
+	for name, t := range map[string]*time.Time{"slot": &q.Slot, "since": &q.Since} {
+		if v := params.Get(name); v != "" {
+			var parseErr error
+			if *t, parseErr = time.Parse(time.RFC3339, v); parseErr != nil {
+				http.Error(w, name+" must be an RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		var parseErr error
+		if q.Limit, parseErr = strconv.Atoi(v); parseErr != nil || q.Limit <= 0 || q.Limit > maxChangefeedEntries {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxChangefeedEntries), http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, queryErr := st.changefeed.Query(q)
+	if queryErr != nil {
+		slog.Error("server: failed to read changefeed", "error", queryErr)
+		http.Error(w, "failed to read changefeed", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []changefeed.Entry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+// storedUsage reads energy_usage points for [from, to) from the first sink
+// that can return them, or from Glow if none can.
+func storedUsage(ctx context.Context, st *settings, meta resourceMeta, from, to time.Time) ([]sink.Point, error) {
+	for _, s := range st.sinks {
+		if reader, ok := s.(sink.Reader); ok {
+			points, err := reader.ReadPoints(ctx, "energy_usage",
+				map[string]string{"resource": meta.Name, "period": "30m"}, from, to)
+			if err != nil {
+				return nil, err
+			}
+			slices.SortFunc(points, func(a, b sink.Point) int { return a.Time.Compare(b.Time) })
+			return points, nil
+		}
+	}
+	return readUsage(st, meta, from, to)
+}
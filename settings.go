@@ -0,0 +1,386 @@
+package main
+
+import (
+	"energy-meter-scraper/alert"
+	"energy-meter-scraper/archive"
+	"energy-meter-scraper/changefeed"
+	"energy-meter-scraper/checkpoint"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/occupancy"
+	"energy-meter-scraper/redact"
+	"energy-meter-scraper/schedule"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/slot"
+	"energy-meter-scraper/split"
+	"energy-meter-scraper/tariff"
+	"energy-meter-scraper/transport"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// settings is everything derived from config. It is replaced as a whole when
+// the config is reloaded, so readers should load it once per unit of work.
+type settings struct {
+	cfg       *config.Config
+	resources []resourceMeta
+	groups    []group
+	sinks     []sink.Sink
+	sinkRefs  *sinkSet
+	stamps    slot.Policy
+	loc       *time.Location
+
+	scrape       schedule.Schedule
+	crossCheck   schedule.Schedule
+	recheck      schedule.Schedule
+	alerts       schedule.Schedule
+	digest       schedule.Schedule
+	splitReport  schedule.Schedule
+	archive      schedule.Schedule
+	archiveStore archive.Store
+	split        *split.Plan
+	tariffs      map[string]*tariff.Tariff
+	usageAlerts  map[string][]usageAlert
+	startupDelay schedule.Jitter
+	catchupDelay schedule.Jitter
+	occupancy    *occupancy.Source
+	checkpoints  *checkpoint.Store
+	changefeed   *changefeed.Log
+}
+
+// location is where days, months, daily schedules and tariff bands begin.
+func (st *settings) location() *time.Location {
+	if st.loc == nil {
+		return time.Local
+	}
+	return st.loc
+}
+
+// startOfDay returns midnight at the start of t's day in loc, which is 23 or
+// 25 hours before the next one when the clocks change.
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+var current atomic.Pointer[settings]
+
+func live() *settings {
+	return current.Load()
+}
+
+// sinkSet counts the units of work using a set of sinks, so that a reload
+// closes replaced sinks only once nothing is still writing to them.
+type sinkSet struct {
+	sinks   []sink.Sink
+	mu      sync.Mutex
+	refs    int
+	retired bool
+}
+
+func (ss *sinkSet) acquire() bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.retired {
+		return false
+	}
+	ss.refs++
+	return true
+}
+
+func (ss *sinkSet) release() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.refs--
+	ss.closeIfUnused()
+}
+
+// retire closes the sinks once the last unit of work using them releases
+// them.
+func (ss *sinkSet) retire() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.retired = true
+	ss.closeIfUnused()
+}
+
+func (ss *sinkSet) closeIfUnused() {
+	if !ss.retired || ss.refs > 0 {
+		return
+	}
+	for _, s := range ss.sinks {
+		_ = s.Close()
+	}
+	ss.sinks = nil
+}
+
+// withLive runs fn with the live settings, keeping their sinks open until
+// it returns even if the config is reloaded meanwhile.
+func withLive(fn func(st *settings)) {
+	for {
+		st := live()
+		if st.sinkRefs.acquire() {
+			defer st.sinkRefs.release()
+			fn(st)
+			return
+		}
+		// Retired between loading and acquiring, so the replacement has
+		// been published
+	}
+}
+
+// newSettings validates cfg and builds settings from it. Sinks are reused
+// from prev if their config is unchanged.
+func newSettings(cfg *config.Config, prev *settings) (*settings, error) {
+	st := &settings{cfg: cfg, resources: cfg.Resources}
+
+	var locErr error
+	if st.loc, locErr = time.LoadLocation(cfg.Timezone); locErr != nil {
+		return nil, fmt.Errorf("TIMEZONE: %w", locErr)
+	}
+
+	var schedErr error
+	if st.scrape, schedErr = schedule.Parse(cfg.Scrape.Schedule); schedErr != nil {
+		return nil, fmt.Errorf("SCHEDULE: %w", schedErr)
+	}
+	if st.crossCheck, schedErr = parseOptionalSchedule(cfg.CrossCheck.Schedule); schedErr != nil {
+		return nil, fmt.Errorf("CROSSCHECK_SCHEDULE: %w", schedErr)
+	}
+	if st.recheck, schedErr = parseOptionalSchedule(cfg.Recheck.Schedule); schedErr != nil {
+		return nil, fmt.Errorf("RECHECK_SCHEDULE: %w", schedErr)
+	}
+	if st.alerts, schedErr = parseOptionalSchedule(cfg.Alerts.Schedule); schedErr != nil {
+		return nil, fmt.Errorf("ALERTS_SCHEDULE: %w", schedErr)
+	}
+	if st.digest, schedErr = parseOptionalSchedule(cfg.Digest.Schedule); schedErr != nil {
+		return nil, fmt.Errorf("DIGEST_SCHEDULE: %w", schedErr)
+	}
+	if st.splitReport, schedErr = parseOptionalSchedule(cfg.Split.Schedule); schedErr != nil {
+		return nil, fmt.Errorf("SPLIT_SCHEDULE: %w", schedErr)
+	}
+	if st.archive, schedErr = parseOptionalSchedule(cfg.Archive.Schedule); schedErr != nil {
+		return nil, fmt.Errorf("ARCHIVE_SCHEDULE: %w", schedErr)
+	}
+
+	var splitErr error
+	if st.split, splitErr = split.New(cfg.Split.Parties); splitErr != nil {
+		return nil, fmt.Errorf("split: %w", splitErr)
+	}
+
+	st.tariffs = map[string]*tariff.Tariff{}
+	for name, tariffCfg := range cfg.Tariffs {
+		if !slices.ContainsFunc(cfg.Resources, func(r config.Resource) bool { return r.Name == name }) {
+			return nil, fmt.Errorf("tariffs: no resource named %q", name)
+		}
+		t, tariffErr := tariff.New(tariffCfg)
+		if tariffErr != nil {
+			return nil, fmt.Errorf("tariffs: %s: %w", name, tariffErr)
+		}
+		if t != nil {
+			st.tariffs[name] = t
+		}
+	}
+
+	var groupsErr error
+	if st.groups, groupsErr = parseGroups(cfg.Resources, cfg.Groups); groupsErr != nil {
+		return nil, fmt.Errorf("groups: %w", groupsErr)
+	}
+
+	slotAlign, slotAlignErr := slot.ParseAlignment(cfg.Scrape.SlotAlign)
+	if slotAlignErr != nil {
+		return nil, fmt.Errorf("SLOT_ALIGN: %w", slotAlignErr)
+	}
+	st.stamps = slot.Policy{Precision: cfg.Scrape.TimestampPrecision, Align: slotAlign}
+
+	var usageAlertsErr error
+	if st.usageAlerts, usageAlertsErr = parseUsageAlerts(cfg.Resources, cfg.Alerts); usageAlertsErr != nil {
+		return nil, usageAlertsErr
+	}
+
+	st.startupDelay = schedule.Jitter{Base: cfg.Scrape.StartupDelay, Fraction: cfg.Scrape.Jitter}
+	st.catchupDelay = schedule.Jitter{Base: cfg.Scrape.CatchupDelay, Fraction: cfg.Scrape.Jitter}
+
+	occupancyHTTP, occupancyHTTPErr := transport.NewClient(config.HTTPConfig{}, cfg.Network)
+	if occupancyHTTPErr != nil {
+		return nil, occupancyHTTPErr
+	}
+	st.occupancy = occupancy.New(cfg.Occupancy, occupancyHTTP)
+
+	// Dry runs write nowhere, so must not move the checkpoints on
+	if prev != nil && prev.cfg.Scrape.CheckpointFile == cfg.Scrape.CheckpointFile {
+		st.checkpoints = prev.checkpoints
+	} else if cfg.Scrape.CheckpointFile != "" && !*dryRun {
+		var checkpointsErr error
+		if st.checkpoints, checkpointsErr = checkpoint.Open(cfg.Scrape.CheckpointFile); checkpointsErr != nil {
+			return nil, checkpointsErr
+		}
+	}
+
+	if prev != nil && reflect.DeepEqual(prev.cfg.Archive, cfg.Archive) && reflect.DeepEqual(prev.cfg.Network, cfg.Network) {
+		st.archiveStore = prev.archiveStore
+	} else if !*dryRun {
+		var archiveErr error
+		if st.archiveStore, archiveErr = archive.Open(cfg); archiveErr != nil {
+			return nil, archiveErr
+		}
+	}
+
+	if prev != nil && prev.cfg.Scrape.ChangefeedFile == cfg.Scrape.ChangefeedFile {
+		st.changefeed = prev.changefeed
+	} else if cfg.Scrape.ChangefeedFile != "" && !*dryRun {
+		var changefeedErr error
+		if st.changefeed, changefeedErr = changefeed.Open(cfg.Scrape.ChangefeedFile); changefeedErr != nil {
+			return nil, changefeedErr
+		}
+	}
+
+	if *dryRun {
+		st.sinks = []sink.Sink{sink.NewLineProtocolWriter(os.Stdout)}
+	} else if prev != nil && !sink.Changed(prev.cfg, cfg) {
+		st.sinks = prev.sinks
+		st.sinkRefs = prev.sinkRefs
+	} else {
+		sinks, sinksErr := sink.OpenAll(cfg)
+		if sinksErr != nil {
+			return nil, sinksErr
+		}
+		if len(sinks) == 0 {
+			return nil, fmt.Errorf("no sinks configured (available in this build: %v)", sink.Available())
+		}
+		for _, s := range sinks {
+			slog.Info("opened sink", "sink", s.Name())
+		}
+		st.sinks = sinks
+	}
+	if st.sinkRefs == nil {
+		st.sinkRefs = &sinkSet{sinks: st.sinks}
+	}
+
+	return st, nil
+}
+
+// closeReplaced closes what prev opened that st opened anew rather than
+// reusing. A cycle still running with prev fails to record its checkpoints
+// and changefeed entries in the old files.
+func closeReplaced(prev, st *settings) {
+	if prev.checkpoints != st.checkpoints {
+		if err := prev.checkpoints.Close(); err != nil {
+			slog.Warn("failed to close replaced checkpoints", "error", err)
+		}
+	}
+	if prev.changefeed != st.changefeed {
+		if err := prev.changefeed.Close(); err != nil {
+			slog.Warn("failed to close replaced changefeed", "error", err)
+		}
+	}
+	if prev.archiveStore != nil && prev.archiveStore != st.archiveStore {
+		if err := prev.archiveStore.Close(); err != nil {
+			slog.Warn("failed to close replaced archive store", "error", err)
+		}
+	}
+}
+
+func parseOptionalSchedule(spec string) (schedule.Schedule, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	return schedule.Parse(spec)
+}
+
+// logLevel is the level of the default logger set up by setupLogging.
+var logLevel = new(slog.LevelVar)
+
+// setupLogging routes all logging, including the log package's, through a
+// handler that keeps credentials out of the output.
+func setupLogging() {
+	slog.SetDefault(slog.New(redact.NewHandler(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))))
+}
+
+func applyLogLevel(level string) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		slog.Warn("invalid log level", "level", level)
+		return
+	}
+	logLevel.Set(l)
+}
+
+var (
+	reloadMu sync.Mutex
+	reloadCh = make(chan struct{})
+)
+
+// reloaded returns a channel that is closed when the settings next change.
+func reloaded() <-chan struct{} {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	return reloadCh
+}
+
+func publish(st *settings) {
+	current.Store(st)
+
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	close(reloadCh)
+	reloadCh = make(chan struct{})
+}
+
+// watchReloads re-reads the config on SIGHUP. Glow credentials and
+// connection settings only take effect on restart, as changing them would
+// mean re-authenticating.
+func watchReloads() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		slog.Info("reloading config")
+		reload()
+	}
+}
+
+func reload() {
+	prev := live()
+
+	cfg, cfgErr := config.Load()
+	if cfgErr != nil {
+		slog.Error("failed to reload config, keeping the current config", "error", cfgErr)
+		return
+	}
+	if !reflect.DeepEqual(cfg.Glow, prev.cfg.Glow) {
+		slog.Warn("glow settings changed; they will take effect on restart")
+	}
+	if cfg.Server.Listen != prev.cfg.Server.Listen {
+		slog.Warn("server listen address changed; it will take effect on restart")
+	}
+	if !reflect.DeepEqual(cfg.Plugs, prev.cfg.Plugs) {
+		slog.Warn("smart plug settings changed; they will take effect on restart")
+	}
+
+	st, stErr := newSettings(cfg, prev)
+	if stErr != nil {
+		slog.Error("failed to reload config, keeping the current config", "error", stErr)
+		return
+	}
+
+	if err := alert.Setup(cfg); err != nil {
+		slog.Error("failed to reload notifiers", "error", err)
+	}
+	redact.SetSecrets(cfg.Secrets()...)
+	applyLogLevel(cfg.LogLevel)
+	publish(st)
+	resumeAfterHalt(cfg)
+
+	if prev.sinkRefs != st.sinkRefs {
+		prev.sinkRefs.retire()
+	}
+	closeReplaced(prev, st)
+	slog.Info("reloaded config")
+}
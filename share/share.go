@@ -0,0 +1,53 @@
+// Package share signs expiring read-only links, so the dashboard can be
+// shared without handing out the API token.
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrExpired  = errors.New("share link has expired")
+	ErrInvalid  = errors.New("share link is invalid")
+	errNoSecret = errors.New("no share secret configured")
+)
+
+// Sign returns the query parameters granting read access until expires.
+func Sign(secret string, expires time.Time) (url.Values, error) {
+	if secret == "" {
+		return nil, errNoSecret
+	}
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return url.Values{"exp": {exp}, "sig": {signature(secret, exp)}}, nil
+}
+
+// Verify checks query parameters produced by Sign.
+func Verify(secret string, query url.Values, now time.Time) error {
+	if secret == "" {
+		return errNoSecret
+	}
+	exp, sig := query.Get("exp"), query.Get("sig")
+	if exp == "" || sig == "" || !hmac.Equal([]byte(sig), []byte(signature(secret, exp))) {
+		return ErrInvalid
+	}
+	expUnix, parseErr := strconv.ParseInt(exp, 10, 64)
+	if parseErr != nil {
+		return ErrInvalid
+	}
+	if now.After(time.Unix(expUnix, 0)) {
+		return ErrExpired
+	}
+	return nil
+}
+
+func signature(secret, exp string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("read:" + exp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/checkpoint"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/glowapi"
+	"energy-meter-scraper/glowapi/glowtest"
+	"energy-meter-scraper/schedule"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/slot"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// memorySink stores points the way influx does, with a point replacing any
+// other in the same series at the same time.
+type memorySink struct {
+	mu     sync.Mutex
+	points map[string]sink.Point
+	writes int
+}
+
+func newMemorySink() *memorySink {
+	return &memorySink{points: map[string]sink.Point{}}
+}
+
+func seriesKey(measurement string, tags map[string]string) string {
+	key := measurement
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		key += "," + k + "=" + tags[k]
+	}
+	return key
+}
+
+func (m *memorySink) Name() string { return "memory" }
+
+func (m *memorySink) Write(_ context.Context, points []sink.Point) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.writes++
+	for _, p := range points {
+		m.points[seriesKey(p.Measurement, p.Tags)+" "+p.Time.UTC().String()] = p
+	}
+	return nil
+}
+
+func (m *memorySink) ReadPoints(_ context.Context, measurement string, tags map[string]string, start, stop time.Time) ([]sink.Point, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []sink.Point
+	for _, p := range m.points {
+		if p.Measurement != measurement || p.Time.Before(start) || !p.Time.Before(stop) {
+			continue
+		}
+		if seriesKey(measurement, p.Tags) == seriesKey(measurement, tags) {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (m *memorySink) LastTime(ctx context.Context, measurement string, tags map[string]string, start, stop time.Time) (time.Time, bool, error) {
+	points, _ := m.ReadPoints(ctx, measurement, tags, start, stop)
+	var last time.Time
+	for _, p := range points {
+		if p.Time.After(last) {
+			last = p.Time
+		}
+	}
+	return last, len(points) > 0, nil
+}
+
+func (m *memorySink) Close() error { return nil }
+
+// series returns the times of the series' points in order.
+func (m *memorySink) series(measurement string, tags map[string]string) []time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var times []time.Time
+	for _, p := range m.points {
+		if p.Measurement == measurement && seriesKey(measurement, p.Tags) == seriesKey(measurement, tags) {
+			times = append(times, p.Time)
+		}
+	}
+	slices.SortFunc(times, time.Time.Compare)
+	return times
+}
+
+// TestSimulateWeeks runs three weeks of half-hourly cycles, across the
+// spring DST change, against a fake Glow whose sessions expire twice a day.
+func TestSimulateWeeks(t *testing.T) {
+	if testing.Short() {
+		t.Skip("simulation")
+	}
+
+	london, locErr := time.LoadLocation("Europe/London")
+	if locErr != nil {
+		t.Fatal(locErr)
+	}
+	start := time.Date(2024, 3, 20, 0, 10, 0, 0, london)
+	end := start.Add(21 * 24 * time.Hour)
+	fake := fakeClock(t, start)
+
+	prevLevel := slog.SetLogLoggerLevel(slog.LevelWarn)
+	defer slog.SetLogLoggerLevel(prevLevel)
+
+	fakeGlow := glowtest.New(clk, start.AddDate(0, 0, -2).Truncate(30*time.Minute))
+	fakeGlow.Delay = 20 * time.Minute
+	fakeGlow.SessionLength = 12 * time.Hour
+	defer fakeGlow.Close()
+
+	prevGlow := glow
+	defer func() { glow = prevGlow }()
+	var authErr error
+	if glow, authErr = glowapi.Authenticate(fakeGlow.Client(), "user", "pass"); authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	checkpointPath := filepath.Join(t.TempDir(), "checkpoints.json")
+	checkpoints, checkpointsErr := checkpoint.Open(checkpointPath)
+	if checkpointsErr != nil {
+		t.Fatal(checkpointsErr)
+	}
+
+	cfg := &config.Config{Resources: []config.Resource{{Name: "electricity", KWHResource: "e-kwh", PenceResource: "e-pence"}}}
+	cfg.Scrape.Lookback = 8 * 24 * time.Hour
+	mem := newMemorySink()
+	st := &settings{
+		cfg:         cfg,
+		resources:   cfg.Resources,
+		sinks:       []sink.Sink{mem},
+		stamps:      slot.Policy{Precision: time.Second, Align: slot.AlignStart},
+		scrape:      mustParse(t, "*/30 * * * *"),
+		checkpoints: checkpoints,
+	}
+	st.sinkRefs = &sinkSet{sinks: st.sinks}
+	publish(st)
+
+	failuresBefore := cycleFailuresTotal.Value()
+	var activations []time.Time
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runScheduled(ctx, func(st *settings) schedule.Schedule { return st.scrape }, func(st *settings) {
+			activations = append(activations, clk.Now())
+			runCycle(st)
+		})
+	}()
+
+	for fake.Now().Before(end) {
+		fake.BlockUntil(1)
+		fake.Advance(time.Minute)
+	}
+	fake.BlockUntil(1)
+	cancel()
+	<-done
+
+	if failed := cycleFailuresTotal.Value() - failuresBefore; failed != 0 {
+		t.Errorf("%v cycles failed", failed)
+	}
+
+	// Every half hour, on the local hour and half hour, including across
+	// the change to BST
+	if want := int(end.Sub(start) / (30 * time.Minute)); len(activations) != want {
+		t.Errorf("%d cycles ran, want %d", len(activations), want)
+	}
+	for i, a := range activations {
+		if local := a.In(london); local.Minute()%30 != 0 || local.Second() != 0 {
+			t.Errorf("cycle ran at %v", local)
+		}
+		if i > 0 && a.Sub(activations[i-1]) != 30*time.Minute {
+			t.Errorf("cycles at %v and %v", activations[i-1], a)
+		}
+	}
+
+	// Each slot is stored once, with no gaps, from the start of the lookback
+	// to the latest reading
+	slots := mem.series("energy_usage", map[string]string{"resource": "electricity", "period": "30m"})
+	if len(slots) == 0 {
+		t.Fatal("no usage was stored")
+	}
+	for i := 1; i < len(slots); i++ {
+		if slots[i].Sub(slots[i-1]) != 30*time.Minute {
+			t.Fatalf("slots jump from %v to %v", slots[i-1], slots[i])
+		}
+	}
+	if !slots[0].Equal(fakeGlow.First) {
+		t.Errorf("first slot is %v, want %v", slots[0], fakeGlow.First)
+	}
+	if last := fakeGlow.Last(); !slots[len(slots)-1].Equal(last) {
+		t.Errorf("last slot is %v, want %v", slots[len(slots)-1], last)
+	}
+
+	// Sessions were renewed rather than failing cycles
+	if logins := fakeGlow.Logins(); logins < 42 {
+		t.Errorf("logged in %d times in 21 days of 12 hour sessions", logins)
+	}
+
+	// With a checkpoint each cycle only reads the new slots, so neither the
+	// checkpoint file nor the requests per cycle grow with time
+	info, statErr := os.Stat(checkpointPath)
+	if statErr != nil {
+		t.Fatal(statErr)
+	}
+	if info.Size() > 256 {
+		t.Errorf("checkpoint file grew to %d bytes", info.Size())
+	}
+	if perCycle := fakeGlow.Requests() / len(activations); perCycle > 10 {
+		t.Errorf("%d requests per cycle", perCycle)
+	}
+	if contents, _ := os.ReadFile(checkpointPath); !strings.Contains(string(contents), "electricity") {
+		t.Errorf("checkpoint file has no electricity checkpoint: %s", contents)
+	}
+}
@@ -0,0 +1,434 @@
+package bigquery
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/googleauth"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/transport"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+func init() {
+	sink.Register("bigquery", New)
+}
+
+// apiBase is the BigQuery API, replaced in tests.
+var apiBase = "https://bigquery.googleapis.com"
+
+// maxRows is the most rows streamed in one request, BigQuery's recommended
+// batch size.
+const maxRows = 500
+
+// baseColumns are in every row. series is the point's tags, so that the
+// latest view can tell one series' slots from another's without knowing
+// which tag columns there are.
+var baseColumns = []column{
+	{Name: "measurement", Type: "STRING", Mode: "REQUIRED"},
+	{Name: "series", Type: "STRING", Mode: "REQUIRED"},
+	{Name: "time", Type: "TIMESTAMP", Mode: "REQUIRED"},
+	{Name: "inserted_at", Type: "TIMESTAMP", Mode: "REQUIRED"},
+}
+
+// latestView selects the last version of each point streamed.
+const latestView = "SELECT * EXCEPT (_version) FROM (SELECT *, ROW_NUMBER() OVER " +
+	"(PARTITION BY measurement, series, time ORDER BY inserted_at DESC) AS _version FROM `%s.%s.%s`) WHERE _version = 1"
+
+type column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Mode string `json:"mode,omitempty"`
+}
+
+// Sink streams points into a table with a column for each tag and field,
+// in snake case. Points are streamed again only when their fields change
+// or the scraper restarts, so a slot has a row for each version of it,
+// which the latest view hides.
+type Sink struct {
+	client   *http.Client
+	account  *googleauth.ServiceAccount
+	project  string
+	dataset  string
+	table    string
+	tables   string
+	ids      sink.IDs
+	lookback time.Duration
+
+	mu sync.Mutex
+	// columns are the table's, by name, loaded before the first insert. It
+	// is nil until then.
+	columns map[string]string
+	// written is the hash of each point last streamed, by measurement,
+	// series and time.
+	written map[string]writtenPoint
+}
+
+type writtenPoint struct {
+	at   time.Time
+	hash string
+}
+
+func New(cfg *config.Config) (sink.Sink, error) {
+	bqCfg := cfg.Sinks.BigQuery
+	if bqCfg.Dataset == "" {
+		return nil, nil
+	}
+
+	httpClient, httpErr := transport.NewClient(bqCfg.HTTP, cfg.Network)
+	if httpErr != nil {
+		return nil, fmt.Errorf("http config: %w", httpErr)
+	}
+	account, accountErr := googleauth.Load(httpClient, bqCfg.CredentialsFile, "https://www.googleapis.com/auth/bigquery")
+	if accountErr != nil {
+		return nil, fmt.Errorf("credentials: %w", accountErr)
+	}
+	project := bqCfg.Project
+	if project == "" {
+		project = account.ProjectID()
+	}
+	if project == "" {
+		return nil, errors.New("no project configured or in the service account's key")
+	}
+
+	return &Sink{
+		client:   httpClient,
+		account:  account,
+		project:  project,
+		dataset:  bqCfg.Dataset,
+		table:    bqCfg.Table,
+		tables:   apiBase + "/bigquery/v2/projects/" + url.PathEscape(project) + "/datasets/" + bqCfg.Dataset + "/tables",
+		ids:      sink.NewIDs(cfg, "bigquery"),
+		lookback: cfg.Scrape.Lookback,
+		written:  map[string]writtenPoint{},
+	}, nil
+}
+
+func (s *Sink) Name() string {
+	return "bigquery"
+}
+
+type row struct {
+	key     string
+	hash    string
+	at      time.Time
+	values  map[string]any
+	columns map[string]string
+}
+
+func (s *Sink) Write(ctx context.Context, points []sink.Point) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	insertedAt := time.Now()
+	var rows []row
+	var newest time.Time
+	for _, p := range points {
+		newest = maxTime(newest, p.Time)
+		r := s.row(p)
+		if prev, ok := s.written[r.key]; ok && prev.hash == r.hash {
+			continue
+		}
+		rows = append(rows, r)
+	}
+	defer s.prune(newest)
+	if len(rows) == 0 {
+		return nil
+	}
+
+	if s.columns == nil {
+		columns, loadErr := s.loadTable(ctx)
+		if loadErr != nil {
+			return fmt.Errorf("table %s.%s: %w", s.dataset, s.table, loadErr)
+		}
+		s.columns = columns
+	}
+	added := map[string]string{}
+	for _, r := range rows {
+		for name, kind := range r.columns {
+			if _, ok := s.columns[name]; !ok {
+				added[name] = kind
+			}
+		}
+	}
+	if len(added) > 0 {
+		if err := s.addColumns(ctx, added); err != nil {
+			return fmt.Errorf("add columns: %w", err)
+		}
+	}
+
+	for batch := range slices.Chunk(rows, maxRows) {
+		if err := s.insert(ctx, batch, insertedAt); err != nil {
+			return err
+		}
+		for _, r := range batch {
+			s.written[r.key] = writtenPoint{at: r.at, hash: r.hash}
+		}
+	}
+	return nil
+}
+
+// row is p's columns and values, with the key and hash it is deduplicated
+// by.
+func (s *Sink) row(p sink.Point) row {
+	tags := s.ids.Tags(p.Tags)
+	var series []string
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		series = append(series, k+"="+tags[k])
+	}
+	r := row{
+		key:     p.Measurement + "," + strings.Join(series, ",") + "," + p.Time.UTC().Format(time.RFC3339Nano),
+		at:      p.Time,
+		values:  map[string]any{"measurement": p.Measurement, "series": strings.Join(series, ","), "time": p.Time.UTC().Format(time.RFC3339Nano)},
+		columns: map[string]string{},
+	}
+	for k, v := range tags {
+		name := snakeCase(k)
+		if !isBase(name) {
+			r.values[name], r.columns[name] = v, "STRING"
+		}
+	}
+	for k, v := range p.Fields {
+		name := snakeCase(k)
+		if kind, value, ok := bigQueryValue(v); ok && !isBase(name) {
+			r.values[name], r.columns[name] = value, kind
+		}
+	}
+	b, _ := json.Marshal(r.values)
+	sum := sha256.Sum256(b)
+	r.hash = hex.EncodeToString(sum[:16])
+	return r
+}
+
+// prune forgets points older than the lookback, which won't be written
+// again.
+func (s *Sink) prune(newest time.Time) {
+	cutoff := newest.Add(-s.lookback - 24*time.Hour)
+	maps.DeleteFunc(s.written, func(_ string, w writtenPoint) bool { return w.at.Before(cutoff) })
+}
+
+// loadTable returns the table's columns, creating it and the latest view if
+// it doesn't exist.
+func (s *Sink) loadTable(ctx context.Context) (map[string]string, error) {
+	var table struct {
+		Schema struct {
+			Fields []column `json:"fields"`
+		} `json:"schema"`
+	}
+	status, getErr := s.do(ctx, "GET", s.tables+"/"+s.table, nil, &table)
+	if status == http.StatusNotFound {
+		status, getErr = s.do(ctx, "POST", s.tables, map[string]any{
+			"tableReference":   s.reference(s.table),
+			"schema":           map[string]any{"fields": baseColumns},
+			"timePartitioning": map[string]any{"type": "DAY", "field": "time"},
+			"clustering":       map[string]any{"fields": []string{"measurement", "series"}},
+		}, &table)
+		// Another instance may have created it first
+		if status == http.StatusConflict {
+			_, getErr = s.do(ctx, "GET", s.tables+"/"+s.table, nil, &table)
+		}
+		if getErr == nil {
+			getErr = s.createView(ctx)
+		}
+	}
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	columns := map[string]string{}
+	for _, c := range table.Schema.Fields {
+		columns[c.Name] = c.Type
+	}
+	return columns, nil
+}
+
+func (s *Sink) createView(ctx context.Context) error {
+	status, createErr := s.do(ctx, "POST", s.tables, map[string]any{
+		"tableReference": s.reference(s.table + "_latest"),
+		"view":           map[string]any{"query": fmt.Sprintf(latestView, s.project, s.dataset, s.table), "useLegacySql": false},
+	}, nil)
+	if status == http.StatusConflict {
+		return nil
+	}
+	return createErr
+}
+
+func (s *Sink) reference(table string) map[string]string {
+	return map[string]string{"projectId": s.project, "datasetId": s.dataset, "tableId": table}
+}
+
+// addColumns adds nullable columns to the table's schema.
+func (s *Sink) addColumns(ctx context.Context, added map[string]string) error {
+	columns := maps.Clone(s.columns)
+	maps.Copy(columns, added)
+	var fields []column
+	for _, c := range baseColumns {
+		fields = append(fields, c)
+		delete(columns, c.Name)
+	}
+	for _, name := range slices.Sorted(maps.Keys(columns)) {
+		fields = append(fields, column{Name: name, Type: columns[name], Mode: "NULLABLE"})
+	}
+	if _, err := s.do(ctx, "PATCH", s.tables+"/"+s.table, map[string]any{"schema": map[string]any{"fields": fields}}, nil); err != nil {
+		return err
+	}
+	maps.Copy(s.columns, added)
+	return nil
+}
+
+// insert streams rows, with the hash as the insert ID so that BigQuery
+// drops a retried request's rows. A value not of its column's type, such as
+// a field whose type has changed, is left out.
+func (s *Sink) insert(ctx context.Context, rows []row, insertedAt time.Time) error {
+	type insertRow struct {
+		InsertID string         `json:"insertId"`
+		JSON     map[string]any `json:"json"`
+	}
+	var body struct {
+		Rows []insertRow `json:"rows"`
+	}
+	for _, r := range rows {
+		values := maps.Clone(r.values)
+		values["inserted_at"] = insertedAt.UTC().Format(time.RFC3339Nano)
+		for name, kind := range r.columns {
+			switch {
+			case s.columns[name] == kind:
+			case s.columns[name] == "FLOAT" && kind == "INTEGER":
+				values[name] = toFloat(values[name])
+			default:
+				delete(values, name)
+			}
+		}
+		body.Rows = append(body.Rows, insertRow{InsertID: r.hash, JSON: values})
+	}
+
+	var out struct {
+		InsertErrors []struct {
+			Index  int `json:"index"`
+			Errors []struct {
+				Reason  string `json:"reason"`
+				Message string `json:"message"`
+			} `json:"errors"`
+		} `json:"insertErrors"`
+	}
+	if _, err := s.do(ctx, "POST", s.tables+"/"+s.table+"/insertAll", body, &out); err != nil {
+		return err
+	}
+	if n := len(out.InsertErrors); n > 0 {
+		first := out.InsertErrors[0]
+		var reasons []string
+		for _, e := range first.Errors {
+			reasons = append(reasons, e.Reason+": "+e.Message)
+		}
+		return fmt.Errorf("%d of %d rows not inserted, the first because %s", n, len(rows), strings.Join(reasons, "; "))
+	}
+	return nil
+}
+
+func (s *Sink) do(ctx context.Context, method, target string, body, out any) (int, error) {
+	token, tokenErr := s.account.Token(ctx)
+	if tokenErr != nil {
+		return 0, tokenErr
+	}
+	var reqBody []byte
+	if body != nil {
+		var marshalErr error
+		if reqBody, marshalErr = json.Marshal(body); marshalErr != nil {
+			return 0, marshalErr
+		}
+	}
+	req, newReqErr := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(reqBody))
+	if newReqErr != nil {
+		return 0, newReqErr
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, doErr := s.client.Do(req)
+	if doErr != nil {
+		return 0, doErr
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("http status code %d: %s", resp.StatusCode, respBody)
+	}
+	if out == nil {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.Unmarshal(respBody, out)
+}
+
+func (s *Sink) Close() error {
+	return nil
+}
+
+func isBase(name string) bool {
+	return slices.ContainsFunc(baseColumns, func(c column) bool { return c.Name == name })
+}
+
+// bigQueryValue is v's column type and JSON value, or false if BigQuery
+// can't hold it.
+func bigQueryValue(v any) (string, any, bool) {
+	switch v := v.(type) {
+	case float64:
+		return "FLOAT", v, !math.IsNaN(v) && !math.IsInf(v, 0)
+	case float32:
+		return bigQueryValue(float64(v))
+	case int:
+		return "INTEGER", int64(v), true
+	case int64:
+		return "INTEGER", v, true
+	case uint64:
+		return "INTEGER", int64(v), v <= math.MaxInt64
+	case bool:
+		return "BOOLEAN", v, true
+	case string:
+		return "STRING", v, true
+	default:
+		return "", nil, false
+	}
+}
+
+func toFloat(v any) float64 {
+	i, _ := v.(int64)
+	return float64(i)
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
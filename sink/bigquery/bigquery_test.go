@@ -0,0 +1,144 @@
+package bigquery
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	const tables = "/bigquery/v2/projects/project/datasets/energy/tables"
+	var requests []string
+	var schema []column
+	var inserted []map[string]any
+	views := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			_, _ = io.WriteString(w, `{"access_token":"token","expires_in":3600}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		requests = append(requests, r.Method+" "+strings.TrimPrefix(r.URL.Path, tables))
+		var body struct {
+			TableReference struct {
+				TableID string `json:"tableId"`
+			} `json:"tableReference"`
+			Schema struct {
+				Fields []column `json:"fields"`
+			} `json:"schema"`
+			View struct {
+				Query string `json:"query"`
+			} `json:"view"`
+			Rows []struct {
+				InsertID string         `json:"insertId"`
+				JSON     map[string]any `json:"json"`
+			} `json:"rows"`
+		}
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &body)
+		switch {
+		case r.Method == "GET" && schema == nil:
+			http.Error(w, `{"error":{"code":404}}`, http.StatusNotFound)
+		case r.Method == "POST" && r.URL.Path == tables && body.View.Query != "":
+			views[body.TableReference.TableID] = body.View.Query
+			_, _ = io.WriteString(w, `{}`)
+		case r.Method == "POST" && r.URL.Path == tables, r.Method == "PATCH":
+			schema = body.Schema.Fields
+			_ = json.NewEncoder(w).Encode(map[string]any{"schema": map[string]any{"fields": schema}})
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/insertAll"):
+			for _, row := range body.Rows {
+				if row.InsertID == "" {
+					t.Errorf("row without an insert ID: %v", row.JSON)
+				}
+				inserted = append(inserted, row.JSON)
+			}
+			_, _ = io.WriteString(w, `{}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	apiBase = server.URL
+
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	credentials, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"project_id":   "project",
+		"client_email": "scraper@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    server.URL + "/token",
+	})
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(path, credentials, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{IDs: map[string]map[string]string{"electricity": {"bigquery": "house"}}}
+	cfg.Scrape.Lookback = 24 * time.Hour
+	cfg.Sinks.BigQuery = config.BigQueryConfig{Dataset: "energy", Table: "energy", CredentialsFile: path}
+	s, newErr := New(cfg)
+	if newErr != nil {
+		t.Fatal(newErr)
+	}
+	defer s.Close()
+
+	at := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	usage := sink.Point{Measurement: "energy_usage", Tags: map[string]string{"resource": "electricity", "period": "30m"},
+		Fields: map[string]any{"kwh": 0.25, "peakKw": int64(2)}, Time: at}
+	ctx := context.Background()
+	for range 2 {
+		if err := s.Write(ctx, []sink.Point{usage}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A corrected slot is streamed again, and a new field adds a column
+	corrected := usage
+	corrected.Fields = map[string]any{"kwh": 0.5, "peakKw": 2.5, "band": "peak"}
+	if err := s.Write(ctx, []sink.Point{corrected}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"GET /energy", "POST ", "POST ", "PATCH /energy", "POST /energy/insertAll", "PATCH /energy", "POST /energy/insertAll"}
+	if strings.Join(requests, ",") != strings.Join(want, ",") {
+		t.Errorf("requests %v, want %v", requests, want)
+	}
+	if !strings.Contains(views["energy_latest"], "FROM `project.energy.energy`") {
+		t.Errorf("views %v", views)
+	}
+	var columns []string
+	for _, c := range schema {
+		columns = append(columns, c.Name+" "+c.Type)
+	}
+	if strings.Join(columns, ",") != "measurement STRING,series STRING,time TIMESTAMP,inserted_at TIMESTAMP,band STRING,kwh FLOAT,peak_kw INTEGER,period STRING,resource STRING" {
+		t.Errorf("columns %v", columns)
+	}
+
+	if len(inserted) != 2 {
+		t.Fatalf("inserted %v, want the slot and its correction", inserted)
+	}
+	first := inserted[0]
+	if first["series"] != "period=30m,resource=house" || first["time"] != "2024-06-01T00:00:00Z" || first["kwh"] != 0.25 || first["peak_kw"] != 2.0 {
+		t.Errorf("row %v", first)
+	}
+	// peakKw is now a float, which its integer column can't hold
+	if second := inserted[1]; second["band"] != "peak" || second["kwh"] != 0.5 || second["peak_kw"] != nil {
+		t.Errorf("corrected row %v", second)
+	}
+}
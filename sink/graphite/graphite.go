@@ -0,0 +1,178 @@
+package graphite
+
+import (
+	"bytes"
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/transport"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	sink.Register("graphite", New)
+}
+
+// maxPacket is the most sent in one UDP datagram, so that packets aren't
+// fragmented on a typical network.
+const maxPacket = 1400
+
+// Sink sends each numeric field as a line of Graphite's plaintext protocol,
+// named prefix.measurement.resource[.tag values].field. String fields,
+// such as the tariff band, have no place in Graphite and are left out.
+type Sink struct {
+	dial             func(ctx context.Context, network, addr string) (net.Conn, error)
+	network, address string
+	prefix           string
+	ids              sink.IDs
+
+	mu sync.Mutex
+	// conn is kept open between writes over TCP, and redialled after an
+	// error.
+	conn net.Conn
+}
+
+func New(cfg *config.Config) (sink.Sink, error) {
+	graphiteCfg := cfg.Sinks.Graphite
+	if graphiteCfg.Address == "" {
+		return nil, nil
+	}
+	return &Sink{
+		dial:    transport.Dialer(cfg.Network),
+		network: graphiteCfg.Protocol,
+		address: graphiteCfg.Address,
+		prefix:  graphiteCfg.Prefix,
+		ids:     sink.NewIDs(cfg, "graphite"),
+	}, nil
+}
+
+func (s *Sink) Name() string {
+	return "graphite"
+}
+
+func (s *Sink) Write(ctx context.Context, points []sink.Point) error {
+	var lines [][]byte
+	for _, p := range points {
+		lines = append(lines, s.lines(p)...)
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		conn, dialErr := s.dial(ctx, s.network, s.address)
+		if dialErr != nil {
+			return dialErr
+		}
+		s.conn = conn
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(30 * time.Second)
+	}
+	_ = s.conn.SetWriteDeadline(deadline)
+
+	for _, packet := range s.packets(lines) {
+		if _, err := s.conn.Write(packet); err != nil {
+			_ = s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// packets are what is written at once: everything over TCP, and over UDP
+// as many whole lines as fit in a datagram.
+func (s *Sink) packets(lines [][]byte) [][]byte {
+	if s.network == "tcp" {
+		return [][]byte{bytes.Join(lines, nil)}
+	}
+	var packets [][]byte
+	var packet []byte
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+len(line) > maxPacket {
+			packets = append(packets, packet)
+			packet = nil
+		}
+		packet = append(packet, line...)
+	}
+	return append(packets, packet)
+}
+
+func (s *Sink) lines(p sink.Point) [][]byte {
+	tags := s.ids.Tags(p.Tags)
+	var path []string
+	if s.prefix != "" {
+		path = append(path, s.prefix)
+	}
+	path = append(path, component(p.Measurement))
+	if resource, ok := tags["resource"]; ok {
+		path = append(path, component(resource))
+	}
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		if k != "resource" {
+			path = append(path, component(tags[k]))
+		}
+	}
+
+	var lines [][]byte
+	timestamp := strconv.FormatInt(p.Time.Unix(), 10)
+	for _, field := range slices.Sorted(maps.Keys(p.Fields)) {
+		value, ok := numeric(p.Fields[field])
+		if !ok {
+			continue
+		}
+		lines = append(lines, []byte(strings.Join(append(path, component(field)), ".")+" "+value+" "+timestamp+"\n"))
+	}
+	return lines
+}
+
+func numeric(v any) (string, bool) {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case bool:
+		if v {
+			return "1", true
+		}
+		return "0", true
+	default:
+		return "", false
+	}
+}
+
+var componentEscaper = strings.NewReplacer(".", "_", " ", "_", "\t", "_", "\n", "_", "/", "_", ";", "_")
+
+// component makes s one element of a metric's path.
+func component(s string) string {
+	return componentEscaper.Replace(s)
+}
+
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,74 @@
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteTCP(t *testing.T) {
+	ln, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatal(listenErr)
+	}
+	defer ln.Close()
+	received := make(chan string, 10)
+	go func() {
+		conn, acceptErr := ln.Accept()
+		if acceptErr != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			received <- scanner.Text()
+		}
+		close(received)
+	}()
+
+	cfg := &config.Config{IDs: map[string]map[string]string{"electricity": {"graphite": "house.electricity"}}}
+	cfg.Sinks.Graphite = config.GraphiteConfig{Address: ln.Addr().String(), Protocol: "tcp", Prefix: "energy"}
+	s, newErr := New(cfg)
+	if newErr != nil {
+		t.Fatal(newErr)
+	}
+
+	at := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	if err := s.Write(context.Background(), []sink.Point{
+		{Measurement: "energy_usage", Tags: map[string]string{"resource": "electricity", "period": "30m"},
+			Fields: map[string]any{"kwh": 0.25, "pence": 6.0, "band": "peak"}, Time: at},
+		{Measurement: "heating_session", Tags: map[string]string{"resource": "gas"}, Fields: map[string]any{"ongoing": true}, Time: at},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for line := range received {
+		got = append(got, line)
+	}
+	want := []string{
+		"energy.energy_usage.house_electricity.30m.kwh 0.25 1704103200",
+		"energy.energy_usage.house_electricity.30m.pence 6 1704103200",
+		"energy.heating_session.gas.ongoing 1 1704103200",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("received\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPacketsUDP(t *testing.T) {
+	s := &Sink{network: "udp"}
+	line := []byte(strings.Repeat("x", 599) + "\n")
+	packets := s.packets([][]byte{line, line, line, line, line})
+	if len(packets) != 3 || len(packets[0]) != 1200 || len(packets[2]) != 600 {
+		t.Errorf("got %d packets, want whole lines in packets of at most %d bytes", len(packets), maxPacket)
+	}
+}
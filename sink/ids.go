@@ -0,0 +1,64 @@
+package sink
+
+import (
+	"energy-meter-scraper/config"
+	"maps"
+)
+
+// IDs maps resource names to the identifiers one integration knows them by,
+// from the ids table in config, so that a resource can be renamed without
+// breaking what is already stored or subscribed to downstream. Resources
+// without an entry keep their name.
+type IDs struct {
+	ids       map[string]string
+	resources map[string]string
+}
+
+// NewIDs returns the IDs of cfg's resources in integration, the sink's name.
+func NewIDs(cfg *config.Config, integration string) IDs {
+	ids := IDs{ids: map[string]string{}, resources: map[string]string{}}
+	for resource, byIntegration := range cfg.IDs {
+		if id, ok := byIntegration[integration]; ok {
+			ids.ids[resource] = id
+			ids.resources[id] = resource
+		}
+	}
+	return ids
+}
+
+// ID returns what integration calls resource.
+func (ids IDs) ID(resource string) string {
+	if id, ok := ids.ids[resource]; ok {
+		return id
+	}
+	return resource
+}
+
+// Resource returns the resource integration calls id.
+func (ids IDs) Resource(id string) string {
+	if resource, ok := ids.resources[id]; ok {
+		return resource
+	}
+	return id
+}
+
+// Tags returns tags with the resource tag replaced by its ID. tags is not
+// modified.
+func (ids IDs) Tags(tags map[string]string) map[string]string {
+	return ids.replace(tags, ids.ID)
+}
+
+// ResourceTags undoes Tags, for points read back.
+func (ids IDs) ResourceTags(tags map[string]string) map[string]string {
+	return ids.replace(tags, ids.Resource)
+}
+
+func (ids IDs) replace(tags map[string]string, by func(string) string) map[string]string {
+	resource, ok := tags["resource"]
+	if !ok || len(ids.ids) == 0 {
+		return tags
+	}
+	tags = maps.Clone(tags)
+	tags["resource"] = by(resource)
+	return tags
+}
@@ -0,0 +1,36 @@
+package sink
+
+import (
+	"energy-meter-scraper/config"
+	"maps"
+	"testing"
+)
+
+func TestIDs(t *testing.T) {
+	cfg := &config.Config{IDs: map[string]map[string]string{
+		"electricity": {"influx": "house_electricity", "mqtt": "main"},
+	}}
+	ids := NewIDs(cfg, "influx")
+
+	if id := ids.ID("electricity"); id != "house_electricity" {
+		t.Errorf("electricity is %q in influx", id)
+	}
+	if id := ids.ID("gas"); id != "gas" {
+		t.Errorf("unmapped gas is %q", id)
+	}
+	if r := ids.Resource("house_electricity"); r != "electricity" {
+		t.Errorf("house_electricity is resource %q", r)
+	}
+
+	tags := map[string]string{"resource": "electricity", "period": "30m"}
+	mapped := ids.Tags(tags)
+	if want := map[string]string{"resource": "house_electricity", "period": "30m"}; !maps.Equal(mapped, want) {
+		t.Errorf("mapped tags %v, want %v", mapped, want)
+	}
+	if tags["resource"] != "electricity" {
+		t.Error("Tags modified its argument")
+	}
+	if back := ids.ResourceTags(mapped); !maps.Equal(back, tags) {
+		t.Errorf("tags read back as %v, want %v", back, tags)
+	}
+}
@@ -0,0 +1,49 @@
+package influx
+
+import (
+	"context"
+	"energy-meter-scraper/sink"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+func (s *Sink) DeletePoints(ctx context.Context, measurement string, tags map[string]string, start, stop time.Time, dryRun bool) (int, error) {
+	r := s.routeOf(tags)
+	result, queryErr := s.client.QueryAPI(r.org).Query(ctx, s.rangeQuery(measurement, tags, start, stop))
+	if queryErr != nil {
+		return 0, fmt.Errorf("query points: %w", queryErr)
+	}
+	defer result.Close()
+
+	// Each record is one field, so points are counted by series and time
+	points := map[string]struct{}{}
+	for result.Next() {
+		rec := result.Record()
+		var series []string
+		for k, v := range rec.Values() {
+			if strings.HasPrefix(k, "_") || k == "result" || k == "table" {
+				continue
+			}
+			series = append(series, fmt.Sprint(k, "=", v))
+		}
+		slices.Sort(series)
+		points[rec.Time().String()+fmt.Sprint(series)] = struct{}{}
+	}
+	if result.Err() != nil {
+		return 0, fmt.Errorf("query points: %w", result.Err())
+	}
+
+	if dryRun || len(points) == 0 {
+		return len(points), nil
+	}
+	// The delete API includes stop where the query excluded it
+	deleteErr := s.client.DeleteAPI().DeleteWithName(ctx, r.org, r.bucket, start, stop.Add(-time.Nanosecond), deletePredicate(measurement, s.ids.Tags(tags)))
+	if deleteErr != nil {
+		return 0, fmt.Errorf("delete points: %w", deleteErr)
+	}
+	return len(points), nil
+}
+
+var _ sink.Deleter = (*Sink)(nil)
@@ -0,0 +1,44 @@
+package influx
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rangeQuery selects measurement points matching tags in [start, stop).
+func (s *Sink) rangeQuery(measurement string, tags map[string]string, start, stop time.Time) string {
+	bucket := s.routeOf(tags).bucket
+	tags = s.ids.Tags(tags)
+	filter := []string{fmt.Sprintf("r._measurement == %s", strconv.Quote(measurement))}
+	for _, k := range sortedKeys(tags) {
+		filter = append(filter, fmt.Sprintf("r[%s] == %s", strconv.Quote(k), strconv.Quote(tags[k])))
+	}
+
+	return fmt.Sprintf(`from(bucket: %s)
+  |> range(start: %s, stop: %s)
+  |> filter(fn: (r) => %s)`,
+		strconv.Quote(bucket), start.UTC().Format(time.RFC3339Nano), stop.UTC().Format(time.RFC3339Nano),
+		strings.Join(filter, " and "))
+}
+
+// deletePredicate matches the same points as rangeQuery, in the syntax of the
+// delete API.
+func deletePredicate(measurement string, tags map[string]string) string {
+	predicate := []string{fmt.Sprintf("_measurement=%s", strconv.Quote(measurement))}
+	for _, k := range sortedKeys(tags) {
+		predicate = append(predicate, fmt.Sprintf("%s=%s", k, strconv.Quote(tags[k])))
+	}
+	return strings.Join(predicate, " AND ")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
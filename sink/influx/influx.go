@@ -0,0 +1,106 @@
+package influx
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/transport"
+	"fmt"
+	"github.com/influxdata/influxdb-client-go/v2"
+	influxApi "github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+func init() {
+	sink.Register("influx", New)
+}
+
+type Sink struct {
+	client influxdb2.Client
+	// routes are where each resource with its own org or bucket is
+	// written, and fallback where every other point is.
+	routes   map[string]route
+	fallback route
+	writers  map[route]influxApi.WriteAPIBlocking
+	ids      sink.IDs
+}
+
+type route struct {
+	org, bucket string
+}
+
+func New(cfg *config.Config) (sink.Sink, error) {
+	influxCfg := cfg.Sinks.Influx
+	if influxCfg.Host == "" {
+		return nil, nil
+	}
+
+	httpClient, httpErr := transport.NewClient(influxCfg.HTTP, cfg.Network)
+	if httpErr != nil {
+		return nil, fmt.Errorf("http config: %w", httpErr)
+	}
+
+	// Timestamps are sent in the coarsest unit that keeps
+	// TIMESTAMP_PRECISION, which the client takes to be s, ms, us or ns
+	client := influxdb2.NewClientWithOptions(influxCfg.Host, influxCfg.Token,
+		influxdb2.DefaultOptions().SetHTTPClient(httpClient).SetPrecision(sink.WirePrecision(cfg.Scrape.TimestampPrecision)))
+
+	s := &Sink{
+		client:   client,
+		routes:   map[string]route{},
+		fallback: route{org: influxCfg.Org, bucket: influxCfg.Bucket},
+		writers:  map[route]influxApi.WriteAPIBlocking{},
+		ids:      sink.NewIDs(cfg, "influx"),
+	}
+	s.writers[s.fallback] = client.WriteAPIBlocking(s.fallback.org, s.fallback.bucket)
+	for resource, r := range influxCfg.Routes {
+		to := s.fallback
+		if r.Org != "" {
+			to.org = r.Org
+		}
+		if r.Bucket != "" {
+			to.bucket = r.Bucket
+		}
+		s.routes[resource] = to
+		if _, ok := s.writers[to]; !ok {
+			s.writers[to] = client.WriteAPIBlocking(to.org, to.bucket)
+		}
+	}
+	return s, nil
+}
+
+// routeOf is where points with tags are written, by their resource before
+// it is mapped to an id.
+func (s *Sink) routeOf(tags map[string]string) route {
+	if r, ok := s.routes[tags["resource"]]; ok {
+		return r
+	}
+	return s.fallback
+}
+
+func (s *Sink) Name() string {
+	return "influx"
+}
+
+func (s *Sink) Write(ctx context.Context, points []sink.Point) error {
+	converted := map[route][]*write.Point{}
+	var order []route
+	for _, p := range points {
+		r := s.routeOf(p.Tags)
+		if _, ok := converted[r]; !ok {
+			order = append(order, r)
+		}
+		converted[r] = append(converted[r], write.NewPoint(p.Measurement, s.ids.Tags(p.Tags), p.Fields, p.Time))
+	}
+	for _, r := range order {
+		if err := s.writers[r].WritePoint(ctx, converted[r]...); err != nil {
+			return fmt.Errorf("%s/%s: %w", r.org, r.bucket, err)
+		}
+	}
+	return nil
+}
+
+func (s *Sink) Close() error {
+	s.client.Close()
+	return nil
+}
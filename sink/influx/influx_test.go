@@ -0,0 +1,112 @@
+package influx
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"fmt"
+	"go.uber.org/goleak"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		lines = append(lines, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{}
+	cfg.Sinks.Influx = config.InfluxConfig{Host: server.URL, Token: "token", Org: "org", Bucket: "bucket"}
+	s, newErr := New(cfg)
+	if newErr != nil {
+		t.Fatal(newErr)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.Write(context.Background(), []sink.Point{{
+				Measurement: "energy_usage",
+				Tags:        map[string]string{"resource": fmt.Sprint("resource-", i)},
+				Fields:      map[string]any{"kwh": 0.5},
+				Time:        time.Unix(1700000000, 0),
+			}})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 8 {
+		t.Errorf("server received %d lines, want 8", len(lines))
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	var mu sync.Mutex
+	written := map[string][]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		to := r.URL.Query().Get("org") + "/" + r.URL.Query().Get("bucket")
+		mu.Lock()
+		written[to] = append(written[to], strings.Split(strings.TrimSpace(string(body)), "\n")...)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{IDs: map[string]map[string]string{"flat": {"influx": "electricity"}}}
+	cfg.Sinks.Influx = config.InfluxConfig{Host: server.URL, Token: "token", Org: "home", Bucket: "energy",
+		Routes: map[string]config.InfluxRoute{"gas": {Bucket: "gas"}, "flat": {Org: "flat"}}}
+	cfg.Scrape.TimestampPrecision = time.Second
+	s, newErr := New(cfg)
+	if newErr != nil {
+		t.Fatal(newErr)
+	}
+	defer s.Close()
+
+	var points []sink.Point
+	for _, resource := range []string{"electricity", "gas", "flat"} {
+		points = append(points, sink.Point{Measurement: "energy_usage", Tags: map[string]string{"resource": resource},
+			Fields: map[string]any{"kwh": 0.5}, Time: time.Unix(1700000000, 0)})
+	}
+	if err := s.Write(context.Background(), points); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"home/energy": "energy_usage,resource=electricity kwh=0.5 1700000000",
+		"home/gas":    "energy_usage,resource=gas kwh=0.5 1700000000",
+		"flat/energy": "energy_usage,resource=electricity kwh=0.5 1700000000",
+	}
+	for to, line := range want {
+		if len(written[to]) != 1 || written[to][0] != line {
+			t.Errorf("%s got %q, want %q", to, written[to], line)
+		}
+	}
+
+	if task := s.(*Sink).BillsTask([]string{"electricity", "gas", "flat"}, "UTC"); !strings.Contains(task, `resources = ["electricity"]`) {
+		t.Errorf("bills task totals routed resources:\n%s", task)
+	}
+}
@@ -0,0 +1,32 @@
+package influx
+
+import (
+	"context"
+	"energy-meter-scraper/sink"
+	"time"
+)
+
+func (s *Sink) LastTime(ctx context.Context, measurement string, tags map[string]string, start, stop time.Time) (time.Time, bool, error) {
+	flux := s.rangeQuery(measurement, tags, start, stop) + `
+  |> group()
+  |> max(column: "_time")
+  |> keep(columns: ["_time"])`
+
+	result, queryErr := s.client.QueryAPI(s.routeOf(tags).org).Query(ctx, flux)
+	if queryErr != nil {
+		return time.Time{}, false, queryErr
+	}
+	defer result.Close()
+
+	var last time.Time
+	found := false
+	for result.Next() {
+		last, found = result.Record().Time(), true
+	}
+	if result.Err() != nil {
+		return time.Time{}, false, result.Err()
+	}
+	return last, found, nil
+}
+
+var _ sink.LastTimer = (*Sink)(nil)
@@ -0,0 +1,57 @@
+package influx
+
+import (
+	"context"
+	"energy-meter-scraper/sink"
+	"strings"
+	"time"
+)
+
+func (s *Sink) ReadPoints(ctx context.Context, measurement string, tags map[string]string, start, stop time.Time) ([]sink.Point, error) {
+	flux := s.rangeQuery(measurement, tags, start, stop) + `
+  |> pivot(rowKey: ["_time"], columnKey: ["_field"], valueColumn: "_value")`
+
+	result, queryErr := s.client.QueryAPI(s.routeOf(tags).org).Query(ctx, flux)
+	if queryErr != nil {
+		return nil, queryErr
+	}
+	defer result.Close()
+
+	var points []sink.Point
+	for result.Next() {
+		rec := result.Record()
+		p := sink.Point{
+			Measurement: rec.Measurement(),
+			Tags:        map[string]string{},
+			Fields:      map[string]any{},
+			Time:        rec.Time(),
+		}
+		// After the pivot, group columns are the tags and the remaining
+		// columns are fields
+		for _, col := range result.TableMetadata().Columns() {
+			name := col.Name()
+			if strings.HasPrefix(name, "_") || name == "result" || name == "table" {
+				continue
+			}
+			val := rec.ValueByKey(name)
+			if val == nil {
+				continue
+			}
+			if col.IsGroup() {
+				if str, ok := val.(string); ok {
+					p.Tags[name] = str
+				}
+			} else {
+				p.Fields[name] = val
+			}
+		}
+		p.Tags = s.ids.ResourceTags(p.Tags)
+		points = append(points, p)
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+	return points, nil
+}
+
+var _ sink.Reader = (*Sink)(nil)
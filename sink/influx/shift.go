@@ -0,0 +1,67 @@
+package influx
+
+import (
+	"context"
+	"energy-meter-scraper/sink"
+	"fmt"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+func (s *Sink) ShiftPoints(ctx context.Context, measurement string, tags map[string]string, start, stop time.Time, by time.Duration, dryRun bool) (int, error) {
+	flux := s.rangeQuery(measurement, tags, start, stop)
+
+	r := s.routeOf(tags)
+	result, queryErr := s.client.QueryAPI(r.org).Query(ctx, flux)
+	if queryErr != nil {
+		return 0, fmt.Errorf("query points: %w", queryErr)
+	}
+	defer result.Close()
+
+	// Each record is one field; points with the same tags and time are
+	// merged again by Influx when written.
+	var shifted []*write.Point
+	moved := map[string]struct{}{}
+	for result.Next() {
+		rec := result.Record()
+		pointTags := map[string]string{}
+		for k, v := range rec.Values() {
+			if strings.HasPrefix(k, "_") || k == "result" || k == "table" {
+				continue
+			}
+			if str, ok := v.(string); ok {
+				pointTags[k] = str
+			}
+		}
+		shifted = append(shifted, write.NewPoint(rec.Measurement(), pointTags,
+			map[string]any{rec.Field(): rec.Value()}, rec.Time().Add(by)))
+		moved[rec.Time().String()+fmt.Sprint(pointTags)] = struct{}{}
+	}
+	if result.Err() != nil {
+		return 0, fmt.Errorf("query points: %w", result.Err())
+	}
+
+	if dryRun || len(shifted) == 0 {
+		return len(moved), nil
+	}
+
+	// The shifted range overlaps the original, so the originals must go
+	// before the shifted points are written. The delete API includes stop
+	// where the query excluded it.
+	deleteErr := s.client.DeleteAPI().DeleteWithName(ctx, r.org, r.bucket, start, stop.Add(-time.Nanosecond), deletePredicate(measurement, s.ids.Tags(tags)))
+	if deleteErr != nil {
+		return 0, fmt.Errorf("delete original points: %w", deleteErr)
+	}
+
+	if writeErr := s.writers[r].WritePoint(ctx, shifted...); writeErr != nil {
+		slog.Error("deleted original points but failed to write shifted points; re-scrape the range to repair",
+			"start", start, "stop", stop)
+		return 0, fmt.Errorf("write shifted points: %w", writeErr)
+	}
+
+	return len(moved), nil
+}
+
+var _ sink.Shifter = (*Sink)(nil)
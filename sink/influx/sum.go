@@ -0,0 +1,47 @@
+package influx
+
+import (
+	"context"
+	"energy-meter-scraper/sink"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+func (s *Sink) SumField(ctx context.Context, measurement, field string, tags map[string]string, start, stop time.Time) (float64, int, error) {
+	base := s.rangeQuery(measurement, tags, start, stop) + fmt.Sprintf(`
+  |> filter(fn: (r) => r._field == %s)
+  |> group()`, strconv.Quote(field))
+
+	flux := fmt.Sprintf(`data = %s
+sum = data |> sum() |> map(fn: (r) => ({_value: float(v: r._value), _field: "sum"}))
+count = data |> count() |> map(fn: (r) => ({_value: float(v: r._value), _field: "count"}))
+union(tables: [sum, count])`, base)
+
+	result, queryErr := s.client.QueryAPI(s.routeOf(tags).org).Query(ctx, flux)
+	if queryErr != nil {
+		return 0, 0, queryErr
+	}
+	defer result.Close()
+
+	var total float64
+	var n int
+	for result.Next() {
+		v, ok := result.Record().Value().(float64)
+		if !ok {
+			continue
+		}
+		switch result.Record().Field() {
+		case "sum":
+			total = v
+		case "count":
+			n = int(v)
+		}
+	}
+	if result.Err() != nil {
+		return 0, 0, result.Err()
+	}
+	return total, n, nil
+}
+
+var _ sink.Summer = (*Sink)(nil)
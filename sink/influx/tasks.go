@@ -0,0 +1,102 @@
+package influx
+
+import (
+	"context"
+	"fmt"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"strconv"
+	"strings"
+)
+
+// BillsTaskName is the name the monthly bills task is created under.
+const BillsTaskName = "energy-monthly-bills"
+
+// BillsTask returns a Flux task that, on the first of each month, totals the
+// previous month's energy_usage and each day's standing charge from
+// energy_tariff into a bills point per resource, with fields kwh,
+// usagePence, standingPence and totalPence. Months are calendar months in
+// location, an IANA timezone name. Resources routed to another org or bucket
+// are left out, as a task reads and writes only its own.
+func (s *Sink) BillsTask(resources []string, location string) string {
+	var quoted []string
+	for _, r := range resources {
+		if s.routeOf(map[string]string{"resource": r}) == s.fallback {
+			quoted = append(quoted, strconv.Quote(r))
+		}
+	}
+	b := strconv.Quote(s.fallback.bucket)
+
+	return fmt.Sprintf(`import "date"
+import "timezone"
+
+option task = {name: %s, cron: "0 6 1 * *"}
+option location = timezone.location(name: %s)
+
+resources = [%s]
+monthEnd = date.truncate(t: now(), unit: 1mo)
+monthStart = date.truncate(t: date.sub(d: 1mo, from: monthEnd), unit: 1mo)
+
+usage = from(bucket: %s)
+  |> range(start: monthStart, stop: monthEnd)
+  |> filter(fn: (r) => r._measurement == "energy_usage" and r.period == "30m" and contains(value: r.resource, set: resources))
+  |> filter(fn: (r) => r._field == "kwh" or r._field == "pence")
+  |> group(columns: ["resource", "_field"])
+  |> sum()
+  |> map(fn: (r) => ({r with _field: if r._field == "pence" then "usagePence" else r._field}))
+
+standing = from(bucket: %s)
+  |> range(start: monthStart, stop: monthEnd)
+  |> filter(fn: (r) => r._measurement == "energy_tariff" and r._field == "standingCharge" and contains(value: r.resource, set: resources))
+  |> aggregateWindow(every: 1d, fn: last, createEmpty: false)
+  |> group(columns: ["resource", "_field"])
+  |> sum()
+  |> map(fn: (r) => ({r with _field: "standingPence"}))
+
+union(tables: [usage, standing])
+  |> map(fn: (r) => ({resource: r.resource, _field: r._field, _value: float(v: r._value)}))
+  |> group(columns: ["resource"])
+  |> pivot(rowKey: ["resource"], columnKey: ["_field"], valueColumn: "_value")
+  |> map(fn: (r) => ({
+      _time: monthStart,
+      _measurement: "bills",
+      resource: r.resource,
+      kwh: if exists r.kwh then r.kwh else 0.0,
+      usagePence: if exists r.usagePence then r.usagePence else 0.0,
+      standingPence: if exists r.standingPence then r.standingPence else 0.0,
+  }))
+  |> map(fn: (r) => ({r with totalPence: r.usagePence + r.standingPence}))
+  |> to(
+      bucket: %s,
+      tagColumns: ["resource"],
+      fieldFn: (r) => ({"kwh": r.kwh, "usagePence": r.usagePence, "standingPence": r.standingPence, "totalPence": r.totalPence}),
+  )
+`, strconv.Quote(BillsTaskName), strconv.Quote(location), strings.Join(quoted, ", "), b, b, b)
+}
+
+// ApplyBillsTask creates the bills task, or replaces its Flux if it already
+// exists, and reports whether it was created.
+func (s *Sink) ApplyBillsTask(ctx context.Context, flux string) (bool, error) {
+	tasks := s.client.TasksAPI()
+	existing, findErr := tasks.FindTasks(ctx, &api.TaskFilter{Name: BillsTaskName, OrgName: s.fallback.org})
+	if findErr != nil {
+		return false, fmt.Errorf("find task: %w", findErr)
+	}
+
+	if len(existing) > 0 {
+		task := existing[0]
+		task.Flux = flux
+		if _, err := tasks.UpdateTask(ctx, &task); err != nil {
+			return false, fmt.Errorf("update task: %w", err)
+		}
+		return false, nil
+	}
+
+	org, orgErr := s.client.OrganizationsAPI().FindOrganizationByName(ctx, s.fallback.org)
+	if orgErr != nil {
+		return false, fmt.Errorf("find org: %w", orgErr)
+	}
+	if _, err := tasks.CreateTaskByFlux(ctx, flux, *org.Id); err != nil {
+		return false, fmt.Errorf("create task: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,118 @@
+package influx3
+
+import (
+	"bytes"
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/transport"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+)
+
+func init() {
+	sink.Register("influx3", New)
+}
+
+// Sink writes to an InfluxDB 3 database through the v2 compatible write
+// API, which every edition serves, from Core to Cloud Dedicated. Each
+// measurement becomes a table, with its tags and fields as columns.
+type Sink struct {
+	client   *http.Client
+	endpoint string
+	token    string
+	// precision is the unit timestamps are sent in, the coarsest that
+	// keeps TIMESTAMP_PRECISION.
+	precision time.Duration
+	ids       sink.IDs
+}
+
+func New(cfg *config.Config) (sink.Sink, error) {
+	influxCfg := cfg.Sinks.Influx3
+	if influxCfg.Host == "" {
+		return nil, nil
+	}
+
+	httpClient, httpErr := transport.NewClient(influxCfg.HTTP, cfg.Network)
+	if httpErr != nil {
+		return nil, fmt.Errorf("http config: %w", httpErr)
+	}
+
+	return &Sink{
+		client: httpClient,
+		endpoint: strings.TrimSuffix(influxCfg.Host, "/") + "/api/v2/write?" +
+			url.Values{"bucket": {influxCfg.Database}, "precision": {sink.Precision(cfg.Scrape.TimestampPrecision)}}.Encode(),
+		token:     influxCfg.Token,
+		precision: cfg.Scrape.TimestampPrecision,
+		ids:       sink.NewIDs(cfg, "influx3"),
+	}, nil
+}
+
+func (s *Sink) Name() string {
+	return "influx3"
+}
+
+func (s *Sink) Write(ctx context.Context, points []sink.Point) error {
+	var body bytes.Buffer
+	for _, p := range points {
+		body.WriteString(sink.LineProtocolPrecision(column(p, s.ids), s.precision))
+		body.WriteByte('\n')
+	}
+
+	req, newReqErr := http.NewRequestWithContext(ctx, "POST", s.endpoint, &body)
+	if newReqErr != nil {
+		return newReqErr
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	resp, postErr := s.client.Do(req)
+	if postErr != nil {
+		return postErr
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("http status code %d: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
+
+func (s *Sink) Close() error {
+	return nil
+}
+
+// column renames p's tags and fields to snake case, as SQL folds unquoted
+// identifiers to lower case, so that e.g. peakKw is queried as peak_kw
+// rather than "peakKw".
+func column(p sink.Point, ids sink.IDs) sink.Point {
+	tags := map[string]string{}
+	for k, v := range ids.Tags(p.Tags) {
+		tags[snakeCase(k)] = v
+	}
+	fields := map[string]any{}
+	for k, v := range p.Fields {
+		fields[snakeCase(k)] = v
+	}
+	return sink.Point{Measurement: p.Measurement, Tags: tags, Fields: fields, Time: p.Time}
+}
+
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,52 @@
+package influx3
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	var query, auth, body string
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, auth = r.URL.RawQuery, r.Header.Get("Authorization")
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{IDs: map[string]map[string]string{"electricity": {"influx3": "house_electricity"}}}
+	cfg.Sinks.Influx3 = config.Influx3Config{Host: server.URL + "/", Token: "secret", Database: "energy"}
+	cfg.Scrape.TimestampPrecision = time.Millisecond
+	s, newErr := New(cfg)
+	if newErr != nil {
+		t.Fatal(newErr)
+	}
+	defer s.Close()
+
+	at := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	if err := s.Write(context.Background(), []sink.Point{
+		{Measurement: "energy_demand", Tags: map[string]string{"resource": "electricity"},
+			Fields: map[string]any{"peakKw": 6.5, "schemaVersion": 2}, Time: at},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if query != "bucket=energy&precision=ms" || auth != "Bearer secret" {
+		t.Errorf("wrote to ?%s with %q", query, auth)
+	}
+	if want := "energy_demand,resource=house_electricity peak_kw=6.5,schema_version=2i 1717200000000\n"; body != want {
+		t.Errorf("wrote %q, want %q", body, want)
+	}
+
+	status = http.StatusBadRequest
+	if err := s.Write(context.Background(), []sink.Point{{Measurement: "energy_usage", Fields: map[string]any{"kwh": 1.0}, Time: at}}); err == nil {
+		t.Error("no error for a rejected write")
+	}
+}
@@ -0,0 +1,139 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	stringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// LineProtocol encodes p in InfluxDB line protocol with a nanosecond
+// timestamp.
+func LineProtocol(p Point) string {
+	return LineProtocolPrecision(p, time.Nanosecond)
+}
+
+// LineProtocolPrecision encodes p with its timestamp in the units Precision
+// names for precision.
+func LineProtocolPrecision(p Point, precision time.Duration) string {
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(p.Measurement))
+
+	for _, k := range sortedKeys(p.Tags) {
+		b.WriteByte(',')
+		b.WriteString(keyEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(keyEscaper.Replace(p.Tags[k]))
+	}
+
+	for i, k := range sortedKeys(p.Fields) {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(keyEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(fieldValue(p.Fields[k]))
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(p.Time.UnixNano()/int64(WirePrecision(precision)), 10))
+	return b.String()
+}
+
+// Precision names WirePrecision(d) as line protocol does.
+func Precision(d time.Duration) string {
+	switch WirePrecision(d) {
+	case time.Second:
+		return "s"
+	case time.Millisecond:
+		return "ms"
+	case time.Microsecond:
+		return "us"
+	default:
+		return "ns"
+	}
+}
+
+// WirePrecision is the unit to send timestamps truncated to d in, the
+// coarsest of s, ms, us and ns that d is a whole number of.
+func WirePrecision(d time.Duration) time.Duration {
+	for _, unit := range []time.Duration{time.Second, time.Millisecond, time.Microsecond} {
+		if d > 0 && d%unit == 0 {
+			return unit
+		}
+	}
+	return time.Nanosecond
+}
+
+func fieldValue(v any) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case int:
+		return strconv.Itoa(v) + "i"
+	case int64:
+		return strconv.FormatInt(v, 10) + "i"
+	case uint64:
+		return strconv.FormatUint(v, 10) + "u"
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return `"` + stringEscaper.Replace(v) + `"`
+	default:
+		return `"` + stringEscaper.Replace(fmt.Sprint(v)) + `"`
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// LineProtocolWriter is a sink that prints points as line protocol, used by
+// --dry-run to show what would be written.
+type LineProtocolWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLineProtocolWriter(w io.Writer) *LineProtocolWriter {
+	return &LineProtocolWriter{w: w}
+}
+
+func (s *LineProtocolWriter) Name() string {
+	return "dry-run"
+}
+
+func (s *LineProtocolWriter) Write(_ context.Context, points []Point) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range points {
+		if _, err := fmt.Fprintln(s.w, LineProtocol(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *LineProtocolWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,77 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLineProtocol(t *testing.T) {
+	got := LineProtocol(Point{
+		Measurement: "energy usage",
+		Tags:        map[string]string{"resource": "gas,main", "period": "30m"},
+		Fields:      map[string]any{"kwh": 1.25, "revision": int64(2), "note": `say "hi"`},
+		Time:        time.Unix(1700000000, 0),
+	})
+	want := `energy\ usage,period=30m,resource=gas\,main kwh=1.25,note="say \"hi\"",revision=2i 1700000000000000000`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestLineProtocolPrecision(t *testing.T) {
+	p := Point{Measurement: "a", Fields: map[string]any{"v": 1}, Time: time.Unix(1700000000, 250_000_000)}
+	for _, tc := range []struct {
+		precision time.Duration
+		name      string
+		want      string
+	}{
+		{0, "ns", "a v=1i 1700000000250000000"},
+		{time.Millisecond, "ms", "a v=1i 1700000000250"},
+		{time.Second, "s", "a v=1i 1700000000"},
+		{time.Minute, "s", "a v=1i 1700000000"},
+		{1500 * time.Microsecond, "us", "a v=1i 1700000000250000"},
+	} {
+		if got := Precision(tc.precision); got != tc.name {
+			t.Errorf("precision of %v is %s, want %s", tc.precision, got, tc.name)
+		}
+		if got := LineProtocolPrecision(p, tc.precision); got != tc.want {
+			t.Errorf("at %v got %s, want %s", tc.precision, got, tc.want)
+		}
+	}
+}
+
+func TestLineProtocolWriterConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewLineProtocolWriter(&buf)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			points := []Point{
+				{Measurement: "a", Fields: map[string]any{"v": 1}, Time: time.Unix(0, 0)},
+				{Measurement: "b", Fields: map[string]any{"v": 2}, Time: time.Unix(0, 0)},
+			}
+			if err := w.Write(context.Background(), points); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Each write's points stay together
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 16 {
+		t.Fatalf("got %d lines, want 16", len(lines))
+	}
+	for i := 0; i < len(lines); i += 2 {
+		if !strings.HasPrefix(lines[i], "a ") || !strings.HasPrefix(lines[i+1], "b ") {
+			t.Fatalf("writes interleaved: %q", lines)
+		}
+	}
+}
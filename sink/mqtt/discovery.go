@@ -0,0 +1,93 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"regexp"
+)
+
+// nodeID groups the scraper's entities in Home Assistant's discovery topics.
+const nodeID = "energy-meter-scraper"
+
+// sensor is a Home Assistant MQTT sensor's discovery config.
+type sensor struct {
+	Name                   string `json:"name"`
+	UniqueID               string `json:"unique_id"`
+	StateTopic             string `json:"state_topic"`
+	ValueTemplate          string `json:"value_template"`
+	LastResetValueTemplate string `json:"last_reset_value_template,omitempty"`
+	DeviceClass            string `json:"device_class,omitempty"`
+	StateClass             string `json:"state_class"`
+	UnitOfMeasurement      string `json:"unit_of_measurement"`
+	Device                 device `json:"device"`
+}
+
+type device struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+var unsafeObjectID = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// discoveryMessages returns the discovery config for each resource's
+// consumption, cost, unit rate and standing charge sensors, read from its
+// reading and tariff topics. Each slot's usage is a total reset at the
+// slot's start, which is how the Energy dashboard takes usage that isn't a
+// meter reading.
+func discoveryMessages(prefix string, resources []config.Resource, readingTopics, tariffTopics map[string]string, ids sink.IDs) []message {
+	var out []message
+	for _, r := range resources {
+		id := ids.ID(r.Name)
+		objectID := unsafeObjectID.ReplaceAllString(id, "_")
+		fuel := "gas"
+		if r.IsElectricity() {
+			fuel = "electricity"
+		}
+		dev := device{
+			Identifiers:  []string{nodeID + "_" + objectID},
+			Name:         r.Name,
+			Manufacturer: "Glowmarkt",
+			Model:        fuel + " meter",
+		}
+
+		const lastReset = "{{ value_json.time }}"
+		sensors := map[string]sensor{
+			"consumption": {
+				Name: "Consumption", StateTopic: readingTopics[r.Name],
+				ValueTemplate:          "{{ value_json.kwh }}",
+				LastResetValueTemplate: lastReset,
+				DeviceClass:            "energy", StateClass: "total", UnitOfMeasurement: "kWh",
+			},
+			"cost": {
+				Name: "Cost", StateTopic: readingTopics[r.Name],
+				ValueTemplate:          "{{ (value_json.pence / 100) if value_json.pence is defined else none }}",
+				LastResetValueTemplate: lastReset,
+				DeviceClass:            "monetary", StateClass: "total", UnitOfMeasurement: "GBP",
+			},
+			"rate": {
+				Name: "Unit rate", StateTopic: tariffTopics[r.Name],
+				ValueTemplate: "{{ value_json.rate / 100 }}",
+				StateClass:    "measurement", UnitOfMeasurement: "GBP/kWh",
+			},
+			"standing_charge": {
+				Name: "Standing charge", StateTopic: tariffTopics[r.Name],
+				ValueTemplate: "{{ value_json.standingCharge / 100 }}",
+				StateClass:    "measurement", UnitOfMeasurement: "GBP/d",
+			},
+		}
+		for _, kind := range []string{"consumption", "cost", "rate", "standing_charge"} {
+			cfg := sensors[kind]
+			cfg.UniqueID = nodeID + "_" + objectID + "_" + kind
+			cfg.Device = dev
+			payload, _ := json.Marshal(cfg)
+			out = append(out, message{
+				topic:   prefix + "/sensor/" + nodeID + "/" + objectID + "_" + kind + "/config",
+				payload: string(payload),
+			})
+		}
+	}
+	return out
+}
@@ -0,0 +1,306 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"errors"
+	"fmt"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	sink.Register("mqtt", New)
+}
+
+// Sink publishes the latest slot of each resource to retained topics that
+// mirror Glow's classifiers, so any MQTT client can read current usage
+// without knowing about the scraper.
+type Sink struct {
+	client paho.Client
+	// bases are the topics each resource's classifiers go under, by name.
+	bases map[string]string
+	// readingTopics and tariffTopics are where each resource's JSON
+	// messages go, by name, if they are enabled.
+	readingTopics, tariffTopics map[string]string
+	ids                         sink.IDs
+	qos                         byte
+	retain                      bool
+
+	mu sync.Mutex
+	// published is the newest slot sent to each topic, so that rewriting
+	// older slots doesn't replace the retained latest value.
+	published map[string]time.Time
+	// tariffs are the last tariff sent to each tariff topic.
+	tariffs map[string]tariffMessage
+}
+
+func New(cfg *config.Config) (sink.Sink, error) {
+	mqttCfg := cfg.Sinks.MQTT
+	if mqttCfg.Broker == "" {
+		return nil, nil
+	}
+
+	ids := sink.NewIDs(cfg, "mqtt")
+	readingTopic, tariffTopic := mqttCfg.ReadingTopic, mqttCfg.TariffTopic
+	var discovery []message
+	if mqttCfg.Discovery {
+		// Home Assistant's sensors read the JSON topics
+		if readingTopic == "" {
+			readingTopic = mqttCfg.TopicPrefix + "/{resource}/reading"
+		}
+		if tariffTopic == "" {
+			tariffTopic = mqttCfg.TopicPrefix + "/{resource}/tariff"
+		}
+	}
+	readingTopics := resourceTopics(readingTopic, cfg.Resources, ids)
+	tariffTopics := resourceTopics(tariffTopic, cfg.Resources, ids)
+	if mqttCfg.Discovery {
+		discovery = discoveryMessages(mqttCfg.DiscoveryPrefix, cfg.Resources, readingTopics, tariffTopics, ids)
+	}
+
+	// The broker being down at start is retried in the background like a
+	// dropped connection, with writes failing until it is up. Discovery
+	// config is sent on every connection, as Home Assistant may have
+	// restarted with a broker that doesn't persist retained messages.
+	opts := paho.NewClientOptions().
+		AddBroker(mqttCfg.Broker).
+		SetClientID(mqttCfg.ClientID).
+		SetUsername(mqttCfg.Username).
+		SetPassword(mqttCfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(func(c paho.Client) {
+			for _, m := range discovery {
+				c.Publish(m.topic, 1, true, m.payload)
+			}
+		})
+	client := paho.NewClient(opts)
+	client.Connect()
+
+	return &Sink{
+		client:        client,
+		bases:         topicBases(mqttCfg.TopicPrefix, cfg.Resources, ids),
+		readingTopics: readingTopics,
+		tariffTopics:  tariffTopics,
+		ids:           ids,
+		qos:           byte(mqttCfg.QoS),
+		retain:        mqttCfg.Retain,
+		published:     map[string]time.Time{},
+		tariffs:       map[string]tariffMessage{},
+	}, nil
+}
+
+// resourceTopics expands a topic template for each resource, or returns
+// nil if there is no template.
+func resourceTopics(template string, resources []config.Resource, ids sink.IDs) map[string]string {
+	if template == "" {
+		return nil
+	}
+	topics := map[string]string{}
+	for _, r := range resources {
+		topics[r.Name] = strings.ReplaceAll(template, "{resource}", ids.ID(r.Name))
+	}
+	return topics
+}
+
+// topicBases returns the topic each resource publishes under: the prefix
+// and its fuel, as Glow classifies it. Resources sharing a fuel are told
+// apart by their ID.
+func topicBases(prefix string, resources []config.Resource, ids sink.IDs) map[string]string {
+	fuel := func(r config.Resource) string {
+		if r.IsElectricity() {
+			return "electricity"
+		}
+		return "gas"
+	}
+	perFuel := map[string]int{}
+	for _, r := range resources {
+		perFuel[fuel(r)]++
+	}
+
+	bases := map[string]string{}
+	for _, r := range resources {
+		base := prefix + "/" + fuel(r)
+		if perFuel[fuel(r)] > 1 {
+			base += "/" + ids.ID(r.Name)
+		}
+		bases[r.Name] = base
+	}
+	return bases
+}
+
+type message struct {
+	topic   string
+	payload string
+	time    time.Time
+	// tariff is set for tariff messages, which are sent when it changes.
+	tariff *tariffMessage
+}
+
+type readingMessage struct {
+	Resource    string    `json:"resource"`
+	Time        time.Time `json:"time"`
+	KWh         *float64  `json:"kwh,omitempty"`
+	Pence       *float64  `json:"pence,omitempty"`
+	Provisional bool      `json:"provisional,omitempty"`
+}
+
+type tariffMessage struct {
+	Resource       string  `json:"resource"`
+	Rate           float64 `json:"rate"`
+	StandingCharge float64 `json:"standingCharge"`
+}
+
+// classifiers maps energy_usage fields to the Glow classifier they are
+// read from, below the fuel.
+var classifiers = map[string]string{
+	"kwh":   "consumption",
+	"pence": "consumption/cost",
+}
+
+// messages returns the value and time messages for the newest 30 minute
+// usage slot of each topic in points, provisional or not, followed by the
+// JSON messages.
+func (s *Sink) messages(points []sink.Point) []message {
+	return append(s.classifierMessages(points), s.jsonMessages(points)...)
+}
+
+func (s *Sink) classifierMessages(points []sink.Point) []message {
+	latest := map[string]message{}
+	for _, p := range points {
+		if (p.Measurement != "energy_usage" && p.Measurement != "energy_usage_provisional") || p.Tags["period"] != "30m" {
+			continue
+		}
+		base, ok := s.bases[p.Tags["resource"]]
+		if !ok {
+			continue
+		}
+		for field, classifier := range classifiers {
+			v, ok := p.Fields[field].(float64)
+			if !ok {
+				continue
+			}
+			topic := base + "/" + classifier + "/30m"
+			if prev, ok := latest[topic]; ok && !p.Time.After(prev.time) {
+				continue
+			}
+			latest[topic] = message{topic: topic, payload: strconv.FormatFloat(v, 'f', -1, 64), time: p.Time}
+		}
+	}
+
+	var out []message
+	for _, m := range latest {
+		if prev, ok := s.published[m.topic]; ok && !m.time.After(prev) {
+			continue
+		}
+		out = append(out, m, message{topic: m.topic + "/time", payload: m.time.UTC().Format(time.RFC3339), time: m.time})
+	}
+	slices.SortFunc(out, func(a, b message) int { return strings.Compare(a.topic, b.topic) })
+	return out
+}
+
+// jsonMessages returns a reading message for each 30 minute usage slot in
+// points newer than its topic's last, in order, and a tariff message for
+// each tariff that differs from the last sent.
+func (s *Sink) jsonMessages(points []sink.Point) []message {
+	points = slices.Clone(points)
+	slices.SortStableFunc(points, func(a, b sink.Point) int { return a.Time.Compare(b.Time) })
+
+	var out []message
+	newest := map[string]time.Time{}
+	tariffs := maps.Clone(s.tariffs)
+	for _, p := range points {
+		resource := p.Tags["resource"]
+		switch {
+		case (p.Measurement == "energy_usage" || p.Measurement == "energy_usage_provisional") && p.Tags["period"] == "30m":
+			topic, ok := s.readingTopics[resource]
+			if !ok {
+				continue
+			}
+			last, ok := newest[topic]
+			if !ok {
+				last = s.published[topic]
+			}
+			if !p.Time.After(last) {
+				continue
+			}
+			reading := readingMessage{Resource: s.ids.ID(resource), Time: p.Time.UTC(), Provisional: p.Measurement == "energy_usage_provisional"}
+			if v, ok := p.Fields["kwh"].(float64); ok {
+				reading.KWh = &v
+			}
+			if v, ok := p.Fields["pence"].(float64); ok {
+				reading.Pence = &v
+			}
+			payload, _ := json.Marshal(reading)
+			out = append(out, message{topic: topic, payload: string(payload), time: p.Time})
+			newest[topic] = p.Time
+
+		case p.Measurement == "energy_tariff":
+			topic, ok := s.tariffTopics[resource]
+			if !ok {
+				continue
+			}
+			rate, rateOK := p.Fields["rate"].(float64)
+			standing, standingOK := p.Fields["standingCharge"].(float64)
+			if !rateOK || !standingOK {
+				continue
+			}
+			tariff := tariffMessage{Resource: s.ids.ID(resource), Rate: rate, StandingCharge: standing}
+			if prev, ok := tariffs[topic]; ok && prev == tariff {
+				continue
+			}
+			tariffs[topic] = tariff
+			payload, _ := json.Marshal(tariff)
+			out = append(out, message{topic: topic, payload: string(payload), time: p.Time, tariff: &tariff})
+		}
+	}
+	return out
+}
+
+func (s *Sink) Name() string {
+	return "mqtt"
+}
+
+func (s *Sink) Write(ctx context.Context, points []sink.Point) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msgs := s.messages(points)
+	if len(msgs) == 0 {
+		return nil
+	}
+	if !s.client.IsConnectionOpen() {
+		return errors.New("not connected to broker")
+	}
+
+	for _, m := range msgs {
+		token := s.client.Publish(m.topic, s.qos, s.retain, m.payload)
+		select {
+		case <-token.Done():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err := token.Error(); err != nil {
+			return fmt.Errorf("publish %s: %w", m.topic, err)
+		}
+		if m.tariff != nil {
+			s.tariffs[m.topic] = *m.tariff
+		} else {
+			s.published[m.topic] = m.time
+		}
+	}
+	return nil
+}
+
+func (s *Sink) Close() error {
+	s.client.Disconnect(250)
+	return nil
+}
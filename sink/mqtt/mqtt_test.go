@@ -0,0 +1,148 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTopicBases(t *testing.T) {
+	got := topicBases("energy", []config.Resource{
+		{Name: "electricity"},
+		{Name: "gas"},
+		{Name: "garage", Fuel: "electricity"},
+	}, sink.NewIDs(&config.Config{IDs: map[string]map[string]string{"garage": {"mqtt": "outbuilding"}}}, "mqtt"))
+	want := map[string]string{
+		"electricity": "energy/electricity/electricity",
+		"garage":      "energy/electricity/outbuilding",
+		"gas":         "energy/gas",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMessagesPublishLatestSlot(t *testing.T) {
+	s := &Sink{bases: map[string]string{"electricity": "energy/electricity"}, published: map[string]time.Time{}}
+	at := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	usage := func(at time.Time, fields map[string]any) sink.Point {
+		return sink.Point{
+			Measurement: "energy_usage",
+			Tags:        map[string]string{"resource": "electricity", "period": "30m"},
+			Fields:      fields,
+			Time:        at,
+		}
+	}
+
+	msgs := s.messages([]sink.Point{
+		usage(at.Add(30*time.Minute), map[string]any{"kwh": 0.25, "pence": 7.5}),
+		usage(at, map[string]any{"kwh": 0.1, "pence": 3.0}),
+		usage(at.Add(time.Hour), map[string]any{"kwh": 0.3}),
+		{Measurement: "energy_tariff", Tags: map[string]string{"resource": "electricity"}, Fields: map[string]any{"rate": 24.5}, Time: at},
+	})
+	got := map[string]string{}
+	for _, m := range msgs {
+		got[m.topic] = m.payload
+	}
+	want := map[string]string{
+		"energy/electricity/consumption/30m":           "0.3",
+		"energy/electricity/consumption/30m/time":      "2024-01-01T11:00:00Z",
+		"energy/electricity/consumption/cost/30m":      "7.5",
+		"energy/electricity/consumption/cost/30m/time": "2024-01-01T10:30:00Z",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Rewriting an earlier slot, e.g. in a recheck, leaves the retained value
+	s.published["energy/electricity/consumption/30m"] = at.Add(time.Hour)
+	if msgs := s.messages([]sink.Point{usage(at, map[string]any{"kwh": 0.2})}); len(msgs) != 0 {
+		t.Errorf("republished an older slot: %v", msgs)
+	}
+}
+
+func TestJSONMessages(t *testing.T) {
+	ids := sink.NewIDs(&config.Config{IDs: map[string]map[string]string{"electricity": {"mqtt": "main"}}}, "mqtt")
+	resources := []config.Resource{{Name: "electricity"}}
+	s := &Sink{
+		readingTopics: resourceTopics("energy/{resource}/reading", resources, ids),
+		tariffTopics:  resourceTopics("energy/{resource}/tariff", resources, ids),
+		ids:           ids,
+		published:     map[string]time.Time{},
+		tariffs:       map[string]tariffMessage{},
+	}
+	at := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	tags := map[string]string{"resource": "electricity", "period": "30m"}
+	tariff := sink.Point{Measurement: "energy_tariff", Tags: map[string]string{"resource": "electricity"},
+		Fields: map[string]any{"rate": 24.5, "standingCharge": 53.2}, Time: at}
+
+	msgs := s.jsonMessages([]sink.Point{
+		{Measurement: "energy_usage_provisional", Tags: tags, Fields: map[string]any{"kwh": 0.3}, Time: at.Add(30 * time.Minute)},
+		{Measurement: "energy_usage", Tags: tags, Fields: map[string]any{"kwh": 0.25, "pence": 7.5}, Time: at},
+		tariff,
+		tariff,
+	})
+	var got []string
+	for _, m := range msgs {
+		got = append(got, m.topic+" "+m.payload)
+	}
+	want := []string{
+		`energy/main/reading {"resource":"main","time":"2024-01-01T10:00:00Z","kwh":0.25,"pence":7.5}`,
+		`energy/main/tariff {"resource":"main","rate":24.5,"standingCharge":53.2}`,
+		`energy/main/reading {"resource":"main","time":"2024-01-01T10:30:00Z","kwh":0.3,"provisional":true}`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Once sent, an unchanged tariff and older slots aren't sent again
+	s.published["energy/main/reading"] = at.Add(30 * time.Minute)
+	s.tariffs["energy/main/tariff"] = tariffMessage{Resource: "main", Rate: 24.5, StandingCharge: 53.2}
+	if msgs := s.jsonMessages([]sink.Point{tariff, {Measurement: "energy_usage", Tags: tags, Fields: map[string]any{"kwh": 0.2}, Time: at}}); len(msgs) != 0 {
+		t.Errorf("sent again: %v", msgs)
+	}
+}
+
+func TestDiscoveryMessages(t *testing.T) {
+	resources := []config.Resource{{Name: "electricity"}, {Name: "gas"}}
+	ids := sink.NewIDs(&config.Config{IDs: map[string]map[string]string{"gas": {"mqtt": "house gas"}}}, "mqtt")
+	readingTopics := resourceTopics("energy/{resource}/reading", resources, ids)
+	tariffTopics := resourceTopics("energy/{resource}/tariff", resources, ids)
+
+	configs := map[string]sensor{}
+	for _, m := range discoveryMessages("homeassistant", resources, readingTopics, tariffTopics, ids) {
+		var s sensor
+		if err := json.Unmarshal([]byte(m.payload), &s); err != nil {
+			t.Fatalf("%s: %s", m.topic, err)
+		}
+		configs[m.topic] = s
+	}
+	if len(configs) != 8 {
+		t.Fatalf("got %d configs, want 8", len(configs))
+	}
+
+	consumption, ok := configs["homeassistant/sensor/energy-meter-scraper/house_gas_consumption/config"]
+	if !ok {
+		t.Fatalf("no gas consumption config in %v", slices.Collect(maps.Keys(configs)))
+	}
+	if consumption.StateTopic != "energy/house gas/reading" || consumption.DeviceClass != "energy" ||
+		consumption.StateClass != "total" || consumption.UnitOfMeasurement != "kWh" || consumption.LastResetValueTemplate == "" {
+		t.Errorf("gas consumption config %+v", consumption)
+	}
+	if consumption.Device.Model != "gas meter" || consumption.UniqueID != "energy-meter-scraper_house_gas_consumption" {
+		t.Errorf("gas consumption device %+v, unique ID %q", consumption.Device, consumption.UniqueID)
+	}
+
+	cost := configs["homeassistant/sensor/energy-meter-scraper/electricity_cost/config"]
+	if cost.DeviceClass != "monetary" || cost.UnitOfMeasurement != "GBP" || cost.StateTopic != "energy/electricity/reading" {
+		t.Errorf("electricity cost config %+v", cost)
+	}
+	rate := configs["homeassistant/sensor/energy-meter-scraper/electricity_rate/config"]
+	if rate.StateTopic != "energy/electricity/tariff" || rate.StateClass != "measurement" {
+		t.Errorf("electricity rate config %+v", rate)
+	}
+}
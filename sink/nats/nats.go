@@ -0,0 +1,141 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	sink.Register("nats", New)
+}
+
+// Sink publishes each point to a JetStream stream, waiting for the stream
+// to acknowledge every point so that a failed write is retried with the
+// rest of the cycle. A retried point carries the same message ID, so the
+// stream drops it if it was stored the first time.
+type Sink struct {
+	conn    *nats.Conn
+	js      jetstream.JetStream
+	subject string
+	ids     sink.IDs
+}
+
+type message struct {
+	Measurement string            `json:"measurement"`
+	Tags        map[string]string `json:"tags"`
+	Fields      map[string]any    `json:"fields"`
+	Time        time.Time         `json:"time"`
+}
+
+func New(cfg *config.Config) (sink.Sink, error) {
+	natsCfg := cfg.Sinks.NATS
+	if natsCfg.URL == "" {
+		return nil, nil
+	}
+
+	// The server being down at start is retried in the background like a
+	// dropped connection, with writes failing until it is up
+	opts := []nats.Option{
+		nats.Name("energy-meter-scraper"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+	}
+	switch {
+	case natsCfg.CredentialsFile != "":
+		opts = append(opts, nats.UserCredentials(natsCfg.CredentialsFile))
+	case natsCfg.Token != "":
+		opts = append(opts, nats.Token(natsCfg.Token))
+	case natsCfg.Username != "":
+		opts = append(opts, nats.UserInfo(natsCfg.Username, natsCfg.Password))
+	}
+	conn, connectErr := nats.Connect(natsCfg.URL, opts...)
+	if connectErr != nil {
+		return nil, fmt.Errorf("connect: %w", connectErr)
+	}
+	js, jsErr := jetstream.New(conn)
+	if jsErr != nil {
+		conn.Close()
+		return nil, jsErr
+	}
+
+	return &Sink{conn: conn, js: js, subject: natsCfg.Subject, ids: sink.NewIDs(cfg, "nats")}, nil
+}
+
+func (s *Sink) Name() string {
+	return "nats"
+}
+
+func (s *Sink) Write(ctx context.Context, points []sink.Point) error {
+	futures := make([]jetstream.PubAckFuture, 0, len(points))
+	for _, p := range points {
+		tags := s.ids.Tags(p.Tags)
+		data, marshalErr := json.Marshal(message{Measurement: p.Measurement, Tags: tags, Fields: p.Fields, Time: p.Time.UTC()})
+		if marshalErr != nil {
+			return fmt.Errorf("%s at %s: %w", p.Measurement, p.Time.Format(time.RFC3339), marshalErr)
+		}
+		future, publishErr := s.js.PublishMsgAsync(&nats.Msg{Subject: subject(s.subject, p.Measurement, tags), Data: data},
+			jetstream.WithMsgID(msgID(p.Measurement, tags, p.Time)))
+		if publishErr != nil {
+			return publishErr
+		}
+		futures = append(futures, future)
+	}
+
+	var errs []error
+	for _, future := range futures {
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			errs = append(errs, err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d points not acknowledged: %w", len(errs), len(points), errors.Join(errs...))
+	}
+	return nil
+}
+
+func (s *Sink) Close() error {
+	return s.conn.Drain()
+}
+
+var tokenEscaper = strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_", "\t", "_")
+
+// subject is prefix.measurement.resource, or prefix.measurement for points
+// without a resource, such as energy_household.
+func subject(prefix, measurement string, tags map[string]string) string {
+	parts := []string{prefix, tokenEscaper.Replace(measurement)}
+	if resource, ok := tags["resource"]; ok {
+		parts = append(parts, tokenEscaper.Replace(resource))
+	}
+	return strings.Join(parts, ".")
+}
+
+// msgID identifies a point by its series and time, which is what the
+// stream deduplicates on. A revision of a slot is published long after
+// the duplicate window, so isn't dropped.
+func msgID(measurement string, tags map[string]string, at time.Time) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(measurement)
+	for _, k := range keys {
+		b.WriteString("," + k + "=" + tags[k])
+	}
+	b.WriteString("@" + at.UTC().Format(time.RFC3339Nano))
+	return b.String()
+}
@@ -0,0 +1,30 @@
+package nats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubject(t *testing.T) {
+	tags := map[string]string{"resource": "house.electricity", "period": "30m"}
+	if got := subject("energy", "energy_usage", tags); got != "energy.energy_usage.house_electricity" {
+		t.Errorf("subject %q", got)
+	}
+	if got := subject("home.energy", "energy_household", map[string]string{}); got != "home.energy.energy_household" {
+		t.Errorf("subject without a resource %q", got)
+	}
+}
+
+func TestMsgID(t *testing.T) {
+	at := time.Date(2024, 1, 1, 10, 30, 0, 0, time.FixedZone("BST", 3600))
+	tags := map[string]string{"resource": "gas", "period": "30m"}
+	id := msgID("energy_usage", tags, at)
+	if id != "energy_usage,period=30m,resource=gas@2024-01-01T09:30:00Z" {
+		t.Errorf("id %q", id)
+	}
+
+	// The tariff of the same slot, and the next slot, are different points
+	if msgID("energy_tariff", map[string]string{"resource": "gas"}, at) == id || msgID("energy_usage", tags, at.Add(30*time.Minute)) == id {
+		t.Error("distinct points share an id")
+	}
+}
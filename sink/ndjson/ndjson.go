@@ -0,0 +1,70 @@
+package ndjson
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+func init() {
+	sink.Register("ndjson", New)
+}
+
+// stdoutMu keeps lines whole while a reload has two sinks writing.
+var stdoutMu sync.Mutex
+
+// Sink writes each point as a line of JSON to stdout, for piping into jq or
+// a log shipper's exec input. Logs go to stderr, so stdout carries only
+// points.
+type Sink struct {
+	w   io.Writer
+	mu  *sync.Mutex
+	ids sink.IDs
+}
+
+type line struct {
+	Measurement string            `json:"measurement"`
+	Tags        map[string]string `json:"tags"`
+	Fields      map[string]any    `json:"fields"`
+	Time        time.Time         `json:"time"`
+}
+
+func New(cfg *config.Config) (sink.Sink, error) {
+	if !cfg.Sinks.NDJSON.Stdout {
+		return nil, nil
+	}
+	return &Sink{w: os.Stdout, mu: &stdoutMu, ids: sink.NewIDs(cfg, "ndjson")}, nil
+}
+
+func (s *Sink) Name() string {
+	return "ndjson"
+}
+
+// Write writes the points in one go, so a reader never sees part of a
+// batch that failed to encode.
+func (s *Sink) Write(_ context.Context, points []sink.Point) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, p := range points {
+		if err := enc.Encode(line{Measurement: p.Measurement, Tags: s.ids.Tags(p.Tags), Fields: p.Fields, Time: p.Time.UTC()}); err != nil {
+			return fmt.Errorf("%s at %s: %w", p.Measurement, p.Time.Format(time.RFC3339), err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.w.Write(buf.Bytes())
+	return err
+}
+
+// Close leaves stdout open, as it isn't the sink's.
+func (s *Sink) Close() error {
+	return nil
+}
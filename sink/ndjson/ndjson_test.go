@@ -0,0 +1,43 @@
+package ndjson
+
+import (
+	"bytes"
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	var out bytes.Buffer
+	cfg := &config.Config{IDs: map[string]map[string]string{"gas": {"ndjson": "house_gas"}}}
+	s := &Sink{w: &out, mu: &sync.Mutex{}, ids: sink.NewIDs(cfg, "ndjson")}
+	at := time.Date(2024, 1, 1, 10, 0, 0, 0, time.FixedZone("BST", 3600))
+
+	if err := s.Write(context.Background(), []sink.Point{
+		{Measurement: "energy_usage", Tags: map[string]string{"resource": "gas", "period": "30m"}, Fields: map[string]any{"kwh": 1.5, "pence": 9.0}, Time: at},
+		{Measurement: "energy_tariff", Tags: map[string]string{"resource": "electricity"}, Fields: map[string]any{"rate": 24.5}, Time: at},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"measurement":"energy_usage","tags":{"period":"30m","resource":"house_gas"},"fields":{"kwh":1.5,"pence":9},"time":"2024-01-01T09:00:00Z"}
+{"measurement":"energy_tariff","tags":{"resource":"electricity"},"fields":{"rate":24.5},"time":"2024-01-01T09:00:00Z"}
+`
+	if out.String() != want {
+		t.Errorf("wrote\n%s\nwant\n%s", out.String(), want)
+	}
+
+	// A batch that can't be encoded writes nothing
+	out.Reset()
+	if err := s.Write(context.Background(), []sink.Point{
+		{Measurement: "energy_usage", Fields: map[string]any{"kwh": 1.0}, Time: at},
+		{Measurement: "energy_usage", Fields: map[string]any{"kwh": func() {}}, Time: at},
+	}); err == nil {
+		t.Error("wrote an unencodable field")
+	}
+	if out.Len() != 0 {
+		t.Errorf("wrote %q from a failed batch", out.String())
+	}
+}
@@ -0,0 +1,214 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/schema"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/transport"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	sink.Register("otlp", New)
+}
+
+// Sink exports each numeric field as a gauge named measurement.field over
+// OTLP/HTTP, in its JSON encoding, with the point's time as the data
+// point's. Tags and string fields, such as the tariff band, are attributes.
+type Sink struct {
+	client   *http.Client
+	endpoint string
+	headers  map[string]string
+	ids      sink.IDs
+}
+
+func New(cfg *config.Config) (sink.Sink, error) {
+	otlpCfg := cfg.Sinks.OTLP
+	if otlpCfg.Endpoint == "" {
+		return nil, nil
+	}
+
+	httpClient, httpErr := transport.NewClient(otlpCfg.HTTP, cfg.Network)
+	if httpErr != nil {
+		return nil, fmt.Errorf("http config: %w", httpErr)
+	}
+
+	return &Sink{
+		client:   httpClient,
+		endpoint: strings.TrimSuffix(otlpCfg.Endpoint, "/") + "/v1/metrics",
+		headers:  otlpCfg.Headers,
+		ids:      sink.NewIDs(cfg, "otlp"),
+	}, nil
+}
+
+func (s *Sink) Name() string {
+	return "otlp"
+}
+
+// The types below are the parts of ExportMetricsServiceRequest written, in
+// the protobuf JSON mapping OTLP/HTTP accepts.
+
+type exportRequest struct {
+	ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+}
+
+type resourceMetrics struct {
+	Resource     resource       `json:"resource"`
+	ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeMetrics struct {
+	Scope   scope    `json:"scope"`
+	Metrics []metric `json:"metrics"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type metric struct {
+	Name  string `json:"name"`
+	Gauge gauge  `json:"gauge"`
+}
+
+type gauge struct {
+	DataPoints []dataPoint `json:"dataPoints"`
+}
+
+// dataPoint is a NumberDataPoint. 64 bit integers are strings in the JSON
+// mapping.
+type dataPoint struct {
+	Attributes   []keyValue `json:"attributes,omitempty"`
+	TimeUnixNano string     `json:"timeUnixNano"`
+	AsDouble     *float64   `json:"asDouble,omitempty"`
+	AsInt        string     `json:"asInt,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type exportResponse struct {
+	PartialSuccess struct {
+		// RejectedDataPoints is an int64, which collectors send as either a
+		// string or a number.
+		RejectedDataPoints json.RawMessage `json:"rejectedDataPoints"`
+		ErrorMessage       string          `json:"errorMessage"`
+	} `json:"partialSuccess"`
+}
+
+func (s *Sink) Write(ctx context.Context, points []sink.Point) error {
+	byName := map[string][]dataPoint{}
+	for _, p := range points {
+		tags := s.ids.Tags(p.Tags)
+		fields := slices.Sorted(maps.Keys(p.Fields))
+		var attributes []keyValue
+		for _, k := range slices.Sorted(maps.Keys(tags)) {
+			attributes = append(attributes, keyValue{Key: k, Value: anyValue{StringValue: tags[k]}})
+		}
+		for _, k := range fields {
+			if v, ok := p.Fields[k].(string); ok {
+				attributes = append(attributes, keyValue{Key: k, Value: anyValue{StringValue: v}})
+			}
+		}
+
+		for _, k := range fields {
+			if k == schema.Field {
+				continue
+			}
+			dp, ok := numeric(p.Fields[k])
+			if !ok {
+				continue
+			}
+			dp.Attributes = attributes
+			dp.TimeUnixNano = strconv.FormatInt(p.Time.UnixNano(), 10)
+			name := p.Measurement + "." + k
+			byName[name] = append(byName[name], dp)
+		}
+	}
+	if len(byName) == 0 {
+		return nil
+	}
+
+	var metrics []metric
+	for _, name := range slices.Sorted(maps.Keys(byName)) {
+		metrics = append(metrics, metric{Name: name, Gauge: gauge{DataPoints: byName[name]}})
+	}
+	body, marshalErr := json.Marshal(exportRequest{ResourceMetrics: []resourceMetrics{{
+		Resource:     resource{Attributes: []keyValue{{Key: "service.name", Value: anyValue{StringValue: "energy-meter-scraper"}}}},
+		ScopeMetrics: []scopeMetrics{{Scope: scope{Name: "energy-meter-scraper"}, Metrics: metrics}},
+	}}})
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	req, newReqErr := http.NewRequestWithContext(ctx, "POST", s.endpoint, bytes.NewReader(body))
+	if newReqErr != nil {
+		return newReqErr
+	}
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, postErr := s.client.Do(req)
+	if postErr != nil {
+		return postErr
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http status code %d: %s", resp.StatusCode, respBody)
+	}
+	var out exportResponse
+	if json.Unmarshal(respBody, &out) == nil {
+		if rejected := strings.Trim(string(out.PartialSuccess.RejectedDataPoints), `"`); rejected != "" && rejected != "0" {
+			return fmt.Errorf("collector rejected %s data points: %s", rejected, out.PartialSuccess.ErrorMessage)
+		}
+	}
+	return nil
+}
+
+func numeric(v any) (dataPoint, bool) {
+	switch v := v.(type) {
+	case float64:
+		return dataPoint{AsDouble: &v}, true
+	case float32:
+		f := float64(v)
+		return dataPoint{AsDouble: &f}, true
+	case int:
+		return dataPoint{AsInt: strconv.Itoa(v)}, true
+	case int64:
+		return dataPoint{AsInt: strconv.FormatInt(v, 10)}, true
+	case bool:
+		if v {
+			return dataPoint{AsInt: "1"}, true
+		}
+		return dataPoint{AsInt: "0"}, true
+	default:
+		return dataPoint{}, false
+	}
+}
+
+func (s *Sink) Close() error {
+	return nil
+}
@@ -0,0 +1,78 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	var path, apiKey string
+	var body exportRequest
+	response := `{}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, apiKey = r.URL.Path, r.Header.Get("api-key")
+		b, _ := io.ReadAll(r.Body)
+		body = exportRequest{}
+		_ = json.Unmarshal(b, &body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, response)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{IDs: map[string]map[string]string{"electricity": {"otlp": "house"}}}
+	cfg.Sinks.OTLP = config.OTLPConfig{Endpoint: server.URL + "/", Headers: map[string]string{"api-key": "secret"}}
+	s, newErr := New(cfg)
+	if newErr != nil {
+		t.Fatal(newErr)
+	}
+	defer s.Close()
+
+	at := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	usage := sink.Point{Measurement: "energy_usage", Tags: map[string]string{"resource": "electricity", "period": "30m"},
+		Fields: map[string]any{"kwh": 0.25, "band": "peak", "schemaVersion": int64(1)}, Time: at}
+	if err := s.Write(context.Background(), []sink.Point{
+		usage,
+		{Measurement: "heating_session", Tags: map[string]string{"resource": "gas"}, Fields: map[string]any{"minutes": int64(90), "ongoing": true}, Time: at},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/v1/metrics" || apiKey != "secret" {
+		t.Errorf("exported to %s with api-key %q", path, apiKey)
+	}
+
+	metrics := body.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	names := []string{}
+	for _, m := range metrics {
+		names = append(names, m.Name)
+	}
+	if len(metrics) != 3 || names[0] != "energy_usage.kwh" || names[1] != "heating_session.minutes" || names[2] != "heating_session.ongoing" {
+		t.Fatalf("exported %v", names)
+	}
+	kwh := metrics[0].Gauge.DataPoints[0]
+	if kwh.AsDouble == nil || *kwh.AsDouble != 0.25 || kwh.TimeUnixNano != "1717200000000000000" {
+		t.Errorf("kwh data point %+v", kwh)
+	}
+	attributes := map[string]string{}
+	for _, kv := range kwh.Attributes {
+		attributes[kv.Key] = kv.Value.StringValue
+	}
+	if len(attributes) != 3 || attributes["resource"] != "house" || attributes["band"] != "peak" || attributes["period"] != "30m" {
+		t.Errorf("kwh attributes %v", attributes)
+	}
+	if minutes := metrics[1].Gauge.DataPoints[0]; minutes.AsInt != "90" {
+		t.Errorf("minutes data point %+v", minutes)
+	}
+
+	// A partial success is a failed write, so that it is retried
+	response = `{"partialSuccess":{"rejectedDataPoints":"1","errorMessage":"out of order"}}`
+	if err := s.Write(context.Background(), []sink.Point{usage}); err == nil {
+		t.Error("no error for rejected data points")
+	}
+}
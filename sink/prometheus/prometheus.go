@@ -0,0 +1,203 @@
+package prometheus
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/metrics"
+	"energy-meter-scraper/sink"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	sink.Register("prometheus", New)
+}
+
+// gauge is a series served for each resource, set from a field of the
+// points written.
+type gauge struct {
+	name, help         string
+	measurements       []string
+	field              string
+	slotTime, halfHour bool
+}
+
+var gauges = []gauge{
+	{name: "energy_usage_kwh", help: "Energy used in the latest half hour slot.", measurements: usageMeasurements, field: "kwh", halfHour: true},
+	{name: "energy_usage_pence", help: "Cost of the latest half hour slot, in pence.", measurements: usageMeasurements, field: "pence", halfHour: true},
+	{name: "energy_usage_slot_timestamp_seconds", help: "Start of the latest half hour slot.", measurements: usageMeasurements, field: "kwh", halfHour: true, slotTime: true},
+	{name: "energy_tariff_rate_pence_per_kwh", help: "Current unit rate.", measurements: []string{"energy_tariff"}, field: "rate"},
+	{name: "energy_tariff_standing_charge_pence_per_day", help: "Current standing charge.", measurements: []string{"energy_tariff"}, field: "standingCharge"},
+}
+
+// The latest slot is often provisional, where that is enabled
+var usageMeasurements = []string{"energy_usage", "energy_usage_provisional"}
+
+type sample struct {
+	value float64
+	time  time.Time
+}
+
+// Sink serves the latest value of each gauge for each resource. Points
+// older than the value served, e.g. from a recheck, are ignored.
+type Sink struct {
+	listen string
+	ids    sink.IDs
+
+	mu sync.Mutex
+	// latest is by gauge, then resource ID.
+	latest map[string]map[string]sample
+}
+
+// server serves whichever sink is current for its address. It outlives a
+// reload, so that the replacement sink can take over the address while the
+// one it replaces finishes writing.
+type server struct {
+	http    *http.Server
+	current atomic.Pointer[Sink]
+}
+
+var (
+	serversMu sync.Mutex
+	// servers are by listen address.
+	servers = map[string]*server{}
+)
+
+func New(cfg *config.Config) (sink.Sink, error) {
+	listen := cfg.Sinks.Prometheus.Listen
+	if listen == "" {
+		return nil, nil
+	}
+	s := newSink(sink.NewIDs(cfg, "prometheus"))
+	s.listen = listen
+
+	serversMu.Lock()
+	defer serversMu.Unlock()
+	if srv, ok := servers[listen]; ok {
+		// Until the next write the values are the replaced sink's
+		prev := srv.current.Load()
+		prev.mu.Lock()
+		for name, samples := range prev.latest {
+			s.latest[name] = maps.Clone(samples)
+		}
+		prev.mu.Unlock()
+		srv.current.Store(s)
+		return s, nil
+	}
+
+	ln, listenErr := net.Listen("tcp", listen)
+	if listenErr != nil {
+		return nil, listenErr
+	}
+	srv := &server{}
+	srv.current.Store(s)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		srv.current.Load().ServeHTTP(w, r)
+	})
+	srv.http = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	servers[listen] = srv
+	go func() {
+		if err := srv.http.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("prometheus exporter stopped", "error", err)
+		}
+	}()
+	return s, nil
+}
+
+func newSink(ids sink.IDs) *Sink {
+	return &Sink{ids: ids, latest: map[string]map[string]sample{}}
+}
+
+func (s *Sink) Name() string {
+	return "prometheus"
+}
+
+func (s *Sink) Write(_ context.Context, points []sink.Point) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range points {
+		resource, ok := p.Tags["resource"]
+		if !ok {
+			continue
+		}
+		for _, g := range gauges {
+			if !slices.Contains(g.measurements, p.Measurement) || (g.halfHour && p.Tags["period"] != "30m") {
+				continue
+			}
+			v, ok := p.Fields[g.field].(float64)
+			if !ok {
+				continue
+			}
+			if g.slotTime {
+				v = float64(p.Time.Unix())
+			}
+
+			id := s.ids.ID(resource)
+			if s.latest[g.name] == nil {
+				s.latest[g.name] = map[string]sample{}
+			}
+			if prev, ok := s.latest[g.name][id]; ok && p.Time.Before(prev.time) {
+				continue
+			}
+			s.latest[g.name][id] = sample{value: v, time: p.Time}
+		}
+	}
+	return nil
+}
+
+// ServeHTTP writes the gauges in the Prometheus text format, followed by the
+// scraper's own metrics.
+func (s *Sink) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.writeText(w)
+	_ = metrics.WriteText(w)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (s *Sink) writeText(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, g := range gauges {
+		samples := s.latest[g.name]
+		if len(samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		ids := make([]string, 0, len(samples))
+		for id := range samples {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+		for _, id := range ids {
+			fmt.Fprintf(w, "%s{resource=\"%s\"} %s\n", g.name, labelEscaper.Replace(id),
+				strconv.FormatFloat(samples[id].value, 'f', -1, 64))
+		}
+	}
+}
+
+// Close stops serving, unless a replacement sink has taken over the address.
+func (s *Sink) Close() error {
+	serversMu.Lock()
+	defer serversMu.Unlock()
+	srv, ok := servers[s.listen]
+	if !ok || srv.current.Load() != s {
+		return nil
+	}
+	delete(servers, s.listen)
+	return srv.http.Close()
+}
@@ -0,0 +1,97 @@
+package prometheus
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/metrics"
+	"energy-meter-scraper/sink"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCycles is registered once, as a metric can't be registered again when
+// tests run with -count.
+var testCycles = metrics.NewCounter("test_prometheus_cycles_total", "Cycles.")
+
+func TestWriteServesLatest(t *testing.T) {
+	s := newSink(sink.NewIDs(&config.Config{IDs: map[string]map[string]string{"gas": {"prometheus": "house_gas"}}}, "prometheus"))
+	at := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	usage := func(resource string, at time.Time, kwh float64) sink.Point {
+		return sink.Point{
+			Measurement: "energy_usage",
+			Tags:        map[string]string{"resource": resource, "period": "30m"},
+			Fields:      map[string]any{"kwh": kwh, "pence": kwh * 30},
+			Time:        at,
+		}
+	}
+	if err := s.Write(context.Background(), []sink.Point{
+		usage("electricity", at.Add(30*time.Minute), 0.5),
+		usage("electricity", at, 0.25),
+		usage("gas", at, 1.5),
+		{Measurement: "energy_usage", Tags: map[string]string{"resource": "electricity", "period": "1d"}, Fields: map[string]any{"kwh": 12.0}, Time: at.Add(time.Hour)},
+		{Measurement: "energy_tariff", Tags: map[string]string{"resource": "electricity"}, Fields: map[string]any{"rate": 24.5, "standingCharge": 53.2}, Time: at},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	testCycles.Set(1)
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("content type %q", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE energy_usage_kwh gauge\n",
+		`energy_usage_kwh{resource="electricity"} 0.5` + "\n",
+		`energy_usage_kwh{resource="house_gas"} 1.5` + "\n",
+		`energy_usage_pence{resource="electricity"} 15` + "\n",
+		`energy_usage_slot_timestamp_seconds{resource="electricity"} 1704105000` + "\n",
+		`energy_tariff_rate_pence_per_kwh{resource="electricity"} 24.5` + "\n",
+		`energy_tariff_standing_charge_pence_per_day{resource="electricity"} 53.2` + "\n",
+		"# TYPE test_prometheus_cycles_total counter\ntest_prometheus_cycles_total 1\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+}
+
+func TestReplacementTakesOverAddress(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Sinks.Prometheus.Listen = "127.0.0.1:0"
+	first, firstErr := New(cfg)
+	if firstErr != nil {
+		t.Fatal(firstErr)
+	}
+	at := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	if err := first.Write(context.Background(), []sink.Point{
+		{Measurement: "energy_tariff", Tags: map[string]string{"resource": "electricity"}, Fields: map[string]any{"rate": 24.5}, Time: at},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// As on a reload, the replacement opens before the first closes
+	second, secondErr := New(cfg)
+	if secondErr != nil {
+		t.Fatal(secondErr)
+	}
+	_ = first.Close()
+	if _, ok := servers[cfg.Sinks.Prometheus.Listen]; !ok {
+		t.Fatal("closing the replaced sink stopped the server")
+	}
+
+	var b strings.Builder
+	second.(*Sink).writeText(&b)
+	if !strings.Contains(b.String(), "energy_tariff_rate_pence_per_kwh") {
+		t.Errorf("replacement lost the replaced sink's values:\n%s", b.String())
+	}
+
+	_ = second.Close()
+	if _, ok := servers[cfg.Sinks.Prometheus.Listen]; ok {
+		t.Error("server still running after closing the current sink")
+	}
+}
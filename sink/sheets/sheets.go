@@ -0,0 +1,285 @@
+package sheets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/googleauth"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/slot"
+	"energy-meter-scraper/transport"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+func init() {
+	sink.Register("sheets", New)
+}
+
+// apiBase is the Sheets API, replaced in tests.
+var apiBase = "https://sheets.googleapis.com"
+
+// header is the first row of an empty sheet.
+var header = []any{"Date", "Resource", "kWh", "Usage cost (£)", "Standing charge (£)", "Total (£)"}
+
+// Sink appends a row for each resource's complete days, once the whole day
+// has been read, totalling its half hour slots and adding the latest
+// standing charge. Days already in the sheet, found by their date and
+// resource, aren't appended again, so rows can be edited or sorted freely
+// but shouldn't have those two columns changed. A day with slots missing,
+// such as one that began before the first reading, is left out rather than
+// appended short.
+type Sink struct {
+	client  *http.Client
+	account *googleauth.ServiceAccount
+	values  string
+	sheet   string
+	ids     sink.IDs
+	stamps  slot.Policy
+	loc     *time.Location
+
+	mu sync.Mutex
+	// rows are the days in the sheet, by date and then resource ID, read
+	// before the first append. It is nil until then.
+	rows map[string]map[string]bool
+	// standing is each resource's latest standing charge, in pence per day.
+	standing map[string]float64
+}
+
+func New(cfg *config.Config) (sink.Sink, error) {
+	sheetsCfg := cfg.Sinks.Sheets
+	if sheetsCfg.SpreadsheetID == "" {
+		return nil, nil
+	}
+
+	httpClient, httpErr := transport.NewClient(sheetsCfg.HTTP, cfg.Network)
+	if httpErr != nil {
+		return nil, fmt.Errorf("http config: %w", httpErr)
+	}
+	account, accountErr := googleauth.Load(httpClient, sheetsCfg.CredentialsFile, "https://www.googleapis.com/auth/spreadsheets")
+	if accountErr != nil {
+		return nil, fmt.Errorf("credentials: %w", accountErr)
+	}
+	loc, locErr := time.LoadLocation(cfg.Timezone)
+	if locErr != nil {
+		return nil, locErr
+	}
+	align, alignErr := slot.ParseAlignment(cfg.Scrape.SlotAlign)
+	if alignErr != nil {
+		return nil, alignErr
+	}
+
+	return &Sink{
+		client:   httpClient,
+		account:  account,
+		values:   apiBase + "/v4/spreadsheets/" + url.PathEscape(sheetsCfg.SpreadsheetID) + "/values/",
+		sheet:    sheetsCfg.Sheet,
+		ids:      sink.NewIDs(cfg, "sheets"),
+		stamps:   slot.Policy{Align: align},
+		loc:      loc,
+		standing: map[string]float64{},
+	}, nil
+}
+
+func (s *Sink) Name() string {
+	return "sheets"
+}
+
+// day is a resource's slots on one day.
+type day struct {
+	date     time.Time
+	resource string
+	slots    map[int64]sink.Point
+}
+
+func (s *Sink) Write(ctx context.Context, points []sink.Point) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	days := map[string]*day{}
+	for _, p := range points {
+		resource, ok := p.Tags["resource"]
+		if !ok {
+			continue
+		}
+		switch {
+		case p.Measurement == "energy_tariff":
+			if standing, ok := p.Fields["standingCharge"].(float64); ok {
+				s.standing[resource] = standing
+			}
+		case p.Measurement == "energy_usage" && p.Tags["period"] == "30m":
+			start := s.stamps.Start(p.Time, 30*time.Minute).In(s.loc)
+			date := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, s.loc)
+			key := resource + "/" + date.Format(time.DateOnly)
+			if days[key] == nil {
+				days[key] = &day{date: date, resource: resource, slots: map[int64]sink.Point{}}
+			}
+			days[key].slots[start.Unix()] = p
+		}
+	}
+
+	var complete []*day
+	for _, key := range slices.Sorted(maps.Keys(days)) {
+		d := days[key]
+		if len(d.slots) == int(d.date.AddDate(0, 0, 1).Sub(d.date)/(30*time.Minute)) {
+			complete = append(complete, d)
+		}
+	}
+	if len(complete) == 0 {
+		return nil
+	}
+
+	// The sheet is read again after a failed append, which may have landed
+	rows, empty := s.rows, false
+	if rows == nil {
+		var readErr error
+		if rows, readErr = s.readRows(ctx); readErr != nil {
+			return fmt.Errorf("read sheet: %w", readErr)
+		}
+		empty = len(rows) == 0
+	}
+
+	slices.SortFunc(complete, func(a, b *day) int { return a.date.Compare(b.date) })
+	var values [][]any
+	if empty {
+		values = append(values, header)
+	}
+	var appended []*day
+	for _, d := range complete {
+		id := s.ids.ID(d.resource)
+		if rows[d.date.Format(time.DateOnly)][id] {
+			continue
+		}
+		var kwh, pence float64
+		for _, p := range d.slots {
+			k, _ := p.Fields["kwh"].(float64)
+			c, _ := p.Fields["pence"].(float64)
+			kwh += k
+			pence += c
+		}
+		row := []any{d.date.Format(time.DateOnly), id, math.Round(kwh*1000) / 1000, pounds(pence)}
+		if standing, ok := s.standing[d.resource]; ok {
+			row = append(row, pounds(standing), pounds(pence+standing))
+		} else {
+			row = append(row, "", pounds(pence))
+		}
+		values = append(values, row)
+		appended = append(appended, d)
+	}
+	if len(appended) == 0 {
+		s.rows = rows
+		return nil
+	}
+
+	if err := s.append(ctx, values); err != nil {
+		return err
+	}
+	for _, d := range appended {
+		date := d.date.Format(time.DateOnly)
+		if rows[date] == nil {
+			rows[date] = map[string]bool{}
+		}
+		rows[date][s.ids.ID(d.resource)] = true
+	}
+	s.rows = rows
+	return nil
+}
+
+// pounds is pence in pounds, to the penny.
+func pounds(pence float64) float64 {
+	return math.Round(pence) / 100
+}
+
+// sheetsEpoch is day zero of a spreadsheet's date serial numbers.
+var sheetsEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// readRows returns the dates and resources in the sheet's first two
+// columns. Dates are read as serial numbers, as the cell's format decides
+// how they are shown, or as text if the cell isn't a date.
+func (s *Sink) readRows(ctx context.Context) (map[string]map[string]bool, error) {
+	query := url.Values{"majorDimension": {"ROWS"}, "valueRenderOption": {"UNFORMATTED_VALUE"}, "dateTimeRenderOption": {"SERIAL_NUMBER"}}
+	var out struct {
+		Values [][]any `json:"values"`
+	}
+	if err := s.do(ctx, "GET", s.values+url.PathEscape(s.rangeOf("A:B"))+"?"+query.Encode(), nil, &out); err != nil {
+		return nil, err
+	}
+
+	rows := map[string]map[string]bool{}
+	for _, row := range out.Values {
+		if len(row) < 2 {
+			continue
+		}
+		var date string
+		switch v := row[0].(type) {
+		case float64:
+			date = sheetsEpoch.AddDate(0, 0, int(v)).Format(time.DateOnly)
+		case string:
+			date = v
+		}
+		resource, _ := row[1].(string)
+		if rows[date] == nil {
+			rows[date] = map[string]bool{}
+		}
+		rows[date][resource] = true
+	}
+	return rows, nil
+}
+
+// append adds rows after the last in the sheet, entered as if typed so that
+// dates and numbers are recognised.
+func (s *Sink) append(ctx context.Context, rows [][]any) error {
+	query := url.Values{"valueInputOption": {"USER_ENTERED"}, "insertDataOption": {"INSERT_ROWS"}}
+	body, marshalErr := json.Marshal(map[string]any{"majorDimension": "ROWS", "values": rows})
+	if marshalErr != nil {
+		return marshalErr
+	}
+	return s.do(ctx, "POST", s.values+url.PathEscape(s.rangeOf("A1"))+":append?"+query.Encode(), body, nil)
+}
+
+// rangeOf is cells, e.g. A:B, of the sheet in A1 notation.
+func (s *Sink) rangeOf(cells string) string {
+	return "'" + s.sheet + "'!" + cells
+}
+
+func (s *Sink) do(ctx context.Context, method, target string, body []byte, out any) error {
+	token, tokenErr := s.account.Token(ctx)
+	if tokenErr != nil {
+		return tokenErr
+	}
+	req, newReqErr := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if newReqErr != nil {
+		return newReqErr
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, doErr := s.client.Do(req)
+	if doErr != nil {
+		return doErr
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http status code %d: %s", resp.StatusCode, respBody)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+func (s *Sink) Close() error {
+	return nil
+}
@@ -0,0 +1,107 @@
+package sheets
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	var tokens int
+	existing := [][]any{{"Date", "Resource"}}
+	var appended [][]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			_ = r.ParseForm()
+			if r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || strings.Count(r.Form.Get("assertion"), ".") != 2 {
+				http.Error(w, "bad grant", http.StatusBadRequest)
+				return
+			}
+			tokens++
+			_, _ = io.WriteString(w, `{"access_token":"token","expires_in":3600}`)
+		case r.Header.Get("Authorization") != "Bearer token":
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		case r.Method == "GET" && r.URL.Path == "/v4/spreadsheets/sheet-id/values/'Daily'!A:B":
+			_ = json.NewEncoder(w).Encode(map[string]any{"values": existing})
+		case r.Method == "POST" && r.URL.Path == "/v4/spreadsheets/sheet-id/values/'Daily'!A1:append":
+			var body struct {
+				Values [][]any `json:"values"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			appended = append(appended, body.Values...)
+			_, _ = io.WriteString(w, `{}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	apiBase = server.URL
+
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	credentials, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "scraper@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    server.URL + "/token",
+	})
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(path, credentials, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{Timezone: "Europe/London", IDs: map[string]map[string]string{"electricity": {"sheets": "Electricity"}}}
+	cfg.Scrape.SlotAlign = "end"
+	cfg.Sinks.Sheets = config.SheetsConfig{SpreadsheetID: "sheet-id", Sheet: "Daily", CredentialsFile: path}
+	s, newErr := New(cfg)
+	if newErr != nil {
+		t.Fatal(newErr)
+	}
+	defer s.Close()
+
+	// Two whole days, the first of which is already in the sheet, and the
+	// start of a third, stamped at the end of each slot
+	loc, _ := time.LoadLocation("Europe/London")
+	first := time.Date(2024, 3, 30, 0, 0, 0, 0, loc)
+	existing = append(existing, []any{time.Date(2024, 3, 30, 0, 0, 0, 0, time.UTC).Sub(sheetsEpoch).Hours() / 24, "Electricity"})
+	points := []sink.Point{{Measurement: "energy_tariff", Tags: map[string]string{"resource": "electricity"},
+		Fields: map[string]any{"rate": 24.5, "standingCharge": 60.1}, Time: first}}
+	for start := first; start.Before(first.AddDate(0, 0, 2).Add(2 * time.Hour)); start = start.Add(30 * time.Minute) {
+		points = append(points, sink.Point{Measurement: "energy_usage", Tags: map[string]string{"resource": "electricity", "period": "30m"},
+			Fields: map[string]any{"kwh": 0.5, "pence": 12.25}, Time: start.Add(30 * time.Minute)})
+	}
+	for range 2 {
+		if err := s.Write(context.Background(), points); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The second day is when the clocks go forward, with 46 slots
+	if len(appended) != 1 {
+		t.Fatalf("appended %v, want the 31st only, once", appended)
+	}
+	want := []any{"2024-03-31", "Electricity", 23.0, 5.64, 0.6, 6.24}
+	for i, v := range want {
+		if appended[0][i] != v {
+			t.Errorf("row %v, want %v", appended[0], want)
+			break
+		}
+	}
+	if tokens != 1 {
+		t.Errorf("fetched %d tokens, want 1", tokens)
+	}
+}
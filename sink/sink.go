@@ -0,0 +1,162 @@
+package sink
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]any
+	Time        time.Time
+}
+
+type Sink interface {
+	Name() string
+	Write(ctx context.Context, points []Point) error
+	Close() error
+}
+
+// Shifter is implemented by sinks that can move points they already store,
+// used to migrate between slot alignments.
+type Shifter interface {
+	Sink
+	// ShiftPoints moves every point of measurement matching tags with a
+	// timestamp in [start, stop) by the given offset, and returns how many
+	// were (or with dryRun, would be) moved.
+	ShiftPoints(ctx context.Context, measurement string, tags map[string]string, start, stop time.Time, by time.Duration, dryRun bool) (int, error)
+}
+
+// Deleter is implemented by sinks that can remove points they store, used to
+// clear a bad window before writing it again.
+type Deleter interface {
+	Sink
+	// DeletePoints removes every point of measurement matching tags with a
+	// timestamp in [start, stop), and returns how many were (or with dryRun,
+	// would be) removed.
+	DeletePoints(ctx context.Context, measurement string, tags map[string]string, start, stop time.Time, dryRun bool) (int, error)
+}
+
+// Reader is implemented by sinks that can return the points they store.
+type Reader interface {
+	Sink
+	// ReadPoints returns points of measurement matching tags with a
+	// timestamp in [start, stop).
+	ReadPoints(ctx context.Context, measurement string, tags map[string]string, start, stop time.Time) ([]Point, error)
+}
+
+// LastTimer is implemented by sinks that can cheaply find their newest point,
+// used to skip writing points a sink already has.
+type LastTimer interface {
+	Sink
+	// LastTime returns the timestamp of the newest point of measurement
+	// matching tags in [start, stop), and false if there is none.
+	LastTime(ctx context.Context, measurement string, tags map[string]string, start, stop time.Time) (time.Time, bool, error)
+}
+
+// Summer is implemented by sinks that can total what they store, used to
+// check written points against Glow's own daily figures.
+type Summer interface {
+	Sink
+	// SumField totals field over points of measurement matching tags with a
+	// timestamp in [start, stop), and returns the total and number of points.
+	SumField(ctx context.Context, measurement, field string, tags map[string]string, start, stop time.Time) (float64, int, error)
+}
+
+// Factory opens a sink from config. It returns a nil Sink if the sink is not
+// configured.
+type Factory func(cfg *config.Config) (Sink, error)
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a sink available. Sinks register themselves from init so
+// that leaving a sink out of the build (see features.go) removes it entirely.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic("sink registered twice: " + name)
+	}
+	registry[name] = factory
+}
+
+// Available lists the sinks compiled into this binary.
+func Available() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// OpenAll opens every compiled-in sink that is configured.
+func OpenAll(cfg *config.Config) ([]Sink, error) {
+	var sinks []Sink
+	for _, name := range Available() {
+		registryMu.Lock()
+		factory := registry[name]
+		registryMu.Unlock()
+
+		s, openErr := factory(cfg)
+		if openErr != nil {
+			for _, opened := range sinks {
+				_ = opened.Close()
+			}
+			return nil, fmt.Errorf("open sink %s: %w", name, openErr)
+		}
+		if s != nil {
+			sinks = append(sinks, s)
+		}
+	}
+	return sinks, nil
+}
+
+// openedWith is the config that sinks read when they are opened. A sink
+// that reads more of it in its Factory must add that here, or a reload
+// won't reopen it.
+type openedWith struct {
+	Sinks    config.SinksConfig
+	Network  config.NetworkConfig
+	IDs      map[string]map[string]string
+	Lookback time.Duration
+	// Precision is what Influx timestamps are sent at
+	Precision time.Duration
+	// Timezone and SlotAlign decide the days the sheets sink totals
+	Timezone  string
+	SlotAlign string
+	// Resources name the MQTT topics and Home Assistant entities
+	Resources []config.Resource
+}
+
+func openedWithOf(cfg *config.Config) openedWith {
+	return openedWith{
+		Sinks:     cfg.Sinks,
+		Network:   cfg.Network,
+		IDs:       cfg.IDs,
+		Lookback:  cfg.Scrape.Lookback,
+		Precision: cfg.Scrape.TimestampPrecision,
+		Timezone:  cfg.Timezone,
+		SlotAlign: cfg.Scrape.SlotAlign,
+		Resources: cfg.Resources,
+	}
+}
+
+// Changed reports whether sinks opened with prev have to be reopened for
+// cfg, as part of the config they read when opened differs.
+func Changed(prev, cfg *config.Config) bool {
+	return !reflect.DeepEqual(openedWithOf(prev), openedWithOf(cfg))
+}
@@ -0,0 +1,42 @@
+package sink
+
+import (
+	"energy-meter-scraper/config"
+	"testing"
+	"time"
+)
+
+func TestChanged(t *testing.T) {
+	prev := &config.Config{IDs: map[string]map[string]string{"gas": {"mqtt": "boiler"}}}
+	prev.Sinks.MQTT.Broker = "tcp://mqtt:1883"
+
+	same := *prev
+	same.LogLevel = "debug"
+	if Changed(prev, &same) {
+		t.Error("changing the log level reopens sinks")
+	}
+
+	ids := *prev
+	ids.IDs = map[string]map[string]string{"gas": {"mqtt": "gas_meter"}}
+	if !Changed(prev, &ids) {
+		t.Error("changing IDs doesn't reopen sinks")
+	}
+
+	precision := *prev
+	precision.Scrape.TimestampPrecision = time.Millisecond
+	if !Changed(prev, &precision) {
+		t.Error("changing the timestamp precision doesn't reopen sinks")
+	}
+
+	tz := *prev
+	tz.Timezone = "Europe/London"
+	if !Changed(prev, &tz) {
+		t.Error("changing the timezone doesn't reopen sinks")
+	}
+
+	added := *prev
+	added.Resources = []config.Resource{{Name: "gas"}}
+	if !Changed(prev, &added) {
+		t.Error("adding a resource doesn't reopen sinks")
+	}
+}
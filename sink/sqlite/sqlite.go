@@ -0,0 +1,274 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"fmt"
+	"math"
+	_ "modernc.org/sqlite"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	sink.Register("sqlite", New)
+}
+
+// schema keeps every point in one table, keyed like an influx series, with
+// tags and fields as JSON objects and time in Unix seconds. The usage view
+// is the half hour slots most queries want.
+const schema = `
+CREATE TABLE IF NOT EXISTS points (
+	measurement TEXT NOT NULL,
+	tags TEXT NOT NULL,
+	time INTEGER NOT NULL,
+	fields TEXT NOT NULL,
+	PRIMARY KEY (measurement, tags, time)
+) WITHOUT ROWID;
+
+CREATE VIEW IF NOT EXISTS usage AS
+SELECT
+	json_extract(tags, '$.resource') AS resource,
+	time,
+	json_extract(fields, '$.kwh') AS kwh,
+	json_extract(fields, '$.pence') AS pence
+FROM points
+WHERE measurement = 'energy_usage' AND json_extract(tags, '$.period') = '30m';
+`
+
+// Sink writes to a SQLite database file. Writing a point that is already
+// stored merges its fields into the stored ones, as influx does.
+type Sink struct {
+	db  *sql.DB
+	ids sink.IDs
+}
+
+func New(cfg *config.Config) (sink.Sink, error) {
+	path := cfg.Sinks.SQLite.Path
+	if path == "" {
+		return nil, nil
+	}
+
+	// WAL lets the database be read while the scraper writes, and survives
+	// power loss on an SD card better than the default journal. The wait
+	// covers a replaced sink still writing after a reload.
+	dsn := "file:" + path + "?" + url.Values{"_pragma": {
+		"journal_mode(WAL)",
+		"synchronous(NORMAL)",
+		"busy_timeout(10000)",
+	}}.Encode()
+	db, openErr := sql.Open("sqlite", dsn)
+	if openErr != nil {
+		return nil, openErr
+	}
+	// SQLite has one writer at a time anyway, and one connection avoids
+	// waiting on the lock within the process
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("create schema in %s: %w", path, err)
+	}
+
+	return &Sink{db: db, ids: sink.NewIDs(cfg, "sqlite")}, nil
+}
+
+func (s *Sink) Name() string {
+	return "sqlite"
+}
+
+func (s *Sink) Write(ctx context.Context, points []sink.Point) error {
+	tx, txErr := s.db.BeginTx(ctx, nil)
+	if txErr != nil {
+		return txErr
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, prepareErr := tx.PrepareContext(ctx, `
+INSERT INTO points (measurement, tags, time, fields) VALUES (?, ?, ?, ?)
+ON CONFLICT (measurement, tags, time) DO UPDATE SET fields = json_patch(fields, excluded.fields)`)
+	if prepareErr != nil {
+		return prepareErr
+	}
+	defer stmt.Close()
+
+	for _, p := range points {
+		tags, _ := json.Marshal(s.ids.Tags(p.Tags))
+		fields, fieldsErr := encodeFields(p.Fields)
+		if fieldsErr != nil {
+			return fmt.Errorf("%s at %s: %w", p.Measurement, p.Time.Format(time.RFC3339), fieldsErr)
+		}
+		if _, err := stmt.ExecContext(ctx, p.Measurement, string(tags), p.Time.Unix(), fields); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// encodeFields returns fields as a JSON object, writing floats with a
+// decimal point so that they are read back as floats rather than integers.
+func encodeFields(fields map[string]any) (string, error) {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		b.Write(key)
+		b.WriteByte(':')
+
+		switch v := fields[k].(type) {
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return "", fmt.Errorf("field %s is %v", k, v)
+			}
+			f := strconv.FormatFloat(v, 'g', -1, 64)
+			if !strings.ContainsAny(f, ".e") {
+				f += ".0"
+			}
+			b.WriteString(f)
+		default:
+			value, marshalErr := json.Marshal(v)
+			if marshalErr != nil {
+				return "", fmt.Errorf("field %s: %w", k, marshalErr)
+			}
+			b.Write(value)
+		}
+	}
+	b.WriteByte('}')
+	return b.String(), nil
+}
+
+// decodeFields undoes encodeFields.
+func decodeFields(fields string) (map[string]any, error) {
+	dec := json.NewDecoder(strings.NewReader(fields))
+	dec.UseNumber()
+	var raw map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	for k, v := range raw {
+		n, ok := v.(json.Number)
+		if !ok {
+			continue
+		}
+		if strings.ContainsAny(n.String(), ".eE") {
+			raw[k], _ = n.Float64()
+		} else {
+			raw[k], _ = n.Int64()
+		}
+	}
+	return raw, nil
+}
+
+// where selects measurement points matching tags in [start, stop).
+func (s *Sink) where(measurement string, tags map[string]string, start, stop time.Time) (string, []any) {
+	tags = s.ids.Tags(tags)
+	clauses := []string{"measurement = ?", "time >= ?", "time < ?"}
+	args := []any{measurement, start.Unix(), stop.Unix()}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		clauses = append(clauses, "json_extract(tags, '$.' || json_quote(?)) = ?")
+		args = append(args, k, tags[k])
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
+
+func (s *Sink) ReadPoints(ctx context.Context, measurement string, tags map[string]string, start, stop time.Time) ([]sink.Point, error) {
+	where, args := s.where(measurement, tags, start, stop)
+	rows, queryErr := s.db.QueryContext(ctx, "SELECT tags, time, fields FROM points"+where+" ORDER BY time", args...)
+	if queryErr != nil {
+		return nil, queryErr
+	}
+	defer rows.Close()
+
+	var points []sink.Point
+	for rows.Next() {
+		var rawTags, rawFields string
+		var unix int64
+		if err := rows.Scan(&rawTags, &unix, &rawFields); err != nil {
+			return nil, err
+		}
+		p := sink.Point{Measurement: measurement, Time: time.Unix(unix, 0).UTC()}
+		if err := json.Unmarshal([]byte(rawTags), &p.Tags); err != nil {
+			return nil, fmt.Errorf("tags %s: %w", rawTags, err)
+		}
+		p.Tags = s.ids.ResourceTags(p.Tags)
+		var fieldsErr error
+		if p.Fields, fieldsErr = decodeFields(rawFields); fieldsErr != nil {
+			return nil, fmt.Errorf("fields %s: %w", rawFields, fieldsErr)
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+func (s *Sink) LastTime(ctx context.Context, measurement string, tags map[string]string, start, stop time.Time) (time.Time, bool, error) {
+	where, args := s.where(measurement, tags, start, stop)
+	var last sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, "SELECT max(time) FROM points"+where, args...).Scan(&last); err != nil {
+		return time.Time{}, false, err
+	}
+	if !last.Valid {
+		return time.Time{}, false, nil
+	}
+	return time.Unix(last.Int64, 0).UTC(), true, nil
+}
+
+func (s *Sink) SumField(ctx context.Context, measurement, field string, tags map[string]string, start, stop time.Time) (float64, int, error) {
+	where, args := s.where(measurement, tags, start, stop)
+	value := "json_extract(fields, '$.' || json_quote(?))"
+	var total float64
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT total("+value+"), count("+value+") FROM points"+where,
+		append([]any{field, field}, args...)...).Scan(&total, &n)
+	return total, n, err
+}
+
+func (s *Sink) DeletePoints(ctx context.Context, measurement string, tags map[string]string, start, stop time.Time, dryRun bool) (int, error) {
+	where, args := s.where(measurement, tags, start, stop)
+	tx, txErr := s.db.BeginTx(ctx, nil)
+	if txErr != nil {
+		return 0, txErr
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var n int
+	if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM points"+where, args...).Scan(&n); err != nil {
+		return 0, err
+	}
+	if dryRun || n == 0 {
+		return n, nil
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM points"+where, args...); err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+func (s *Sink) Close() error {
+	return s.db.Close()
+}
+
+var (
+	_ sink.Reader    = (*Sink)(nil)
+	_ sink.LastTimer = (*Sink)(nil)
+	_ sink.Summer    = (*Sink)(nil)
+	_ sink.Deleter   = (*Sink)(nil)
+)
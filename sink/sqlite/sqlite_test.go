@@ -0,0 +1,137 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func openSink(t *testing.T, path string) *Sink {
+	t.Helper()
+	cfg := &config.Config{IDs: map[string]map[string]string{"gas": {"sqlite": "house_gas"}}}
+	cfg.Sinks.SQLite.Path = path
+	s, openErr := New(cfg)
+	if openErr != nil {
+		t.Fatal(openErr)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s.(*Sink)
+}
+
+func TestWriteAndRead(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "energy.db")
+	s := openSink(t, path)
+	at := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	usage := func(resource string, at time.Time, kwh float64) sink.Point {
+		return sink.Point{
+			Measurement: "energy_usage",
+			Tags:        map[string]string{"resource": resource, "period": "30m"},
+			Fields:      map[string]any{"kwh": kwh, "pence": kwh * 30},
+			Time:        at,
+		}
+	}
+	if err := s.Write(ctx, []sink.Point{
+		usage("electricity", at, 0),
+		usage("electricity", at.Add(30*time.Minute), 0.5),
+		usage("gas", at, 1.5),
+		{Measurement: "scraper_health", Tags: map[string]string{}, Fields: map[string]any{"result": 0, "ok": true}, Time: at},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Rewriting a point merges its fields
+	if err := s.Write(ctx, []sink.Point{{
+		Measurement: "energy_usage",
+		Tags:        map[string]string{"resource": "electricity", "period": "30m"},
+		Fields:      map[string]any{"pence": 2.0},
+		Time:        at,
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, readErr := s.ReadPoints(ctx, "energy_usage", map[string]string{"resource": "electricity"}, at, at.Add(time.Hour))
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	want := []sink.Point{
+		{Measurement: "energy_usage", Tags: map[string]string{"resource": "electricity", "period": "30m"}, Fields: map[string]any{"kwh": 0.0, "pence": 2.0}, Time: at},
+		usage("electricity", at.Add(30*time.Minute), 0.5),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read %v, want %v", got, want)
+	}
+	health, healthErr := s.ReadPoints(ctx, "scraper_health", nil, at, at.Add(time.Second))
+	if healthErr != nil {
+		t.Fatal(healthErr)
+	}
+	if len(health) != 1 || !reflect.DeepEqual(health[0].Fields, map[string]any{"result": int64(0), "ok": true}) {
+		t.Errorf("health %v", health)
+	}
+
+	// Resources are stored under their IDs, and read back by name
+	gas, gasErr := s.ReadPoints(ctx, "energy_usage", map[string]string{"resource": "gas"}, at, at.Add(time.Hour))
+	if gasErr != nil || len(gas) != 1 || gas[0].Tags["resource"] != "gas" {
+		t.Errorf("gas %v, %v", gas, gasErr)
+	}
+	db, dbErr := sql.Open("sqlite", path)
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+	var resource string
+	var kwh float64
+	if err := db.QueryRow("SELECT resource, kwh FROM usage WHERE time = ? AND resource != 'electricity'", at.Unix()).Scan(&resource, &kwh); err != nil {
+		t.Fatal(err)
+	}
+	if resource != "house_gas" || kwh != 1.5 {
+		t.Errorf("usage view has %s %v, want house_gas 1.5", resource, kwh)
+	}
+
+	tags := map[string]string{"resource": "electricity", "period": "30m"}
+	last, ok, lastErr := s.LastTime(ctx, "energy_usage", tags, at, at.Add(24*time.Hour))
+	if lastErr != nil || !ok || !last.Equal(at.Add(30*time.Minute)) {
+		t.Errorf("last %v, %v, %v", last, ok, lastErr)
+	}
+	if _, ok, _ := s.LastTime(ctx, "energy_usage", tags, at.Add(time.Hour), at.Add(2*time.Hour)); ok {
+		t.Error("found a last time in an empty range")
+	}
+	total, n, sumErr := s.SumField(ctx, "energy_usage", "kwh", tags, at, at.Add(time.Hour))
+	if sumErr != nil || total != 0.5 || n != 2 {
+		t.Errorf("sum %v over %d points, %v", total, n, sumErr)
+	}
+
+	if n, err := s.DeletePoints(ctx, "energy_usage", tags, at, at.Add(time.Hour), true); err != nil || n != 2 {
+		t.Errorf("dry run deleted %d, %v", n, err)
+	}
+	if n, err := s.DeletePoints(ctx, "energy_usage", tags, at, at.Add(30*time.Minute), false); err != nil || n != 1 {
+		t.Errorf("deleted %d, %v", n, err)
+	}
+	if left, _ := s.ReadPoints(ctx, "energy_usage", tags, at, at.Add(time.Hour)); len(left) != 1 {
+		t.Errorf("%d points left, want 1", len(left))
+	}
+}
+
+func TestReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "energy.db")
+	at := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	point := sink.Point{Measurement: "energy_tariff", Tags: map[string]string{"resource": "electricity"}, Fields: map[string]any{"rate": 24.5}, Time: at}
+
+	first := openSink(t, path)
+	if err := first.Write(ctx, []sink.Point{point}); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, readErr := openSink(t, path).ReadPoints(ctx, "energy_tariff", nil, at, at.Add(time.Second))
+	if readErr != nil || len(got) != 1 || got[0].Fields["rate"] != 24.5 {
+		t.Errorf("after reopening read %v, %v", got, readErr)
+	}
+}
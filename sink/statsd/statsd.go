@@ -0,0 +1,254 @@
+package statsd
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/schema"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/transport"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	sink.Register("statsd", New)
+}
+
+// maxPacket is the most sent in one datagram, DogStatsD's recommended
+// payload size for a 1500 byte MTU.
+const maxPacket = 1432
+
+// counted are the measurements whose fields are usage, sent as counts as
+// each new slot arrives.
+var counted = []string{"energy_usage", "energy_export", "appliance_usage", "energy_usage_residual"}
+
+// gauged are the measurements whose fields are current values, sent as
+// gauges.
+var gauged = []string{"energy_tariff"}
+
+// counts are the latest slot counted for each series, by measurement and
+// tags. Every cycle rewrites the lookback, so only later slots are counted.
+// They outlive a sink, so that a reload doesn't count slots again.
+var counts = struct {
+	mu     sync.Mutex
+	latest map[string]time.Time
+}{latest: map[string]time.Time{}}
+
+// Sink counts usage and gauges the tariff over StatsD, as
+// prefix.measurement.field with the point's tags, which is the aggregation
+// StatsD does anyway. As StatsD has no timestamps, the first time a series
+// is seen only its latest slot is counted, rather than the whole lookback
+// at once.
+type Sink struct {
+	dial    func(ctx context.Context, network, addr string) (net.Conn, error)
+	address string
+	prefix  string
+	// tagged sends DogStatsD tags rather than putting tag values in the
+	// name.
+	tagged bool
+	ids    sink.IDs
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func New(cfg *config.Config) (sink.Sink, error) {
+	statsdCfg := cfg.Sinks.StatsD
+	if statsdCfg.Address == "" {
+		return nil, nil
+	}
+	return &Sink{
+		dial:    transport.Dialer(cfg.Network),
+		address: statsdCfg.Address,
+		prefix:  statsdCfg.Prefix,
+		tagged:  statsdCfg.Format == "dogstatsd",
+		ids:     sink.NewIDs(cfg, "statsd"),
+	}, nil
+}
+
+func (s *Sink) Name() string {
+	return "statsd"
+}
+
+func (s *Sink) Write(ctx context.Context, points []sink.Point) error {
+	var lines [][]byte
+	newest := map[string]time.Time{}
+
+	counts.mu.Lock()
+	latest := map[string]sink.Point{}
+	for _, p := range points {
+		switch {
+		case slices.Contains(gauged, p.Measurement):
+			lines = append(lines, s.lines(p, "g")...)
+		case slices.Contains(counted, p.Measurement):
+			key := series(p)
+			if prev, ok := latest[key]; !ok || p.Time.After(prev.Time) {
+				latest[key] = p
+			}
+			seen, ok := counts.latest[key]
+			if !ok || !p.Time.After(seen) {
+				continue
+			}
+			lines = append(lines, s.lines(p, "c")...)
+			if p.Time.After(newest[key]) {
+				newest[key] = p.Time
+			}
+		}
+	}
+	for key, p := range latest {
+		if _, ok := counts.latest[key]; !ok {
+			lines = append(lines, s.lines(p, "c")...)
+			newest[key] = p.Time
+		}
+	}
+	counts.mu.Unlock()
+	if len(lines) == 0 {
+		return nil
+	}
+
+	if err := s.send(ctx, lines); err != nil {
+		return err
+	}
+	counts.mu.Lock()
+	defer counts.mu.Unlock()
+	for key, t := range newest {
+		if t.After(counts.latest[key]) {
+			counts.latest[key] = t
+		}
+	}
+	return nil
+}
+
+// send writes lines in datagrams of as many whole lines as fit.
+func (s *Sink) send(ctx context.Context, lines [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		conn, dialErr := s.dial(ctx, "udp", s.address)
+		if dialErr != nil {
+			return dialErr
+		}
+		s.conn = conn
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(30 * time.Second)
+	}
+	_ = s.conn.SetWriteDeadline(deadline)
+
+	var packets [][]byte
+	var packet []byte
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+1+len(line) > maxPacket {
+			packets = append(packets, packet)
+			packet = nil
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	for _, packet := range append(packets, packet) {
+		if _, err := s.conn.Write(packet); err != nil {
+			_ = s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// series identifies the points of one measurement and set of tags.
+func series(p sink.Point) string {
+	key := p.Measurement
+	for _, k := range slices.Sorted(maps.Keys(p.Tags)) {
+		key += "," + k + "=" + p.Tags[k]
+	}
+	return key
+}
+
+// lines are p's numeric fields as metrics of type kind.
+func (s *Sink) lines(p sink.Point, kind string) [][]byte {
+	tags := s.ids.Tags(p.Tags)
+	var path []string
+	if s.prefix != "" {
+		path = append(path, s.prefix)
+	}
+	path = append(path, name(p.Measurement))
+	var suffix string
+	if s.tagged {
+		var pairs []string
+		for _, k := range slices.Sorted(maps.Keys(tags)) {
+			pairs = append(pairs, tagEscaper.Replace(k)+":"+tagEscaper.Replace(tags[k]))
+		}
+		if len(pairs) > 0 {
+			suffix = "|#" + strings.Join(pairs, ",")
+		}
+	} else {
+		if resource, ok := tags["resource"]; ok {
+			path = append(path, name(resource))
+		}
+		for _, k := range slices.Sorted(maps.Keys(tags)) {
+			if k != "resource" {
+				path = append(path, name(tags[k]))
+			}
+		}
+	}
+
+	var lines [][]byte
+	for _, field := range slices.Sorted(maps.Keys(p.Fields)) {
+		if field == schema.Field {
+			continue
+		}
+		value, ok := numeric(p.Fields[field])
+		if !ok {
+			continue
+		}
+		lines = append(lines, []byte(strings.Join(append(path, name(field)), ".")+":"+value+"|"+kind+suffix))
+	}
+	return lines
+}
+
+func numeric(v any) (string, bool) {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	default:
+		return "", false
+	}
+}
+
+var (
+	nameEscaper = strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", "#", "_", " ", "_", "\n", "_")
+	tagEscaper  = strings.NewReplacer(",", "_", "|", "_", ":", "_", " ", "_", "\n", "_")
+)
+
+// name makes s one element of a metric's name.
+func name(s string) string {
+	return nameEscaper.Replace(s)
+}
+
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,110 @@
+package statsd
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listen returns a UDP address and a func receiving the lines sent to it.
+func listen(t *testing.T) (string, func() []string) {
+	conn, listenErr := net.ListenPacket("udp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatal(listenErr)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn.LocalAddr().String(), func() []string {
+		var lines []string
+		buf := make([]byte, 65536)
+		for {
+			_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, _, readErr := conn.ReadFrom(buf)
+			if readErr != nil {
+				slices.Sort(lines)
+				return lines
+			}
+			lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+		}
+	}
+}
+
+func usage(resource string, at time.Time, kwh float64) sink.Point {
+	return sink.Point{Measurement: "energy_usage", Tags: map[string]string{"resource": resource, "period": "30m"},
+		Fields: map[string]any{"kwh": kwh, "band": "peak", "schemaVersion": int64(1)}, Time: at}
+}
+
+// resetCounts forgets the slots counted by earlier tests, or earlier runs
+// with -count, as counts outlive a sink.
+func resetCounts() {
+	counts.mu.Lock()
+	defer counts.mu.Unlock()
+	counts.latest = map[string]time.Time{}
+}
+
+func TestWriteCountsNewSlots(t *testing.T) {
+	resetCounts()
+	addr, received := listen(t)
+	cfg := &config.Config{IDs: map[string]map[string]string{"counted": {"statsd": "house"}}}
+	cfg.Sinks.StatsD = config.StatsDConfig{Address: addr, Prefix: "energy", Format: "dogstatsd"}
+	s, newErr := New(cfg)
+	if newErr != nil {
+		t.Fatal(newErr)
+	}
+	defer s.Close()
+	ctx := context.Background()
+	at := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	// Only the latest slot of the lookback is counted at first
+	if err := s.Write(ctx, []sink.Point{
+		usage("counted", at, 0.1),
+		usage("counted", at.Add(30*time.Minute), 0.2),
+		{Measurement: "energy_tariff", Tags: map[string]string{"resource": "counted"}, Fields: map[string]any{"rate": 24.5}, Time: at},
+		{Measurement: "energy_demand", Tags: map[string]string{"resource": "counted"}, Fields: map[string]any{"kw": 2.0}, Time: at},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"energy.energy_tariff.rate:24.5|g|#resource:house",
+		"energy.energy_usage.kwh:0.2|c|#period:30m,resource:house",
+	}
+	if got := received(); !slices.Equal(got, want) {
+		t.Errorf("first write sent %q, want %q", got, want)
+	}
+
+	// Then slots after it, however often the lookback is rewritten
+	if err := s.Write(ctx, []sink.Point{
+		usage("counted", at, 0.1),
+		usage("counted", at.Add(30*time.Minute), 0.2),
+		usage("counted", at.Add(time.Hour), 0.3),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"energy.energy_usage.kwh:0.3|c|#period:30m,resource:house"}
+	if got := received(); !slices.Equal(got, want) {
+		t.Errorf("second write sent %q, want %q", got, want)
+	}
+}
+
+func TestWriteUntagged(t *testing.T) {
+	addr, received := listen(t)
+	cfg := &config.Config{}
+	cfg.Sinks.StatsD = config.StatsDConfig{Address: addr, Prefix: "energy", Format: "statsd"}
+	s, newErr := New(cfg)
+	if newErr != nil {
+		t.Fatal(newErr)
+	}
+	defer s.Close()
+
+	if err := s.Write(context.Background(), []sink.Point{usage("gas.meter", time.Now(), 1.5)}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"energy.energy_usage.gas_meter.30m.kwh:1.5|c"}
+	if got := received(); !slices.Equal(got, want) {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
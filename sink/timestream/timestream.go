@@ -0,0 +1,219 @@
+package timestream
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/transport"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite/types"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func init() {
+	sink.Register("timestream", New)
+}
+
+// maxRecords is the most WriteRecords accepts at once.
+const maxRecords = 100
+
+// Sink writes each point as a multi-measure record named after its
+// measurement, with tags as dimensions and fields as measures. Records are
+// versioned by when they were written, so that a corrected slot replaces
+// the record already written for it.
+type Sink struct {
+	client    *timestreamwrite.Client
+	database  string
+	table     string
+	retention types.RetentionProperties
+	ids       sink.IDs
+
+	mu sync.Mutex
+	// ready is whether the table has been created or updated with the
+	// retention.
+	ready bool
+}
+
+func New(cfg *config.Config) (sink.Sink, error) {
+	tsCfg := cfg.Sinks.Timestream
+	if tsCfg.Database == "" {
+		return nil, nil
+	}
+	httpClient, httpErr := transport.NewClient(config.HTTPConfig{}, cfg.Network)
+	if httpErr != nil {
+		return nil, fmt.Errorf("http config: %w", httpErr)
+	}
+
+	var opts []func(*awsConfig.LoadOptions) error
+	if tsCfg.Region != "" {
+		opts = append(opts, awsConfig.WithRegion(tsCfg.Region))
+	}
+	awsCfg, awsErr := awsConfig.LoadDefaultConfig(context.Background(), opts...)
+	if awsErr != nil {
+		return nil, fmt.Errorf("timestream: %w", awsErr)
+	}
+	client := timestreamwrite.NewFromConfig(awsCfg, func(o *timestreamwrite.Options) {
+		o.HTTPClient = httpClient
+		if tsCfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(tsCfg.Endpoint)
+			o.EndpointDiscovery.EnableEndpointDiscovery = aws.EndpointDiscoveryDisabled
+		}
+	})
+
+	return &Sink{
+		client:   client,
+		database: tsCfg.Database,
+		table:    tsCfg.Table,
+		retention: types.RetentionProperties{
+			MemoryStoreRetentionPeriodInHours:  aws.Int64(int64(tsCfg.MemoryRetention / time.Hour)),
+			MagneticStoreRetentionPeriodInDays: aws.Int64(int64(tsCfg.MagneticRetention / (24 * time.Hour))),
+		},
+		ids: sink.NewIDs(cfg, "timestream"),
+	}, nil
+}
+
+func (s *Sink) Name() string {
+	return "timestream"
+}
+
+// ensureTable creates the table, or if it exists updates its retention, the
+// first time it is written to.
+func (s *Sink) ensureTable(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ready {
+		return nil
+	}
+
+	magnetic := &types.MagneticStoreWriteProperties{EnableMagneticStoreWrites: aws.Bool(true)}
+	_, createErr := s.client.CreateTable(ctx, &timestreamwrite.CreateTableInput{
+		DatabaseName:                 aws.String(s.database),
+		TableName:                    aws.String(s.table),
+		RetentionProperties:          &s.retention,
+		MagneticStoreWriteProperties: magnetic,
+	})
+	var conflict *types.ConflictException
+	if errors.As(createErr, &conflict) {
+		_, createErr = s.client.UpdateTable(ctx, &timestreamwrite.UpdateTableInput{
+			DatabaseName:                 aws.String(s.database),
+			TableName:                    aws.String(s.table),
+			RetentionProperties:          &s.retention,
+			MagneticStoreWriteProperties: magnetic,
+		})
+	}
+	if createErr != nil {
+		return fmt.Errorf("table %s.%s: %w", s.database, s.table, createErr)
+	}
+	s.ready = true
+	return nil
+}
+
+func (s *Sink) Write(ctx context.Context, points []sink.Point) error {
+	version := time.Now().UnixMilli()
+	var records []types.Record
+	for _, p := range points {
+		if r, ok := s.record(p, version); ok {
+			records = append(records, r)
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	if err := s.ensureTable(ctx); err != nil {
+		return err
+	}
+
+	for batch := range slices.Chunk(records, maxRecords) {
+		_, writeErr := s.client.WriteRecords(ctx, &timestreamwrite.WriteRecordsInput{
+			DatabaseName: aws.String(s.database),
+			TableName:    aws.String(s.table),
+			Records:      batch,
+		})
+		var rejected *types.RejectedRecordsException
+		if errors.As(writeErr, &rejected) && len(rejected.RejectedRecords) > 0 {
+			return fmt.Errorf("%d of %d records rejected, the first because: %s",
+				len(rejected.RejectedRecords), len(batch), aws.ToString(rejected.RejectedRecords[0].Reason))
+		}
+		if writeErr != nil {
+			return writeErr
+		}
+	}
+	return nil
+}
+
+// record is p as a multi-measure record, or false if it has no field
+// Timestream can hold.
+func (s *Sink) record(p sink.Point, version int64) (types.Record, bool) {
+	var measures []types.MeasureValue
+	for _, k := range slices.Sorted(maps.Keys(p.Fields)) {
+		v, kind, ok := measureValue(p.Fields[k])
+		if !ok {
+			continue
+		}
+		measures = append(measures, types.MeasureValue{Name: aws.String(k), Value: aws.String(v), Type: kind})
+	}
+	if len(measures) == 0 {
+		return types.Record{}, false
+	}
+
+	tags := s.ids.Tags(p.Tags)
+	var dimensions []types.Dimension
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		if tags[k] == "" {
+			continue
+		}
+		dimensions = append(dimensions, types.Dimension{Name: aws.String(k), Value: aws.String(tags[k])})
+	}
+	return types.Record{
+		Dimensions:       dimensions,
+		MeasureName:      aws.String(p.Measurement),
+		MeasureValueType: types.MeasureValueTypeMulti,
+		MeasureValues:    measures,
+		Time:             aws.String(strconv.FormatInt(p.Time.UnixMilli(), 10)),
+		TimeUnit:         types.TimeUnitMilliseconds,
+		Version:          aws.Int64(version),
+	}, true
+}
+
+func measureValue(v any) (string, types.MeasureValueType, bool) {
+	switch v := v.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", "", false
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), types.MeasureValueTypeDouble, true
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return "", "", false
+		}
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), types.MeasureValueTypeDouble, true
+	case int:
+		return strconv.Itoa(v), types.MeasureValueTypeBigint, true
+	case int64:
+		return strconv.FormatInt(v, 10), types.MeasureValueTypeBigint, true
+	case uint64:
+		if v > math.MaxInt64 {
+			return "", "", false
+		}
+		return strconv.FormatUint(v, 10), types.MeasureValueTypeBigint, true
+	case bool:
+		return strconv.FormatBool(v), types.MeasureValueTypeBoolean, true
+	case string:
+		return v, types.MeasureValueTypeVarchar, v != ""
+	default:
+		return "", "", false
+	}
+}
+
+func (s *Sink) Close() error {
+	return nil
+}
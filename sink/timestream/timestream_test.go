@@ -0,0 +1,98 @@
+package timestream
+
+import (
+	"context"
+	"encoding/json"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	var operations []string
+	var written []map[string]any
+	reject := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "Timestream_20181101.")
+		operations = append(operations, operation)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		switch {
+		case operation == "CreateTable":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"__type":"ConflictException","Message":"Table energy already exists"}`)
+		case operation == "WriteRecords" && reject:
+			w.WriteHeader(419)
+			_, _ = io.WriteString(w, `{"__type":"RejectedRecordsException","Message":"rejected","RejectedRecords":[{"RecordIndex":0,"Reason":"too old"}]}`)
+		case operation == "WriteRecords":
+			var body struct {
+				Records []map[string]any
+			}
+			b, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(b, &body)
+			written = append(written, body.Records...)
+			_, _ = io.WriteString(w, `{"RecordsIngested":{"Total":1}}`)
+		default:
+			_, _ = io.WriteString(w, `{}`)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{IDs: map[string]map[string]string{"electricity": {"timestream": "house"}}}
+	cfg.Sinks.Timestream = config.TimestreamConfig{Database: "energy", Table: "energy", Region: "eu-west-2", Endpoint: server.URL,
+		MemoryRetention: 24 * time.Hour, MagneticRetention: 365 * 24 * time.Hour}
+	s, newErr := New(cfg)
+	if newErr != nil {
+		t.Fatal(newErr)
+	}
+	defer s.Close()
+
+	at := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	points := []sink.Point{
+		{Measurement: "energy_usage", Tags: map[string]string{"resource": "electricity", "period": "30m"},
+			Fields: map[string]any{"kwh": 0.25, "band": "peak", "schemaVersion": int64(1)}, Time: at},
+		{Measurement: "heating_session", Tags: map[string]string{"resource": "gas"}, Fields: map[string]any{"ongoing": true}, Time: at},
+		{Measurement: "energy_usage", Tags: map[string]string{"resource": "gas"}, Fields: map[string]any{"note": ""}, Time: at},
+	}
+	for range 2 {
+		if err := s.Write(context.Background(), points); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strings.Join(operations, ",") != "CreateTable,UpdateTable,WriteRecords,WriteRecords" {
+		t.Errorf("operations %v, want the table updated once as it exists", operations)
+	}
+
+	if len(written) != 4 {
+		t.Fatalf("wrote %d records, want 2 a write", len(written))
+	}
+	usage, _ := json.Marshal(written[0])
+	for _, want := range []string{
+		`"Dimensions":[{"Name":"period","Value":"30m"},{"Name":"resource","Value":"house"}]`,
+		`"MeasureName":"energy_usage"`,
+		`"MeasureValueType":"MULTI"`,
+		`{"Name":"band","Type":"VARCHAR","Value":"peak"}`,
+		`{"Name":"kwh","Type":"DOUBLE","Value":"0.25"}`,
+		`{"Name":"schemaVersion","Type":"BIGINT","Value":"1"}`,
+		`"Time":"1717200000000"`,
+		`"TimeUnit":"MILLISECONDS"`,
+	} {
+		if !strings.Contains(string(usage), want) {
+			t.Errorf("record %s, want %s", usage, want)
+		}
+	}
+	if written[0]["Version"] == nil {
+		t.Errorf("record without a version: %s", usage)
+	}
+
+	reject = true
+	if err := s.Write(context.Background(), points); err == nil || !strings.Contains(err.Error(), "too old") {
+		t.Errorf("rejected write returned %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+// Package slo measures how reliably half-hour slots are written: the share
+// of slots written within a deadline of ending, over a rolling window.
+package slo
+
+import (
+	"sync"
+	"time"
+)
+
+const slot = 30 * time.Minute
+
+type Objective struct {
+	// Target is the fraction of slots that must be written on time.
+	Target float64
+	// Deadline is how soon after a slot ends it must be written.
+	Deadline time.Duration
+	// Window is how far back slots count.
+	Window time.Duration
+}
+
+type Report struct {
+	Target          float64 `json:"target"`
+	DeadlineSeconds float64 `json:"deadlineSeconds"`
+	WindowSeconds   float64 `json:"windowSeconds"`
+	// Due is how many slots in the window are past their deadline.
+	Due    int `json:"due"`
+	OnTime int `json:"onTime"`
+	// Ratio is OnTime as a fraction of Due, or 1 if nothing is due yet.
+	Ratio float64 `json:"ratio"`
+	// BudgetRemaining is the fraction of the late slots the target allows
+	// that are still unused. It is negative once the objective is missed.
+	BudgetRemaining float64 `json:"budgetRemaining"`
+	Met             bool    `json:"met"`
+}
+
+// Tracker records when each resource's slots are first written. Only slots
+// ending after it was created count, as earlier ones were never its to
+// write on time.
+type Tracker struct {
+	since time.Time
+
+	mu      sync.Mutex
+	written map[string]map[int64]time.Time
+}
+
+func NewTracker(since time.Time) *Tracker {
+	return &Tracker{since: since, written: map[string]map[int64]time.Time{}}
+}
+
+// Written records that resource's slot ending at slotEnd was written at at.
+// Rewrites of a slot don't change when it was first written.
+func (t *Tracker) Written(resource string, slotEnd, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	slots := t.written[resource]
+	if slots == nil {
+		slots = map[int64]time.Time{}
+		t.written[resource] = slots
+	}
+	if _, ok := slots[slotEnd.Unix()]; !ok {
+		slots[slotEnd.Unix()] = at
+	}
+}
+
+// Report measures the resources' slots against o as of now, forgetting
+// slots that have left the window.
+func (t *Tracker) Report(o Objective, now time.Time, resources []string) Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r := Report{Target: o.Target, DeadlineSeconds: o.Deadline.Seconds(), WindowSeconds: o.Window.Seconds()}
+
+	windowStart := now.Add(-o.Window)
+	for _, slots := range t.written {
+		for end := range slots {
+			if time.Unix(end, 0).Before(windowStart) {
+				delete(slots, end)
+			}
+		}
+	}
+
+	first := windowStart
+	if t.since.After(first) {
+		first = t.since
+	}
+	first = first.Truncate(slot).Add(slot)
+	lastDue := now.Add(-o.Deadline)
+
+	for _, resource := range resources {
+		slots := t.written[resource]
+		for end := first; !end.After(lastDue); end = end.Add(slot) {
+			r.Due++
+			if at, ok := slots[end.Unix()]; ok && at.Sub(end) <= o.Deadline {
+				r.OnTime++
+			}
+		}
+	}
+
+	r.Ratio = 1
+	if r.Due > 0 {
+		r.Ratio = float64(r.OnTime) / float64(r.Due)
+	}
+	late := float64(r.Due - r.OnTime)
+	allowed := (1 - o.Target) * float64(r.Due)
+	switch {
+	case late == 0:
+		r.BudgetRemaining = 1
+	case allowed == 0:
+		// A target of 1 allows nothing, so each late slot overspends a
+		// whole budget
+		r.BudgetRemaining = -late
+	default:
+		r.BudgetRemaining = 1 - late/allowed
+	}
+	r.Met = r.Ratio >= o.Target
+	return r
+}
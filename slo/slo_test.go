@@ -0,0 +1,59 @@
+package slo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tr := NewTracker(start)
+	o := Objective{Target: 0.9, Deadline: 2 * time.Hour, Window: 24 * time.Hour}
+
+	// A day of slots, all on time except one written late and one never
+	for end := start.Add(30 * time.Minute); !end.After(start.Add(24 * time.Hour)); end = end.Add(30 * time.Minute) {
+		switch end {
+		case start.Add(5 * time.Hour):
+			tr.Written("gas", end, end.Add(3*time.Hour))
+		case start.Add(6 * time.Hour):
+		default:
+			tr.Written("gas", end, end.Add(20*time.Minute))
+		}
+	}
+	// Rewrites don't make a late slot on time
+	tr.Written("gas", start.Add(5*time.Hour), start.Add(5*time.Hour))
+
+	r := tr.Report(o, start.Add(24*time.Hour), []string{"gas"})
+	// Slots ending 00:30 to 22:00 are past the deadline
+	if r.Due != 44 || r.OnTime != 42 {
+		t.Errorf("due %d on time %d, want 44 and 42", r.Due, r.OnTime)
+	}
+	if !r.Met || r.BudgetRemaining <= 0 || r.BudgetRemaining >= 1 {
+		t.Errorf("met %v with %v of the budget left", r.Met, r.BudgetRemaining)
+	}
+
+	// A resource that writes nothing uses up the budget
+	r = tr.Report(o, start.Add(24*time.Hour), []string{"gas", "electricity"})
+	if r.Met || r.BudgetRemaining >= 0 {
+		t.Errorf("met %v with %v of the budget left", r.Met, r.BudgetRemaining)
+	}
+}
+
+func TestReportWindow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tr := NewTracker(start)
+	o := Objective{Target: 0.99, Deadline: time.Hour, Window: 2 * time.Hour}
+
+	if r := tr.Report(o, start.Add(30*time.Minute), []string{"gas"}); r.Due != 0 || r.Ratio != 1 || !r.Met {
+		t.Errorf("nothing due yet: %+v", r)
+	}
+
+	// Slots that have left the window no longer count against it
+	now := start.Add(10 * time.Hour)
+	for end := now.Add(-2 * time.Hour).Add(30 * time.Minute); !end.After(now.Add(-time.Hour)); end = end.Add(30 * time.Minute) {
+		tr.Written("gas", end, end)
+	}
+	if r := tr.Report(o, now, []string{"gas"}); r.Due != 2 || r.OnTime != 2 {
+		t.Errorf("due %d on time %d, want 2 and 2", r.Due, r.OnTime)
+	}
+}
@@ -0,0 +1,82 @@
+package slot
+
+import (
+	"fmt"
+	"time"
+)
+
+// Glow stamps each aggregated reading with the start of its period, so
+// AlignReported and AlignStart agree for readings from Glow. The default is
+// AlignStart, which is what Grafana's time grouping expects; Home Assistant
+// statistics expect AlignEnd. Points already written can be moved between
+// conventions with the migrate-slot-align command.
+
+type Alignment string
+
+const (
+	// AlignReported keeps the timestamp Glow returned.
+	AlignReported Alignment = "reported"
+	// AlignStart stamps a reading at the start of its period.
+	AlignStart Alignment = "start"
+	// AlignEnd stamps a reading at the end of its period.
+	AlignEnd Alignment = "end"
+)
+
+func ParseAlignment(s string) (Alignment, error) {
+	switch a := Alignment(s); a {
+	case AlignReported, AlignStart, AlignEnd:
+		return a, nil
+	default:
+		return "", fmt.Errorf("unknown slot alignment %q (expected reported, start or end)", s)
+	}
+}
+
+// Offset returns how far a point written with alignment from must move to
+// match alignment to.
+func Offset(from, to Alignment, period time.Duration) time.Duration {
+	isEnd := func(a Alignment) bool { return a == AlignEnd }
+	switch {
+	case !isEnd(from) && isEnd(to):
+		return period
+	case isEnd(from) && !isEnd(to):
+		return -period
+	default:
+		return 0
+	}
+}
+
+// Policy decides the timestamp written for a reading.
+type Policy struct {
+	// Precision is what timestamps are truncated to. Zero means no truncation.
+	Precision time.Duration
+	Align     Alignment
+}
+
+// Stamp returns the timestamp to write for a reading Glow reported at
+// reported covering period.
+func (p Policy) Stamp(reported time.Time, period time.Duration) time.Time {
+	t := reported
+	switch p.Align {
+	case AlignStart:
+		t = t.Truncate(period)
+	case AlignEnd:
+		t = t.Truncate(period).Add(period)
+	}
+	return p.Truncate(t)
+}
+
+// Truncate applies the precision alone, for points that are not readings.
+func (p Policy) Truncate(t time.Time) time.Time {
+	if p.Precision <= 0 {
+		return t
+	}
+	return t.Truncate(p.Precision)
+}
+
+// Start returns the start of the period a point stamped by p covers.
+func (p Policy) Start(stamped time.Time, period time.Duration) time.Time {
+	if p.Align == AlignEnd {
+		return stamped.Add(-period)
+	}
+	return stamped
+}
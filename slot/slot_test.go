@@ -0,0 +1,99 @@
+package slot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyStamp(t *testing.T) {
+	reported := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+	mid := time.Date(2024, 3, 1, 10, 44, 59, 500_000_000, time.UTC)
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		reported time.Time
+		want     time.Time
+	}{
+		{"reported keeps the time", Policy{Align: AlignReported}, mid, mid},
+		{"reported with precision", Policy{Align: AlignReported, Precision: time.Second}, mid, mid.Truncate(time.Second)},
+		{"start of an aligned reading", Policy{Align: AlignStart}, reported, reported},
+		{"start of a mid-slot reading", Policy{Align: AlignStart}, mid, reported},
+		{"end of an aligned reading", Policy{Align: AlignEnd}, reported, reported.Add(30 * time.Minute)},
+		{"end of a mid-slot reading", Policy{Align: AlignEnd}, mid, reported.Add(30 * time.Minute)},
+		{"zero precision does not truncate", Policy{Align: AlignReported, Precision: 0}, mid, mid},
+		{"negative precision does not truncate", Policy{Align: AlignReported, Precision: -time.Second}, mid, mid},
+		{"precision coarser than the period", Policy{Align: AlignEnd, Precision: time.Hour}, reported, reported.Truncate(time.Hour).Add(time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Stamp(tt.reported, 30*time.Minute); !got.Equal(tt.want) {
+				t.Errorf("Stamp(%s) = %s, want %s", tt.reported, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyTruncate(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 10, 44, 59, 123_456_789, time.UTC)
+
+	tests := []struct {
+		precision time.Duration
+		want      time.Time
+	}{
+		{0, ts},
+		{time.Millisecond, time.Date(2024, 3, 1, 10, 44, 59, 123_000_000, time.UTC)},
+		{time.Second, time.Date(2024, 3, 1, 10, 44, 59, 0, time.UTC)},
+		{time.Minute, time.Date(2024, 3, 1, 10, 44, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		p := Policy{Precision: tt.precision, Align: AlignStart}
+		if got := p.Truncate(ts); !got.Equal(tt.want) {
+			t.Errorf("Truncate with precision %s = %s, want %s", tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyStart(t *testing.T) {
+	start := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+	for _, align := range []Alignment{AlignReported, AlignStart, AlignEnd} {
+		p := Policy{Align: align}
+		if got := p.Start(p.Stamp(start, 30*time.Minute), 30*time.Minute); !got.Equal(start) {
+			t.Errorf("%s: Start(Stamp(%s)) = %s", align, start, got)
+		}
+	}
+}
+
+func TestOffset(t *testing.T) {
+	tests := []struct {
+		from, to Alignment
+		want     time.Duration
+	}{
+		{AlignStart, AlignEnd, 30 * time.Minute},
+		{AlignReported, AlignEnd, 30 * time.Minute},
+		{AlignEnd, AlignStart, -30 * time.Minute},
+		{AlignEnd, AlignReported, -30 * time.Minute},
+		{AlignStart, AlignReported, 0},
+		{AlignReported, AlignStart, 0},
+		{AlignStart, AlignStart, 0},
+		{AlignEnd, AlignEnd, 0},
+	}
+	for _, tt := range tests {
+		if got := Offset(tt.from, tt.to, 30*time.Minute); got != tt.want {
+			t.Errorf("Offset(%s, %s) = %s, want %s", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestParseAlignment(t *testing.T) {
+	for _, s := range []string{"reported", "start", "end"} {
+		if a, err := ParseAlignment(s); err != nil || string(a) != s {
+			t.Errorf("ParseAlignment(%q) = %q, %v", s, a, err)
+		}
+	}
+	for _, s := range []string{"", "Start", "middle"} {
+		if _, err := ParseAlignment(s); err == nil {
+			t.Errorf("ParseAlignment(%q) succeeded, want error", s)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package split divides a household's energy costs between parties, either
+// by a fixed share or by attributing usage in a daily time window (such as
+// overnight EV charging) to one party.
+package split
+
+import (
+	"energy-meter-scraper/config"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Household is the party left with whatever isn't attributed to anyone else.
+const Household = "household"
+
+type party struct {
+	name      string
+	share     float64
+	resources []string
+	// window is [from, to) minutes after midnight, wrapping past midnight if
+	// to < from. Both are zero for share-only parties.
+	from, to int
+	windowed bool
+}
+
+// Plan attributes costs to parties.
+type Plan struct {
+	parties []party
+}
+
+// New returns nil if no parties are configured.
+func New(cfg []config.SplitParty) (*Plan, error) {
+	if len(cfg) == 0 {
+		return nil, nil
+	}
+
+	p := &Plan{}
+	var total float64
+	for _, c := range cfg {
+		if c.Name == "" || c.Name == Household {
+			return nil, fmt.Errorf("party name %q is reserved or empty", c.Name)
+		}
+		if c.Share < 0 || c.Share > 1 {
+			return nil, fmt.Errorf("%s: share must be between 0 and 1", c.Name)
+		}
+		pt := party{name: c.Name, share: c.Share, resources: c.Resources}
+		if c.Window != "" {
+			var windowErr error
+			if pt.from, pt.to, windowErr = parseWindow(c.Window); windowErr != nil {
+				return nil, fmt.Errorf("%s: window: %w", c.Name, windowErr)
+			}
+			pt.windowed = true
+		}
+		if !pt.windowed && pt.share == 0 {
+			return nil, fmt.Errorf("%s: needs a share or a window", c.Name)
+		}
+		total += pt.share
+		p.parties = append(p.parties, pt)
+	}
+	if total > 1 {
+		return nil, errors.New("shares add up to more than 1")
+	}
+	return p, nil
+}
+
+// parseWindow parses "HH:MM-HH:MM". The end may be 24:00.
+func parseWindow(s string) (int, int, error) {
+	fromStr, toStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("expected HH:MM-HH:MM, got %q", s)
+	}
+	from, fromErr := parseClock(fromStr, false)
+	to, toErr := parseClock(toStr, true)
+	if fromErr != nil || toErr != nil {
+		return 0, 0, fmt.Errorf("expected HH:MM-HH:MM, got %q", s)
+	}
+	if to == 24*60 && from == 0 {
+		return 0, 0, fmt.Errorf("window %q covers the whole day; use a share", s)
+	}
+	if to == 24*60 {
+		to = 0
+	}
+	if from == to {
+		return 0, 0, fmt.Errorf("empty window %q", s)
+	}
+	return from, to, nil
+}
+
+// parseClock parses "HH:MM" as minutes after midnight. With end, 24:00 is
+// allowed.
+func parseClock(s string, end bool) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err == nil {
+		return t.Hour()*60 + t.Minute(), nil
+	}
+	if end && strings.TrimSpace(s) == "24:00" {
+		return 24 * 60, nil
+	}
+	return 0, err
+}
+
+func (pt party) covers(resource string, t time.Time) bool {
+	if !pt.windowed {
+		return false
+	}
+	if len(pt.resources) > 0 && !slices.Contains(pt.resources, resource) {
+		return false
+	}
+	m := t.Hour()*60 + t.Minute()
+	if pt.from < pt.to {
+		return m >= pt.from && m < pt.to
+	}
+	return m >= pt.from || m < pt.to
+}
+
+// Usage adds the cost of a slot of usage starting at t to each party's
+// total. The first party whose window covers the slot is charged all of it;
+// otherwise it is divided by share and the rest charged to Household.
+func (p *Plan) Usage(totals map[string]float64, resource string, t time.Time, pence float64) {
+	for _, pt := range p.parties {
+		if pt.covers(resource, t) {
+			totals[pt.name] += pence
+			return
+		}
+	}
+	p.Fixed(totals, pence)
+}
+
+// Fixed adds a cost that doesn't depend on usage, like a standing charge,
+// divided by share.
+func (p *Plan) Fixed(totals map[string]float64, pence float64) {
+	rest := pence
+	for _, pt := range p.parties {
+		if pt.share > 0 {
+			totals[pt.name] += pence * pt.share
+			rest -= pence * pt.share
+		}
+	}
+	totals[Household] += rest
+}
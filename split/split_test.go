@@ -0,0 +1,98 @@
+package split
+
+import (
+	"energy-meter-scraper/config"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		in       string
+		from, to int
+	}{
+		{"00:30-04:30", 30, 270},
+		{"23:00-06:00", 23 * 60, 6 * 60},
+		{"18:00-24:00", 18 * 60, 0},
+		{"7:30-9:00", 7*60 + 30, 9 * 60},
+	}
+	for _, tt := range tests {
+		from, to, err := parseWindow(tt.in)
+		if err != nil || from != tt.from || to != tt.to {
+			t.Errorf("parseWindow(%q) = %d, %d, %v, want %d, %d", tt.in, from, to, err, tt.from, tt.to)
+		}
+	}
+
+	for _, in := range []string{"", "00:30", "24:30-01:00", "00:00-24:30", "-1:00-02:00", "01:00--02:00", "12:60-13:00", "01:00-01:00", "00:00-24:00", "24:00-01:00", "ab:cd-01:00"} {
+		if _, _, err := parseWindow(in); err == nil {
+			t.Errorf("parseWindow(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestCovers(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2024, 1, 1, h, m, 0, 0, time.UTC) }
+	overnight := party{windowed: true, from: 23 * 60, to: 6 * 60}
+	evening := party{windowed: true, from: 18 * 60, to: 0, resources: []string{"electricity"}}
+
+	tests := []struct {
+		name     string
+		pt       party
+		resource string
+		t        time.Time
+		want     bool
+	}{
+		{"overnight start", overnight, "gas", at(23, 0), true},
+		{"overnight after midnight", overnight, "gas", at(5, 30), true},
+		{"overnight end excluded", overnight, "gas", at(6, 0), false},
+		{"overnight before start", overnight, "gas", at(22, 30), false},
+		{"to midnight", evening, "electricity", at(23, 30), true},
+		{"to midnight excludes midnight", evening, "electricity", at(0, 0), false},
+		{"other resource", evening, "gas", at(19, 0), false},
+		{"share-only party", party{share: 0.5}, "gas", at(12, 0), false},
+	}
+	for _, tt := range tests {
+		if got := tt.pt.covers(tt.resource, tt.t); got != tt.want {
+			t.Errorf("%s: covers = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	plan, err := New([]config.SplitParty{
+		{Name: "lodger", Share: 0.4},
+		{Name: "ev", Window: "00:30-04:30", Resources: []string{"electricity"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	totals := map[string]float64{}
+	plan.Usage(totals, "electricity", time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC), 100)
+	plan.Usage(totals, "electricity", time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), 100)
+	plan.Usage(totals, "gas", time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC), 50)
+	plan.Fixed(totals, 50)
+
+	want := map[string]float64{"ev": 100, "lodger": 80, Household: 120}
+	for name, w := range want {
+		if math.Abs(totals[name]-w) > 1e-9 {
+			t.Errorf("%s = %v, want %v", name, totals[name], w)
+		}
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for name, parties := range map[string][]config.SplitParty{
+		"reserved name":  {{Name: Household, Share: 0.1}},
+		"empty name":     {{Share: 0.1}},
+		"no share":       {{Name: "lodger"}},
+		"share over one": {{Name: "lodger", Share: 1.5}},
+		"shares sum":     {{Name: "a", Share: 0.6}, {Name: "b", Share: 0.6}},
+		"bad window":     {{Name: "ev", Window: "25:00-01:00"}},
+	} {
+		if _, err := New(parties); err == nil {
+			t.Errorf("%s: New succeeded, want error", name)
+		}
+	}
+}
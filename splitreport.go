@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/alert"
+	"energy-meter-scraper/split"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// sendSplitReport sends each party's share of the previous month's costs.
+func sendSplitReport(st *settings) {
+	if st.split == nil {
+		return
+	}
+
+	now := clk.Now().In(st.location())
+	month := time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, now.Location())
+	report, reportErr := splitReport(st, month)
+	if reportErr != nil {
+		slog.Error("split report: failed", "error", reportErr)
+		return
+	}
+
+	alert.Send(context.Background(), alert.Alert{
+		Kind:    alert.KindDigest,
+		Key:     "digest/split",
+		Title:   "Energy costs for " + month.Format("January 2006"),
+		Message: report,
+	})
+}
+
+// splitReport totals the costs of the month starting at month by party.
+// Standing charges are taken from the current tariff, so are approximate for
+// months the tariff has since changed.
+func splitReport(st *settings, month time.Time) (string, error) {
+	monthEnd := month.AddDate(0, 1, 0)
+	days := float64(monthEnd.AddDate(0, 0, -1).Day())
+
+	totals := map[string]float64{}
+	for _, meta := range st.resources {
+		usage, usageErr := readUsage(st, meta, month, monthEnd.Add(-time.Second))
+		if usageErr != nil {
+			return "", fmt.Errorf("%s: %w", meta.Name, usageErr)
+		}
+		for _, p := range usage {
+			pence, _ := p.Fields["pence"].(float64)
+			slotStart := st.stamps.Start(p.Time, 30*time.Minute)
+			st.split.Usage(totals, meta.Name, slotStart.In(st.location()), pence)
+		}
+
+		tariff, tariffErr := glow.Tariff(meta.KWHResource)
+		if tariffErr != nil {
+			return "", fmt.Errorf("%s: tariff: %w", meta.Name, tariffErr)
+		}
+		st.split.Fixed(totals, tariff.CurrentRates.StandingCharge*days)
+	}
+
+	var names []string
+	for name := range totals {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var lines []string
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%s: £%.2f", name, totals[name]/100))
+	}
+	if _, ok := totals[split.Household]; !ok {
+		lines = append(lines, split.Household+": £0.00")
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/lease"
+	"energy-meter-scraper/metrics"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// primary is cleared while another instance holds the standby lease.
+	// Without a lease file every instance is primary.
+	primary atomic.Bool
+
+	primaryGauge = metrics.NewGauge("scraper_primary",
+		"1 if this instance scrapes, 0 if it is standing by for another.")
+)
+
+func init() {
+	primary.Store(true)
+	primaryGauge.Set(1)
+}
+
+// leaseHolder names this instance in the lease file.
+func leaseHolder() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s/%d", host, os.Getpid())
+}
+
+// followLease renews the lease, or waits for it to expire, a third of its
+// TTL at a time until ctx is done.
+func followLease(ctx context.Context, l *lease.File, takeover func()) {
+	for {
+		timer := clk.NewTimer(live().cfg.Standby.LeaseTTL / 3)
+		select {
+		case <-timer.Chan():
+			checkLease(l, live().cfg.Standby.LeaseTTL, takeover)
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// checkLease takes or renews the lease. On taking over it reloads the
+// checkpoints the old primary saved, then calls takeover to scrape at once,
+// so that at most the slot in progress is late and none are written twice.
+func checkLease(l *lease.File, ttl time.Duration, takeover func()) {
+	held, acquireErr := l.Acquire(clk.Now(), ttl)
+	if acquireErr != nil {
+		// Two primaries would write every slot twice, while standing by
+		// only delays them until the lease can be read again
+		slog.Error("failed to check the standby lease; standing by", "error", acquireErr)
+		held = false
+	}
+	was := primary.Swap(held)
+	if held {
+		primaryGauge.Set(1)
+	} else {
+		primaryGauge.Set(0)
+	}
+
+	switch {
+	case held && !was:
+		slog.Info("taking over as primary")
+		withLive(func(st *settings) {
+			if err := st.checkpoints.Reload(); err != nil {
+				slog.Error("failed to reload checkpoints on takeover", "error", err)
+			}
+		})
+		takeover()
+	case !held && was:
+		holder, _, _ := l.Holder(clk.Now())
+		slog.Warn("standing by", "primary", holder)
+	}
+}
+
+// whenActive wraps a scheduled job so that it is skipped on a standby or
+// while paused.
+func whenActive(fn func(*settings)) func(*settings) {
+	return func(st *settings) {
+		if primary.Load() && !paused.Load() && !halted.Load() {
+			fn(st)
+		}
+	}
+}
+
+// releaseLease gives up the lease on shutdown, if held, so the standby
+// takes over without waiting for it to expire.
+func releaseLease(l *lease.File) {
+	if l == nil || !primary.Load() {
+		return
+	}
+	if err := l.Release(); err != nil {
+		slog.Warn("failed to release the standby lease", "error", err)
+	}
+}
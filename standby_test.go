@@ -0,0 +1,77 @@
+package main
+
+import (
+	"energy-meter-scraper/checkpoint"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/lease"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStandbyTakeover(t *testing.T) {
+	now := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	fake := fakeClock(t, now)
+	t.Cleanup(func() { primary.Store(true) })
+
+	dir := t.TempDir()
+	leasePath := filepath.Join(dir, "lease.json")
+	checkpointsPath := filepath.Join(dir, "checkpoints.json")
+	ttl := 2 * time.Minute
+
+	// The primary holds the lease and records its progress
+	if held, err := lease.New(leasePath, "primary").Acquire(now, ttl); err != nil || !held {
+		t.Fatalf("primary acquire: %v, %v", held, err)
+	}
+	primaryCheckpoints, openErr := checkpoint.Open(checkpointsPath)
+	if openErr != nil {
+		t.Fatal(openErr)
+	}
+
+	standbyCheckpoints, openErr := checkpoint.Open(checkpointsPath)
+	if openErr != nil {
+		t.Fatal(openErr)
+	}
+	cfg := &config.Config{}
+	cfg.Standby.LeaseTTL = ttl
+	publish(&settings{cfg: cfg, sinkRefs: &sinkSet{}, checkpoints: standbyCheckpoints})
+
+	standby := lease.New(leasePath, "standby")
+	takeovers := 0
+	checkLease(standby, ttl, func() { takeovers++ })
+	if primary.Load() {
+		t.Fatal("primary while another instance holds the lease")
+	}
+	ran := false
+	whenActive(func(*settings) { ran = true })(live())
+	if ran {
+		t.Error("standby ran a primary-only job")
+	}
+
+	through := now.Add(-30 * time.Minute)
+	if err := primaryCheckpoints.Set("electricity", through); err != nil {
+		t.Fatal(err)
+	}
+
+	// The primary stops renewing, so the standby takes over once the lease
+	// expires, carrying on from the primary's checkpoint
+	fake.Advance(ttl / 3)
+	checkLease(standby, ttl, func() { takeovers++ })
+	if primary.Load() || takeovers != 0 {
+		t.Fatal("took over before the lease expired")
+	}
+	fake.Advance(ttl)
+	checkLease(standby, ttl, func() { takeovers++ })
+	if !primary.Load() || takeovers != 1 {
+		t.Fatalf("primary %v after %d takeovers, want a takeover once the lease expired", primary.Load(), takeovers)
+	}
+	if last, ok := standbyCheckpoints.Last("electricity"); !ok || !last.Equal(through) {
+		t.Errorf("checkpoint after takeover %v, want %v", last, through)
+	}
+
+	// Renewing doesn't take over again
+	checkLease(standby, ttl, func() { takeovers++ })
+	if takeovers != 1 {
+		t.Errorf("%d takeovers after renewing, want 1", takeovers)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"energy-meter-scraper/metrics"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/slo"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	sloRatio = metrics.NewGauge("scraper_slo_ratio",
+		"Fraction of slots in the SLO window written within the deadline.")
+	sloBudgetRemaining = metrics.NewGauge("scraper_slo_error_budget_remaining",
+		"Fraction of the late slots the SLO allows that are still unused.")
+)
+
+// slots records when each slot was first written, for the SLO.
+var slots = slo.NewTracker(clk.Now())
+
+// recordWritten notes the usage slots just written for resource.
+func recordWritten(st *settings, resource string, usage []sink.Point) {
+	now := clk.Now()
+	for _, p := range usage {
+		slots.Written(resource, st.stamps.Start(p.Time, 30*time.Minute).Add(30*time.Minute), now)
+	}
+}
+
+// sloReport measures slots of the resources still being scraped against the
+// configured objective and updates the SLO metrics.
+func sloReport(st *settings) slo.Report {
+	var names []string
+	for _, meta := range st.resources {
+		if isDormantResource(meta.Name) {
+			continue
+		}
+		names = append(names, meta.Name)
+	}
+	cfg := st.cfg.SLO
+	report := slots.Report(slo.Objective{Target: cfg.Target, Deadline: cfg.Deadline, Window: cfg.Window}, clk.Now(), names)
+	sloRatio.Set(report.Ratio)
+	sloBudgetRemaining.Set(report.BudgetRemaining)
+	return report
+}
+
+type statusResponse struct {
+	SLO     slo.Report      `json:"slo"`
+	Cycles  cyclesStatus    `json:"cycles"`
+	Dormant []dormantStatus `json:"dormant"`
+	// Primary is false while standing by for another instance.
+	Primary bool `json:"primary"`
+	Paused  bool `json:"paused"`
+	// Halted is true once Glow has refused the application ID.
+	Halted   bool   `json:"halted"`
+	LogLevel string `json:"logLevel"`
+}
+
+type dormantStatus struct {
+	Resource    string    `json:"resource"`
+	LastReading time.Time `json:"lastReading"`
+}
+
+type cyclesStatus struct {
+	Total               int `json:"total"`
+	Failures            int `json:"failures"`
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+	// LastSuccess is when a cycle last wrote readings, or null if none has.
+	LastSuccess *time.Time `json:"lastSuccess"`
+}
+
+// handleStatus reports whether the pipeline is healthy.
+func handleStatus(w http.ResponseWriter, _ *http.Request) {
+	resp := statusResponse{
+		SLO: sloReport(live()),
+		Cycles: cyclesStatus{
+			Total:               int(cyclesTotal.Value()),
+			Failures:            int(cycleFailuresTotal.Value()),
+			ConsecutiveFailures: int(consecutiveFailures.Value()),
+		},
+		Dormant:  []dormantStatus{},
+		Primary:  primary.Load(),
+		Paused:   paused.Load(),
+		Halted:   halted.Load(),
+		LogLevel: logLevel.Level().String(),
+	}
+	if last := lastSuccess.Value(); last > 0 {
+		at := time.Unix(int64(last), 0).UTC()
+		resp.Cycles.LastSuccess = &at
+	}
+	for name, last := range dormantResources() {
+		resp.Dormant = append(resp.Dormant, dormantStatus{Resource: name, LastReading: last})
+	}
+	slices.SortFunc(resp.Dormant, func(a, b dormantStatus) int { return strings.Compare(a.Resource, b.Resource) })
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
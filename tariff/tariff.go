@@ -0,0 +1,241 @@
+// Package tariff models time-of-use tariffs, whose rate depends on the time
+// of day in bands such as peak, shoulder and off-peak, and may change with
+// the season, and some also charge for the month's peak demand.
+package tariff
+
+import (
+	"energy-meter-scraper/config"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Tariff gives the rate at any time. Both bands and seasons may wrap: a
+// band past midnight and a season past the new year.
+type Tariff struct {
+	seasons        []season
+	capacityRate   float64
+	standingCharge float64
+}
+
+type season struct {
+	name string
+	// from and to are the first and last days as month*100+day, wrapping
+	// past the new year if to < from. Both are zero for all year.
+	from, to int
+	bands    []band
+}
+
+type band struct {
+	name string
+	rate float64
+	// window is [from, to) minutes after midnight, wrapping past midnight if
+	// to < from. rest bands have no window and cover the remaining time.
+	from, to int
+	rest     bool
+}
+
+// New returns nil if cfg has no seasons.
+func New(cfg config.TariffConfig) (*Tariff, error) {
+	if len(cfg.Seasons) == 0 {
+		if cfg.CapacityRate != 0 || cfg.StandingCharge != 0 {
+			return nil, errors.New("capacityRate and standingCharge need the seasons giving the unit rates")
+		}
+		return nil, nil
+	}
+	if cfg.CapacityRate < 0 {
+		return nil, fmt.Errorf("capacityRate %v is negative", cfg.CapacityRate)
+	}
+	if cfg.StandingCharge < 0 {
+		return nil, fmt.Errorf("standingCharge %v is negative", cfg.StandingCharge)
+	}
+
+	t := &Tariff{capacityRate: cfg.CapacityRate, standingCharge: cfg.StandingCharge}
+	for i, c := range cfg.Seasons {
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("season %d", i+1)
+		}
+		s := season{name: name}
+		if (c.From == "") != (c.To == "") {
+			return nil, fmt.Errorf("%s: from and to must be set together", name)
+		}
+		if c.From != "" {
+			var fromErr, toErr error
+			s.from, fromErr = parseDay(c.From)
+			s.to, toErr = parseDay(c.To)
+			if err := errors.Join(fromErr, toErr); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+
+		rests := 0
+		for _, bc := range c.Bands {
+			b := band{name: bc.Name, rate: bc.Rate}
+			if bc.Name == "" {
+				return nil, fmt.Errorf("%s: band without a name", name)
+			}
+			if bc.Window == "" {
+				b.rest = true
+				rests++
+			} else {
+				var windowErr error
+				if b.from, b.to, windowErr = parseWindow(bc.Window); windowErr != nil {
+					return nil, fmt.Errorf("%s: %s: %w", name, bc.Name, windowErr)
+				}
+			}
+			s.bands = append(s.bands, b)
+		}
+		if rests > 1 {
+			return nil, fmt.Errorf("%s: only one band can be without a window", name)
+		}
+		if err := s.checkBands(); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		t.seasons = append(t.seasons, s)
+	}
+	return t, t.checkSeasons()
+}
+
+// checkBands requires every minute of the day to be in exactly one band.
+func (s season) checkBands() error {
+	for m := 0; m < 24*60; m++ {
+		var in []string
+		rest := false
+		for _, b := range s.bands {
+			if b.rest {
+				rest = true
+			} else if b.covers(m) {
+				in = append(in, b.name)
+			}
+		}
+		switch {
+		case len(in) > 1:
+			return fmt.Errorf("bands %s overlap at %02d:%02d", strings.Join(in, " and "), m/60, m%60)
+		case len(in) == 0 && !rest:
+			return fmt.Errorf("no band covers %02d:%02d", m/60, m%60)
+		}
+	}
+	return nil
+}
+
+// checkSeasons requires every day of the year, including 29 February, to be
+// in a season, and seasons not to overlap.
+func (t *Tariff) checkSeasons() error {
+	for day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC); day.Year() == 2024; day = day.AddDate(0, 0, 1) {
+		var in []string
+		for _, s := range t.seasons {
+			if s.covers(day) {
+				in = append(in, s.name)
+			}
+		}
+		switch {
+		case len(in) > 1:
+			return fmt.Errorf("seasons %s overlap on %s", strings.Join(in, " and "), day.Format("01-02"))
+		case len(in) == 0:
+			return fmt.Errorf("no season covers %s", day.Format("01-02"))
+		}
+	}
+	return nil
+}
+
+// Band returns the name and rate in pence per kWh of the band at, in at's
+// location.
+func (t *Tariff) Band(at time.Time) (string, float64) {
+	for _, s := range t.seasons {
+		if !s.covers(at) {
+			continue
+		}
+		m := at.Hour()*60 + at.Minute()
+		var rest band
+		for _, b := range s.bands {
+			if b.rest {
+				rest = b
+			} else if b.covers(m) {
+				return b.name, b.rate
+			}
+		}
+		return rest.name, rest.rate
+	}
+	// Unreachable, as New checks every day is covered
+	return "", 0
+}
+
+// Cost returns the cost in pence of kwh used in the slot starting at.
+func (t *Tariff) Cost(at time.Time, kwh float64) float64 {
+	_, rate := t.Band(at)
+	return kwh * rate
+}
+
+// HasCapacityCharge reports whether t charges for peak demand.
+func (t *Tariff) HasCapacityCharge() bool {
+	return t.capacityRate > 0
+}
+
+// CapacityCharge returns the demand charge in pence for a month whose peak
+// half hour averaged peakKW.
+func (t *Tariff) CapacityCharge(peakKW float64) float64 {
+	return peakKW * t.capacityRate
+}
+
+// StandingCharge returns the standing charge in pence per day, or 0 if it
+// isn't configured.
+func (t *Tariff) StandingCharge() float64 {
+	return t.standingCharge
+}
+
+func (s season) covers(t time.Time) bool {
+	if s.from == 0 && s.to == 0 {
+		return true
+	}
+	d := int(t.Month())*100 + t.Day()
+	if s.from <= s.to {
+		return d >= s.from && d <= s.to
+	}
+	return d >= s.from || d <= s.to
+}
+
+func (b band) covers(m int) bool {
+	if b.from < b.to {
+		return m >= b.from && m < b.to
+	}
+	return m >= b.from || m < b.to
+}
+
+// parseDay parses "MM-DD" as month*100+day.
+func parseDay(s string) (int, error) {
+	t, err := time.Parse("01-02", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("expected MM-DD, got %q", s)
+	}
+	return int(t.Month())*100 + t.Day(), nil
+}
+
+// parseWindow parses "HH:MM-HH:MM" as minutes after midnight. The end may
+// be 24:00.
+func parseWindow(s string) (int, int, error) {
+	fromStr, toStr, ok := strings.Cut(s, "-")
+	from, fromErr := parseClock(fromStr)
+	to, toErr := parseClock(toStr)
+	if !ok || fromErr != nil || toErr != nil || from == 24*60 {
+		return 0, 0, fmt.Errorf("expected HH:MM-HH:MM, got %q", s)
+	}
+	to %= 24 * 60
+	if from == to {
+		return 0, 0, fmt.Errorf("window %q is empty or the whole day; leave the band's window out", s)
+	}
+	return from, to, nil
+}
+
+func parseClock(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,123 @@
+package tariff
+
+import (
+	"energy-meter-scraper/config"
+	"math"
+	"testing"
+	"time"
+)
+
+func threeRate() config.TariffConfig {
+	return config.TariffConfig{Seasons: []config.TariffSeason{
+		{
+			Name: "winter", From: "10-01", To: "03-31",
+			Bands: []config.TariffBand{
+				{Name: "peak", Window: "16:00-19:00", Rate: 40},
+				{Name: "offpeak", Window: "23:00-05:00", Rate: 10},
+				{Name: "shoulder", Rate: 25},
+			},
+		},
+		{
+			Name: "summer", From: "04-01", To: "09-30",
+			Bands: []config.TariffBand{
+				{Name: "offpeak", Window: "00:00-06:00", Rate: 8},
+				{Name: "day", Window: "06:00-24:00", Rate: 22},
+			},
+		},
+	}}
+}
+
+func TestBand(t *testing.T) {
+	tr, err := New(threeRate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(m time.Month, d, h, min int) time.Time { return time.Date(2024, m, d, h, min, 0, 0, time.UTC) }
+
+	tests := []struct {
+		at   time.Time
+		band string
+		rate float64
+	}{
+		{at(1, 15, 16, 0), "peak", 40},
+		{at(1, 15, 18, 30), "peak", 40},
+		{at(1, 15, 19, 0), "shoulder", 25},
+		// Off-peak spans midnight
+		{at(1, 15, 23, 30), "offpeak", 10},
+		{at(1, 16, 4, 30), "offpeak", 10},
+		{at(1, 16, 5, 0), "shoulder", 25},
+		// Winter spans the new year, and ends on its last day
+		{at(12, 31, 17, 0), "peak", 40},
+		{at(3, 31, 17, 0), "peak", 40},
+		{at(4, 1, 17, 0), "day", 22},
+		{at(9, 30, 23, 30), "day", 22},
+		{at(10, 1, 0, 0), "offpeak", 10},
+	}
+	for _, tt := range tests {
+		if band, rate := tr.Band(tt.at); band != tt.band || rate != tt.rate {
+			t.Errorf("Band(%v) = %s, %v, want %s, %v", tt.at, band, rate, tt.band, tt.rate)
+		}
+	}
+	if cost := tr.Cost(at(1, 15, 16, 30), 0.5); cost != 20 {
+		t.Errorf("cost %v, want 20", cost)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	allDay := []config.TariffBand{{Name: "flat", Rate: 20}}
+	tests := map[string]config.TariffConfig{
+		"overlapping bands": {Seasons: []config.TariffSeason{{Bands: []config.TariffBand{
+			{Name: "a", Window: "00:00-08:00"}, {Name: "b", Window: "07:00-09:00"}, {Name: "c"},
+		}}}},
+		"uncovered time": {Seasons: []config.TariffSeason{{Bands: []config.TariffBand{
+			{Name: "a", Window: "00:00-08:00"},
+		}}}},
+		"two rest bands": {Seasons: []config.TariffSeason{{Bands: []config.TariffBand{{Name: "a"}, {Name: "b"}}}}},
+		"gap between seasons": {Seasons: []config.TariffSeason{
+			{From: "01-01", To: "06-30", Bands: allDay}, {From: "07-02", To: "12-31", Bands: allDay},
+		}},
+		"overlapping seasons": {Seasons: []config.TariffSeason{
+			{From: "01-01", To: "06-30", Bands: allDay}, {From: "06-30", To: "12-31", Bands: allDay},
+		}},
+		"missing leap day": {Seasons: []config.TariffSeason{
+			{From: "03-01", To: "02-28", Bands: allDay},
+		}},
+		"half a season":            {Seasons: []config.TariffSeason{{From: "01-01", Bands: allDay}}},
+		"bad window":               {Seasons: []config.TariffSeason{{Bands: []config.TariffBand{{Name: "a", Window: "08:00-08:00"}, {Name: "b"}}}}},
+		"capacity without seasons": {CapacityRate: 150},
+		"negative capacity":        {Seasons: []config.TariffSeason{{Bands: allDay}}, CapacityRate: -1},
+		"standing without seasons": {StandingCharge: 50},
+		"negative standing charge": {Seasons: []config.TariffSeason{{Bands: allDay}}, StandingCharge: -1},
+	}
+	for name, cfg := range tests {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	if tr, err := New(config.TariffConfig{}); tr != nil || err != nil {
+		t.Errorf("empty config gave %v, %v", tr, err)
+	}
+	if _, err := New(config.TariffConfig{Seasons: []config.TariffSeason{{From: "03-01", To: "02-29", Bands: allDay}}}); err != nil {
+		t.Errorf("season ending on the leap day: %v", err)
+	}
+}
+
+func TestCapacityCharge(t *testing.T) {
+	cfg := threeRate()
+	if tr, _ := New(cfg); tr.HasCapacityCharge() {
+		t.Error("tariff without a capacityRate has a capacity charge")
+	}
+
+	cfg.CapacityRate = 150
+	tr, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tr.HasCapacityCharge() {
+		t.Error("no capacity charge")
+	}
+	if got := tr.CapacityCharge(4.2); math.Abs(got-630) > 1e-9 {
+		t.Errorf("charge for a 4.2 kW peak is %v, want 630", got)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/alert"
+	"energy-meter-scraper/sink"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tariffHistory is how far back a stored tariff is looked for the first
+// time a resource is seen, so that a change across a restart is caught.
+const tariffHistory = 7 * 24 * time.Hour
+
+// seenTariffs holds each resource's last energy_tariff point.
+var seenTariffs = struct {
+	mu     sync.Mutex
+	points map[string]sink.Point
+}{points: map[string]sink.Point{}}
+
+// tariffFields are the energy_tariff fields compared, with how each is
+// described in alerts.
+var tariffFields = []struct{ field, name, unit string }{
+	{"rate", "unit rate", "p/kWh"},
+	{"standingCharge", "standing charge", "p/day"},
+}
+
+// checkTariffChange alerts if current's rate or standing charge differs
+// from the resource's previous tariff by more than the configured
+// fraction. The first time a resource is seen its previous tariff is read
+// from a sink, if one can be queried.
+func checkTariffChange(st *settings, meta resourceMeta, current sink.Point) {
+	threshold := st.cfg.Alerts.TariffChange
+	if threshold <= 0 {
+		return
+	}
+
+	seenTariffs.mu.Lock()
+	prev, seen := seenTariffs.points[meta.Name]
+	seenTariffs.points[meta.Name] = current
+	seenTariffs.mu.Unlock()
+	if !seen {
+		var found bool
+		if prev, found = storedTariff(st, meta, current.Time); !found {
+			return
+		}
+	}
+
+	var changes []string
+	for _, f := range tariffFields {
+		was, wasOK := prev.Fields[f.field].(float64)
+		now, nowOK := current.Fields[f.field].(float64)
+		if !wasOK || !nowOK || was == now {
+			continue
+		}
+		change := math.Inf(1)
+		if was != 0 {
+			change = (now - was) / was
+		}
+		if math.Abs(change) > threshold {
+			changes = append(changes, fmt.Sprintf("%s from %.2f%s to %.2f%s (%+.1f%%)", f.name, was, f.unit, now, f.unit, change*100))
+		}
+	}
+	if changes == nil {
+		return
+	}
+	alert.Send(context.Background(), alert.Alert{
+		Key:     "tariff/" + meta.Name,
+		Title:   fmt.Sprintf("%s tariff changed", meta.Name),
+		Message: fmt.Sprintf("Glow's %s tariff changed: %s", meta.Name, strings.Join(changes, ", ")),
+	})
+}
+
+// storedTariff returns the latest energy_tariff point stored for the
+// resource before at, from the first sink that can be queried.
+func storedTariff(st *settings, meta resourceMeta, at time.Time) (sink.Point, bool) {
+	for _, s := range st.sinks {
+		reader, ok := s.(sink.Reader)
+		if !ok {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		points, readErr := reader.ReadPoints(ctx, "energy_tariff", map[string]string{"resource": meta.Name}, at.Add(-tariffHistory), at)
+		cancel()
+		if readErr != nil {
+			slog.Warn("failed to read the stored tariff", "resource", meta.Name, "sink", s.Name(), "error", readErr)
+			return sink.Point{}, false
+		}
+		var latest sink.Point
+		for _, p := range points {
+			if p.Time.Before(at) && p.Time.After(latest.Time) {
+				latest = p
+			}
+		}
+		return latest, !latest.Time.IsZero()
+	}
+	return sink.Point{}, false
+}
+
+// mismatchedTariffs are the resources whose Glow tariff last disagreed with
+// the configured one, so that a mismatch is alerted on once rather than
+// every cycle.
+var mismatchedTariffs = struct {
+	mu        sync.Mutex
+	resources map[string]bool
+}{resources: map[string]bool{}}
+
+// checkTariffMismatch alerts if Glow's tariff disagrees with the resource's
+// configured tariff by more than the configured fraction. The unit rate is
+// compared with the band in force at the latest reading, and the standing
+// charge only if one is configured.
+func checkTariffMismatch(st *settings, meta resourceMeta, current sink.Point, latest time.Time) {
+	threshold := st.cfg.Alerts.TariffMismatch
+	configured := st.tariffs[meta.Name]
+	if threshold <= 0 || configured == nil {
+		return
+	}
+
+	band, rate := configured.Band(latest.In(st.location()))
+	var differences []string
+	differs := func(name, unit string, want float64, wantName, field string) {
+		got, ok := current.Fields[field].(float64)
+		if ok && math.Abs(got-want) > want*threshold {
+			differences = append(differences, fmt.Sprintf("%s of %.2f%s rather than %s %.2f%s", name, got, unit, wantName, want, unit))
+		}
+	}
+	differs("unit rate", "p/kWh", rate, "the "+band+" band's", "rate")
+	if standing := configured.StandingCharge(); standing > 0 {
+		differs("standing charge", "p/day", standing, "the contracted", "standingCharge")
+	}
+
+	mismatchedTariffs.mu.Lock()
+	was := mismatchedTariffs.resources[meta.Name]
+	mismatchedTariffs.resources[meta.Name] = differences != nil
+	mismatchedTariffs.mu.Unlock()
+
+	switch {
+	case differences != nil && !was:
+		alert.Send(context.Background(), alert.Alert{
+			Key:   "tariff-mismatch/" + meta.Name,
+			Title: fmt.Sprintf("%s tariff in Glow doesn't match the configured tariff", meta.Name),
+			Message: fmt.Sprintf("Glow reports a %s for %s, so its tariff may be stale since switching",
+				strings.Join(differences, " and a "), meta.Name),
+		})
+	case differences == nil && was:
+		slog.Info("glow's tariff matches the configured tariff again", "resource", meta.Name)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/alert"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"energy-meter-scraper/tariff"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// captured collects the alerts sent while capturing is set.
+var captured = struct {
+	sync.Mutex
+	on     bool
+	alerts []alert.Alert
+}{}
+
+type captureNotifier struct{}
+
+func (captureNotifier) Name() string { return "capture" }
+
+func (captureNotifier) Notify(_ context.Context, a alert.Alert) error {
+	captured.Lock()
+	defer captured.Unlock()
+	captured.alerts = append(captured.alerts, a)
+	return nil
+}
+
+func init() {
+	alert.Register("capture", func(*config.Config) (alert.Notifier, error) {
+		captured.Lock()
+		defer captured.Unlock()
+		if !captured.on {
+			return nil, nil
+		}
+		return captureNotifier{}, nil
+	})
+}
+
+// captureAlerts sends alerts to the returned func for the rest of the test.
+func captureAlerts(t *testing.T) func() []alert.Alert {
+	setCapturing := func(on bool) {
+		captured.Lock()
+		captured.on, captured.alerts = on, nil
+		captured.Unlock()
+		if err := alert.Setup(&config.Config{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setCapturing(true)
+	t.Cleanup(func() { setCapturing(false) })
+	return func() []alert.Alert {
+		captured.Lock()
+		defer captured.Unlock()
+		return captured.alerts
+	}
+}
+
+func TestCheckTariffChange(t *testing.T) {
+	alerts := captureAlerts(t)
+	t.Cleanup(func() { seenTariffs.points = map[string]sink.Point{} })
+
+	at := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	tariff := func(at time.Time, rate, standing float64) sink.Point {
+		return sink.Point{Measurement: "energy_tariff", Tags: map[string]string{"resource": "electricity"},
+			Fields: map[string]any{"rate": rate, "standingCharge": standing}, Time: at}
+	}
+	mem := newMemorySink()
+	if err := mem.Write(context.Background(), []sink.Point{tariff(at.Add(-24*time.Hour), 24.5, 60)}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{}
+	cfg.Alerts.TariffChange = 0.05
+	st := &settings{cfg: cfg, sinks: []sink.Sink{mem}}
+	meta := config.Resource{Name: "electricity"}
+
+	// The price cap rose while the scraper was stopped
+	checkTariffChange(st, meta, tariff(at, 26, 61))
+	got := alerts()
+	if len(got) != 1 || got[0].Key != "tariff/electricity" {
+		t.Fatalf("got %+v, want one tariff alert", got)
+	}
+	if !strings.Contains(got[0].Message, "unit rate from 24.50p/kWh to 26.00p/kWh (+6.1%)") || strings.Contains(got[0].Message, "standing") {
+		t.Errorf("message %q", got[0].Message)
+	}
+
+	// Later cycles compare with the last tariff seen
+	checkTariffChange(st, meta, tariff(at.Add(time.Hour), 26, 61))
+	checkTariffChange(st, meta, tariff(at.Add(2*time.Hour), 26, 0))
+	if got := alerts(); len(got) != 2 || !strings.Contains(got[1].Message, "standing charge from 61.00p/day to 0.00p/day (-100.0%)") {
+		t.Errorf("got %+v, want an alert for the standing charge only", got)
+	}
+}
+
+func TestCheckTariffMismatch(t *testing.T) {
+	alerts := captureAlerts(t)
+	t.Cleanup(func() { mismatchedTariffs.resources = map[string]bool{} })
+
+	configured, tariffErr := tariff.New(config.TariffConfig{
+		Seasons: []config.TariffSeason{{Bands: []config.TariffBand{
+			{Name: "offpeak", Window: "00:30-05:30", Rate: 8.5},
+			{Name: "day", Rate: 27},
+		}}},
+		StandingCharge: 48,
+	})
+	if tariffErr != nil {
+		t.Fatal(tariffErr)
+	}
+	cfg := &config.Config{}
+	cfg.Alerts.TariffMismatch = 0.01
+	st := &settings{cfg: cfg, loc: time.UTC, tariffs: map[string]*tariff.Tariff{"electricity": configured}}
+	meta := config.Resource{Name: "electricity"}
+	glowTariff := func(rate, standing float64) sink.Point {
+		return sink.Point{Measurement: "energy_tariff", Fields: map[string]any{"rate": rate, "standingCharge": standing}}
+	}
+	day := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	// Glow still has the previous supplier's flat rate, which is alerted on
+	// once however many cycles it lasts
+	checkTariffMismatch(st, meta, glowTariff(27.1, 48), day)
+	checkTariffMismatch(st, meta, glowTariff(24.5, 61), day)
+	checkTariffMismatch(st, meta, glowTariff(24.5, 61), day.Add(time.Hour))
+	got := alerts()
+	if len(got) != 1 || got[0].Key != "tariff-mismatch/electricity" {
+		t.Fatalf("got %+v, want one mismatch alert", got)
+	}
+	if want := "unit rate of 24.50p/kWh rather than the day band's 27.00p/kWh and a standing charge of 61.00p/day rather than the contracted 48.00p/day"; !strings.Contains(got[0].Message, want) {
+		t.Errorf("message %q, want it to contain %q", got[0].Message, want)
+	}
+
+	// Once Glow catches up, a later mismatch alerts again
+	checkTariffMismatch(st, meta, glowTariff(8.5, 48), day.Add(-9*time.Hour))
+	checkTariffMismatch(st, meta, glowTariff(8.5, 48), day)
+	if got := alerts(); len(got) != 2 || !strings.Contains(got[1].Message, "8.50p/kWh rather than the day band's 27.00p/kWh") {
+		t.Errorf("got %+v, want a second alert for the off-peak rate during the day", got)
+	}
+}
@@ -0,0 +1,67 @@
+package transport
+
+import (
+	"context"
+	"energy-meter-scraper/config"
+	"errors"
+	"log/slog"
+	"net"
+	"time"
+)
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// newDialer returns a dial function that retries DNS failures with backoff,
+// so a resolver that is briefly down (e.g. a Pi-hole restarting) causes a
+// short delay rather than a failed request.
+func newDialer(cfg config.NetworkConfig) dialFunc {
+	var resolvers []*net.Resolver
+	for _, addr := range cfg.Resolvers {
+		resolvers = append(resolvers, newResolver(addr))
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		for attempt := 0; ; attempt++ {
+			d := &net.Dialer{
+				Timeout:       30 * time.Second,
+				KeepAlive:     30 * time.Second,
+				FallbackDelay: cfg.FallbackDelay,
+			}
+			if len(resolvers) > 0 {
+				d.Resolver = resolvers[attempt%len(resolvers)]
+			}
+
+			conn, err := d.DialContext(ctx, network, addr)
+
+			var dnsErr *net.DNSError
+			if err == nil || !errors.As(err, &dnsErr) || attempt >= cfg.DNSRetries {
+				return conn, err
+			}
+
+			wait := time.Duration(1<<attempt) * time.Second
+			slog.Info("dns lookup failed, retrying", "addr", addr, "attempt", attempt+1, "wait", wait, "error", err)
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+	}
+}
+
+func newResolver(addr string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			d := net.Dialer{Timeout: 5 * time.Second}
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// Dialer returns a dial function with the DNS settings in cfg, for clients
+// speaking TCP or UDP directly rather than HTTP.
+func Dialer(cfg config.NetworkConfig) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return newDialer(cfg)
+}
@@ -0,0 +1,74 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"energy-meter-scraper/config"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// DefaultTimeout bounds each request when HTTPConfig.Timeout is zero. It
+// matches the influx client's own default.
+const DefaultTimeout = 20 * time.Second
+
+// NewClient builds an http client honouring the proxy and TLS settings in cfg
+// and the DNS settings in netCfg.
+func NewClient(cfg config.HTTPConfig, netCfg config.NetworkConfig) (*http.Client, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = newDialer(netCfg)
+
+	if cfg.Proxy != "" {
+		proxyURL, parseErr := url.Parse(cfg.Proxy)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", parseErr)
+		}
+		t.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig, tlsErr := TLSConfig(cfg)
+	if tlsErr != nil {
+		return nil, tlsErr
+	}
+	t.TLSClientConfig = tlsConfig
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return &http.Client{Transport: t, Timeout: timeout}, nil
+}
+
+func TLSConfig(cfg config.HTTPConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CAFile != "" {
+		pool, poolErr := x509.SystemCertPool()
+		if poolErr != nil {
+			pool = x509.NewCertPool()
+		}
+
+		pem, readErr := os.ReadFile(cfg.CAFile)
+		if readErr != nil {
+			return nil, fmt.Errorf("read ca file: %w", readErr)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in ca file " + cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, certErr := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if certErr != nil {
+			return nil, fmt.Errorf("load client certificate: %w", certErr)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
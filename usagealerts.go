@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"energy-meter-scraper/alert"
+	"energy-meter-scraper/baseline"
+	"energy-meter-scraper/config"
+	"energy-meter-scraper/sink"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// usageAlert compares one field of a resource's daily total to a baseline.
+type usageAlert struct {
+	kind     string
+	field    string
+	unit     string
+	baseline baseline.Baseline
+	// threshold is the fraction the day may exceed (or for anomalies, fall
+	// short of) the baseline by.
+	threshold float64
+	// overOnly ignores days below the baseline.
+	overOnly bool
+}
+
+// parseUsageAlerts builds the configured alerts for each resource.
+func parseUsageAlerts(resources []resourceMeta, alertsCfg config.AlertsConfig) (map[string][]usageAlert, error) {
+	out := map[string][]usageAlert{}
+	for _, meta := range resources {
+		for _, kind := range []struct {
+			name     string
+			field    string
+			unit     string
+			cfg      config.UsageAlertConfig
+			overOnly bool
+		}{
+			{"anomaly", "kwh", "kWh", alertsCfg.Anomaly, false},
+			{"budget", "pence", "p", alertsCfg.Budget, true},
+		} {
+			spec, ok := kind.cfg.Baselines[meta.Name]
+			if !ok {
+				spec = kind.cfg.Baselines["*"]
+			}
+			if spec == "" || spec == "off" {
+				continue
+			}
+
+			b, parseErr := baseline.Parse(spec)
+			if parseErr != nil {
+				return nil, fmt.Errorf("%s baseline for %s: %w", kind.name, meta.Name, parseErr)
+			}
+			out[meta.Name] = append(out[meta.Name], usageAlert{
+				kind:      kind.name,
+				field:     kind.field,
+				unit:      kind.unit,
+				baseline:  b,
+				threshold: kind.cfg.Threshold,
+				overOnly:  kind.overOnly,
+			})
+		}
+	}
+	return out, nil
+}
+
+// checkUsageAlerts compares the previous day with each configured baseline.
+func checkUsageAlerts(st *settings) {
+	day := startOfDay(clk.Now(), st.location()).AddDate(0, 0, -1)
+	for _, meta := range st.resources {
+		for _, a := range st.usageAlerts[meta.Name] {
+			checkUsageAlert(context.Background(), st, meta, a, day)
+		}
+	}
+}
+
+func checkUsageAlert(ctx context.Context, st *settings, meta resourceMeta, a usageAlert, day time.Time) {
+	var summer sink.Summer
+	for _, s := range st.sinks {
+		if candidate, ok := s.(sink.Summer); ok {
+			summer = candidate
+			break
+		}
+	}
+	if summer == nil {
+		slog.Warn("usage alerts need a sink that can be queried", "resource", meta.Name)
+		return
+	}
+
+	if a.kind == "anomaly" {
+		awayNow, awayNowErr := st.occupancy.Away(ctx)
+		awayThen, awayThenErr := awayOn(ctx, st, summer, day)
+		if awayNowErr != nil || awayThenErr != nil {
+			slog.Warn("usage alert: failed to read occupancy", "error", errors.Join(awayNowErr, awayThenErr))
+		}
+		if awayNow || awayThen {
+			slog.Info("usage alert: suppressed while away", "resource", meta.Name, "day", day.Format(time.DateOnly))
+			return
+		}
+	}
+
+	history := dailyHistory(ctx, st, summer, meta, a.field)
+
+	got, ok, gotErr := history(day)
+	if gotErr != nil || !ok {
+		slog.Info("usage alert: no data for day", "resource", meta.Name, "kind", a.kind, "error", gotErr)
+		return
+	}
+	want, ok, wantErr := a.baseline.Expected(day, history)
+	if wantErr != nil {
+		slog.Error("usage alert: failed to compute baseline", "resource", meta.Name, "kind", a.kind, "error", wantErr)
+		return
+	}
+	if !ok {
+		slog.Info("usage alert: not enough history for baseline", "resource", meta.Name, "kind", a.kind, "baseline", a.baseline.Name())
+		return
+	}
+
+	over := got > want*(1+a.threshold)
+	under := !a.overOnly && got < want*(1-a.threshold)
+	if !over && !under {
+		return
+	}
+
+	direction := "above"
+	if under {
+		direction = "below"
+	}
+	alert.Send(ctx, alert.Alert{
+		Key:   a.kind + "/" + meta.Name,
+		Title: fmt.Sprintf("%s %s for %s", meta.Name, a.kind, day.Format(time.DateOnly)),
+		Message: fmt.Sprintf("%s used %.2f%s, %s the %s baseline of %.2f%s",
+			meta.Name, got, a.unit, direction, a.baseline.Name(), want, a.unit),
+	})
+}
+
+// dailyHistory looks up daily totals from the sink, memoised because
+// baselines ask for the same days repeatedly. Days the household was away
+// are treated as missing so that holidays don't drag baselines down.
+func dailyHistory(ctx context.Context, st *settings, summer sink.Summer, meta resourceMeta, field string) baseline.History {
+	type entry struct {
+		v  float64
+		ok bool
+	}
+	cache := map[time.Time]entry{}
+
+	return func(day time.Time) (float64, bool, error) {
+		if e, ok := cache[day]; ok {
+			return e.v, e.ok, nil
+		}
+
+		total, n, err := summer.SumField(ctx, "energy_usage", field,
+			map[string]string{"resource": meta.Name, "period": "30m"},
+			st.stamps.Stamp(day, 30*time.Minute), st.stamps.Stamp(day.AddDate(0, 0, 1), 30*time.Minute))
+		if err != nil {
+			return 0, false, err
+		}
+		away, awayErr := awayOn(ctx, st, summer, day)
+		if awayErr != nil {
+			return 0, false, awayErr
+		}
+
+		e := entry{v: total, ok: n > 0 && !away}
+		cache[day] = e
+		return e.v, e.ok, nil
+	}
+}